@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/bootstrap"
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mediaLogOutput string
+	mediaLogAnchor string
+)
+
+// MediaLogCmd represents the medialog command
+var MediaLogCmd = &cobra.Command{
+	Use:   "medialog",
+	Short: "Media access log tools",
+}
+
+// mediaLogPassphraseHelp describes where the passphrase comes from, shared by the subcommands
+const mediaLogPassphraseHelp = `The passphrase is read the same way as the server does: media_log.file_passphrase
+in the config file of --data, overridden by the OPENLIST_MEDIA_LOG_FILE_PASSPHRASE
+environment variable (MEDIA_LOG_FILE_PASSPHRASE with --no-prefix).`
+
+// mediaLogPassphrase loads the config like the server and returns the media log passphrase,
+// so a passphrase set through the config file or env works without passing it on the command line
+func mediaLogPassphrase() string {
+	bootstrap.InitConfig()
+	return conf.Conf.MediaLog.FilePassphrase
+}
+
+// MediaLogDecryptCmd decrypt an encrypted media log file with the passphrase from the config
+var MediaLogDecryptCmd = &cobra.Command{
+	Use:     "decrypt <file>",
+	Short:   "Decrypt an encrypted media log file",
+	Long:    "Decrypt an encrypted media log file.\n\n" + mediaLogPassphraseHelp,
+	Example: `OPENLIST_MEDIA_LOG_FILE_PASSPHRASE=secret openlist medialog decrypt data/log/media.log -o media.txt`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase := mediaLogPassphrase()
+		if passphrase == "" {
+			log.Fatal("media_log.file_passphrase is not set, set it in the config file or OPENLIST_MEDIA_LOG_FILE_PASSPHRASE")
+		}
+		src, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("failed to open media log: %+v", err)
+		}
+		defer src.Close()
+		var dst io.Writer = os.Stdout
+		if mediaLogOutput != "" {
+			f, err := os.OpenFile(mediaLogOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				log.Fatalf("failed to create output file: %+v", err)
+			}
+			defer f.Close()
+			dst = f
+		}
+		if err = middlewares.DecryptMediaLog(dst, src, passphrase); err != nil {
+			log.Fatalf("failed to decrypt media log: %+v", err)
+		}
+	},
+}
+
+// MediaLogVerifyCmd check the audit chain of a media log file, an encrypted file is decrypted
+// with the passphrase from the config
+var MediaLogVerifyCmd = &cobra.Command{
+	Use:     "verify <file>",
+	Short:   "Verify the audit chain of a media log file",
+	Long:    "Verify the audit chain of a media log file.\n\nAn encrypted file is decrypted first. " + mediaLogPassphraseHelp,
+	Example: `openlist medialog verify data/log/media.log --anchor <last hash of the previous file>`,
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := middlewares.VerifyMediaLogFile(args[0], mediaLogPassphrase(), mediaLogAnchor)
+		if err != nil {
+			log.Fatalf("failed to verify media log: %+v", err)
+		}
+		fmt.Printf("entries: %d\nanchor: %s\nlast hash: %s\n", report.Entries, report.Anchor, report.LastHash)
+		if !report.Intact() {
+			if report.BrokenLine > 0 {
+				fmt.Printf("broken at line %d: %s\n", report.BrokenLine, report.Reason)
+			} else {
+				fmt.Println(report.Reason)
+			}
+			os.Exit(1)
+		}
+		fmt.Println("audit chain is intact")
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(MediaLogCmd)
+	MediaLogCmd.AddCommand(MediaLogDecryptCmd)
+	MediaLogDecryptCmd.Flags().StringVarP(&mediaLogOutput, "output", "o", "", "output file, defaults to stdout")
+	MediaLogCmd.AddCommand(MediaLogVerifyCmd)
+	MediaLogVerifyCmd.Flags().StringVar(&mediaLogAnchor, "anchor", "", "last hash of the previous log file, the first entry must continue from it")
+}
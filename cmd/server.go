@@ -55,6 +55,11 @@ the address is defined in config file`,
 		} else {
 			r.Use(middlewares.MediaLoggerMiddleware(), gin.RecoveryWithWriter(log.StandardLogger().Out))
 		}
+		closeMediaLog, err := middlewares.InitMediaLog(conf.Conf.MediaLog)
+		if err != nil {
+			utils.Log.Fatalf("failed to init media log: %+v", err)
+		}
+		defer closeMediaLog()
 		server.Init(r)
 		var httpHandler http.Handler = r
 		if conf.Conf.Scheme.EnableH2c {
@@ -230,6 +235,8 @@ the address is defined in config file`,
 			}()
 		}
 		wg.Wait()
+		// stop background tasks of the rate limit and brute force middlewares
+		middlewares.CloseMediaMiddlewares()
 		utils.Log.Println("Server exit")
 	},
 }
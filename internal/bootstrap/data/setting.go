@@ -222,6 +222,12 @@ func InitialSettings() []model.SettingItem {
 		{Key: conf.StreamMaxClientUploadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxServerDownloadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
 		{Key: conf.StreamMaxServerUploadSpeed, Value: "-1", Type: conf.TypeNumber, Group: model.TRAFFIC, Flag: model.PRIVATE},
+
+		// media log settings
+		{Key: conf.MediaLogDisabledMounts, Value: "", Type: conf.TypeText, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `mount paths whose media access is not logged, one per line`},
+		{Key: conf.MediaLogUnmountedPaths, Value: "true", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `log media access for paths that do not belong to any storage`},
+		{Key: conf.MediaLogDryRun, Value: "false", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `evaluate media access without writing logs or notifying sinks, see the internal stats for what would be logged`},
+		{Key: conf.MediaLogDryRunRecent, Value: "true", Type: conf.TypeBool, Group: model.GLOBAL, Flag: model.PRIVATE, Help: `keep events evaluated in dry-run mode in the recent events buffer`},
 	}
 	initialSettingItems = append(initialSettingItems, tool.Tools.Items()...)
 	if flags.Dev {
@@ -47,6 +47,189 @@ type LogConfig struct {
 	Compress   bool   `json:"compress" env:"COMPRESS"`
 }
 
+type MediaLogFilter struct {
+	PathPrefixes []string `json:"path_prefixes"`
+	Events       []string `json:"events"`
+	Users        []string `json:"users"`
+}
+
+type MediaLogWebhook struct {
+	Name     string            `json:"name"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Secret   string            `json:"secret"`
+	Template string            `json:"template"`
+	Filter   MediaLogFilter    `json:"filter"`
+}
+
+// MediaLogNotifier configures a chat bot or push service channel; Type selects the message format
+type MediaLogNotifier struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// seconds to coalesce events into one message, 0 uses the channel's default
+	CoalesceWindow int            `json:"coalesce_window"`
+	Filter         MediaLogFilter `json:"filter"`
+	// Slack channel override and per-event-type message templates
+	Channel   string            `json:"channel"`
+	Templates map[string]string `json:"templates"`
+	// Token is the ntfy / Gotify access token, the WeCom, DingTalk or Feishu bot key, or the Bark device key.
+	// Priority is the ntfy / Gotify priority of plain access events
+	Token    string `json:"token"`
+	Priority int    `json:"priority"`
+	// signing secret for DingTalk and Feishu bots
+	Secret string `json:"secret"`
+	// Feishu message format, card (default) or text
+	Format string `json:"format"`
+	// Bark notification group and sound
+	Group string `json:"group"`
+	Sound string `json:"sound"`
+}
+
+// MediaLogExec runs an external command once per event. The event JSON is passed on stdin
+// and the main fields as environment variables. Command[0] is executed directly, not through a shell;
+// an empty Command disables it
+type MediaLogExec struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+	// timeout of a single run in seconds, default 10
+	Timeout int `json:"timeout"`
+	// max concurrent processes, default 1; events beyond that are dropped
+	MaxConcurrent int `json:"max_concurrent"`
+	// runs per second and burst size, default 1 per second
+	RateLimit float64        `json:"rate_limit"`
+	Burst     int            `json:"burst"`
+	Filter    MediaLogFilter `json:"filter"`
+}
+
+// MediaLogWindow is a logging time window. Start and End are local HH:MM times; an End not after Start
+// wraps past midnight. Days are weekday abbreviations like mon, tue and match the day the window starts;
+// empty means every day
+type MediaLogWindow struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// MediaLogSchedule limits plain access events to the given windows; audit events such as alerts are always logged.
+// No windows means no limit, and an empty Timezone uses the server's time zone
+type MediaLogSchedule struct {
+	Timezone string           `json:"timezone"`
+	Windows  []MediaLogWindow `json:"windows"`
+}
+
+// MediaTrafficClient classifies clients by User-Agent. Pattern is a case-insensitive regexp and Traffic is
+// scan (media server library scans), sync (rclone and other sync or mount clients) or bot (crawlers)
+type MediaTrafficClient struct {
+	Pattern string `json:"pattern"`
+	Traffic string `json:"traffic"`
+}
+
+// MediaLogStoreConfig controls saving access events to the database, where the admin API can search them
+type MediaLogStoreConfig struct {
+	Enable bool `json:"enable" env:"ENABLE"`
+}
+
+// MediaLogSpool writes sink events to a write-ahead log (one JSON per line) first. After a crash, events
+// not yet acknowledged by every sink are redelivered on restart, so sinks may see duplicates
+type MediaLogSpool struct {
+	Enable bool   `json:"enable" env:"ENABLE"`
+	Path   string `json:"path" env:"PATH"`
+	// the log is compacted to pending events once it exceeds MaxSize MB; events older than MaxAge hours are not redelivered
+	MaxSize int `json:"max_size_mb" env:"MAX_SIZE_MB"`
+	MaxAge  int `json:"max_age_hours" env:"MAX_AGE_HOURS"`
+	// when to sync to disk: always after each write, interval once a second, never leaves it to the OS
+	Fsync string `json:"fsync" env:"FSYNC"`
+}
+
+type MediaLogConfig struct {
+	File          LogConfig           `json:"file" envPrefix:"FILE_"`
+	MaxPathLength int                 `json:"max_path_length" env:"MAX_PATH_LENGTH"`
+	Webhooks      []MediaLogWebhook   `json:"webhooks"`
+	Notifiers     []MediaLogNotifier  `json:"notifiers"`
+	Execs         []MediaLogExec      `json:"execs"`
+	Store         MediaLogStoreConfig `json:"store" envPrefix:"STORE_"`
+	Spool         MediaLogSpool       `json:"spool" envPrefix:"SPOOL_"`
+	// encrypts the media log file with a key derived from this passphrase; read it back via the admin API or openlist medialog decrypt
+	FilePassphrase string `json:"file_passphrase" env:"FILE_PASSPHRASE"`
+	// hash-chains audit events (deletes, uploads, alerts) in the log file; openlist medialog verify detects tampering
+	AuditChain bool `json:"audit_chain" env:"AUDIT_CHAIN"`
+	// log file format: text (default) matches the console output; combined is the Apache/NCSA combined format
+	// for GoAccess; nginx matches nginx's default log_format; w3c is the W3C extended format with a #Fields:
+	// directive at the top of each file. These three only contain plain access events.
+	// cef is the Common Event Format for SIEM import and includes audit and alert events
+	FileFormat string `json:"file_format" env:"FILE_FORMAT"`
+	// stop writing the log file, keeping console output, when its disk has less than MinFreeSpace MB free; 0 disables the check.
+	// DiskCheckInterval is the minimum number of seconds between checks
+	MinFreeSpace      int `json:"min_free_space_mb" env:"MIN_FREE_SPACE_MB"`
+	DiskCheckInterval int `json:"disk_check_interval" env:"DISK_CHECK_INTERVAL"`
+	// case-insensitive suffixes of in-progress downloads (e.g. movie.mp4.part) whose accesses are not logged
+	TempSuffixes []string `json:"temp_suffixes" env:"TEMP_SUFFIXES"`
+	// how HEAD requests are handled: ignore drops them, log_as_probe logs probe events,
+	// merge folds them into a GET for the same user, IP and path that follows shortly
+	HeadRequests string `json:"head_requests" env:"HEAD_REQUESTS"`
+	// events for which FilterExpr is false are not logged, e.g. ext == ".mkv" && user != "admin".
+	// NotifyExpr only applies to notifiers: such events are still logged but not sent. Empty means no filter
+	FilterExpr string           `json:"filter_expr" env:"FILTER_EXPR"`
+	NotifyExpr string           `json:"notify_expr" env:"NOTIFY_EXPR"`
+	Schedule   MediaLogSchedule `json:"schedule"`
+	// typical bitrate in kbps per extension, used by ScrapeDetectionMiddleware to estimate play time; other extensions are not checked
+	ScrapeBitrates map[string]int `json:"scrape_bitrates_kbps" env:"SCRAPE_BITRATES_KBPS"`
+	// number of recent events kept in memory for the admin API, lost on restart
+	RecentSize int `json:"recent_size" env:"RECENT_SIZE"`
+	// log requests from background tasks such as search indexing and thumbnail generation, tagged internal.
+	// They never count towards stored access records, average latency or anomaly detection
+	LogInternal bool `json:"log_internal" env:"LOG_INTERNAL"`
+	// library scans by Jellyfin, Emby, Plex etc. are logged as traffic=scan by default; when set they are
+	// dropped and counted under scan in suppressed
+	DropScanTraffic bool `json:"drop_scan_traffic" env:"DROP_SCAN_TRAFFIC"`
+	// extra client rules, checked before the built-in ones (Jellyfin, Emby, Plex and ffprobe are scan,
+	// rclone, GoodSync, Cyberduck etc. are sync, search engine crawlers, curl and wget are bot)
+	TrafficClients []MediaTrafficClient `json:"traffic_clients"`
+	// crawlers are logged as traffic=bot by default; DropBotTraffic drops them and counts them under bot in suppressed.
+	// With VerifyBots, requests claiming to be Googlebot, bingbot etc. are only tagged bot after a reverse DNS check.
+	// Checks run in the background and are cached; until then, and on failure, requests are logged as plain access
+	DropBotTraffic bool `json:"drop_bot_traffic" env:"DROP_BOT_TRAFFIC"`
+	VerifyBots     bool `json:"verify_bots" env:"VERIFY_BOTS"`
+	// merge image accesses while browsing an album, off by default
+	Album MediaLogAlbum `json:"album" envPrefix:"ALBUM_"`
+	// trending file scores
+	Trending MediaLogTrending `json:"trending" envPrefix:"TRENDING_"`
+	// estimate playback completion from bytes transferred, off by default
+	Completion MediaLogCompletion `json:"completion" envPrefix:"COMPLETION_"`
+	// max path length in characters for structured events (JSON log file, sinks, recent events), 0 keeps full paths;
+	// max_path_length only applies to the text log
+	MaxEventPathLength int `json:"max_event_path_length" env:"MAX_EVENT_PATH_LENGTH"`
+}
+
+// MediaLogCompletion groups requests for the same file by the same user and IP into playback sessions and
+// emits a playback_session event after 30 minutes without new requests. A session covering less than
+// SampledBelow percent of the file is sampled, at least CompletedAt percent is completed, otherwise partial
+type MediaLogCompletion struct {
+	Enable       bool `json:"enable" env:"ENABLE"`
+	SampledBelow int  `json:"sampled_below_percent" env:"SAMPLED_BELOW_PERCENT"`
+	CompletedAt  int  `json:"completed_percent" env:"COMPLETED_PERCENT"`
+}
+
+// MediaLogTrending controls trending scores: each access adds 1 and scores decay with a half-life of HalfLife hours.
+// At most MaxFiles files are kept, evicting the lowest scores. With store enabled, scores are saved every
+// PersistInterval minutes
+type MediaLogTrending struct {
+	HalfLife        int `json:"half_life_hours" env:"HALF_LIFE_HOURS"`
+	MaxFiles        int `json:"max_files" env:"MAX_FILES"`
+	PersistInterval int `json:"persist_interval_minutes" env:"PERSIST_INTERVAL_MINUTES"`
+}
+
+// MediaLogAlbum merges image accesses from album browsing into one album_view event. When the same user and IP
+// fetch at least MinImages images from one directory within Window seconds, only the directory, image count and
+// total size are logged, including later images in the window. Below the threshold, accesses are logged one by one
+// when the window ends
+type MediaLogAlbum struct {
+	Enable    bool `json:"enable" env:"ENABLE"`
+	MinImages int  `json:"min_images" env:"MIN_IMAGES"`
+	Window    int  `json:"window" env:"WINDOW"`
+}
+
 type TaskConfig struct {
 	Workers        int  `json:"workers" env:"WORKERS"`
 	MaxRetry       int  `json:"max_retry" env:"MAX_RETRY"`
@@ -95,28 +278,29 @@ type SFTP struct {
 }
 
 type Config struct {
-	Force                 bool        `json:"force" env:"FORCE"`
-	SiteURL               string      `json:"site_url" env:"SITE_URL"`
-	Cdn                   string      `json:"cdn" env:"CDN"`
-	JwtSecret             string      `json:"jwt_secret" env:"JWT_SECRET"`
-	TokenExpiresIn        int         `json:"token_expires_in" env:"TOKEN_EXPIRES_IN"`
-	Database              Database    `json:"database" envPrefix:"DB_"`
-	Meilisearch           Meilisearch `json:"meilisearch" envPrefix:"MEILISEARCH_"`
-	Scheme                Scheme      `json:"scheme"`
-	TempDir               string      `json:"temp_dir" env:"TEMP_DIR"`
-	BleveDir              string      `json:"bleve_dir" env:"BLEVE_DIR"`
-	DistDir               string      `json:"dist_dir"`
-	Log                   LogConfig   `json:"log"`
-	DelayedStart          int         `json:"delayed_start" env:"DELAYED_START"`
-	MaxConnections        int         `json:"max_connections" env:"MAX_CONNECTIONS"`
-	MaxConcurrency        int         `json:"max_concurrency" env:"MAX_CONCURRENCY"`
-	TlsInsecureSkipVerify bool        `json:"tls_insecure_skip_verify" env:"TLS_INSECURE_SKIP_VERIFY"`
-	Tasks                 TasksConfig `json:"tasks" envPrefix:"TASKS_"`
-	Cors                  Cors        `json:"cors" envPrefix:"CORS_"`
-	S3                    S3          `json:"s3" envPrefix:"S3_"`
-	FTP                   FTP         `json:"ftp" envPrefix:"FTP_"`
-	SFTP                  SFTP        `json:"sftp" envPrefix:"SFTP_"`
-	LastLaunchedVersion   string      `json:"last_launched_version"`
+	Force                 bool           `json:"force" env:"FORCE"`
+	SiteURL               string         `json:"site_url" env:"SITE_URL"`
+	Cdn                   string         `json:"cdn" env:"CDN"`
+	JwtSecret             string         `json:"jwt_secret" env:"JWT_SECRET"`
+	TokenExpiresIn        int            `json:"token_expires_in" env:"TOKEN_EXPIRES_IN"`
+	Database              Database       `json:"database" envPrefix:"DB_"`
+	Meilisearch           Meilisearch    `json:"meilisearch" envPrefix:"MEILISEARCH_"`
+	Scheme                Scheme         `json:"scheme"`
+	TempDir               string         `json:"temp_dir" env:"TEMP_DIR"`
+	BleveDir              string         `json:"bleve_dir" env:"BLEVE_DIR"`
+	DistDir               string         `json:"dist_dir"`
+	Log                   LogConfig      `json:"log"`
+	MediaLog              MediaLogConfig `json:"media_log" envPrefix:"MEDIA_LOG_"`
+	DelayedStart          int            `json:"delayed_start" env:"DELAYED_START"`
+	MaxConnections        int            `json:"max_connections" env:"MAX_CONNECTIONS"`
+	MaxConcurrency        int            `json:"max_concurrency" env:"MAX_CONCURRENCY"`
+	TlsInsecureSkipVerify bool           `json:"tls_insecure_skip_verify" env:"TLS_INSECURE_SKIP_VERIFY"`
+	Tasks                 TasksConfig    `json:"tasks" envPrefix:"TASKS_"`
+	Cors                  Cors           `json:"cors" envPrefix:"CORS_"`
+	S3                    S3             `json:"s3" envPrefix:"S3_"`
+	FTP                   FTP            `json:"ftp" envPrefix:"FTP_"`
+	SFTP                  SFTP           `json:"sftp" envPrefix:"SFTP_"`
+	LastLaunchedVersion   string         `json:"last_launched_version"`
 }
 
 func DefaultConfig() *Config {
@@ -154,6 +338,7 @@ func DefaultConfig() *Config {
 			MaxBackups: 30,
 			MaxAge:     28,
 		},
+		MediaLog:              DefaultMediaLogConfig(),
 		MaxConnections:        0,
 		MaxConcurrency:        64,
 		TlsInsecureSkipVerify: true,
@@ -221,3 +406,46 @@ func DefaultConfig() *Config {
 		LastLaunchedVersion: "",
 	}
 }
+
+func DefaultMediaLogConfig() MediaLogConfig {
+	return MediaLogConfig{
+		File: LogConfig{
+			Enable:     false,
+			Name:       filepath.Join(flags.DataDir, "log/media.log"),
+			MaxSize:    50,
+			MaxBackups: 30,
+			MaxAge:     28,
+		},
+		FileFormat:        "text",
+		MaxPathLength:     1024,
+		MinFreeSpace:      100,
+		DiskCheckInterval: 10,
+		TempSuffixes:      []string{".part", ".aria2", ".crdownload", ".!qB", ".tmp"},
+		HeadRequests:      "merge",
+		RecentSize:        1000,
+		Album: MediaLogAlbum{
+			MinImages: 10,
+			Window:    10,
+		},
+		Trending: MediaLogTrending{
+			HalfLife:        72,
+			MaxFiles:        10000,
+			PersistInterval: 5,
+		},
+		Completion: MediaLogCompletion{
+			SampledBelow: 10,
+			CompletedAt:  90,
+		},
+		Spool: MediaLogSpool{
+			Path:    filepath.Join(flags.DataDir, "log/media_spool.ndjson"),
+			MaxSize: 16,
+			MaxAge:  24,
+			Fsync:   "interval",
+		},
+		ScrapeBitrates: map[string]int{
+			".mp4": 5000, ".m4v": 5000, ".mov": 5000, ".mkv": 8000, ".avi": 3000, ".wmv": 3000,
+			".flv": 2000, ".webm": 3000, ".mpg": 5000, ".mpeg": 5000, ".3gp": 500,
+			".rm": 1000, ".rmvb": 1500, ".ts": 6000,
+		},
+	}
+}
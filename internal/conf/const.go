@@ -136,6 +136,12 @@ const (
 	StreamMaxClientUploadSpeed            = "max_client_upload_speed"
 	StreamMaxServerDownloadSpeed          = "max_server_download_speed"
 	StreamMaxServerUploadSpeed            = "max_server_upload_speed"
+
+	// media log
+	MediaLogDisabledMounts = "media_log_disabled_mounts"
+	MediaLogUnmountedPaths = "media_log_unmounted_paths"
+	MediaLogDryRun         = "media_log_dry_run"
+	MediaLogDryRunRecent   = "media_log_dry_run_recent"
 )
 
 const (
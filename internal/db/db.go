@@ -12,10 +12,11 @@ var db *gorm.DB
 
 func Init(d *gorm.DB) {
 	db = d
-	err := AutoMigrate(new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey))
+	err := AutoMigrate(new(model.Storage), new(model.User), new(model.Meta), new(model.SettingItem), new(model.SearchNode), new(model.TaskItem), new(model.SSHPublicKey), new(model.MediaAccessLog), new(model.MediaTrendingScore))
 	if err != nil {
 		log.Fatalf("failed migrate database: %s", err.Error())
 	}
+	initMediaAccessFTS()
 }
 
 func AutoMigrate(dst ...interface{}) error {
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
+)
+
+// mediaAccessFTS is true when the sqlite3 FTS5 index for media access logs is available
+var mediaAccessFTS bool
+
+func mediaAccessTable() string {
+	return conf.Conf.Database.TablePrefix + "media_access_logs"
+}
+
+// initMediaAccessFTS creates an external content FTS5 table kept in sync by triggers.
+// Rows written before the table existed are indexed once by a rebuild right after it is created.
+// FTS5 may not be compiled into the sqlite driver, in which case search falls back to LIKE.
+func initMediaAccessFTS() {
+	if conf.Conf.Database.Type != "sqlite3" {
+		return
+	}
+	table := mediaAccessTable()
+	fts := table + "_fts"
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", fts).Scan(&existing).Error; err != nil {
+		log.Warnf("media access full text search is unavailable, fallback to LIKE: %+v", err)
+		return
+	}
+	stmts := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(path, username, client_ip, content='%s', content_rowid='id')", fts, table),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN "+
+			"INSERT INTO %s(rowid, path, username, client_ip) VALUES (new.id, new.path, new.username, new.client_ip); END", table, table, fts),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN "+
+			"INSERT INTO %s(%s, rowid, path, username, client_ip) VALUES ('delete', old.id, old.path, old.username, old.client_ip); END", table, table, fts, fts),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE ON %s BEGIN "+
+			"INSERT INTO %s(%s, rowid, path, username, client_ip) VALUES ('delete', old.id, old.path, old.username, old.client_ip); "+
+			"INSERT INTO %s(rowid, path, username, client_ip) VALUES (new.id, new.path, new.username, new.client_ip); END", table, table, fts, fts, fts),
+	}
+	if existing == 0 {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts))
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Warnf("media access full text search is unavailable, fallback to LIKE: %+v", err)
+			return
+		}
+	}
+	mediaAccessFTS = true
+}
+
+func CreateMediaAccessLogs(logs []model.MediaAccessLog) error {
+	return db.CreateInBatches(&logs, 1000).Error
+}
+
+// DeleteMediaAccessLogsByUser deletes all media access logs of the user in batches of batchSize,
+// so a user with a long history does not lock the table for a long time
+func DeleteMediaAccessLogsByUser(username string, batchSize int) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		if err := db.Model(&model.MediaAccessLog{}).Where("username = ?", username).
+			Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return total, errors.Wrapf(err, "failed get media access logs of user")
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := db.Where("id IN ?", ids).Delete(&model.MediaAccessLog{})
+		if result.Error != nil {
+			return total, errors.Wrapf(result.Error, "failed delete media access logs of user")
+		}
+		total += result.RowsAffected
+	}
+}
+
+// WalkMediaAccessLogsByUser calls fn with the media access logs of the user in id order, batchSize rows at a time,
+// keyset pagination keeps the cost of each batch constant however long the history is
+func WalkMediaAccessLogsByUser(username string, from, to *time.Time, batchSize int, fn func([]model.MediaAccessLog) error) error {
+	var lastID uint
+	for {
+		walkDB := db.Where("username = ? AND id > ?", username, lastID)
+		if from != nil {
+			walkDB = walkDB.Where(fmt.Sprintf("%s >= ?", columnName("time")), *from)
+		}
+		if to != nil {
+			walkDB = walkDB.Where(fmt.Sprintf("%s <= ?", columnName("time")), *to)
+		}
+		var logs []model.MediaAccessLog
+		if err := walkDB.Order("id").Limit(batchSize).Find(&logs).Error; err != nil {
+			return errors.Wrapf(err, "failed get media access logs of user")
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err := fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+		lastID = logs[len(logs)-1].ID
+	}
+}
+
+var mediaAccessSearchColumns = map[string][]string{
+	"":     {"path", "username", "client_ip"},
+	"path": {"path"},
+	"user": {"username"},
+	"ip":   {"client_ip"},
+}
+
+// ftsPhrase quotes the query as a single FTS5 phrase with prefix matching,
+// so operators and column filters in user input are treated as plain text
+func ftsPhrase(query string) string {
+	return `"` + strings.ReplaceAll(query, `"`, `""`) + `" *`
+}
+
+// escapeLike escapes the LIKE wildcards in s, used with ESCAPE '!'
+// which, unlike backslash, means the same in sqlite, mysql and postgres string literals
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+func SearchMediaAccessLogs(req model.MediaAccessSearchReq) ([]model.MediaAccessLog, int64, error) {
+	columns := mediaAccessSearchColumns[req.Field]
+	searchDB := db.Model(&model.MediaAccessLog{})
+	// stored paths are NFC, a query typed on macOS may arrive decomposed
+	if query := norm.NFC.String(strings.TrimSpace(req.Query)); query != "" {
+		if mediaAccessFTS {
+			fts := mediaAccessTable() + "_fts"
+			match := ftsPhrase(query)
+			if req.Field != "" {
+				match = fmt.Sprintf("{%s} : %s", columns[0], match)
+			}
+			searchDB = searchDB.Where(fmt.Sprintf("id IN (SELECT rowid FROM %s WHERE %s MATCH ?)", fts, fts), match)
+		} else {
+			like := "%" + escapeLike(query) + "%"
+			clause := db.Where(fmt.Sprintf(`%s LIKE ? ESCAPE '!'`, columnName(columns[0])), like)
+			for _, column := range columns[1:] {
+				clause = clause.Or(fmt.Sprintf(`%s LIKE ? ESCAPE '!'`, columnName(column)), like)
+			}
+			searchDB = searchDB.Where(clause)
+		}
+	}
+	if req.From != nil {
+		searchDB = searchDB.Where(fmt.Sprintf("%s >= ?", columnName("time")), *req.From)
+	}
+	if req.To != nil {
+		searchDB = searchDB.Where(fmt.Sprintf("%s <= ?", columnName("time")), *req.To)
+	}
+
+	var count int64
+	if err := searchDB.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed get media access logs count")
+	}
+	var logs []model.MediaAccessLog
+	if err := searchDB.Order(fmt.Sprintf("%s desc, id desc", columnName("time"))).
+		Offset(req.Offset).Limit(req.Limit).Find(&logs).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "failed search media access logs")
+	}
+	return logs, count, nil
+}
+
+// GetRecentMediaAccessLogsByUser returns the latest limit access and redirect download logs of the user, newest first,
+// logs of scanners, sync clients and bots are skipped
+func GetRecentMediaAccessLogsByUser(username string, limit int) ([]model.MediaAccessLog, error) {
+	var logs []model.MediaAccessLog
+	if err := db.Where("username = ? AND event IN ?", username, []string{"access", "redirect_download"}).
+		Where("traffic = '' OR traffic IS NULL").Order("id desc").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get recent media access logs of user")
+	}
+	return logs, nil
+}
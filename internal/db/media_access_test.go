@@ -0,0 +1,131 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig()
+	Init(dB)
+}
+
+func TestSearchMediaAccessLogs(t *testing.T) {
+	start := time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+	logs := []model.MediaAccessLog{
+		{Event: "access", Time: start, ClientIP: "10.0.0.1", Username: "alice", Path: "/d/music/Caf\u00e9.flac", Status: 200},
+		{Event: "access", Time: start.Add(time.Minute), ClientIP: "10.0.0.2", Username: "bob", Path: "/d/movies/a.mkv", Status: 206},
+		{Event: "access", Time: start.Add(2 * time.Minute), ClientIP: "10.0.0.1", Username: "alice", Path: "/d/movies/b.mkv", Status: 200},
+	}
+	if err := CreateMediaAccessLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Where("1 = 1").Delete(&model.MediaAccessLog{})
+
+	search := func(t *testing.T, req model.MediaAccessSearchReq) ([]model.MediaAccessLog, int64) {
+		t.Helper()
+		if err := req.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		items, total, err := SearchMediaAccessLogs(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return items, total
+	}
+	run := func(t *testing.T) {
+		// NFD query matches the NFC stored path
+		if items, total := search(t, model.MediaAccessSearchReq{Query: "Cafe\u0301"}); total != 1 || items[0].Username != "alice" {
+			t.Fatalf("NFD query = %d %+v", total, items)
+		}
+		if _, total := search(t, model.MediaAccessSearchReq{Query: "movies", Field: "path"}); total != 2 {
+			t.Fatalf("path query total = %d", total)
+		}
+		if _, total := search(t, model.MediaAccessSearchReq{Query: "bob", Field: "path"}); total != 0 {
+			t.Fatalf("user name matched the path field, total = %d", total)
+		}
+		if items, total := search(t, model.MediaAccessSearchReq{Query: "alice", Field: "user", Limit: 1}); total != 2 || len(items) != 1 ||
+			items[0].Path != "/d/movies/b.mkv" {
+			t.Fatalf("user query = %d %+v", total, items)
+		}
+		if items, _ := search(t, model.MediaAccessSearchReq{Query: "alice", Field: "user", Limit: 1, Offset: 1}); len(items) != 1 ||
+			items[0].Path != "/d/music/Caf\u00e9.flac" {
+			t.Fatalf("second page = %+v", items)
+		}
+		from := start.Add(30 * time.Second)
+		if _, total := search(t, model.MediaAccessSearchReq{From: &from}); total != 2 {
+			t.Fatalf("from total = %d", total)
+		}
+	}
+
+	fts := mediaAccessFTS
+	defer func() { mediaAccessFTS = fts }()
+	t.Run("fts", func(t *testing.T) {
+		if !fts {
+			t.Skip("sqlite driver built without FTS5")
+		}
+		run(t)
+	})
+	t.Run("like", func(t *testing.T) {
+		mediaAccessFTS = false
+		run(t)
+	})
+}
+
+func TestMediaAccessFTSIndexesExistingRows(t *testing.T) {
+	if !mediaAccessFTS {
+		t.Skip("sqlite driver built without FTS5")
+	}
+	table := mediaAccessTable()
+	fts := table + "_fts"
+	// rows written before the FTS table existed
+	for _, stmt := range []string{
+		"DROP TRIGGER IF EXISTS " + table + "_ai",
+		"DROP TRIGGER IF EXISTS " + table + "_ad",
+		"DROP TRIGGER IF EXISTS " + table + "_au",
+		"DROP TABLE IF EXISTS " + fts,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	logs := []model.MediaAccessLog{
+		{Event: "access", Time: time.Now(), ClientIP: "10.0.0.3", Username: "carol", Path: "/d/old/history.mkv", Status: 200},
+	}
+	if err := CreateMediaAccessLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Where("1 = 1").Delete(&model.MediaAccessLog{})
+
+	initMediaAccessFTS()
+	if !mediaAccessFTS {
+		t.Fatal("full text search was not restored")
+	}
+	items, total, err := SearchMediaAccessLogs(model.MediaAccessSearchReq{Query: "history", Field: "path", Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || items[0].Username != "carol" {
+		t.Fatalf("existing rows were not indexed: %d %+v", total, items)
+	}
+
+	// updated rows are re-indexed
+	if err = db.Model(&model.MediaAccessLog{}).Where("id = ?", items[0].ID).Update("path", "/d/old/renamed.mkv").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ = SearchMediaAccessLogs(model.MediaAccessSearchReq{Query: "renamed", Field: "path", Limit: 10}); total != 1 {
+		t.Fatalf("updated row was not indexed, total = %d", total)
+	}
+	if _, total, _ = SearchMediaAccessLogs(model.MediaAccessSearchReq{Query: "history", Field: "path", Limit: 10}); total != 0 {
+		t.Fatalf("old path of the updated row is still indexed, total = %d", total)
+	}
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+func GetMediaTrendingScores() ([]model.MediaTrendingScore, error) {
+	var scores []model.MediaTrendingScore
+	if err := db.Find(&scores).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed get media trending scores")
+	}
+	return scores, nil
+}
+
+// ReplaceMediaTrendingScores replaces the whole score table in one transaction,
+// the in-memory table is bounded so the snapshot is small
+func ReplaceMediaTrendingScores(scores []model.MediaTrendingScore) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&model.MediaTrendingScore{}).Error; err != nil {
+			return errors.Wrapf(err, "failed clear media trending scores")
+		}
+		if len(scores) == 0 {
+			return nil
+		}
+		return errors.Wrapf(tx.CreateInBatches(&scores, 1000).Error, "failed save media trending scores")
+	})
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// MediaAccessLog is a persisted media access event
+type MediaAccessLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Event     string    `json:"event" gorm:"index"`
+	Time      time.Time `json:"time" gorm:"index"`
+	ClientIP  string    `json:"client_ip" gorm:"index"`
+	Username  string    `json:"username" gorm:"index"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path" gorm:"type:text"`
+	Status    int       `json:"status"`
+	UserAgent string    `json:"user_agent" gorm:"type:text"`
+	// Traffic is scan, sync or bot for automated clients, empty for people
+	Traffic string `json:"traffic,omitempty" gorm:"size:16;default:''"`
+}
+
+type MediaAccessSearchReq struct {
+	Query string `json:"q" form:"q"`
+	// path, user or ip, empty for all of them
+	Field  string     `json:"field" form:"field"`
+	From   *time.Time `json:"from" form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `json:"to" form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int        `json:"limit" form:"limit"`
+	Offset int        `json:"offset" form:"offset"`
+}
+
+const (
+	DefaultMediaAccessSearchLimit = 50
+	MaxMediaAccessSearchLimit     = 500
+)
+
+func (r *MediaAccessSearchReq) Validate() error {
+	switch r.Field {
+	case "", "path", "user", "ip":
+	default:
+		return fmt.Errorf("invalid field: %s", r.Field)
+	}
+	if r.Limit < 1 {
+		r.Limit = DefaultMediaAccessSearchLimit
+	}
+	if r.Limit > MaxMediaAccessSearchLimit {
+		r.Limit = MaxMediaAccessSearchLimit
+	}
+	if r.Offset < 0 {
+		r.Offset = 0
+	}
+	return nil
+}
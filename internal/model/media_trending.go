@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// MediaTrendingScore is the persisted decayed access score of a media file,
+// Score is the value at UpdatedAt and keeps decaying from there
+type MediaTrendingScore struct {
+	Path      string    `json:"path" gorm:"primaryKey;size:768"`
+	Score     float64   `json:"score"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -31,6 +31,8 @@ type TransferTask struct {
 	DstStorageMp string        `json:"dst_storage_mp"`
 	DeletePolicy DeletePolicy  `json:"delete_policy"`
 	Url          string        `json:"-"`
+	// virtual path of the file written to the destination storage, empty for directories
+	addedPath string
 }
 
 func (t *TransferTask) Run() error {
@@ -64,6 +66,7 @@ func (t *TransferTask) Run() error {
 				Mimetype: mimetype,
 				Closers:  utils.NewClosers(r),
 			}
+			t.addedPath = stdpath.Join(t.DstStorageMp, t.DstDirPath, name)
 			return op.Put(t.Ctx(), t.DstStorage, t.DstDirPath, s, t.SetProgress)
 		}
 		return transferStdPath(t)
@@ -84,6 +87,7 @@ func (t *TransferTask) GetStatus() string {
 }
 
 func (t *TransferTask) OnSucceeded() {
+	t.logOfflineAdded()
 	if t.DeletePolicy == DeleteOnUploadSucceed || t.DeletePolicy == DeleteAlways {
 		if t.SrcStorage == nil {
 			removeStdTemp(t)
@@ -93,6 +97,24 @@ func (t *TransferTask) OnSucceeded() {
 	}
 }
 
+// logOfflineAdded report the transferred file to the media log through the fields read by
+// middlewares.MediaLogHook, the media log keeps only media files and one entry per file
+func (t *TransferTask) logOfflineAdded() {
+	if t.addedPath == "" {
+		return
+	}
+	username := ""
+	if t.Creator != nil {
+		username = t.Creator.Username
+	}
+	log.WithFields(log.Fields{
+		"event":      "offline_added",
+		"media_path": t.addedPath,
+		"username":   username,
+		"size":       t.GetTotalBytes(),
+	}).Infof("offline download added %s", t.addedPath)
+}
+
 func (t *TransferTask) OnFailed() {
 	if t.DeletePolicy == DeleteOnUploadFailed || t.DeletePolicy == DeleteAlways {
 		if t.SrcStorage == nil {
@@ -190,6 +212,7 @@ func transferStdFile(t *TransferTask) error {
 		Closers:  utils.NewClosers(rc),
 	}
 	t.SetTotalBytes(info.Size())
+	t.addedPath = stdpath.Join(t.DstStorageMp, t.DstDirPath, s.Obj.GetName())
 	return op.Put(t.Ctx(), t.DstStorage, t.DstDirPath, s, t.SetProgress)
 }
 
@@ -291,6 +314,7 @@ func transferObjFile(t *TransferTask) error {
 		return errors.WithMessagef(err, "failed get [%s] stream", t.SrcObjPath)
 	}
 	t.SetTotalBytes(srcFile.GetSize())
+	t.addedPath = stdpath.Join(t.DstStorageMp, t.DstDirPath, srcFile.GetName())
 	return op.Put(t.Ctx(), t.DstStorage, t.DstDirPath, ss, t.SetProgress)
 }
 
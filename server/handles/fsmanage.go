@@ -14,6 +14,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/pkg/generic"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 )
@@ -254,6 +255,7 @@ func FsRemove(c *gin.Context) {
 			common.ErrorResp(c, err, 500)
 			return
 		}
+		middlewares.RecordMediaAudit(c, middlewares.EventDelete, stdpath.Join(reqDir, name))
 	}
 	//fs.ClearCache(req.Dir)
 	common.SuccessResp(c)
@@ -13,6 +13,7 @@ import (
 	"github.com/OpenListTeam/OpenList/v4/internal/task"
 	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
 	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
 	"github.com/gin-gonic/gin"
 )
 
@@ -99,6 +100,7 @@ func FsStream(c *gin.Context) {
 		common.ErrorResp(c, err, 500)
 		return
 	}
+	middlewares.RecordMediaAudit(c, middlewares.EventUpload, path)
 	if t == nil {
 		common.SuccessResp(c)
 		return
@@ -194,6 +196,7 @@ func FsForm(c *gin.Context) {
 		common.ErrorResp(c, err, 500)
 		return
 	}
+	middlewares.RecordMediaAudit(c, middlewares.EventUpload, path)
 	if t == nil {
 		common.SuccessResp(c)
 		return
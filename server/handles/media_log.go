@@ -0,0 +1,550 @@
+package handles
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/OpenListTeam/OpenList/v4/internal/setting"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListMediaLogWebhooks(c *gin.Context) {
+	common.SuccessResp(c, middlewares.ListMediaWebhooks())
+}
+
+// TestMediaLogNotifier send a sample event to verify the notifier config before saving
+func TestMediaLogNotifier(c *gin.Context) {
+	var req conf.MediaLogNotifier
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if err := middlewares.SendTestNotification(req); err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c)
+}
+
+type TestMediaLogExprReq struct {
+	Expr  string                   `json:"expr" binding:"required"`
+	Event *middlewares.AccessEvent `json:"event"`
+}
+
+// TestMediaLogExpr evaluate a filter expression against a sample event without saving it
+func TestMediaLogExpr(c *gin.Context) {
+	var req TestMediaLogExprReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	result, err := middlewares.EvalMediaExpr(req.Expr, req.Event)
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	common.SuccessResp(c, gin.H{"result": result})
+}
+
+type MediaLogSearchResp struct {
+	TotalCount int64                  `json:"total_count"`
+	Items      []model.MediaAccessLog `json:"items"`
+	NextCursor string                 `json:"next_cursor"`
+}
+
+func SearchMediaLog(c *gin.Context) {
+	var req model.MediaAccessSearchReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	items, total, err := db.SearchMediaAccessLogs(req)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	resp := MediaLogSearchResp{TotalCount: total, Items: items}
+	if next := req.Offset + len(items); int64(next) < total {
+		resp.NextCursor = strconv.Itoa(next)
+	}
+	common.SuccessResp(c, resp)
+}
+
+// GetMediaStats view counts exclude library scans, sync clients and bots unless include_scan/include_sync/include_bot=true
+func GetMediaStats(c *gin.Context) {
+	var include []string
+	if c.Query("include_scan") == "true" {
+		include = append(include, middlewares.TrafficScan)
+	}
+	if c.Query("include_sync") == "true" {
+		include = append(include, middlewares.TrafficSync)
+	}
+	if c.Query("include_bot") == "true" {
+		include = append(include, middlewares.TrafficBot)
+	}
+	common.SuccessResp(c, middlewares.GetMediaStats(include...))
+}
+
+// GetMediaTrending list the files with the highest time decayed access score, limit defaults to 20
+func GetMediaTrending(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 1000 {
+		common.ErrorStrResp(c, "limit must be between 1 and 1000", 400)
+		return
+	}
+	common.SuccessResp(c, middlewares.GetMediaTrending(limit))
+}
+
+// GetMediaMetrics expose media metrics in Prometheus text format
+func GetMediaMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(200)
+	_ = middlewares.WriteMediaPrometheusMetrics(c.Writer)
+}
+
+func GetMediaLogInternalStats(c *gin.Context) {
+	common.SuccessResp(c, middlewares.GetMediaLogInternalStats())
+}
+
+func ResetMediaLogInternalStats(c *gin.Context) {
+	middlewares.ResetMediaLogInternalStats()
+	common.SuccessResp(c)
+}
+
+type StartMediaLogTraceReq struct {
+	// Count is the number of requests to trace
+	Count int `json:"count" binding:"required,min=1,max=1000"`
+	// Timeout in seconds, tracing stops after it even if fewer requests were seen, at most one hour
+	Timeout    int  `json:"timeout"`
+	HeaderOnly bool `json:"header_only"`
+}
+
+func GetMediaLogTrace(c *gin.Context) {
+	common.SuccessResp(c, middlewares.GetMediaTraces())
+}
+
+// StartMediaLogTrace record why the next requests were or were not logged, previous traces are cleared
+func StartMediaLogTrace(c *gin.Context) {
+	var req StartMediaLogTraceReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	middlewares.StartMediaTrace(req.Count, time.Duration(req.Timeout)*time.Second, req.HeaderOnly)
+	common.SuccessResp(c, middlewares.GetMediaTraces())
+}
+
+func StopMediaLogTrace(c *gin.Context) {
+	middlewares.StopMediaTrace()
+	common.SuccessResp(c)
+}
+
+// mediaLogDisabledMounts parse the disabled mount paths setting, one mount path per line
+func mediaLogDisabledMounts() map[string]bool {
+	disabled := make(map[string]bool)
+	for _, line := range strings.Split(setting.GetStr(conf.MediaLogDisabledMounts), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			disabled[utils.FixAndCleanPath(line)] = true
+		}
+	}
+	return disabled
+}
+
+// MediaLogDryRun read the dry-run switches from the settings, so they take effect without a restart
+func MediaLogDryRun() middlewares.MediaDryRun {
+	return middlewares.MediaDryRun{
+		Enabled:    setting.GetBool(conf.MediaLogDryRun),
+		KeepRecent: setting.GetBool(conf.MediaLogDryRunRecent),
+	}
+}
+
+// MediaLogMountEnabled report whether media access under the virtual path should be logged,
+// paths that belong to no storage follow the media_log_unmounted_paths setting
+func MediaLogMountEnabled(path string) bool {
+	storage, _, err := op.GetStorageAndActualPath(path)
+	if err != nil {
+		return setting.GetBool(conf.MediaLogUnmountedPaths)
+	}
+	return !mediaLogDisabledMounts()[utils.GetActualMountPath(storage.GetStorage().MountPath)]
+}
+
+type MediaLogMountResp struct {
+	MountPath string `json:"mount_path"`
+	Driver    string `json:"driver"`
+	Enabled   bool   `json:"enabled"`
+}
+
+func ListMediaLogMounts(c *gin.Context) {
+	disabled := mediaLogDisabledMounts()
+	seen := make(map[string]bool)
+	resp := make([]MediaLogMountResp, 0)
+	for _, storage := range op.GetAllStorages() {
+		// balanced storages share one mount path
+		mountPath := utils.GetActualMountPath(storage.GetStorage().MountPath)
+		if seen[mountPath] {
+			continue
+		}
+		seen[mountPath] = true
+		resp = append(resp, MediaLogMountResp{
+			MountPath: mountPath,
+			Driver:    storage.GetStorage().Driver,
+			Enabled:   !disabled[mountPath],
+		})
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].MountPath < resp[j].MountPath })
+	common.SuccessResp(c, resp)
+}
+
+type SetMediaLogMountReq struct {
+	MountPath string `json:"mount_path" binding:"required"`
+	Enable    bool   `json:"enable"`
+}
+
+func SetMediaLogMount(c *gin.Context) {
+	var req SetMediaLogMountReq
+	if err := c.ShouldBind(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	item, err := op.GetSettingItemByKey(conf.MediaLogDisabledMounts)
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	disabled := mediaLogDisabledMounts()
+	mountPath := utils.FixAndCleanPath(req.MountPath)
+	if req.Enable {
+		delete(disabled, mountPath)
+	} else {
+		disabled[mountPath] = true
+	}
+	mounts := make([]string, 0, len(disabled))
+	for m := range disabled {
+		mounts = append(mounts, m)
+	}
+	sort.Strings(mounts)
+	item.Value = strings.Join(mounts, "\n")
+	if err = op.SaveSettingItem(item); err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c)
+}
+
+// ExportMediaLog stream a media log file as plain text, encrypted chunks are decrypted with the configured passphrase
+func ExportMediaLog(c *gin.Context) {
+	cfg := conf.Conf.MediaLog
+	if !cfg.File.Enable {
+		common.ErrorStrResp(c, "media log file is not enabled", 400)
+		return
+	}
+	filePath, err := middlewares.ResolveMediaLogFile(cfg.File.Name, c.Query("name"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		common.ErrorResp(c, err, 404)
+		return
+	}
+	defer f.Close()
+	filename := strings.TrimSuffix(filepath.Base(filePath), ".gz")
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err = middlewares.DecryptMediaLog(c.Writer, f, cfg.FilePassphrase); err != nil {
+		log.Errorf("failed to export media log %s: %+v", filename, err)
+	}
+}
+
+// VerifyMediaLog check the audit chain of a media log file, anchor is the last hash of the previous file
+func VerifyMediaLog(c *gin.Context) {
+	cfg := conf.Conf.MediaLog
+	if !cfg.File.Enable {
+		common.ErrorStrResp(c, "media log file is not enabled", 400)
+		return
+	}
+	filePath, err := middlewares.ResolveMediaLogFile(cfg.File.Name, c.Query("name"))
+	if err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	report, err := middlewares.VerifyMediaLogFile(filePath, cfg.FilePassphrase, c.Query("anchor"))
+	if err != nil {
+		common.ErrorResp(c, err, 500)
+		return
+	}
+	common.SuccessResp(c, report)
+}
+
+// PurgeMediaLogUser delete all stored media access logs of a user, e.g. after the account is removed.
+// The username must be repeated in the confirm query parameter to avoid accidental purges.
+func PurgeMediaLogUser(c *gin.Context) {
+	username := c.Param("username")
+	if username == "" || c.Query("confirm") != username {
+		common.ErrorStrResp(c, "confirm must be set to the username to purge", 400)
+		return
+	}
+	count, err := middlewares.PurgeMediaUser(username)
+	if err != nil {
+		common.ErrorResp(c, err, 500, true)
+		return
+	}
+	middlewares.RecordMediaPurge(c, count)
+	common.SuccessResp(c, gin.H{"removed": count})
+}
+
+const mediaLogExportBatch = 500
+
+type MediaLogExportReq struct {
+	// json or csv, defaults to json
+	Format string     `form:"format"`
+	From   *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// GetMyRecentlyWatched list the distinct media files the current user accessed most recently, guests get an empty list
+func GetMyRecentlyWatched(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 200 {
+		common.ErrorStrResp(c, "limit must be between 1 and 200", 400)
+		return
+	}
+	user := c.MustGet("user").(*model.User)
+	if user.IsGuest() {
+		common.SuccessResp(c, []middlewares.WatchedFile{})
+		return
+	}
+	common.SuccessResp(c, middlewares.GetRecentlyWatched(user.Username, limit))
+}
+
+type MediaLogExportMeta struct {
+	Username    string     `json:"username"`
+	GeneratedAt time.Time  `json:"generated_at"`
+	From        *time.Time `json:"from,omitempty"`
+	To          *time.Time `json:"to,omitempty"`
+}
+
+// ExportMediaLogUser export all stored media access logs of a user
+func ExportMediaLogUser(c *gin.Context) {
+	exportMediaLogUser(c, c.Param("username"))
+}
+
+// ExportMyMediaLog let the current user export their own media access history
+func ExportMyMediaLog(c *gin.Context) {
+	user := c.MustGet("user").(*model.User)
+	exportMediaLogUser(c, user.Username)
+}
+
+// exportMediaLogUser stream the logs batch by batch so a long history is never held in memory,
+// once the body has started an error can only be logged and the output is left truncated
+func exportMediaLogUser(c *gin.Context, username string) {
+	var req MediaLogExportReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		common.ErrorResp(c, err, 400)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	if req.Format != "json" && req.Format != "csv" {
+		common.ErrorStrResp(c, "format must be json or csv", 400)
+		return
+	}
+	meta := MediaLogExportMeta{Username: username, GeneratedAt: time.Now(), From: req.From, To: req.To}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="medialog-%s.%s"`, url.PathEscape(username), req.Format))
+	var err error
+	if req.Format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		err = exportMediaLogCSV(c, meta)
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		err = exportMediaLogJSON(c, meta)
+	}
+	if err != nil {
+		log.Errorf("failed to export media log of user %s: %+v", username, err)
+	}
+}
+
+func exportMediaLogJSON(c *gin.Context, meta MediaLogExportMeta) error {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(c.Writer, `{"metadata":%s,"entries":[`, header); err != nil {
+		return err
+	}
+	first := true
+	err = db.WalkMediaAccessLogsByUser(meta.Username, meta.From, meta.To, mediaLogExportBatch, func(logs []model.MediaAccessLog) error {
+		for _, item := range logs {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if !first {
+				data = append([]byte{','}, data...)
+			}
+			first = false
+			if _, err = c.Writer.Write(data); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Writer.WriteString("]}\n")
+	return err
+}
+
+func exportMediaLogCSV(c *gin.Context, meta MediaLogExportMeta) error {
+	fmt.Fprintf(c.Writer, "# username: %s\n# generated_at: %s\n", meta.Username, meta.GeneratedAt.Format(time.RFC3339))
+	if meta.From != nil {
+		fmt.Fprintf(c.Writer, "# from: %s\n", meta.From.Format(time.RFC3339))
+	}
+	if meta.To != nil {
+		fmt.Fprintf(c.Writer, "# to: %s\n", meta.To.Format(time.RFC3339))
+	}
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write([]string{"id", "event", "time", "client_ip", "username", "method", "path", "status", "user_agent"}); err != nil {
+		return err
+	}
+	err := db.WalkMediaAccessLogsByUser(meta.Username, meta.From, meta.To, mediaLogExportBatch, func(logs []model.MediaAccessLog) error {
+		for _, item := range logs {
+			if err := w.Write([]string{
+				strconv.FormatUint(uint64(item.ID), 10), item.Event, item.Time.Format(time.RFC3339), item.ClientIP,
+				item.Username, item.Method, item.Path, strconv.Itoa(item.Status), item.UserAgent,
+			}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+type MediaLogRecentResp struct {
+	middlewares.RecentMediaEvents
+	// Persistent is true when events are also stored in the database, older events can be found with search
+	Persistent bool `json:"persistent"`
+}
+
+// GetRecentMediaLog return the latest events kept in memory, newest first
+func GetRecentMediaLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if err != nil || limit < 1 {
+		common.ErrorStrResp(c, "limit must be a positive integer", 400)
+		return
+	}
+	common.SuccessResp(c, MediaLogRecentResp{
+		RecentMediaEvents: middlewares.GetRecentMediaEvents(limit),
+		Persistent:        conf.Conf.MediaLog.Store.Enable,
+	})
+}
+
+const mediaLogTailHeartbeat = 30 * time.Second
+
+// TailMediaLog return the last n events oldest first. Clients accepting text/event-stream
+// get them as an "init" event and then keep receiving new events, resuming with Last-Event-ID
+func TailMediaLog(c *gin.Context) {
+	n, err := strconv.Atoi(c.DefaultQuery("n", "100"))
+	if err != nil || n < 1 {
+		common.ErrorStrResp(c, "n must be a positive integer", 400)
+		return
+	}
+	if !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		common.SuccessResp(c, middlewares.TailMediaEvents(n))
+		return
+	}
+
+	tail := middlewares.SubscribeMediaTail(n, c.GetHeader("Last-Event-ID"))
+	lastID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	defer func() { tail.Close(lastID) }()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	w := c.Writer
+	send := func(event string, id uint64, data any) bool {
+		body, err := json.Marshal(data)
+		if err != nil {
+			return false
+		}
+		if event != "" {
+			fmt.Fprintf(w, "event: %s\n", event)
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, body); err != nil {
+			return false
+		}
+		lastID = id
+		return true
+	}
+
+	fmt.Fprintf(w, "retry: %d\n\n", 3000)
+	if tail.Resumed {
+		for _, ev := range tail.Backlog {
+			if !send("", ev.ID, ev) {
+				return
+			}
+		}
+	} else {
+		id := lastID
+		if len(tail.Backlog) > 0 {
+			id = tail.Backlog[len(tail.Backlog)-1].ID
+		}
+		if !send("init", id, tail.Backlog) {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(mediaLogTailHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case ev, ok := <-tail.Updates:
+			// the subscription is dropped when the client falls too far behind, it reconnects with Last-Event-ID
+			if !ok || !send("", ev.ID, ev) {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
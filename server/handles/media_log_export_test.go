@@ -0,0 +1,173 @@
+package handles_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/handles"
+	"github.com/OpenListTeam/OpenList/v4/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+// more than two export batches, so keyset pagination crosses batch boundaries
+const exportTestRows = 1203
+
+var exportTestStart = time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+
+func newExportRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		role := model.GENERAL
+		switch c.GetHeader("X-Role") {
+		case "admin":
+			role = model.ADMIN
+		case "guest":
+			role = model.GUEST
+		}
+		c.Set("user", &model.User{Username: c.GetHeader("X-User"), Role: role})
+	})
+	r.GET("/api/me/medialog/export", middlewares.AuthNotGuest, handles.ExportMyMediaLog)
+	r.Group("/api/admin", middlewares.AuthAdmin).GET("/medialog/user/:username/export", handles.ExportMediaLogUser)
+	return r
+}
+
+func insertExportLogs(t *testing.T) {
+	t.Helper()
+	logs := make([]model.MediaAccessLog, 0, exportTestRows+exportTestRows/10)
+	for i := 0; i < exportTestRows; i++ {
+		logs = append(logs, model.MediaAccessLog{Event: "access", Time: exportTestStart.Add(time.Duration(i) * time.Second),
+			ClientIP: "10.0.0.1", Username: "alice", Method: "GET", Path: fmt.Sprintf("/d/movies/%04d.mkv", i), Status: 200})
+		if i%10 == 0 {
+			logs = append(logs, model.MediaAccessLog{Event: "access", Time: exportTestStart.Add(time.Duration(i) * time.Second),
+				ClientIP: "10.0.0.2", Username: "bob", Method: "GET", Path: "/d/music/b.mkv", Status: 200})
+		}
+	}
+	insertMediaAccessLogs(t, logs)
+}
+
+func exportRequest(r *gin.Engine, target, user, role string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("X-User", user)
+	req.Header.Set("X-Role", role)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type exportJSON struct {
+	Metadata handles.MediaLogExportMeta `json:"metadata"`
+	Entries  []model.MediaAccessLog     `json:"entries"`
+}
+
+func TestExportMediaLogUserJSON(t *testing.T) {
+	insertExportLogs(t)
+	w := exportRequest(newExportRouter(), "/api/admin/medialog/user/alice/export", "admin", "admin")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("content type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="medialog-alice.json"`) {
+		t.Fatalf("content disposition = %q", cd)
+	}
+	var out exportJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON export: %v", err)
+	}
+	if out.Metadata.Username != "alice" || out.Metadata.GeneratedAt.IsZero() || out.Metadata.From != nil {
+		t.Fatalf("metadata = %+v", out.Metadata)
+	}
+	if len(out.Entries) != exportTestRows {
+		t.Fatalf("got %d entries, want %d", len(out.Entries), exportTestRows)
+	}
+	for i, entry := range out.Entries {
+		if entry.Username != "alice" || entry.Path != fmt.Sprintf("/d/movies/%04d.mkv", i) {
+			t.Fatalf("entry %d = %+v", i, entry)
+		}
+		if i > 0 && entry.ID <= out.Entries[i-1].ID {
+			t.Fatalf("entry %d is out of order", i)
+		}
+	}
+}
+
+func TestExportMediaLogUserCSV(t *testing.T) {
+	insertExportLogs(t)
+	from := exportTestStart.Add(100 * time.Second).Format(time.RFC3339)
+	w := exportRequest(newExportRouter(), "/api/admin/medialog/user/alice/export?format=csv&from="+from, "admin", "admin")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	var comments []string
+	var body strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "# ") {
+			comments = append(comments, line)
+		} else {
+			body.WriteString(line + "\n")
+		}
+	}
+	if len(comments) != 3 || comments[0] != "# username: alice" || comments[2] != "# from: "+from {
+		t.Fatalf("metadata header = %q", comments)
+	}
+	records, err := csv.NewReader(strings.NewReader(body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != exportTestRows-100+1 || records[0][0] != "id" || records[0][6] != "path" {
+		t.Fatalf("got %d records, header %q", len(records), records[0])
+	}
+	lastID := 0
+	for i, record := range records[1:] {
+		id, _ := strconv.Atoi(record[0])
+		if record[4] != "alice" || record[6] != fmt.Sprintf("/d/movies/%04d.mkv", i+100) || id <= lastID {
+			t.Fatalf("record %d = %q", i, record)
+		}
+		lastID = id
+	}
+}
+
+func TestExportMediaLogAccess(t *testing.T) {
+	insertExportLogs(t)
+	r := newExportRouter()
+
+	// only admins can export another user's history
+	w := exportRequest(r, "/api/admin/medialog/user/alice/export", "bob", "")
+	var resp common.Resp[any]
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != 403 {
+		t.Fatalf("non-admin export = %q", w.Body.String())
+	}
+
+	// users export their own history, whatever the path says
+	w = exportRequest(r, "/api/me/medialog/export", "bob", "")
+	var out exportJSON
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Metadata.Username != "bob" || len(out.Entries) != (exportTestRows+9)/10 {
+		t.Fatalf("self export: %s with %d entries", out.Metadata.Username, len(out.Entries))
+	}
+	for _, entry := range out.Entries {
+		if entry.Username != "bob" {
+			t.Fatalf("self export leaked %+v", entry)
+		}
+	}
+
+	w = exportRequest(r, "/api/me/medialog/export", "guest", "guest")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != 403 {
+		t.Fatalf("guest export = %q", w.Body.String())
+	}
+	w = exportRequest(r, "/api/me/medialog/export?format=xml", "bob", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != 400 {
+		t.Fatalf("invalid format = %q", w.Body.String())
+	}
+}
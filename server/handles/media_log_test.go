@@ -0,0 +1,79 @@
+package handles_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/OpenListTeam/OpenList/v4/server/handles"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	dB, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	conf.Conf = conf.DefaultConfig()
+	db.Init(dB)
+	gin.SetMode(gin.TestMode)
+}
+
+// insertMediaAccessLogs replaces all stored media access logs with logs
+func insertMediaAccessLogs(t *testing.T, logs []model.MediaAccessLog) {
+	t.Helper()
+	if err := db.GetDb().Where("1 = 1").Delete(&model.MediaAccessLog{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateMediaAccessLogs(logs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchMediaLog(t *testing.T) {
+	start := time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+	insertMediaAccessLogs(t, []model.MediaAccessLog{
+		{Event: "access", Time: start, ClientIP: "10.0.0.1", Username: "alice", Path: "/d/music/Caf\u00e9.flac", Status: 200},
+		{Event: "access", Time: start.Add(time.Minute), ClientIP: "10.0.0.2", Username: "bob", Path: "/d/movies/a.mkv", Status: 206},
+		{Event: "access", Time: start.Add(2 * time.Minute), ClientIP: "10.0.0.1", Username: "alice", Path: "/d/movies/b.mkv", Status: 200},
+	})
+	r := gin.New()
+	r.GET("/search", handles.SearchMediaLog)
+	search := func(query url.Values) (int, handles.MediaLogSearchResp) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?"+query.Encode(), nil))
+		var resp common.Resp[handles.MediaLogSearchResp]
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+		}
+		return resp.Code, resp.Data
+	}
+
+	// a decomposed query, as typed on macOS, matches the NFC stored path
+	if code, resp := search(url.Values{"q": {"Cafe\u0301"}}); code != 200 || resp.TotalCount != 1 ||
+		resp.Items[0].Path != "/d/music/Caf\u00e9.flac" {
+		t.Fatalf("NFD query = %d %+v", code, resp)
+	}
+
+	code, resp := search(url.Values{"q": {"alice"}, "field": {"user"}, "limit": {"1"}})
+	if code != 200 || resp.TotalCount != 2 || len(resp.Items) != 1 || resp.Items[0].Path != "/d/movies/b.mkv" || resp.NextCursor != "1" {
+		t.Fatalf("first page = %d %+v", code, resp)
+	}
+	code, resp = search(url.Values{"q": {"alice"}, "field": {"user"}, "limit": {"1"}, "offset": {resp.NextCursor}})
+	if code != 200 || len(resp.Items) != 1 || resp.Items[0].Path != "/d/music/Caf\u00e9.flac" || resp.NextCursor != "" {
+		t.Fatalf("second page = %d %+v", code, resp)
+	}
+
+	if code, _ := search(url.Values{"q": {"alice"}, "field": {"agent"}}); code != 400 {
+		t.Fatalf("invalid field returned %d", code)
+	}
+}
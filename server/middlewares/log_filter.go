@@ -0,0 +1,255 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportedExtensions 是日志过滤器保留的媒体文件扩展名，与媒体日志使用同一份列表
+var supportedExtensions = mediaExtensions
+
+var (
+	// pathRegex 匹配 GIN 日志中以媒体扩展名结尾的路径（可以带查询参数），匹配前需要先转为小写
+	// 只在无法从日志行中解析出路径时使用
+	pathRegex    = regexp.MustCompile(`\.(jpe?g|png|gif|bmp|webp|svg|tiff|ico|heic|mp4|avi|mkv|mov|wmv|flv|webm|m4v|mpe?g|3gp|rmvb|rm|ts|m3u8)(\?[^"\s]*)?"`)
+	fsAPIRegex   = regexp.MustCompile(`"/api/fs/(list|get)[?"]`)
+	ignoredRegex = regexp.MustCompile(`"(/assets/|/images/|/favicon\.ico|/robots\.txt|/ping)`)
+)
+
+var ginMarker = []byte("[GIN]")
+
+// maxLogLineBuffer 是未结束的日志行最多缓存的字节数，超过后不再等待换行符，直接按一行处理
+const maxLogLineBuffer = 64 * 1024
+
+// LoggerFilterWriter 过滤 GIN 访问日志，只保留媒体文件和 /api/fs/list、/api/fs/get 的请求
+// 静态资源和其他 API 的日志被丢弃，非 GIN 格式的内容原样输出
+// 一行日志可能分多次写入，没有换行符的部分会先缓存，退出前需要调用 Flush 或 Close 输出剩余内容
+type LoggerFilterWriter struct {
+	Writer io.Writer
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func NewLoggerFilterWriter(w io.Writer) *LoggerFilterWriter {
+	return &LoggerFilterWriter{Writer: w}
+}
+
+// Write 实现 io.Writer，一次写入可能包含多行日志，按行过滤后只写出保留的行
+// 被过滤掉和缓存起来的内容同样视为写入成功，返回值始终为 len(p)
+func (w *LoggerFilterWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data := p
+	if len(w.buf) > 0 {
+		w.buf = append(w.buf, p...)
+		data = w.buf
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if len(data)-end > maxLogLineBuffer {
+		end = len(data)
+	}
+	err := w.writeLines(data[:end])
+	w.buf = append(w.buf[:0], data[end:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush 输出缓存中还没有换行符的最后一行
+func (w *LoggerFilterWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.writeLines(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Close 调用 Flush，不会关闭底层的 Writer
+func (w *LoggerFilterWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *LoggerFilterWriter) writeLines(p []byte) error {
+	kept := filterLogLines(p)
+	if len(kept) == 0 {
+		return nil
+	}
+	_, err := w.Writer.Write(kept)
+	return err
+}
+
+// filterLogLines 逐行过滤 p，返回保留的行，每行保留原有的换行符
+// 末尾没有换行符的部分作为单独一行处理；所有行都保留时直接返回 p，不做拷贝
+func filterLogLines(p []byte) []byte {
+	var kept []byte
+	dropped := false
+	for off := 0; off < len(p); {
+		n := bytes.IndexByte(p[off:], '\n') + 1
+		if n == 0 {
+			n = len(p) - off
+		}
+		line := p[off : off+n]
+		switch {
+		case keepLogLine(line):
+			if dropped {
+				kept = append(kept, line...)
+			}
+		case !dropped:
+			dropped = true
+			kept = append(make([]byte, 0, len(p)), p[:off]...)
+		}
+		off += n
+	}
+	if !dropped {
+		return p
+	}
+	return kept
+}
+
+// NewFilteredLogger 返回只把媒体相关访问日志写入 w 的 gin 日志中间件，skipPaths 中的路径不记录
+func NewFilteredLogger(w io.Writer, skipPaths []string) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Output:    NewLoggerFilterWriter(w),
+		SkipPaths: skipPaths,
+	})
+}
+
+// NewDualFilteredLogger 和 NewFilteredLogger 类似，但其他 API（/api/ 下的非媒体请求）的日志
+// 不会被丢弃，而是写入 otherApiWriter，便于以较低的优先级单独保存；静态资源的日志两边都不写
+func NewDualFilteredLogger(mediaWriter, otherApiWriter io.Writer, skipPaths []string) gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Output:    &dualLogWriter{media: mediaWriter, other: otherApiWriter},
+		SkipPaths: skipPaths,
+	})
+}
+
+// dualLogWriter 按行把日志分发到媒体日志和其他 API 日志两个 writer
+type dualLogWriter struct {
+	media io.Writer
+	other io.Writer
+}
+
+func (w *dualLogWriter) Write(p []byte) (int, error) {
+	var media, other []byte
+	for off := 0; off < len(p); {
+		n := bytes.IndexByte(p[off:], '\n') + 1
+		if n == 0 {
+			n = len(p) - off
+		}
+		line := p[off : off+n]
+		if keepLogLine(line) {
+			media = append(media, line...)
+		} else if isOtherAPILogLine(line) {
+			other = append(other, line...)
+		}
+		off += n
+	}
+	if len(media) > 0 {
+		if _, err := w.media.Write(media); err != nil {
+			return 0, err
+		}
+	}
+	if len(other) > 0 {
+		if _, err := w.other.Write(other); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// isOtherAPILogLine 判断被媒体过滤器丢弃的日志行是否是 /api/ 下的请求
+func isOtherAPILogLine(line []byte) bool {
+	if p, ok := ginLinePath(line); ok {
+		return strings.HasPrefix(p, "/api/")
+	}
+	return bytes.Contains(line, []byte(`"/api/`))
+}
+
+// keepLogLine 判断一行日志是否需要保留
+// 先从日志行中取出路径，按扩展名查表；路径解析失败时才退回到正则匹配整行
+func keepLogLine(line []byte) bool {
+	if !bytes.Contains(line, ginMarker) {
+		return true
+	}
+	p, ok := ginLinePath(line)
+	if !ok {
+		return keepLogLineRegex(line)
+	}
+	return keepRequestPath(p)
+}
+
+// keepRequestPath 判断请求路径对应的日志是否需要保留
+func keepRequestPath(p string) bool {
+	for _, prefix := range ignoredPaths {
+		if strings.HasPrefix(p, prefix) {
+			return false
+		}
+	}
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+	if p == "/api/fs/list" || p == "/api/fs/get" {
+		return true
+	}
+	if isTempDownload(p) {
+		return false
+	}
+	ext := path.Ext(p)
+	if supportedExtensions[ext] {
+		return true
+	}
+	return supportedExtensions[strings.ToLower(ext)]
+}
+
+// ginLinePath 取出 GIN 日志行中的请求路径，例如
+//
+//	[GIN] 2025/07/12 - 15:10:36 | 200 | 2.656541586s | 10.26.0.4 | POST "/api/fs/list"
+//
+// 路径是日志行中第一个带引号的字段，gin 使用 %#v 输出，包含特殊字符时需要反转义
+func ginLinePath(line []byte) (string, bool) {
+	start := bytes.IndexByte(line, '"')
+	if start < 0 {
+		return "", false
+	}
+	rest := line[start+1:]
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return "", false
+	}
+	quoted := rest[:end]
+	if bytes.IndexByte(quoted, '\\') < 0 {
+		return string(quoted), true
+	}
+	// 路径中有转义字符（包括转义的引号），找到真正的结束引号后再反转义
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '"':
+			p, err := strconv.Unquote(string(line[start : start+i+2]))
+			return p, err == nil
+		}
+	}
+	return "", false
+}
+
+// keepLogLineRegex 使用正则表达式判断整行日志，用于无法解析出路径的日志行
+func keepLogLineRegex(line []byte) bool {
+	lower := bytes.ToLower(line)
+	if !bytes.Contains(lower, []byte("[gin]")) {
+		return true
+	}
+	if ignoredRegex.Match(lower) {
+		return false
+	}
+	return fsAPIRegex.Match(lower) || pathRegex.Match(lower)
+}
@@ -0,0 +1,244 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ginLogCorpus = []struct {
+	line string
+	keep bool
+}{
+	{`[GIN] 2025/07/12 - 15:10:36 | 200 | 2.656541586s | 10.26.0.4 | POST "/api/fs/list"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:37 | 200 |   12.30412ms | 10.26.0.4 | POST "/api/fs/get"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:37 | 200 |   12.30412ms | 10.26.0.4 | POST "/api/fs/get?refresh=true"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:38 | 200 |     1.0123ms | 10.26.0.4 | POST "/api/fs/link"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:38 | 200 |     1.0123ms | 10.26.0.4 | GET "/api/me"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:39 | 206 |  3.204567s | 10.26.0.4 | GET "/d/movies/Interstellar.mkv"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:39 | 206 |  3.204567s | 10.26.0.4 | GET "/d/movies/Interstellar.MKV"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:39 | 302 |   801.2µs | 10.26.0.4 | GET "/d/photos/a.jpg?sign=abc:0"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:40 | 200 |   401.2µs | 10.26.0.4 | GET "/p/live/index.m3u8"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:40 | 200 |   401.2µs | 10.26.0.4 | GET "/p/live/seg-001.ts"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:41 | 200 |   101.2µs | 10.26.0.4 | GET "/d/docs/notes.txt"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:41 | 200 |   101.2µs | 10.26.0.4 | GET "/d/backup/archive.zip"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:42 | 200 |    21.2µs | 10.26.0.4 | GET "/assets/index-3f2a.js"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:42 | 200 |    21.2µs | 10.26.0.4 | GET "/images/logo.png"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:42 | 200 |    21.2µs | 10.26.0.4 | GET "/favicon.ico"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:43 | 200 |    11.2µs | 10.26.0.4 | GET "/ping"` + "\n", false},
+	{`[GIN] 2025/07/12 - 15:10:44 | 200 |    11.2µs | 10.26.0.4 | GET "/d/电影/星际穿越.mp4"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:44 | 200 |    11.2µs | 10.26.0.4 | GET "/d/a\"b.mp4"` + "\n", true},
+	{`[GIN] 2025/07/12 - 15:10:45 | 404 |    11.2µs | 10.26.0.4 | GET "/d/video.mp4.txt"` + "\n", false},
+	{"[WARN] Running in \"debug\" mode. Switch to \"release\" mode in production.\n", true},
+	{"plain text without marker\n", true},
+}
+
+func TestKeepLogLine(t *testing.T) {
+	for _, tt := range ginLogCorpus {
+		if got := keepLogLine([]byte(tt.line)); got != tt.keep {
+			t.Errorf("keepLogLine(%q) = %v, want %v", tt.line, got, tt.keep)
+		}
+		if got := keepLogLineRegex([]byte(tt.line)); got != tt.keep {
+			t.Errorf("keepLogLineRegex(%q) = %v, want %v", tt.line, got, tt.keep)
+		}
+	}
+}
+
+func TestGinLinePath(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{`[GIN] | 200 | GET "/d/a.mp4"`, "/d/a.mp4", true},
+		{`[GIN] | 200 | GET "/d/a\"b.mp4"`, `/d/a"b.mp4`, true},
+		{`[GIN] | 200 | GET "/d/a\\b.mp4"`, `/d/a\b.mp4`, true},
+		{`[GIN] | 200 | GET "/d/a.mp4`, "", false},
+		{`[GIN] | 200 | GET /d/a.mp4`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ginLinePath([]byte(tt.line))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ginLinePath(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoggerFilterWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLoggerFilterWriter(&buf)
+	var want bytes.Buffer
+	for _, tt := range ginLogCorpus {
+		n, err := w.Write([]byte(tt.line))
+		if err != nil || n != len(tt.line) {
+			t.Fatalf("Write(%q) = %d, %v", tt.line, n, err)
+		}
+		if tt.keep {
+			want.WriteString(tt.line)
+		}
+	}
+	if buf.String() != want.String() {
+		t.Errorf("output = %q, want %q", buf.String(), want.String())
+	}
+}
+
+func TestLoggerFilterWriterMultiLine(t *testing.T) {
+	media := `[GIN] 2025/07/12 - 15:10:39 | 206 |  3.2s | 10.26.0.4 | GET "/d/movies/a.mkv"` + "\n"
+	list := `[GIN] 2025/07/12 - 15:10:36 | 200 |  2.6s | 10.26.0.4 | POST "/api/fs/list"` + "\n"
+	api := `[GIN] 2025/07/12 - 15:10:38 | 200 |  1.0ms | 10.26.0.4 | GET "/api/me"` + "\n"
+	asset := `[GIN] 2025/07/12 - 15:10:42 | 200 |  21µs | 10.26.0.4 | GET "/assets/index.js"` + "\n"
+	partial := `[GIN] 2025/07/12 - 15:10:42 | 200 |  21µs | 10.26.0.4 | GET "/d/b.mp4"`
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"media then api", media + api, media},
+		{"api then media", api + media, media},
+		{"all kept", media + list, media + list},
+		{"all dropped", api + asset, ""},
+		{"interleaved", api + media + asset + list + api, media + list},
+		{"trailing partial kept", api + partial, partial},
+		{"trailing partial dropped", media + api[:len(api)-1], media},
+		{"blank lines", "\n" + api + "\n", "\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewLoggerFilterWriter(&buf)
+			n, err := w.Write([]byte(tt.input))
+			if err != nil || n != len(tt.input) {
+				t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(tt.input))
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerFilterWriterPartialLines(t *testing.T) {
+	media := `[GIN] 2025/07/12 - 15:10:39 | 206 |  3.2s | 10.26.0.4 | GET "/d/movies/a.mkv"` + "\n"
+	api := `[GIN] 2025/07/12 - 15:10:38 | 200 |  1.0ms | 10.26.0.4 | GET "/api/me.mkv/x"` + "\n"
+
+	var buf bytes.Buffer
+	w := NewLoggerFilterWriter(&buf)
+	// 在路径中间拆分，两个片段单独都无法正确判断
+	input := media + api
+	prev := 0
+	for _, cut := range []int{3, len(media) - 5, len(media) + 30, len(input)} {
+		if _, err := w.Write([]byte(input[prev:cut])); err != nil {
+			t.Fatal(err)
+		}
+		prev = cut
+	}
+	if buf.String() != media {
+		t.Errorf("output = %q, want %q", buf.String(), media)
+	}
+
+	buf.Reset()
+	partial := `[GIN] 2025/07/12 - 15:10:42 | 200 |  21µs | 10.26.0.4 | GET "/d/b.mp4"`
+	w.Write([]byte(partial))
+	if buf.Len() != 0 {
+		t.Fatalf("partial line written before newline: %q", buf.String())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != partial {
+		t.Errorf("Close output = %q, want %q", buf.String(), partial)
+	}
+}
+
+func TestLoggerFilterWriterBufferCap(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLoggerFilterWriter(&buf)
+	long := "plain " + strings.Repeat("x", maxLogLineBuffer)
+	w.Write([]byte(long[:10]))
+	w.Write([]byte(long[10:]))
+	if buf.String() != long {
+		t.Fatalf("over-long partial line should be flushed as is, got %d bytes", buf.Len())
+	}
+	if len(w.buf) != 0 {
+		t.Fatalf("buffer not cleared, %d bytes left", len(w.buf))
+	}
+}
+
+func TestLoggerFilterWriterConcurrent(t *testing.T) {
+	media := `[GIN] 2025/07/12 - 15:10:39 | 206 |  3.2s | 10.26.0.4 | GET "/d/movies/a.mkv"` + "\n"
+	api := `[GIN] 2025/07/12 - 15:10:38 | 200 |  1.0ms | 10.26.0.4 | GET "/api/me"` + "\n"
+
+	var buf bytes.Buffer
+	w := NewLoggerFilterWriter(&buf)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				w.Write([]byte(media))
+				w.Write([]byte(api))
+			}
+		}()
+	}
+	wg.Wait()
+	if want := strings.Repeat(media, 800); buf.String() != want {
+		t.Errorf("got %d bytes, want %d bytes of media lines", buf.Len(), len(want))
+	}
+}
+
+func TestNewDualFilteredLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var media, other bytes.Buffer
+	r := gin.New()
+	r.Use(NewDualFilteredLogger(&media, &other, []string{"/api/public/settings"}))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, p := range []string{"/d/movies/a.mp4", "/api/fs/list", "/api/me", "/api/public/settings", "/assets/index.js", "/favicon.ico"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	check := func(name, out string, want, notWant []string) {
+		for _, p := range want {
+			if !strings.Contains(out, `"`+p+`"`) {
+				t.Errorf("%s log missing %s: %q", name, p, out)
+			}
+		}
+		for _, p := range notWant {
+			if strings.Contains(out, `"`+p+`"`) {
+				t.Errorf("%s log should not contain %s: %q", name, p, out)
+			}
+		}
+	}
+	check("media", media.String(), []string{"/d/movies/a.mp4", "/api/fs/list"},
+		[]string{"/api/me", "/api/public/settings", "/assets/index.js", "/favicon.ico"})
+	check("other", other.String(), []string{"/api/me"},
+		[]string{"/d/movies/a.mp4", "/api/fs/list", "/api/public/settings", "/assets/index.js", "/favicon.ico"})
+}
+
+func BenchmarkKeepLogLine(b *testing.B) {
+	lines := make([][]byte, len(ginLogCorpus))
+	for i, tt := range ginLogCorpus {
+		lines[i] = []byte(tt.line)
+	}
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			keepLogLine(lines[i%len(lines)])
+		}
+	})
+	b.Run("regex", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			keepLogLineRegex(lines[i%len(lines)])
+		}
+	})
+}
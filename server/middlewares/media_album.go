@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"container/list"
+	"net/http"
+	stdpath "path"
+	"sync"
+	"time"
+)
+
+const (
+	// 暂存的目录最多保留的组数，超出时最早的一组直接输出
+	albumMaxPending = 1024
+	// 检查过期分组的间隔
+	albumSweepInterval = time.Second
+)
+
+type albumKey struct {
+	user string
+	ip   string
+	dir  string
+}
+
+// albumGroup 是同一用户、IP 在一个目录下暂存的图片访问
+type albumGroup struct {
+	key albumKey
+	o   *mediaLoggerOptions
+	// 达到阈值之前暂存的事件，合并后清空
+	events []*AccessEvent
+	first  *AccessEvent
+	count  int
+	bytes  int64
+	// 达到阈值后为 true，之后的访问只计数
+	collapsed bool
+	expires   time.Time
+}
+
+// albumCache 暂存图片访问，在窗口内同一目录的图片数达到阈值时合并为一条 album_view，
+// 窗口结束时仍未达到阈值的访问逐条输出
+type albumCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	max     int
+	order   *list.List // *albumGroup，最早创建的在前
+	pending map[albumKey]*list.Element
+	// 过期或被挤出的分组通过 flush 输出
+	flush     func(o *mediaLoggerOptions, ev *AccessEvent)
+	sweepOnce sync.Once
+}
+
+func newAlbumCache(now func() time.Time, max int) *albumCache {
+	return &albumCache{
+		now:     now,
+		max:     max,
+		order:   list.New(),
+		pending: make(map[albumKey]*list.Element),
+		flush:   writeMediaAccess,
+	}
+}
+
+var albumViews = newAlbumCache(time.Now, albumMaxPending)
+
+// admitAlbumImage 在开启 media_log.album 时暂存图片的 GET 请求，返回 false 表示事件由 albumViews 稍后输出
+func admitAlbumImage(o *mediaLoggerOptions, ev *AccessEvent) bool {
+	cfg := mediaLogConf().Album
+	if !cfg.Enable || cfg.MinImages < 2 || cfg.Window <= 0 {
+		return true
+	}
+	if ev.Event != EventAccess || ev.Method != http.MethodGet || ev.Traffic != "" ||
+		mediaCategoryOf(ev.Path) != MediaCategoryImage {
+		return true
+	}
+	ev.trace.step("album", ev.Path, "held", "waiting for more images in the same directory")
+	albumViews.add(o, ev, cfg.MinImages, time.Duration(cfg.Window)*time.Second)
+	return false
+}
+
+// add 把图片访问加入所在目录的分组，window 从分组中第一张图片开始计算，合并之后每次访问都会延长窗口
+func (c *albumCache) add(o *mediaLoggerOptions, ev *AccessEvent, minImages int, window time.Duration) {
+	c.sweepOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(albumSweepInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				c.flushExpired()
+			}
+		}()
+	})
+	ev.fillBytes()
+	c.mu.Lock()
+	now := c.now()
+	out := c.expireLocked(now)
+	key := albumKey{user: ev.Username, ip: ev.ClientIP, dir: stdpath.Dir(ev.Path)}
+	var g *albumGroup
+	if el, ok := c.pending[key]; ok {
+		g = el.Value.(*albumGroup)
+	} else {
+		g = &albumGroup{key: key, o: o, first: ev, expires: now.Add(window)}
+		c.pending[key] = c.order.PushBack(g)
+	}
+	g.count++
+	if ev.Bytes != nil {
+		g.bytes += *ev.Bytes
+	}
+	switch {
+	case g.collapsed:
+		g.expires = now.Add(window)
+	case g.count >= minImages:
+		g.collapsed = true
+		g.events = nil
+		g.expires = now.Add(window)
+	default:
+		g.events = append(g.events, ev)
+	}
+	for c.order.Len() > c.max {
+		out = append(out, c.removeLocked(c.order.Front()))
+	}
+	c.mu.Unlock()
+	c.flushAll(out)
+}
+
+// forget 丢弃 username 暂存的图片访问，不输出，返回丢弃的组数
+func (c *albumCache) forget(username string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*albumGroup).key.user == username {
+			c.removeLocked(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// flushExpired 输出所有窗口已经结束的分组
+func (c *albumCache) flushExpired() {
+	c.mu.Lock()
+	out := c.expireLocked(c.now())
+	c.mu.Unlock()
+	c.flushAll(out)
+}
+
+// expireLocked 取出过期的分组；合并后的分组会延长窗口，所以需要检查全部分组
+func (c *albumCache) expireLocked(now time.Time) []*albumGroup {
+	var out []*albumGroup
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if !now.Before(el.Value.(*albumGroup).expires) {
+			out = append(out, c.removeLocked(el))
+		}
+		el = next
+	}
+	return out
+}
+
+func (c *albumCache) removeLocked(el *list.Element) *albumGroup {
+	g := c.order.Remove(el).(*albumGroup)
+	delete(c.pending, g.key)
+	return g
+}
+
+// flushAll 在锁外输出，避免慢速的 sink 阻塞其他请求
+func (c *albumCache) flushAll(groups []*albumGroup) {
+	for _, g := range groups {
+		if !g.collapsed {
+			for _, ev := range g.events {
+				c.flush(g.o, ev)
+			}
+			continue
+		}
+		c.flush(g.o, g.albumEvent())
+	}
+}
+
+// albumEvent 生成合并后的 album_view 事件，Path 为目录，时间和客户端信息取自第一张图片
+func (g *albumGroup) albumEvent() *AccessEvent {
+	first := g.first
+	ev := &AccessEvent{
+		Event:     EventAlbumView,
+		Time:      first.Time,
+		ClientIP:  first.ClientIP,
+		Username:  first.Username,
+		Method:    first.Method,
+		UserAgent: first.UserAgent,
+		Path:      g.key.dir,
+		Status:    first.Status,
+		Count:     g.count,
+		startedAt: first.startedAt,
+		trace:     first.trace,
+	}
+	if g.bytes > 0 {
+		bytes := g.bytes
+		ev.Bytes = &bytes
+	}
+	return ev
+}
@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func newTestAlbumCache(max int) (*albumCache, *fakeClock, *[]*AccessEvent) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	c := newAlbumCache(clock.Now, max)
+	var flushed []*AccessEvent
+	c.flush = func(_ *mediaLoggerOptions, ev *AccessEvent) { flushed = append(flushed, ev) }
+	return c, clock, &flushed
+}
+
+func imageEvent(user, ip, path string, size int64) *AccessEvent {
+	return &AccessEvent{Event: EventAccess, Method: http.MethodGet, Username: user, ClientIP: ip, Path: path, BytesServed: &size}
+}
+
+func TestAlbumCacheCollapse(t *testing.T) {
+	c, clock, flushed := newTestAlbumCache(16)
+	const window = 10 * time.Second
+	for i := 0; i < 25; i++ {
+		c.add(nil, imageEvent("alice", "10.0.0.1", fmt.Sprintf("/photos/trip/%02d.jpg", i), 100), 10, window)
+		clock.Advance(time.Second)
+	}
+	// 合并之后继续浏览会延长窗口
+	c.flushExpired()
+	if len(*flushed) != 0 {
+		t.Fatalf("album flushed while still browsing: %+v", *flushed)
+	}
+	clock.Advance(window)
+	c.flushExpired()
+	if len(*flushed) != 1 {
+		t.Fatalf("got %d events, want 1 album_view", len(*flushed))
+	}
+	ev := (*flushed)[0]
+	if ev.Event != EventAlbumView || ev.Path != "/photos/trip" || ev.Count != 25 || ev.Bytes == nil || *ev.Bytes != 2500 {
+		t.Fatalf("album event %+v", ev)
+	}
+}
+
+func TestAlbumCacheBelowThreshold(t *testing.T) {
+	c, clock, flushed := newTestAlbumCache(16)
+	const window = 10 * time.Second
+	// 不同目录、不同用户的图片分别计数，都达不到阈值
+	for i := 0; i < 5; i++ {
+		c.add(nil, imageEvent("alice", "10.0.0.1", fmt.Sprintf("/photos/a/%d.jpg", i), 100), 6, window)
+		c.add(nil, imageEvent("alice", "10.0.0.1", fmt.Sprintf("/photos/b/%d.jpg", i), 100), 6, window)
+		c.add(nil, imageEvent("bob", "10.0.0.2", fmt.Sprintf("/photos/a/%d.jpg", i), 100), 6, window)
+	}
+	clock.Advance(window - time.Second)
+	c.flushExpired()
+	if len(*flushed) != 0 {
+		t.Fatalf("flushed before the window ended: %d", len(*flushed))
+	}
+	clock.Advance(time.Second)
+	c.flushExpired()
+	if len(*flushed) != 15 {
+		t.Fatalf("got %d events, want 15 individual accesses", len(*flushed))
+	}
+	for _, ev := range *flushed {
+		if ev.Event != EventAccess {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	}
+}
+
+func TestAlbumCacheForgetAndOverflow(t *testing.T) {
+	c, _, flushed := newTestAlbumCache(2)
+	c.add(nil, imageEvent("alice", "10.0.0.1", "/a/1.jpg", 1), 10, time.Minute)
+	c.add(nil, imageEvent("bob", "10.0.0.2", "/b/1.jpg", 1), 10, time.Minute)
+	if n := c.forget("alice"); n != 1 {
+		t.Fatalf("forget = %d, want 1", n)
+	}
+	c.add(nil, imageEvent("carol", "10.0.0.3", "/c/1.jpg", 1), 10, time.Minute)
+	c.add(nil, imageEvent("dave", "10.0.0.4", "/d/1.jpg", 1), 10, time.Minute)
+	if len(*flushed) != 1 || (*flushed)[0].Username != "bob" {
+		t.Fatalf("overflow flushed %+v, want bob's access", *flushed)
+	}
+}
+
+func TestMediaLogAlbumView(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	defer func(m map[string][]string) { conf.SlicesMap = m }(conf.SlicesMap)
+	conf.SlicesMap = map[string][]string{conf.VideoTypes: {"mp4"}, conf.ImageTypes: {"jpg"}}
+	defer func(a *albumCache) { albumViews = a }(albumViews)
+	albumViews = newAlbumCache(time.Now, albumMaxPending)
+	defer func(album bool, minImages, window int) {
+		mediaLogConf().Album.Enable, mediaLogConf().Album.MinImages, mediaLogConf().Album.Window = album, minImages, window
+	}(mediaLogConf().Album.Enable, mediaLogConf().Album.MinImages, mediaLogConf().Album.Window)
+	mediaLogConf().Album.Enable, mediaLogConf().Album.MinImages, mediaLogConf().Album.Window = true, 3, 60
+
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "image") })
+	paths := []string{"/d/movie.mp4"}
+	for i := 0; i < 2*scanBurstFiles; i++ {
+		paths = append(paths, fmt.Sprintf("/d/photos/%02d.jpg", i))
+	}
+	for _, p := range paths {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	// 视频不经过合并，图片在窗口结束前不输出，也不会因为数量多被当作扫描
+	if len(sink.events) != 1 || sink.events[0].Path != "/d/movie.mp4" {
+		t.Fatalf("events before flush %+v", sink.events)
+	}
+
+	albumViews.now = func() time.Time { return time.Now().Add(time.Minute) }
+	albumViews.flushExpired()
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	ev := sink.events[1]
+	if ev.Event != EventAlbumView || ev.Path != "/d/photos" || ev.Count != 2*scanBurstFiles || ev.Traffic != "" || ev.Bytes == nil || *ev.Bytes != 5*2*scanBurstFiles {
+		t.Fatalf("album event %+v", ev)
+	}
+	if msg := hook.LastEntry().Message; !strings.Contains(msg, "操作：浏览相册") || !strings.Contains(msg, fmt.Sprintf("图片数：%d", 2*scanBurstFiles)) {
+		t.Fatalf("log line %q", msg)
+	}
+}
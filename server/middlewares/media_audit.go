@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 开启审计链后，审计事件（删除、上传、告警等）的日志行末尾追加
+//
+//	#chain prev=<上一条的哈希> hash=<SHA-256(上一条的哈希 ‖ 日志行)>
+//
+// 删除或修改其中任意一行都会使后面的链断开；链头（最后一条的哈希）另外保存在日志文件旁的 .chain 文件中，
+// 用于发现末尾的行被删除。日志文件切割后新文件的第一条以上一个文件最后一条的哈希为 prev，两个文件首尾相连
+// 普通的访问事件不加入链，不增加额外开销
+const auditChainMarker = " #chain prev="
+
+// auditChainGenesis 是新建的链第一条记录的 prev
+var auditChainGenesis = strings.Repeat("0", sha256.Size*2)
+
+type auditChain struct {
+	mu       sync.Mutex
+	headPath string
+	last     string
+}
+
+func auditChainHeadPath(logName string) string {
+	return logName + ".chain"
+}
+
+// loadAuditChain 从链头文件恢复链，文件不存在时新建
+func loadAuditChain(headPath string) (*auditChain, error) {
+	a := &auditChain{headPath: headPath, last: auditChainGenesis}
+	head, err := ReadAuditChainHead(headPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.last = head
+	return a, nil
+}
+
+// ReadAuditChainHead 读取链头文件中保存的最后一条记录的哈希
+func ReadAuditChainHead(headPath string) (string, error) {
+	data, err := os.ReadFile(headPath)
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(data))
+	if !isAuditHash(head) {
+		return "", fmt.Errorf("invalid audit chain head in %s", headPath)
+	}
+	return head, nil
+}
+
+func auditChainHash(prev, line string) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte(line))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isAuditHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// append 计算 line 在链上的哈希并通过 write 写入带哈希的日志行，写入成功后才更新链头
+// 整个过程持有锁，保证文件中的顺序与链的顺序一致
+func (a *auditChain) append(line string, write func(sealed string) error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	hash := auditChainHash(a.last, line)
+	if err := write(line + auditChainMarker + a.last + " hash=" + hash); err != nil {
+		return err
+	}
+	a.last = hash
+	tmp := a.headPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(hash+"\n"), 0600); err != nil {
+		log.Errorf("failed to save audit chain head: %+v", err)
+		return nil
+	}
+	if err := os.Rename(tmp, a.headPath); err != nil {
+		log.Errorf("failed to save audit chain head: %+v", err)
+	}
+	return nil
+}
+
+// AuditChainReport 是校验审计链的结果，BrokenLine 为第一处断开的行号（从 1 开始），为 0 表示完整
+type AuditChainReport struct {
+	Entries    int    `json:"entries"`
+	Anchor     string `json:"anchor"`
+	LastHash   string `json:"last_hash"`
+	BrokenLine int    `json:"broken_line,omitempty"`
+	// Truncated 表示链本身完整，但最后一条与链头文件不一致，末尾的记录被删除了
+	Truncated bool   `json:"truncated,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Intact 判断链是否完整
+func (r *AuditChainReport) Intact() bool {
+	return r.BrokenLine == 0 && !r.Truncated
+}
+
+// VerifyAuditChain 逐行重放日志中的审计链，遇到第一处断开时停止
+// anchor 为上一个日志文件最后一条的哈希（或当前链头之前的哈希），为空时不检查第一条的 prev，
+// 第一条的 prev 记录在 Anchor 中，用于和上一个文件的 LastHash 对照
+func VerifyAuditChain(r io.Reader, anchor string) (*AuditChainReport, error) {
+	report := &AuditChainReport{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := scanner.Text()
+		i := strings.LastIndex(text, auditChainMarker)
+		if i < 0 {
+			continue
+		}
+		line, rest := text[:i], text[i+len(auditChainMarker):]
+		prev, hash, ok := strings.Cut(rest, " hash=")
+		broken := func(reason string) (*AuditChainReport, error) {
+			report.BrokenLine = lineNo
+			report.Reason = reason
+			return report, nil
+		}
+		if !ok || !isAuditHash(prev) || !isAuditHash(hash) {
+			return broken("malformed chain entry")
+		}
+		if report.Entries == 0 {
+			report.Anchor = prev
+			if anchor != "" && prev != anchor {
+				return broken("first entry does not continue from the anchor")
+			}
+		} else if prev != report.LastHash {
+			return broken("entry does not continue from the previous entry, lines may have been removed")
+		}
+		if auditChainHash(prev, line) != hash {
+			return broken("hash mismatch, entry has been modified")
+		}
+		report.Entries++
+		report.LastHash = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// VerifyMediaLogFile 校验日志文件中的审计链，加密的文件使用 passphrase 解密
+// 文件旁存在链头文件（即当前正在写入的日志文件）时，同时检查末尾的记录是否被删除；
+// 切割后新文件还没有审计记录时链头指向上一个文件，这时无法判断，只校验已有的记录
+func VerifyMediaLogFile(name, passphrase, anchor string) (*AuditChainReport, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(DecryptMediaLog(pw, f, passphrase))
+	}()
+	report, err := VerifyAuditChain(pr, anchor)
+	_ = pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !report.Intact() {
+		return report, nil
+	}
+	head, err := ReadAuditChainHead(auditChainHeadPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if report.Entries > 0 && head != report.LastHash {
+		report.Truncated = true
+		report.Reason = "last entry does not match the chain head, entries at the end may have been removed"
+	}
+	return report, nil
+}
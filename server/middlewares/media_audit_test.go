@@ -0,0 +1,173 @@
+package middlewares
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestAuditChain(t *testing.T) {
+	dir := t.TempDir()
+	logName := filepath.Join(dir, "media.log")
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if err := logger.EnableAuditChain(); err != nil {
+		t.Fatal(err)
+	}
+	entries := []struct{ event, line string }{
+		{EventDelete, "alice 删除 /movies/a.mkv"},
+		{EventAccess, "bob /movies/b.mp4"},
+		{EventUpload, "alice 上传 /movies/c.mp4"},
+		{EventDenied, "eve /private/d.mp4"},
+	}
+	for _, e := range entries {
+		if err := logger.writeEntry(&AccessEvent{Event: e.event}, e.line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = logger.Close()
+
+	data, err := os.ReadFile(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	// 普通的访问事件不加入链
+	if lines[1] != "bob /movies/b.mp4" {
+		t.Fatalf("plain access line = %q", lines[1])
+	}
+	report, err := VerifyMediaLogFile(logName, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Intact() || report.Entries != 3 || report.Anchor != auditChainGenesis {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// 重启后继续之前的链
+	logger = NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if err := logger.EnableAuditChain(); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.writeEntry(&AccessEvent{Event: EventDelete}, "alice 删除 /movies/e.mkv"); err != nil {
+		t.Fatal(err)
+	}
+	_ = logger.Close()
+	if report, err = VerifyMediaLogFile(logName, "", ""); err != nil || !report.Intact() || report.Entries != 4 {
+		t.Fatalf("after restart: %+v, %v", report, err)
+	}
+	if report, _ = VerifyMediaLogFile(logName, "", strings.Repeat("1", 64)); report.BrokenLine != 1 {
+		t.Fatalf("wrong anchor: %+v", report)
+	}
+
+	data, _ = os.ReadFile(logName)
+	lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	tamper := func(lines []string) *AuditChainReport {
+		t.Helper()
+		report, err := VerifyAuditChain(strings.NewReader(strings.Join(lines, "\n")+"\n"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	// 删除中间的一条审计记录
+	removed := append(append([]string{}, lines[:2]...), lines[3:]...)
+	if report := tamper(removed); report.BrokenLine != 3 {
+		t.Fatalf("removed entry: %+v", report)
+	}
+	// 修改一条审计记录的内容
+	modified := append([]string{}, lines...)
+	modified[2] = strings.Replace(modified[2], "c.mp4", "x.mp4", 1)
+	if report := tamper(modified); report.BrokenLine != 3 || !strings.Contains(report.Reason, "modified") {
+		t.Fatalf("modified entry: %+v", report)
+	}
+	// 删除普通访问记录不影响链
+	if report := tamper(append([]string{lines[0]}, lines[2:]...)); !report.Intact() {
+		t.Fatalf("removed plain line: %+v", report)
+	}
+
+	// 删除末尾的审计记录，只能通过链头发现
+	if err := os.WriteFile(logName, []byte(strings.Join(lines[:len(lines)-1], "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report, err = VerifyMediaLogFile(logName, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Truncated || report.Intact() {
+		t.Fatalf("truncated: %+v", report)
+	}
+}
+
+func TestAuditChainEncrypted(t *testing.T) {
+	logName := filepath.Join(t.TempDir(), "media.log")
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if err := logger.EncryptWith("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := logger.EnableAuditChain(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/a.mkv", "/b.mkv"} {
+		if err := logger.writeEntry(&AccessEvent{Event: EventDelete}, "alice 删除 "+path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = logger.Close()
+
+	report, err := VerifyMediaLogFile(logName, "correct horse", "")
+	if err != nil || !report.Intact() || report.Entries != 2 {
+		t.Fatalf("report = %+v, %v", report, err)
+	}
+	if _, err := VerifyMediaLogFile(logName, "wrong", ""); err == nil {
+		t.Fatal("wrong passphrase verified")
+	}
+}
+
+func TestAuditChainSkipsPlainAccess(t *testing.T) {
+	logName := filepath.Join(t.TempDir(), "media.log")
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if err := logger.EnableAuditChain(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		_ = logger.writeEntry(&AccessEvent{Event: EventAccess}, "bob /movies/b.mp4")
+	}
+	_ = logger.Close()
+	// 没有审计事件时不写链头文件
+	if _, err := os.Stat(auditChainHeadPath(logName)); !os.IsNotExist(err) {
+		t.Fatalf("chain head written for plain access events: %v", err)
+	}
+	data, _ := os.ReadFile(logName)
+	if bytes.Contains(data, []byte(auditChainMarker)) {
+		t.Fatal("plain access line is chained")
+	}
+}
+
+func BenchmarkMediaFileLoggerAuditChain(b *testing.B) {
+	for _, chain := range []bool{false, true} {
+		name := "plain"
+		if chain {
+			name = "chain"
+		}
+		b.Run(name, func(b *testing.B) {
+			logger := NewMediaFileLogger(conf.LogConfig{Name: filepath.Join(b.TempDir(), "media.log"), MaxSize: 100})
+			defer logger.Close()
+			if chain {
+				if err := logger.EnableAuditChain(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			ev := &AccessEvent{Event: EventAccess}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = logger.writeEntry(ev, "bob /movies/b.mp4")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	barkServerURL = "https://api.day.app"
+	// Bark 推送到单个设备，默认每 10 分钟最多推送一次活动汇总
+	defaultBarkWindow = 10 * time.Minute
+	// 汇总中最多列出的事件数
+	barkMaxLines = 5
+)
+
+// barkSink 通过 Bark 向 iOS 设备推送通知，例如 "alice is playing Interstellar.mkv"
+type barkSink struct {
+	server string
+	key    string
+	group  string
+	sound  string
+	client *http.Client
+}
+
+// newBarkSink 创建 Bark sink，URL 为服务器地址（默认为官方服务器），Token 为设备 key
+func newBarkSink(cfg conf.MediaLogNotifier) *barkSink {
+	server := cfg.URL
+	if server == "" {
+		server = barkServerURL
+	}
+	return &barkSink{
+		server: strings.TrimSuffix(server, "/"),
+		key:    cfg.Token,
+		group:  cfg.Group,
+		sound:  cfg.Sound,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func barkLine(ce *coalescedEvent) string {
+	name := eventFileName(ce.AccessEvent)
+	line := fmt.Sprintf("%s %s %s", orDash(ce.Username), ce.Event, name)
+	if ce.Event == EventAccess {
+		line = fmt.Sprintf("%s is playing %s", orDash(ce.Username), name)
+	}
+	if ce.Count > 1 {
+		line += fmt.Sprintf(" (×%d)", ce.Count)
+	}
+	return line
+}
+
+// pushURL 生成 {server}/{key}/{title}/{body} 形式的推送地址
+// 文件名可能包含 /、?、# 等任意字符，每一段都需要单独转义
+func (s *barkSink) pushURL(title, body string) string {
+	u := fmt.Sprintf("%s/%s/%s/%s", s.server, url.PathEscape(s.key), url.PathEscape(title), url.PathEscape(body))
+	query := url.Values{}
+	if s.group != "" {
+		query.Set("group", s.group)
+	}
+	if s.sound != "" {
+		query.Set("sound", s.sound)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (s *barkSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *barkSink) WriteBatch(evs []*AccessEvent) error {
+	events := coalesceEvents(evs)
+	lines := make([]string, 0, barkMaxLines+1)
+	for i, ce := range events {
+		if i == barkMaxLines {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(events)-barkMaxLines))
+			break
+		}
+		lines = append(lines, barkLine(ce))
+	}
+	target := s.pushURL("OpenList", strings.Join(lines, "\n"))
+	return sendNotification(s.client, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, target, nil)
+	})
+}
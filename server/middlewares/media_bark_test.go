@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestBarkSinkEscapesFileName(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	t.Cleanup(srv.Close)
+
+	sink := newBarkSink(conf.MediaLogNotifier{URL: srv.URL + "/", Token: "devkey", Group: "media", Sound: "bell"})
+	ev := testAccessEvent()
+	ev.Path = "/movies/What?/100% #1 &more.mkv"
+	if err := sink.Write(ev); err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if want := "/devkey/OpenList/alice is playing 100% #1 &more.mkv"; r.URL.Path != want {
+		t.Fatalf("path = %q, want %q", r.URL.Path, want)
+	}
+	if q := r.URL.Query(); q.Get("group") != "media" || q.Get("sound") != "bell" || len(q) != 2 {
+		t.Fatalf("query = %v", q)
+	}
+}
@@ -0,0 +1,223 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+// botEngine 是可以通过反向 DNS 验证的搜索引擎爬虫，IP 的 PTR 记录必须以 domains 之一结尾，
+// 并且 PTR 记录的主机名正向解析后包含该 IP
+type botEngine struct {
+	name    string
+	ua      *regexp.Regexp
+	domains []string
+}
+
+var botEngines = []*botEngine{
+	{"Googlebot", regexp.MustCompile(`(?i)googlebot`), []string{".googlebot.com", ".google.com"}},
+	{"bingbot", regexp.MustCompile(`(?i)bingbot`), []string{".search.msn.com"}},
+	{"Baiduspider", regexp.MustCompile(`(?i)baiduspider`), []string{".baidu.com", ".baidu.jp"}},
+	{"YandexBot", regexp.MustCompile(`(?i)yandex(bot|images|video)`), []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	{"Applebot", regexp.MustCompile(`(?i)applebot`), []string{".applebot.apple.com"}},
+}
+
+// claimedBotEngine 返回 User-Agent 自称的搜索引擎，不是可验证的搜索引擎时返回 nil
+func claimedBotEngine(userAgent string) *botEngine {
+	for _, engine := range botEngines {
+		if engine.ua.MatchString(userAgent) {
+			return engine
+		}
+	}
+	return nil
+}
+
+type botState int
+
+const (
+	botPending botState = iota
+	botVerified
+	botUnverified
+)
+
+const (
+	// 验证结果的缓存时间；验证请求在队列满时被丢弃，pending 过期后重新排队
+	botVerifiedTTL   = 24 * time.Hour
+	botUnverifiedTTL = time.Hour
+	botPendingTTL    = time.Minute
+	botLookupTimeout = 5 * time.Second
+	botMaxEntries    = 10000
+	botQueueSize     = 256
+	// 每秒最多验证的 IP 数，每次验证包括一次反向解析和一次正向解析
+	botLookupsPerSecond = 5
+)
+
+type botVerification struct {
+	state   botState
+	expires time.Time
+}
+
+type botLookup struct {
+	ip     string
+	engine *botEngine
+}
+
+// botVerifier 在后台验证自称搜索引擎的 IP，请求处理时只读取缓存，不会等待 DNS
+type botVerifier struct {
+	mu    sync.Mutex
+	cache map[string]*botVerification
+
+	queue   chan botLookup
+	limiter *rate.Limiter
+	// 便于测试替换
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	lookupIP   func(ctx context.Context, host string) ([]net.IP, error)
+	now        func() time.Time
+
+	done chan struct{}
+}
+
+func newBotVerifier() *botVerifier {
+	return &botVerifier{
+		cache:      make(map[string]*botVerification),
+		queue:      make(chan botLookup, botQueueSize),
+		limiter:    rate.NewLimiter(botLookupsPerSecond, 1),
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		},
+		now: time.Now,
+	}
+}
+
+// start 启动后台验证，返回的函数停止验证并等待正在进行的查询结束
+func (v *botVerifier) start() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	v.done = make(chan struct{})
+	go v.run(ctx)
+	return func() {
+		cancel()
+		<-v.done
+	}
+}
+
+func (v *botVerifier) run(ctx context.Context) {
+	defer close(v.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case lookup := <-v.queue:
+			if err := v.limiter.Wait(ctx); err != nil {
+				return
+			}
+			v.verify(ctx, lookup)
+		}
+	}
+}
+
+// status 返回 IP 的验证结果，没有结果时把验证放入队列并返回 botPending
+func (v *botVerifier) status(ip string, engine *botEngine) botState {
+	now := v.now()
+	key := engine.name + "|" + ip
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if entry := v.cache[key]; entry != nil && now.Before(entry.expires) {
+		return entry.state
+	}
+	if len(v.cache) >= botMaxEntries {
+		for k, entry := range v.cache {
+			if !now.Before(entry.expires) {
+				delete(v.cache, k)
+			}
+		}
+		if len(v.cache) >= botMaxEntries {
+			return botPending
+		}
+	}
+	select {
+	case v.queue <- botLookup{ip: ip, engine: engine}:
+		v.cache[key] = &botVerification{state: botPending, expires: now.Add(botPendingTTL)}
+	default:
+	}
+	return botPending
+}
+
+// verify 做一次反向解析和正向解析并缓存结果
+func (v *botVerifier) verify(ctx context.Context, lookup botLookup) {
+	ctx, cancel := context.WithTimeout(ctx, botLookupTimeout)
+	defer cancel()
+	state, ttl := botUnverified, botUnverifiedTTL
+	if v.matches(ctx, lookup) {
+		state, ttl = botVerified, botVerifiedTTL
+	} else if ctx.Err() == nil {
+		log.Warnf("media bot: %s claims to be %s but its reverse DNS does not match", lookup.ip, lookup.engine.name)
+	}
+	v.mu.Lock()
+	v.cache[lookup.engine.name+"|"+lookup.ip] = &botVerification{state: state, expires: v.now().Add(ttl)}
+	v.mu.Unlock()
+}
+
+func (v *botVerifier) matches(ctx context.Context, lookup botLookup) bool {
+	ip := net.ParseIP(lookup.ip)
+	if ip == nil {
+		return false
+	}
+	names, err := v.lookupAddr(ctx, lookup.ip)
+	if err != nil {
+		log.Debugf("media bot: reverse lookup of %s failed: %+v", lookup.ip, err)
+		return false
+	}
+	for _, name := range names {
+		host := strings.ToLower(strings.TrimSuffix(name, "."))
+		if !hasAnySuffix(host, lookup.engine.domains) {
+			continue
+		}
+		ips, err := v.lookupIP(ctx, host)
+		if err != nil {
+			log.Debugf("media bot: lookup of %s failed: %+v", host, err)
+			continue
+		}
+		for _, resolved := range ips {
+			if resolved.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaBotVerifier 由 InitMediaLog 在开启 verify_bots 时设置
+var mediaBotVerifier atomic.Pointer[botVerifier]
+
+// tagBot 为爬虫的访问设置 Traffic，返回是否标记
+// 开启 verify_bots 时，自称搜索引擎的请求只有验证通过才标记，验证完成前和验证失败的请求不标记，
+// 避免伪造 User-Agent 的抓取工具借 drop_bot_traffic 隐藏访问记录
+func tagBot(ev *AccessEvent) bool {
+	if v := mediaBotVerifier.Load(); v != nil {
+		if engine := claimedBotEngine(ev.UserAgent); engine != nil {
+			if v.status(ev.ClientIP, engine) != botVerified {
+				return false
+			}
+			ev.BotVerified = true
+		}
+	}
+	ev.Traffic = TrafficBot
+	return true
+}
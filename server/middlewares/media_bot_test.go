@@ -0,0 +1,178 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestClassifyBotUserAgent(t *testing.T) {
+	for ua, want := range map[string]string{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": TrafficBot,
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":  TrafficBot,
+		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/)": TrafficBot,
+		"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)":       TrafficBot,
+		"curl/8.5.0":               TrafficBot,
+		"Wget/1.21.4":              TrafficBot,
+		"Some Crawler 1.0":         TrafficBot,
+		"Mozilla/5.0 (X11; Linux)": "",
+		// 内嵌 curl 的播放器不是爬虫
+		"mpv 0.38.0 (libcurl/8.5.0)": "",
+	} {
+		if got := classifyUserAgent(ua); got != want {
+			t.Errorf("classifyUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+// newTestBotVerifier 返回使用固定 DNS 记录的验证器，release 关闭前反向解析一直阻塞
+func newTestBotVerifier(ptr map[string][]string, a map[string][]string, release chan struct{}) *botVerifier {
+	v := newBotVerifier()
+	v.limiter.SetLimit(1000)
+	v.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if names, ok := ptr[addr]; ok {
+			return names, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	v.lookupIP = func(_ context.Context, host string) ([]net.IP, error) {
+		var ips []net.IP
+		for _, s := range a[host] {
+			ips = append(ips, net.ParseIP(s))
+		}
+		return ips, nil
+	}
+	return v
+}
+
+// waitBotState 等待后台验证完成
+func waitBotState(t *testing.T, v *botVerifier, ip string, engine *botEngine, want botState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for v.status(ip, engine) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: state %d, want %d", ip, v.status(ip, engine), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBotVerifier(t *testing.T) {
+	release := make(chan struct{})
+	v := newTestBotVerifier(map[string][]string{
+		"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."},
+		// PTR 伪造成 googlebot.com，但正向解析不包含该 IP
+		"203.0.113.9": {"crawl.googlebot.com."},
+	}, map[string][]string{
+		"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"},
+		"crawl.googlebot.com":             {"66.249.66.2"},
+	}, release)
+	stop := v.start()
+	defer stop()
+	google := claimedBotEngine("Googlebot/2.1")
+
+	// DNS 查询阻塞时请求处理也不会等待
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if got := v.status("66.249.66.1", google); got != botPending {
+			t.Fatalf("state before the lookup finished = %d", got)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("status blocked for %s", elapsed)
+	}
+	close(release)
+
+	waitBotState(t, v, "66.249.66.1", google, botVerified)
+	waitBotState(t, v, "203.0.113.9", google, botUnverified)
+	waitBotState(t, v, "198.51.100.1", google, botUnverified)
+	// 同一个 IP 自称其他搜索引擎时单独验证
+	waitBotState(t, v, "66.249.66.1", claimedBotEngine("bingbot/2.0"), botUnverified)
+}
+
+func TestBotVerifierQueueFull(t *testing.T) {
+	// 没有启动后台验证，队列写满后不再排队也不阻塞
+	v := newBotVerifier()
+	google := claimedBotEngine("Googlebot/2.1")
+	for i := 0; i < botQueueSize+10; i++ {
+		if got := v.status(net.IPv4(10, 0, byte(i>>8), byte(i)).String(), google); got != botPending {
+			t.Fatalf("state = %d", got)
+		}
+	}
+	if len(v.queue) != botQueueSize || len(v.cache) != botQueueSize {
+		t.Fatalf("queue %d, cache %d", len(v.queue), len(v.cache))
+	}
+}
+
+func TestMediaLogBotTraffic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	close(release)
+	v := newTestBotVerifier(map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+		map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}}, release)
+	stop := v.start()
+	defer stop()
+	mediaBotVerifier.Store(v)
+	defer mediaBotVerifier.Store(nil)
+	defer func(drop bool) { mediaLogConf().DropBotTraffic = drop }(mediaLogConf().DropBotTraffic)
+	defer ResetMediaLogInternalStats()
+	ResetMediaLogInternalStats()
+
+	logger, _ := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	serve := func(ip, ua string) *AccessEvent {
+		sink.events = nil
+		req := httptest.NewRequest(http.MethodGet, "/d/public/a.mp4", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if len(sink.events) == 0 {
+			return nil
+		}
+		return sink.events[0]
+	}
+	const googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+
+	// 验证完成前按普通访问记录
+	if ev := serve("66.249.66.1", googlebot); ev.Traffic != "" {
+		t.Fatalf("unverified googlebot tagged %q", ev.Traffic)
+	}
+	waitBotState(t, v, "66.249.66.1", claimedBotEngine(googlebot), botVerified)
+	if ev := serve("66.249.66.1", googlebot); ev.Traffic != TrafficBot || !ev.BotVerified {
+		t.Fatalf("verified googlebot: %+v", ev)
+	}
+	// 无法验证的工具只按 User-Agent 标记
+	if ev := serve("192.0.2.1", "curl/8.5.0"); ev.Traffic != TrafficBot || ev.BotVerified {
+		t.Fatalf("curl: %+v", ev)
+	}
+
+	// 开启丢弃后，伪造的 Googlebot 仍然记录
+	mediaLogConf().DropBotTraffic = true
+	if ev := serve("66.249.66.1", googlebot); ev != nil {
+		t.Fatalf("verified bot was not dropped: %+v", ev)
+	}
+	if ev := serve("192.0.2.1", "Wget/1.21.4"); ev != nil {
+		t.Fatalf("wget was not dropped: %+v", ev)
+	}
+	waitBotState(t, v, "203.0.113.9", claimedBotEngine(googlebot), botUnverified)
+	if ev := serve("203.0.113.9", googlebot); ev == nil || ev.Traffic != "" {
+		t.Fatalf("spoofed googlebot: %+v", ev)
+	}
+	if got := GetMediaLogInternalStats().Suppressed[TrafficBot]; got != 2 {
+		t.Fatalf("suppressed bot = %d, want 2", got)
+	}
+}
@@ -0,0 +1,189 @@
+package middlewares
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// MediaAlert 是检测类中间件发出的告警
+type MediaAlert struct {
+	Kind     string        `json:"kind"`
+	ClientIP string        `json:"client_ip"`
+	Username string        `json:"username"`
+	Path     string        `json:"path"`
+	Count    int           `json:"count"`
+	Window   time.Duration `json:"window"`
+	Time     time.Time     `json:"time"`
+	// BaselineLatencyAlertMiddleware 告警时本次请求的耗时和基线耗时
+	Latency  time.Duration `json:"latency,omitempty"`
+	Baseline time.Duration `json:"baseline,omitempty"`
+}
+
+// AlertSink 接收检测类中间件发出的告警，实现时不能阻塞太久，告警在请求处理过程中同步发送
+type AlertSink interface {
+	Alert(a MediaAlert)
+}
+
+// AlertSinkFunc 把普通函数转换为 AlertSink
+type AlertSinkFunc func(a MediaAlert)
+
+func (f AlertSinkFunc) Alert(a MediaAlert) { f(a) }
+
+// AlertSessionBreadth 是 SessionBreadthMonitor 发出的告警类型
+const AlertSessionBreadth = "session_breadth"
+
+// hllPrecision 为 HyperLogLog 的精度，2^10 个寄存器，每个会话占用 1KB，标准误差约 3%
+const hllPrecision = 10
+
+// hyperLogLog 估算不同元素的个数，内存占用固定，不保存元素本身
+type hyperLogLog struct {
+	registers [1 << hllPrecision]uint8
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// 剩余位中第一个 1 的位置，最后补一个 1 避免全 0 时溢出
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() int {
+	const m = float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// 基数较小时改用线性计数，误差更小
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(e))
+}
+
+type breadthSession struct {
+	start   time.Time
+	paths   hyperLogLog
+	alerted bool
+}
+
+// breadthTracker 按会话统计时间窗口内访问的不同路径数，窗口从会话第一次访问开始
+type breadthTracker struct {
+	mu       sync.Mutex
+	seed     maphash.Seed
+	maxPaths int
+	window   time.Duration
+	sessions map[uint64]*breadthSession
+}
+
+func newBreadthTracker(maxPaths int, window time.Duration) *breadthTracker {
+	return &breadthTracker{
+		seed:     maphash.MakeSeed(),
+		maxPaths: maxPaths,
+		window:   window,
+		sessions: make(map[uint64]*breadthSession),
+	}
+}
+
+func (t *breadthTracker) hash(s string) uint64 {
+	return maphash.String(t.seed, s)
+}
+
+// record 记录一次访问，估算值在窗口内第一次超过 maxPaths 时返回估算值和 true
+func (t *breadthTracker) record(key, path string, now time.Time) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.hash(key)
+	s := t.sessions[id]
+	if s == nil || now.Sub(s.start) > t.window {
+		s = &breadthSession{start: now}
+		t.sessions[id] = s
+	}
+	s.paths.add(t.hash(path))
+	if s.alerted {
+		return 0, false
+	}
+	n := s.paths.estimate()
+	if n <= t.maxPaths {
+		return n, false
+	}
+	s.alerted = true
+	return n, true
+}
+
+// sweep 清理窗口已经结束的会话
+func (t *breadthTracker) sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, s := range t.sessions {
+		if now.Sub(s.start) > t.window {
+			delete(t.sessions, id)
+		}
+	}
+}
+
+// sessionKey 返回统计使用的会话标识：OpenList 的登录会话通过 Authorization 头中的 token 维持，
+// 没有 token 时使用客户端 IP；token 只用于计算哈希，不会保存
+func sessionKey(c *gin.Context) string {
+	if token := c.GetHeader("Authorization"); token != "" {
+		return "token:" + token
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// SessionBreadthMonitor 统计每个会话在 sessionWindow 内访问的不同媒体文件数，
+// 超过 maxPaths 时调用 alert，每个窗口只告警一次。正常观看很少在短时间内打开大量不同的文件，
+// 超过阈值通常说明是自动化的批量抓取。不同路径数使用 HyperLogLog 估算，每个会话固定占用 1KB，
+// 估算值有约 3% 的误差；alert 为 nil 时只输出警告日志
+// Jellyfin 等媒体服务器刷新媒体库时同样会读取大量文件，扫描流量不计入
+func SessionBreadthMonitor(maxPaths int, sessionWindow time.Duration, alert AlertSink) gin.HandlerFunc {
+	tracker := newBreadthTracker(maxPaths, sessionWindow)
+	go func() {
+		ticker := time.NewTicker(sessionWindow)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			tracker.sweep(now)
+		}
+	}()
+	return sessionBreadthMonitor(tracker, alert, time.Now)
+}
+
+func sessionBreadthMonitor(tracker *breadthTracker, alert AlertSink, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		path := c.Request.URL.Path
+		if !isMediaFilePath(path) || c.Writer.Status() >= http.StatusBadRequest || isInternalRequest(c) || isScanRequest(c) {
+			return
+		}
+		n, exceeded := tracker.record(sessionKey(c), path, now())
+		if !exceeded {
+			return
+		}
+		a := MediaAlert{
+			Kind:     AlertSessionBreadth,
+			ClientIP: c.ClientIP(),
+			Username: getUserName(c),
+			Path:     path,
+			Count:    n,
+			Window:   tracker.window,
+			Time:     now(),
+		}
+		log.Warnf("media session breadth: %s (%s) accessed about %d distinct files within %s",
+			a.Username, a.ClientIP, n, tracker.window)
+		if alert != nil {
+			alert.Alert(a)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	tracker := newBreadthTracker(0, time.Minute)
+	for _, n := range []int{10, 500, 20000} {
+		var h hyperLogLog
+		for i := 0; i < n; i++ {
+			hash := tracker.hash(fmt.Sprintf("/movies/%d.mp4", i))
+			// 重复的路径不影响估算
+			h.add(hash)
+			h.add(hash)
+		}
+		if got := h.estimate(); math.Abs(float64(got-n)) > float64(n)*0.1+1 {
+			t.Errorf("estimate for %d distinct paths = %d", n, got)
+		}
+	}
+}
+
+func TestSessionBreadthMonitor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	var alerts []MediaAlert
+	r := gin.New()
+	r.Use(sessionBreadthMonitor(newBreadthTracker(20, 10*time.Minute), AlertSinkFunc(func(a MediaAlert) {
+		alerts = append(alerts, a)
+	}), clock.Now))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "video") })
+	serve := func(ip, token, u string) {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 反复观看同一批文件不告警
+	for i := 0; i < 100; i++ {
+		serve("192.0.2.1", "", fmt.Sprintf("/d/movies/%d.mp4", i%10))
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("repeated access should not alert, got %+v", alerts)
+	}
+
+	// 同一个 token 换 IP 仍然算同一个会话，只告警一次
+	for i := 0; i < 40; i++ {
+		serve(fmt.Sprintf("192.0.2.%d", 10+i%2), "token-a", fmt.Sprintf("/d/movies/%d.mp4", i))
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertSessionBreadth || alerts[0].Count <= 20 {
+		t.Fatalf("alerts = %+v", alerts)
+	}
+
+	// 窗口结束后重新计数
+	clock.Advance(11 * time.Minute)
+	for i := 0; i < 15; i++ {
+		serve("192.0.2.10", "token-a", fmt.Sprintf("/d/shows/%d.mp4", i))
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("new window should start from zero, got %d alerts", len(alerts))
+	}
+}
@@ -0,0 +1,206 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	authFailureWindow = 5 * time.Minute
+	// maxFailures、blockDuration 不是正数时使用的默认值
+	authDefaultMaxFailures = 5
+	authDefaultBlockFor    = 15 * time.Minute
+	// 只需要读取错误响应中的 code 字段，不缓存更多内容
+	authFailureCaptureSize = 1024
+)
+
+// authFailureWriter 在响应为 JSON 时保存开头的一小段内容，用于判断是否为认证失败
+// OpenList 的 API 错误使用 HTTP 200 加 JSON code 返回，媒体文件本身不会被缓存
+type authFailureWriter struct {
+	gin.ResponseWriter
+	head bytes.Buffer
+}
+
+func (w *authFailureWriter) capture(data []byte) {
+	if rest := authFailureCaptureSize - w.head.Len(); rest > 0 &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.head.Write(data[:min(len(data), rest)])
+	}
+}
+
+func (w *authFailureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *authFailureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *authFailureWriter) unauthorized() bool {
+	if w.Status() == http.StatusUnauthorized {
+		return true
+	}
+	var resp struct {
+		Code int `json:"code"`
+	}
+	return json.Unmarshal(w.head.Bytes(), &resp) == nil && resp.Code == http.StatusUnauthorized
+}
+
+type authFailureTracker struct {
+	mu           sync.Mutex
+	maxFailures  int
+	blockFor     time.Duration
+	failures     map[string][]time.Time
+	blockedUntil map[string]time.Time
+}
+
+// blocked 判断 ip 是否处于封禁期，封禁到期时解除并记录日志
+func (t *authFailureTracker) blocked(ip string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.blockedUntil[ip]
+	if !ok {
+		return false
+	}
+	if now.Before(until) {
+		return true
+	}
+	delete(t.blockedUntil, ip)
+	log.Infof("media auth brute force: unblocked %s", ip)
+	return false
+}
+
+// recordFailure 记录一次认证失败，5 分钟内达到 maxFailures 次时封禁该 IP
+func (t *authFailureTracker) recordFailure(ip string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	recent := pruneBefore(t.failures[ip], now.Add(-authFailureWindow))
+	recent = append(recent, now)
+	if len(recent) < t.maxFailures {
+		t.failures[ip] = recent
+		return
+	}
+	delete(t.failures, ip)
+	until := now.Add(t.blockFor)
+	t.blockedUntil[ip] = until
+	log.Warnf("media auth brute force: blocked %s after %d failed attempts, unblock at %s",
+		ip, len(recent), until.Format(time.DateTime))
+}
+
+// sweep 清理过期的失败记录和封禁，避免长期运行时占用内存
+func (t *authFailureTracker) sweep(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ip, times := range t.failures {
+		if recent := pruneBefore(times, now.Add(-authFailureWindow)); len(recent) > 0 {
+			t.failures[ip] = recent
+		} else {
+			delete(t.failures, ip)
+		}
+	}
+	for ip, until := range t.blockedUntil {
+		if !now.Before(until) {
+			delete(t.blockedUntil, ip)
+			log.Infof("media auth brute force: unblocked %s", ip)
+		}
+	}
+}
+
+// pruneBefore 去掉 times 中早于 cutoff 的时间，times 按时间升序排列
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// MediaAuthBruteForceMiddleware 统计同一 IP 访问媒体路径时的认证失败（401），
+// 5 分钟内达到 maxFailures 次后封禁 blockDuration，封禁期间的请求直接返回 403；
+// maxFailures 不是正数时为 5 次，blockDuration 不是正数时为 15 分钟
+// 清理过期记录的后台任务在服务器退出时由 CloseMediaMiddlewares 停止
+func MediaAuthBruteForceMiddleware(maxFailures int, blockDuration time.Duration) gin.HandlerFunc {
+	guard := NewMediaAuthBruteForce(maxFailures, blockDuration)
+	closeOnShutdown(guard)
+	return guard.Middleware()
+}
+
+// MediaAuthBruteForce 按 IP 统计认证失败并封禁，后台每分钟清理一次过期的记录，Close 停止清理
+type MediaAuthBruteForce struct {
+	tracker *authFailureTracker
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewMediaAuthBruteForce 创建封禁器，参数与 MediaAuthBruteForceMiddleware 相同
+func NewMediaAuthBruteForce(maxFailures int, blockDuration time.Duration) *MediaAuthBruteForce {
+	if maxFailures <= 0 {
+		maxFailures = authDefaultMaxFailures
+	}
+	if blockDuration <= 0 {
+		blockDuration = authDefaultBlockFor
+	}
+	b := &MediaAuthBruteForce{
+		tracker: &authFailureTracker{
+			maxFailures:  maxFailures,
+			blockFor:     blockDuration,
+			failures:     make(map[string][]time.Time),
+			blockedUntil: make(map[string]time.Time),
+		},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(b.stopped)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				b.tracker.sweep(now)
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// Close 停止后台清理，可以重复调用，之后中间件仍然可以使用
+func (b *MediaAuthBruteForce) Close() error {
+	b.once.Do(func() { close(b.done) })
+	<-b.stopped
+	return nil
+}
+
+// Middleware 返回封禁中间件
+func (b *MediaAuthBruteForce) Middleware() gin.HandlerFunc {
+	tracker := b.tracker
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) || isInternalRequest(c) {
+			c.Next()
+			return
+		}
+		ip := c.ClientIP()
+		if tracker.blocked(ip, time.Now()) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		w := &authFailureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.unauthorized() {
+			tracker.recordFailure(ip, time.Now())
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMediaAuthBruteForceMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	guard := NewMediaAuthBruteForce(3, 50*time.Millisecond)
+	defer guard.Close()
+	r := gin.New()
+	r.Use(guard.Middleware())
+	r.GET("/d/*path", func(c *gin.Context) {
+		if c.Query("sign") == "ok" {
+			c.Data(http.StatusOK, "video/mp4", []byte("data"))
+			return
+		}
+		// 与 common.ErrorResp 相同，错误以 HTTP 200 加 JSON code 返回
+		c.JSON(http.StatusOK, gin.H{"code": 401, "message": "sign mismatch"})
+	})
+	get := func(target string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := get("/d/movie.mp4?sign=bad"); code != http.StatusOK {
+			t.Fatalf("attempt %d: status %d before block", i, code)
+		}
+	}
+	if code := get("/d/movie.mp4?sign=ok"); code != http.StatusForbidden {
+		t.Fatalf("blocked ip got status %d, want 403", code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if code := get("/d/movie.mp4?sign=ok"); code != http.StatusOK {
+		t.Fatalf("after block expired got status %d, want 200", code)
+	}
+}
+
+func TestMediaAuthBruteForceDefaults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// maxFailures 为 0 时不会在第一次失败后就封禁
+	guard := NewMediaAuthBruteForce(0, 0)
+	if guard.tracker.maxFailures != authDefaultMaxFailures || guard.tracker.blockFor != authDefaultBlockFor {
+		t.Fatalf("maxFailures = %d, blockFor = %s", guard.tracker.maxFailures, guard.tracker.blockFor)
+	}
+	r := gin.New()
+	r.Use(guard.Middleware())
+	r.GET("/d/*path", func(c *gin.Context) { c.Status(http.StatusUnauthorized) })
+	for i := 0; i < authDefaultMaxFailures; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movie.mp4", nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d", i, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movie.mp4", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status after %d failures = %d, want 403", authDefaultMaxFailures, w.Code)
+	}
+
+	if err := guard.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = guard.Close()
+}
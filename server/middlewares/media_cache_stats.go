@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 汇总日志中列出的命中率最低的路径数
+	cacheColdPathsLimit = 5
+	// interval 不是正数时输出汇总的间隔
+	cacheDefaultSummaryInterval = time.Minute
+)
+
+type cacheCounters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheEfficiencyTracker 根据上游返回的 X-Cache / CF-Cache-Status 头统计 CDN 缓存命中情况，
+// 按路径前缀（挂载目录）分别计数，并定期输出汇总日志
+type CacheEfficiencyTracker struct {
+	// 路径前缀 -> *cacheCounters
+	counters sync.Map
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewCacheEfficiencyTracker 创建统计器，并在后台每隔 interval 输出一次汇总，interval 不是正数时每分钟输出一次，例如
+//
+//	tracker := middlewares.NewCacheEfficiencyTracker(time.Minute)
+//	defer tracker.Close()
+//	r.Use(tracker.Handler())
+func NewCacheEfficiencyTracker(interval time.Duration) *CacheEfficiencyTracker {
+	if interval <= 0 {
+		interval = cacheDefaultSummaryInterval
+	}
+	t := &CacheEfficiencyTracker{done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(t.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.logSummary()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// Close 停止输出汇总，可以重复调用，之后仍然可以通过 Summary 读取统计
+func (t *CacheEfficiencyTracker) Close() error {
+	t.once.Do(func() { close(t.done) })
+	<-t.stopped
+	return nil
+}
+
+// Handler 返回在请求处理完成后读取缓存状态头的中间件，没有缓存状态或状态无法判断的请求不计数
+func (t *CacheEfficiencyTracker) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		hit, ok := upstreamCacheHit(c.Writer.Header())
+		if !ok {
+			return
+		}
+		v, _ := t.counters.LoadOrStore(cachePathPrefix(c.Request.URL.Path), new(cacheCounters))
+		if hit {
+			v.(*cacheCounters).hits.Add(1)
+		} else {
+			v.(*cacheCounters).misses.Add(1)
+		}
+	}
+}
+
+// upstreamCacheHit 解析缓存状态，第二个返回值为 false 表示没有缓存状态或不是命中/未命中（例如 DYNAMIC、BYPASS）
+func upstreamCacheHit(h http.Header) (hit bool, ok bool) {
+	status := h.Get("CF-Cache-Status")
+	if status == "" {
+		status = h.Get("X-Cache")
+	}
+	status = strings.ToUpper(status)
+	switch {
+	case status == "":
+		return false, false
+	case strings.Contains(status, "HIT"), status == "STALE", status == "REVALIDATED", status == "UPDATING":
+		return true, true
+	case strings.Contains(status, "MISS"), status == "EXPIRED":
+		return false, true
+	}
+	return false, false
+}
+
+// cachePathPrefix 去掉 /d、/p 等路由前缀后取第一级目录，例如 /d/movies/a.mp4 返回 /movies
+func cachePathPrefix(p string) string {
+	return firstPathSegment(mediaVirtualPath(p))
+}
+
+// CacheColdPath 是一个路径前缀的缓存统计
+type CacheColdPath struct {
+	Path    string  `json:"path"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// CacheEfficiencySummary 是所有路径的缓存统计汇总，ColdPaths 按未命中次数从多到少排列
+type CacheEfficiencySummary struct {
+	HitRate       float64         `json:"hit_rate"`
+	TotalRequests int64           `json:"total_requests"`
+	ColdPaths     []CacheColdPath `json:"top_5_cold_paths"`
+}
+
+// Summary 返回当前的统计汇总
+func (t *CacheEfficiencyTracker) Summary() CacheEfficiencySummary {
+	var s CacheEfficiencySummary
+	var hits int64
+	t.counters.Range(func(k, v any) bool {
+		counters := v.(*cacheCounters)
+		h, m := counters.hits.Load(), counters.misses.Load()
+		hits += h
+		s.TotalRequests += h + m
+		if m > 0 {
+			s.ColdPaths = append(s.ColdPaths, CacheColdPath{Path: k.(string), Misses: m, HitRate: float64(h) / float64(h+m)})
+		}
+		return true
+	})
+	if s.TotalRequests > 0 {
+		s.HitRate = float64(hits) / float64(s.TotalRequests)
+	}
+	sort.Slice(s.ColdPaths, func(i, j int) bool {
+		if s.ColdPaths[i].Misses != s.ColdPaths[j].Misses {
+			return s.ColdPaths[i].Misses > s.ColdPaths[j].Misses
+		}
+		return s.ColdPaths[i].Path < s.ColdPaths[j].Path
+	})
+	if len(s.ColdPaths) > cacheColdPathsLimit {
+		s.ColdPaths = s.ColdPaths[:cacheColdPathsLimit]
+	}
+	return s
+}
+
+// ResetStats 清空所有计数，主要用于测试
+func (t *CacheEfficiencyTracker) ResetStats() {
+	t.counters.Range(func(k, _ any) bool {
+		t.counters.Delete(k)
+		return true
+	})
+}
+
+func (t *CacheEfficiencyTracker) logSummary() {
+	s := t.Summary()
+	if s.TotalRequests == 0 {
+		return
+	}
+	log.WithFields(log.Fields{
+		"hit_rate":         s.HitRate,
+		"total_requests":   s.TotalRequests,
+		"top_5_cold_paths": s.ColdPaths,
+	}).Info("media upstream cache efficiency")
+}
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpstreamCacheHit(t *testing.T) {
+	cases := []struct {
+		header, value string
+		hit, ok       bool
+	}{
+		{"CF-Cache-Status", "HIT", true, true},
+		{"CF-Cache-Status", "MISS", false, true},
+		{"CF-Cache-Status", "EXPIRED", false, true},
+		{"CF-Cache-Status", "DYNAMIC", false, false},
+		{"X-Cache", "Hit from cloudfront", true, true},
+		{"X-Cache", "Miss from cloudfront", false, true},
+		{"X-Cache", "TCP_HIT", true, true},
+		{"X-Other", "HIT", false, false},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		h.Set(tc.header, tc.value)
+		if hit, ok := upstreamCacheHit(h); hit != tc.hit || ok != tc.ok {
+			t.Errorf("%s: %s = %v, %v, want %v, %v", tc.header, tc.value, hit, ok, tc.hit, tc.ok)
+		}
+	}
+}
+
+func TestCacheEfficiencyTracker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker := NewCacheEfficiencyTracker(time.Hour)
+	defer tracker.Close()
+	r := gin.New()
+	r.Use(tracker.Handler())
+	r.GET("/d/*path", func(c *gin.Context) {
+		c.Header("CF-Cache-Status", c.Query("cache"))
+		c.Status(http.StatusOK)
+	})
+	requests := []string{
+		"/d/movies/a.mp4?cache=HIT",
+		"/d/movies/b.mp4?cache=MISS",
+		"/d/movies/c.mp4?cache=HIT",
+		"/d/photos/a.jpg?cache=MISS",
+		"/d/photos/b.jpg?cache=MISS",
+		"/d/music/a.mp3?cache=DYNAMIC",
+	}
+	for _, u := range requests {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+	}
+
+	s := tracker.Summary()
+	if s.TotalRequests != 5 || s.HitRate != 0.4 {
+		t.Fatalf("total %d hit rate %v, want 5 and 0.4", s.TotalRequests, s.HitRate)
+	}
+	if len(s.ColdPaths) != 2 || s.ColdPaths[0].Path != "/photos" || s.ColdPaths[0].Misses != 2 || s.ColdPaths[1].Path != "/movies" {
+		t.Fatalf("unexpected cold paths %+v", s.ColdPaths)
+	}
+
+	tracker.ResetStats()
+	if s := tracker.Summary(); s.TotalRequests != 0 || len(s.ColdPaths) != 0 {
+		t.Fatalf("stats not reset: %+v", s)
+	}
+}
+
+func TestCacheEfficiencyTrackerClose(t *testing.T) {
+	// interval 不是正数时使用默认值，不会 panic
+	tracker := NewCacheEfficiencyTracker(0)
+	done := make(chan struct{})
+	go func() {
+		_ = tracker.Close()
+		_ = tracker.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the summary goroutine")
+	}
+}
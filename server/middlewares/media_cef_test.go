@@ -0,0 +1,114 @@
+package middlewares
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// splitCEFHeader 按未转义的 | 拆分 CEF 行，返回头部的 7 个字段和扩展部分
+func splitCEFHeader(t *testing.T, line string) []string {
+	t.Helper()
+	var fields []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			cur.WriteByte(line[i+1])
+			i++
+		case line[i] == '|' && len(fields) < 7:
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	fields = append(fields, cur.String())
+	if len(fields) != 8 {
+		t.Fatalf("line %q has %d fields", line, len(fields))
+	}
+	return fields
+}
+
+func TestFormatCEF(t *testing.T) {
+	oldVersion := conf.Version
+	conf.Version = "v4.0.0|beta"
+	defer func() { conf.Version = oldVersion }()
+
+	size := int64(1048576)
+	ev := &AccessEvent{
+		Event: EventAccess, Time: time.UnixMilli(1752304236000),
+		ClientIP: "203.0.113.7", Username: "alice", Method: "GET",
+		Path: `/movies/a|b\c=d.mp4`, Bytes: &size,
+	}
+	line := formatCEF(ev)
+	want := `CEF:0|OpenList|MediaLogger|v4.0.0\|beta|access|Media access a\|b\\c=d.mp4|3|` +
+		`rt=1752304236000 src=203.0.113.7 suser=alice requestMethod=GET request=/movies/a%7Cb%5Cc\=d.mp4 filePath=/movies/a|b\\c\=d.mp4 out=1048576`
+	if line != want {
+		t.Fatalf("formatCEF:\n%s\nwant:\n%s", line, want)
+	}
+	fields := splitCEFHeader(t, line)
+	if fields[3] != "v4.0.0|beta" || fields[5] != `Media access a|b\c=d.mp4` || fields[6] != "3" {
+		t.Fatalf("header fields %q", fields)
+	}
+}
+
+func TestFormatCEFHostileFilenames(t *testing.T) {
+	for _, name := range []string{
+		"a|b.mp4",
+		`a\|b.mp4`,
+		`trailing\`,
+		"line\nbreak|CEF:0|fake|header|.mp4",
+		"x=y\r\nz.mkv",
+	} {
+		ev := &AccessEvent{Event: EventDenied, ClientIP: "192.0.2.1", Username: "未知用户", Path: "/movies/" + name}
+		line := formatCEF(ev)
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("%q: line spans multiple lines: %q", name, line)
+			continue
+		}
+		fields := splitCEFHeader(t, line)
+		if fields[4] != EventDenied || fields[6] != "8" {
+			t.Errorf("%q: header fields %q", name, fields)
+		}
+		if !strings.HasPrefix(fields[5], "Media access denied ") {
+			t.Errorf("%q: name %q", name, fields[5])
+		}
+		if strings.Contains(line, "suser=") || strings.Contains(line, "out=") {
+			t.Errorf("%q: unexpected extension in %q", name, line)
+		}
+	}
+}
+
+func TestFormatCEFSeverity(t *testing.T) {
+	cases := map[string]string{
+		EventAccess:  "3",
+		EventProbe:   "3",
+		EventDelete:  "5",
+		EventRename:  "5",
+		EventDenied:  "8",
+		EventAnomaly: "8",
+	}
+	for event, want := range cases {
+		fields := splitCEFHeader(t, formatCEF(&AccessEvent{Event: event, Path: "/a.mp4"}))
+		if fields[6] != want {
+			t.Errorf("%s: severity %s, want %s", event, fields[6], want)
+		}
+	}
+}
+
+func TestCEFLogSink(t *testing.T) {
+	var b strings.Builder
+	sink := CEFLogSink(&b)
+	for _, p := range []string{"/a.mp4", "/b.mkv"} {
+		if err := sink.Write(&AccessEvent{Event: EventAccess, Path: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "CEF:0|OpenList|MediaLogger|") || !strings.HasSuffix(lines[1], "filePath=/b.mkv") {
+		t.Fatalf("sink output %q", b.String())
+	}
+}
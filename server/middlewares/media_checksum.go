@@ -0,0 +1,163 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io/fs"
+	"net/http"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// checksumSidecarExt 是校验文件的扩展名，内容与 sha256sum 的输出相同，只读取第一个字段
+	checksumSidecarExt = ".sha256"
+	// 严格模式下最多缓存的响应体大小，超过时改为边校验边发送，不一致时只能记录日志
+	checksumStrictMaxBuffer = 64 << 20
+)
+
+type checksumOptions struct {
+	strict    bool
+	maxBuffer int
+}
+
+// ChecksumOption 用于配置 ChecksumVerificationMiddleware
+type ChecksumOption func(o *checksumOptions)
+
+// WithStrictChecksum 在校验不一致时返回 500 而不是损坏的文件
+// 需要先缓存完整的响应体再发送，超过 64MB 的文件仍然边校验边发送，不一致时只记录日志
+func WithStrictChecksum() ChecksumOption {
+	return func(o *checksumOptions) {
+		o.strict = true
+	}
+}
+
+// ChecksumVerificationMiddleware 用预先计算的 SHA-256 校验媒体文件在存储后是否损坏，
+// 校验文件按虚拟路径放在 checksumDir 下，例如 /d/movies/a.mp4 对应 checksumDir/movies/a.mp4.sha256
+// 发送完整文件的 200 响应时计算响应体的哈希，与校验文件不一致时输出 Error 日志；
+// 没有校验文件的文件、Range 请求返回的 206 响应和客户端中途断开没有写完的响应不校验
+func ChecksumVerificationMiddleware(checksumDir string, opts ...ChecksumOption) gin.HandlerFunc {
+	o := &checksumOptions{maxBuffer: checksumStrictMaxBuffer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if c.Request.Method != http.MethodGet || !isMediaFilePath(p) {
+			c.Next()
+			return
+		}
+		expected, err := readChecksumSidecar(checksumDir, mediaVirtualPath(p))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Warnf("media checksum: %s: %+v", p, err)
+			}
+			c.Next()
+			return
+		}
+
+		origin := c.Writer
+		var buffered *contentLengthWriter
+		if o.strict {
+			buffered = &contentLengthWriter{ResponseWriter: origin, limit: o.maxBuffer}
+			c.Writer = buffered
+		}
+		hasher := &responseBodyHasher{ResponseWriter: c.Writer, hash: sha256.New()}
+		c.Writer = hasher
+		c.Next()
+		c.Writer = origin
+
+		if hasher.Status() != http.StatusOK || !hasher.complete() {
+			if buffered != nil {
+				buffered.finish()
+			}
+			return
+		}
+		actual := hex.EncodeToString(hasher.hash.Sum(nil))
+		if actual == expected {
+			if buffered != nil {
+				buffered.finish()
+			}
+			return
+		}
+		log.WithFields(log.Fields{"path": p, "expected": expected, "actual": actual}).
+			Error("media checksum mismatch, the stored file may be corrupted")
+		if buffered == nil || buffered.passthrough {
+			return
+		}
+		// 响应还没有发出，丢弃缓存的内容，改为返回 500
+		buffered.body.Reset()
+		for _, name := range []string{"Content-Length", "Content-Type", "Content-Disposition",
+			"Accept-Ranges", "ETag", "Last-Modified", "Transfer-Encoding"} {
+			origin.Header().Del(name)
+		}
+		origin.WriteHeader(http.StatusInternalServerError)
+		c.Abort()
+	}
+}
+
+// readChecksumSidecar 读取虚拟路径对应的校验文件，返回小写的十六进制 SHA-256
+func readChecksumSidecar(dir, virtualPath string) (string, error) {
+	// Clean 之后的绝对路径不包含 ..，拼接后不会跑到 dir 之外
+	name := filepath.Join(dir, filepath.FromSlash(stdpath.Clean("/"+virtualPath))) + checksumSidecarExt
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum file " + name)
+	}
+	sum := strings.ToLower(fields[0])
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != sha256.Size*2 {
+		return "", errors.New("invalid SHA-256 in " + name)
+	}
+	return sum, nil
+}
+
+// responseBodyHasher 在写给客户端的同时计算响应体的哈希
+type responseBodyHasher struct {
+	gin.ResponseWriter
+	hash hash.Hash
+	// 写入客户端成功的字节数，以及是否出现过写入错误（通常是客户端断开）
+	written int64
+	failed  bool
+}
+
+func (w *responseBodyHasher) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.hash.Write(b[:n])
+	w.written += int64(n)
+	w.failed = w.failed || err != nil
+	return n, err
+}
+
+func (w *responseBodyHasher) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.hash.Write([]byte(s[:n]))
+	w.written += int64(n)
+	w.failed = w.failed || err != nil
+	return n, err
+}
+
+// complete 判断完整的响应体是否都已写出：没有写入错误，并且写出的字节数与 Content-Length 一致；
+// 播放器拖动进度时经常中途断开，这时的哈希只覆盖文件的一部分，不能用来判断文件是否损坏
+func (w *responseBodyHasher) complete() bool {
+	if w.failed {
+		return false
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		return err == nil && n == w.written
+	}
+	return true
+}
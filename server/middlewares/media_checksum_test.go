@@ -0,0 +1,172 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func writeChecksumSidecar(t *testing.T, dir, name, content string) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(content))
+	p := filepath.Join(dir, filepath.FromSlash(name)+checksumSidecarExt)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	line := hex.EncodeToString(sum[:]) + "  " + filepath.Base(name) + "\n"
+	if err := os.WriteFile(p, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newChecksumRouter(dir string, opts ...ChecksumOption) *gin.Engine {
+	r := gin.New()
+	r.Use(ChecksumVerificationMiddleware(dir, opts...))
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/movies/good.mp4", "/movies/bad.mp4", "/movies/none.mp4":
+			c.Header("Content-Length", "8")
+			c.Data(http.StatusOK, "video/mp4", []byte("01234567"))
+		case "/movies/short.mp4":
+			// 上游中途断开，写出的内容少于 Content-Length
+			c.Header("Content-Length", "8")
+			c.Data(http.StatusOK, "video/mp4", []byte("0123"))
+		case "/movies/partial.mp4":
+			c.Data(http.StatusPartialContent, "video/mp4", []byte("0123"))
+		}
+	})
+	return r
+}
+
+func TestChecksumVerificationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	dir := t.TempDir()
+	writeChecksumSidecar(t, dir, "movies/good.mp4", "01234567")
+	writeChecksumSidecar(t, dir, "movies/bad.mp4", "01234568")
+	writeChecksumSidecar(t, dir, "movies/partial.mp4", "01234567")
+	writeChecksumSidecar(t, dir, "movies/short.mp4", "01234567")
+
+	for name, strict := range map[string]bool{"lenient": false, "strict": true} {
+		var opts []ChecksumOption
+		if strict {
+			opts = append(opts, WithStrictChecksum())
+		}
+		r := newChecksumRouter(dir, opts...)
+		cases := []struct {
+			path     string
+			status   int
+			body     string
+			mismatch bool
+		}{
+			{"/d/movies/good.mp4", http.StatusOK, "01234567", false},
+			{"/d/movies/none.mp4", http.StatusOK, "01234567", false},
+			{"/d/movies/partial.mp4", http.StatusPartialContent, "0123", false},
+			{"/d/movies/short.mp4", http.StatusOK, "0123", false},
+			{"/d/movies/bad.mp4", http.StatusOK, "01234567", true},
+		}
+		for _, tc := range cases {
+			hook.Reset()
+			if strict && tc.mismatch {
+				tc.status, tc.body = http.StatusInternalServerError, ""
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if w.Code != tc.status || w.Body.String() != tc.body {
+				t.Errorf("%s %s: got %d %q, want %d %q", name, tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+			}
+			entry := hook.LastEntry()
+			if got := entry != nil && entry.Level == log.ErrorLevel; got != tc.mismatch {
+				t.Errorf("%s %s: error logged = %v, want %v", name, tc.path, got, tc.mismatch)
+			}
+			if tc.mismatch && entry != nil && (entry.Data["expected"] == entry.Data["actual"] || entry.Data["path"] != tc.path) {
+				t.Errorf("%s %s: log fields %v", name, tc.path, entry.Data)
+			}
+		}
+	}
+}
+
+// abortingWriter 模拟客户端中途断开，写入 limit 字节之后返回错误
+type abortingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (w *abortingWriter) Write(b []byte) (int, error) {
+	n := min(len(b), w.limit-w.Body.Len())
+	w.ResponseRecorder.Write(b[:n])
+	if n < len(b) {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, nil
+}
+
+func TestChecksumClientAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	dir := t.TempDir()
+	writeChecksumSidecar(t, dir, "movies/good.mp4", "01234567")
+
+	w := &abortingWriter{ResponseRecorder: httptest.NewRecorder(), limit: 4}
+	newChecksumRouter(dir).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movies/good.mp4", nil))
+	if w.Body.String() != "0123" {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level <= log.ErrorLevel {
+			t.Fatalf("aborted download was reported: %s %v", entry.Message, entry.Data)
+		}
+	}
+}
+
+func TestChecksumStrictLargeResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	dir := t.TempDir()
+	writeChecksumSidecar(t, dir, "movies/bad.mp4", "other")
+
+	// 超过缓存上限时已经发出了响应，只能记录日志
+	r := newChecksumRouter(dir, WithStrictChecksum(), func(o *checksumOptions) { o.maxBuffer = 4 })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movies/bad.mp4", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "01234567" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != log.ErrorLevel {
+		t.Fatalf("mismatch was not logged: %+v", entry)
+	}
+}
+
+func TestReadChecksumSidecar(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "secret.mp4.sha256")
+	sub := filepath.Join(dir, "sums")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outside, []byte("00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 路径中的 .. 不能读取 checksumDir 之外的文件
+	if _, err := readChecksumSidecar(sub, "/../secret.mp4"); !os.IsNotExist(err) {
+		t.Fatalf("traversal: err = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "a.mp4.sha256"), []byte("not-a-hash a.mp4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readChecksumSidecar(sub, "/a.mp4"); err == nil {
+		t.Fatal("invalid checksum accepted")
+	}
+}
@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 媒体日志文件的输出格式
+const (
+	// MediaFileFormatText 为默认的中文文本格式，与控制台输出相同
+	MediaFileFormatText = "text"
+	// MediaFileFormatCombined 为 Apache/NCSA combined 格式，可以直接交给 GoAccess 等工具分析，
+	// 只写入普通的访问事件，审计事件不写入
+	MediaFileFormatCombined = "combined"
+	// MediaFileFormatNginx 与 nginx 默认的 combined log_format 相同，转义方式也与 nginx 一致，
+	// 可以直接交给解析 nginx 日志的工具，同样只写入普通的访问事件
+	MediaFileFormatNginx = "nginx"
+)
+
+// combinedTimeLayout 是 combined 格式中的时间，例如 [12/Jul/2025:15:10:36 +0800]
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// formatCombinedLog 把事件格式化为 NCSA combined 格式：
+//
+//	ip ident user [time] "METHOD path HTTP/1.1" status bytes "referer" "user-agent"
+//
+// 没有的字段按惯例写为 -，ident 和 referer 始终为 -；路径按 URL 编码，避免空格和引号破坏字段
+func formatCombinedLog(ev *AccessEvent) string {
+	method := ev.Method
+	if method == "" {
+		method = "-"
+	}
+	status := "-"
+	if ev.Status > 0 {
+		status = strconv.Itoa(ev.Status)
+	}
+	// 与 Apache 的 %b 相同，没有传输数据时为 -
+	bytes := "-"
+	if ev.BytesServed != nil && *ev.BytesServed > 0 {
+		bytes = strconv.FormatInt(*ev.BytesServed, 10)
+	}
+	user := ev.Username
+	if user == "未知用户" {
+		user = ""
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s HTTP/1.1" %s %s "-" "%s"`,
+		combinedField(ev.ClientIP),
+		combinedField(user),
+		ev.Time.Format(combinedTimeLayout),
+		method,
+		(&url.URL{Path: ev.Path}).EscapedPath(),
+		status,
+		bytes,
+		escapeCombined(ev.UserAgent))
+}
+
+// combinedField 返回不带引号的字段，为空时返回 -，空格也会转义，避免被当作字段分隔
+func combinedField(s string) string {
+	return escapeCombinedValue(s, true)
+}
+
+// escapeCombined 返回引号中的字段，按 Apache 的方式转义引号、反斜杠和控制字符，为空时返回 -
+func escapeCombined(s string) string {
+	return escapeCombinedValue(s, false)
+}
+
+func escapeCombinedValue(s string, escapeSpace bool) string {
+	if s == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f || (c == ' ' && escapeSpace):
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// formatNginxLog 按 nginx 默认的 log_format combined 格式化事件：
+//
+//	$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"
+//
+// 与 nginx 相同，变量为空时写为 -，没有传输数据时 $body_bytes_sent 为 0，没有状态码时 $status 为 000，
+// 每个变量中的引号、反斜杠、控制字符和非 ASCII 字节都转义为 \xHH
+func formatNginxLog(ev *AccessEvent) string {
+	method := ev.Method
+	if method == "" {
+		method = "-"
+	}
+	var bytes int64
+	if ev.BytesServed != nil {
+		bytes = *ev.BytesServed
+	}
+	user := ev.Username
+	if user == "未知用户" {
+		user = ""
+	}
+	request := method + " " + (&url.URL{Path: ev.Path}).EscapedPath() + " HTTP/1.1"
+	return fmt.Sprintf(`%s - %s [%s] "%s" %03d %d "-" "%s"`,
+		escapeNginx(ev.ClientIP),
+		escapeNginx(user),
+		ev.Time.Format(combinedTimeLayout),
+		escapeNginx(request),
+		ev.Status,
+		bytes,
+		escapeNginx(ev.UserAgent))
+}
+
+// escapeNginx 与 nginx 的 escape=default 相同：引号、反斜杠、小于空格和大于等于 0x7f 的字节写为 \xHH（大写），
+// 为空时返回 -
+func escapeNginx(s string) string {
+	if s == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < ' ' || c >= 0x7f {
+			fmt.Fprintf(&b, "\\x%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestCombinedLogGolden(t *testing.T) {
+	checkFileFormatGolden(t, MediaFileFormatCombined, "media_combined.golden")
+}
+
+func TestNginxLogGolden(t *testing.T) {
+	checkFileFormatGolden(t, MediaFileFormatNginx, "media_nginx.golden")
+}
+
+func TestMediaFileLoggerUnknownFormat(t *testing.T) {
+	logger := NewMediaFileLogger(conf.LogConfig{Name: filepath.Join(t.TempDir(), "media.log")})
+	defer logger.Close()
+	if err := logger.SetFormat("xml"); err == nil {
+		t.Fatal("unknown format should be rejected")
+	}
+}
+
+// checkFileFormatGolden 以 format 格式写入同一组事件，与 testdata 中的 golden 文件比较，
+// 使用 go test -run Golden -update 更新 golden 文件
+func checkFileFormatGolden(t *testing.T, format, goldenName string) {
+	t.Helper()
+	logName := filepath.Join(t.TempDir(), "media.log")
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	defer logger.Close()
+	if err := logger.SetFormat(format); err != nil {
+		t.Fatal(err)
+	}
+
+	cst := time.FixedZone("CST", 8*3600)
+	est := time.FixedZone("EST", -5*3600)
+	served := func(n int64) *int64 { return &n }
+	events := []*AccessEvent{
+		{
+			Event: EventAccess, Time: time.Date(2025, 7, 12, 15, 10, 36, 0, cst),
+			ClientIP: "203.0.113.7", Username: "alice", Method: "GET", Path: "/movies/a.mp4",
+			Status: 206, BytesServed: served(1048576),
+			UserAgent: "Mozilla/5.0 (X11; Linux x86_64) VLC/3.0.20",
+		},
+		// 路径中的空格和中文按 URL 编码，用户名中的空格、中文和 User-Agent 中的引号转义
+		{
+			Event: EventRedirectDownload, Time: time.Date(2025, 1, 2, 3, 4, 5, 0, est),
+			ClientIP: "2001:db8::1", Username: "bob 史密斯", Method: "GET", Path: "/电影/my movie.mkv",
+			Status: 302, UserAgent: `curl/8.0 "test" C:\tmp`,
+		},
+		// 没有的字段写为 -
+		{
+			Event: EventProbe, Time: time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC),
+			ClientIP: "192.0.2.1", Username: "未知用户", Method: "HEAD", Path: "/music/b.flac",
+			Status: 200, BytesServed: served(0),
+		},
+		{
+			Event: EventAccess, Time: time.Date(2025, 7, 12, 15, 10, 36, 0, cst),
+			Path: "/movies/hook.mkv",
+		},
+		// 审计事件不写入 combined 格式的文件
+		{
+			Event: EventDelete, Time: time.Date(2025, 7, 12, 15, 10, 36, 0, cst),
+			ClientIP: "203.0.113.7", Username: "admin", Path: "/movies/a.mp4",
+		},
+	}
+	for _, ev := range events {
+		if err := logger.writeEntry(ev, formatMediaLog(ev)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := os.ReadFile(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", goldenName)
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("%s log mismatch\ngot:\n%s\nwant:\n%s", format, got, want)
+	}
+}
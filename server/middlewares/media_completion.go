@@ -0,0 +1,323 @@
+package middlewares
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 播放会话按传输的字节覆盖了文件的多少分类
+const (
+	CompletionSampled   = "sampled"
+	CompletionPartial   = "partial"
+	CompletionCompleted = "completed"
+)
+
+const (
+	// 同一个文件超过这个时间没有新的请求时视为播放结束
+	playbackIdleTimeout = 30 * time.Minute
+	// 同时跟踪的播放会话和记住的文件大小的上限
+	playbackMaxSessions = 10000
+	playbackMaxSizes    = 10000
+	// 每个会话最多保存的不相连区间数，反复拖动进度超过之后新的区间不再计入
+	playbackMaxIntervals = 1024
+	// 检查结束的会话的间隔
+	playbackSweepInterval = time.Minute
+)
+
+// byteInterval 是 [start, end) 的字节区间
+type byteInterval struct {
+	start, end int64
+}
+
+// byteCoverage 记录已经传输的字节区间，区间按 start 排序，互不重叠也不相连，
+// 重复传输的部分只计算一次
+type byteCoverage struct {
+	intervals []byteInterval
+}
+
+// add 加入 [start, end)，与已有的区间重叠或相连时合并
+func (c *byteCoverage) add(start, end int64) {
+	if start < 0 {
+		start = 0
+	}
+	if end <= start {
+		return
+	}
+	// 第一个 end 不小于 start 的区间，之前的区间都在新区间左侧且不相连
+	i := sort.Search(len(c.intervals), func(i int) bool { return c.intervals[i].end >= start })
+	j := i
+	for j < len(c.intervals) && c.intervals[j].start <= end {
+		start = min(start, c.intervals[j].start)
+		end = max(end, c.intervals[j].end)
+		j++
+	}
+	if i == j {
+		if len(c.intervals) >= playbackMaxIntervals {
+			return
+		}
+		c.intervals = append(c.intervals, byteInterval{})
+		copy(c.intervals[i+1:], c.intervals[i:])
+		c.intervals[i] = byteInterval{start, end}
+		return
+	}
+	c.intervals[i] = byteInterval{start, end}
+	c.intervals = append(c.intervals[:i+1], c.intervals[j:]...)
+}
+
+// covered 返回已经传输的字节数，limit > 0 时不计算 limit 之后的部分
+func (c *byteCoverage) covered(limit int64) int64 {
+	var n int64
+	for _, iv := range c.intervals {
+		end := iv.end
+		if limit > 0 {
+			end = min(end, limit)
+		}
+		if end > iv.start {
+			n += end - iv.start
+		}
+	}
+	return n
+}
+
+// classifyCompletion 按覆盖比例分类，sampledBelow 和 completedAt 为百分比
+func classifyCompletion(fraction float64, sampledBelow, completedAt int) string {
+	switch {
+	case fraction*100 >= float64(completedAt):
+		return CompletionCompleted
+	case fraction*100 < float64(sampledBelow):
+		return CompletionSampled
+	}
+	return CompletionPartial
+}
+
+type playbackKey struct {
+	user string
+	ip   string
+	path string
+}
+
+type playbackSession struct {
+	o        *mediaLoggerOptions
+	first    *AccessEvent
+	coverage byteCoverage
+	size     int64
+	last     time.Time
+}
+
+// playbackTracker 把同一用户、IP 对同一个文件的请求合并为播放会话，
+// 会话结束时按传输的字节覆盖了文件的比例输出一条 playback_session 事件
+type playbackTracker struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	sessions map[playbackKey]*playbackSession
+	// /api/fs/get 返回的文件大小，按虚拟路径保存，Range 响应中没有总大小时使用
+	sizes map[string]int64
+	// 结束的会话通过 flush 输出，为空时使用 writeMediaAccess（writeMediaAccess 引用了 mediaPlayback，不能在初始化时设置）
+	flush     func(o *mediaLoggerOptions, ev *AccessEvent)
+	sweepOnce sync.Once
+
+	sampled   atomic.Int64
+	partial   atomic.Int64
+	completed atomic.Int64
+}
+
+func newPlaybackTracker(now func() time.Time) *playbackTracker {
+	return &playbackTracker{
+		now:      now,
+		sessions: make(map[playbackKey]*playbackSession),
+		sizes:    make(map[string]int64),
+	}
+}
+
+var mediaPlayback = newPlaybackTracker(time.Now)
+
+// transferredRange 返回一次请求传输的字节区间和响应中的文件总大小，无法确定区间时 ok 为 false
+// 206 响应取 RangeCaptureMiddleware 记录的 Content-Range，连接中断时按实际传输的字节数截短；
+// 200 响应从文件开头传输
+func transferredRange(ev *AccessEvent) (start, end, size int64, ok bool) {
+	if ev.BytesServed == nil {
+		return 0, 0, 0, false
+	}
+	served := *ev.BytesServed
+	switch ev.Status {
+	case http.StatusOK:
+		return 0, served, 0, true
+	case http.StatusPartialContent:
+		r, found := strings.CutPrefix(ev.RequestedRange, "bytes ")
+		if !found {
+			return 0, 0, 0, false
+		}
+		span, total, _ := strings.Cut(r, "/")
+		size, _ = strconv.ParseInt(total, 10, 64)
+		first, last, found := strings.Cut(span, "-")
+		start, err1 := strconv.ParseInt(first, 10, 64)
+		stop, err2 := strconv.ParseInt(last, 10, 64)
+		if !found || err1 != nil || err2 != nil {
+			return 0, 0, 0, false
+		}
+		return start, min(stop+1, start+served), size, true
+	}
+	return 0, 0, 0, false
+}
+
+// observe 统计一条已经输出的事件
+func (t *playbackTracker) observe(o *mediaLoggerOptions, ev *AccessEvent) {
+	if ev.Internal || ev.Traffic != "" {
+		return
+	}
+	if ev.Event == EventAccess && ev.Method == http.MethodPost && ev.Bytes != nil {
+		t.rememberSize(mediaVirtualPath(ev.Path), *ev.Bytes)
+		return
+	}
+	if ev.Event != EventAccess || ev.Method != http.MethodGet {
+		return
+	}
+	start, end, size, ok := transferredRange(ev)
+	if !ok {
+		return
+	}
+	t.sweepOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(playbackSweepInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				t.flushExpired()
+			}
+		}()
+	})
+
+	t.mu.Lock()
+	now := t.now()
+	out := t.expireLocked(now)
+	p := mediaVirtualPath(ev.Path)
+	key := playbackKey{user: ev.Username, ip: ev.ClientIP, path: p}
+	s := t.sessions[key]
+	if s == nil {
+		if len(t.sessions) >= playbackMaxSessions {
+			// 超出上限时提前结束最久没有请求的会话
+			out = append(out, t.removeOldestLocked())
+		}
+		s = &playbackSession{o: o, first: ev}
+		t.sessions[key] = s
+	}
+	if size <= 0 {
+		size = t.sizes[p]
+	}
+	// 200 响应的 Bytes 通常就是传输的字节数，只在没有其他来源时使用
+	if size <= 0 && ev.Status == http.StatusOK && ev.Bytes != nil {
+		size = *ev.Bytes
+	}
+	if size > 0 {
+		s.size = size
+	}
+	s.coverage.add(start, end)
+	s.last = now
+	t.mu.Unlock()
+	t.flushAll(out)
+}
+
+func (t *playbackTracker) rememberSize(p string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.sizes[p]; !ok && len(t.sizes) >= playbackMaxSizes {
+		clear(t.sizes)
+	}
+	t.sizes[p] = size
+}
+
+// forget 丢弃 username 未结束的播放会话，不输出，返回丢弃的会话数
+func (t *playbackTracker) forget(username string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for key := range t.sessions {
+		if key.user == username {
+			delete(t.sessions, key)
+			n++
+		}
+	}
+	return n
+}
+
+// flushExpired 输出所有已经结束的会话
+func (t *playbackTracker) flushExpired() {
+	t.mu.Lock()
+	out := t.expireLocked(t.now())
+	t.mu.Unlock()
+	t.flushAll(out)
+}
+
+func (t *playbackTracker) expireLocked(now time.Time) []*playbackSession {
+	var out []*playbackSession
+	for key, s := range t.sessions {
+		if now.Sub(s.last) >= playbackIdleTimeout {
+			delete(t.sessions, key)
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (t *playbackTracker) removeOldestLocked() *playbackSession {
+	var (
+		oldestKey playbackKey
+		oldest    *playbackSession
+	)
+	for key, s := range t.sessions {
+		if oldest == nil || s.last.Before(oldest.last) {
+			oldestKey, oldest = key, s
+		}
+	}
+	delete(t.sessions, oldestKey)
+	return oldest
+}
+
+// flushAll 在锁外输出，不知道文件大小的会话无法计算比例，不输出
+func (t *playbackTracker) flushAll(sessions []*playbackSession) {
+	flush := t.flush
+	if flush == nil {
+		flush = writeMediaAccess
+	}
+	cfg := mediaLogConf().Completion
+	for _, s := range sessions {
+		if s.size <= 0 {
+			continue
+		}
+		fraction := float64(s.coverage.covered(s.size)) / float64(s.size)
+		completion := classifyCompletion(fraction, cfg.SampledBelow, cfg.CompletedAt)
+		switch completion {
+		case CompletionSampled:
+			t.sampled.Add(1)
+		case CompletionPartial:
+			t.partial.Add(1)
+		case CompletionCompleted:
+			t.completed.Add(1)
+		}
+		flush(s.o, s.summaryEvent(fraction, completion))
+	}
+}
+
+// summaryEvent 生成会话的 playback_session 事件，时间和客户端信息取自会话的第一个请求
+func (s *playbackSession) summaryEvent(fraction float64, completion string) *AccessEvent {
+	first := s.first
+	size, covered := s.size, s.coverage.covered(s.size)
+	return &AccessEvent{
+		Event:       EventPlaybackSession,
+		Time:        first.Time,
+		ClientIP:    first.ClientIP,
+		Username:    first.Username,
+		Method:      first.Method,
+		UserAgent:   first.UserAgent,
+		Path:        first.Path,
+		Status:      first.Status,
+		Bytes:       &size,
+		BytesServed: &covered,
+		Coverage:    fraction,
+		Completion:  completion,
+	}
+}
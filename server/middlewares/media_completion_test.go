@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestByteCoverage(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		ranges    [][2]int64
+		want      []byteInterval
+		wantTotal int64
+	}{
+		{"disjoint", [][2]int64{{50, 60}, {0, 10}, {20, 30}}, []byteInterval{{0, 10}, {20, 30}, {50, 60}}, 30},
+		{"overlap", [][2]int64{{0, 100}, {50, 150}}, []byteInterval{{0, 150}}, 150},
+		{"duplicate", [][2]int64{{10, 20}, {10, 20}, {10, 20}}, []byteInterval{{10, 20}}, 10},
+		{"adjacent", [][2]int64{{0, 10}, {10, 20}}, []byteInterval{{0, 20}}, 20},
+		{"contained", [][2]int64{{0, 100}, {20, 30}}, []byteInterval{{0, 100}}, 100},
+		{"bridge", [][2]int64{{0, 10}, {20, 30}, {40, 50}, {5, 45}}, []byteInterval{{0, 50}}, 50},
+		{"covers all", [][2]int64{{10, 20}, {30, 40}, {0, 100}}, []byteInterval{{0, 100}}, 100},
+		{"empty", [][2]int64{{10, 10}, {20, 5}}, nil, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var c byteCoverage
+			for _, r := range tt.ranges {
+				c.add(r[0], r[1])
+			}
+			if len(c.intervals) != len(tt.want) {
+				t.Fatalf("intervals = %v, want %v", c.intervals, tt.want)
+			}
+			for i := range tt.want {
+				if c.intervals[i] != tt.want[i] {
+					t.Fatalf("intervals = %v, want %v", c.intervals, tt.want)
+				}
+			}
+			if got := c.covered(0); got != tt.wantTotal {
+				t.Fatalf("covered = %d, want %d", got, tt.wantTotal)
+			}
+		})
+	}
+
+	var c byteCoverage
+	c.add(0, 100)
+	c.add(200, 300)
+	if got := c.covered(250); got != 150 {
+		t.Fatalf("covered(250) = %d, want 150", got)
+	}
+}
+
+func TestClassifyCompletion(t *testing.T) {
+	for _, tt := range []struct {
+		fraction float64
+		want     string
+	}{
+		{0, CompletionSampled},
+		{0.099, CompletionSampled},
+		{0.1, CompletionPartial},
+		{0.5, CompletionPartial},
+		{0.9, CompletionCompleted},
+		{1, CompletionCompleted},
+	} {
+		if got := classifyCompletion(tt.fraction, 10, 90); got != tt.want {
+			t.Errorf("classifyCompletion(%v) = %s, want %s", tt.fraction, got, tt.want)
+		}
+	}
+}
+
+func TestPlaybackTracker(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)}
+	tracker := newPlaybackTracker(clock.Now)
+	var out []*AccessEvent
+	tracker.flush = func(_ *mediaLoggerOptions, ev *AccessEvent) { out = append(out, ev) }
+	n := func(v int64) *int64 { return &v }
+	get := func(user, path string, status int, rng string, served int64) *AccessEvent {
+		return &AccessEvent{Event: EventAccess, Method: http.MethodGet, Username: user, ClientIP: "10.0.0.1",
+			Path: path, Status: status, RequestedRange: rng, BytesServed: n(served)}
+	}
+
+	// alice 从头播放到结尾，中间拖回去重新看的部分不重复计算
+	tracker.observe(nil, get("alice", "/d/movies/a.mkv", 206, "bytes 0-4999/10000", 5000))
+	tracker.observe(nil, get("alice", "/d/movies/a.mkv", 206, "bytes 2000-6999/10000", 5000))
+	tracker.observe(nil, get("alice", "/p/movies/a.mkv", 206, "bytes 7000-9999/10000", 3000))
+	// bob 只看了开头，第二个请求中途断开
+	tracker.observe(nil, get("bob", "/d/movies/a.mkv", 206, "bytes 0-499/10000", 500))
+	tracker.observe(nil, get("bob", "/d/movies/a.mkv", 206, "bytes 500-9999/10000", 300))
+	// carol 的 200 响应不带总大小，使用 /api/fs/get 返回的大小
+	tracker.observe(nil, &AccessEvent{Event: EventAccess, Method: http.MethodPost, Path: "/music/b.flac", Status: 200, Bytes: n(4000)})
+	tracker.observe(nil, get("carol", "/d/music/b.flac", 200, "", 2000))
+	// 扫描和未知范围的请求不计入
+	scan := get("dave", "/d/movies/a.mkv", 206, "bytes 0-9999/10000", 10000)
+	scan.Traffic = TrafficScan
+	tracker.observe(nil, scan)
+	tracker.observe(nil, get("erin", "/d/movies/a.mkv", 206, "", 100))
+
+	clock.Advance(playbackIdleTimeout - time.Second)
+	tracker.flushExpired()
+	if len(out) != 0 {
+		t.Fatalf("sessions ended early: %+v", out)
+	}
+	clock.Advance(time.Second)
+	tracker.flushExpired()
+
+	got := make(map[string]*AccessEvent)
+	for _, ev := range out {
+		if ev.Event != EventPlaybackSession {
+			t.Fatalf("event = %s", ev.Event)
+		}
+		got[ev.Username] = ev
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %+v", out)
+	}
+	if a := got["alice"]; a.Completion != CompletionCompleted || a.Coverage != 1 || *a.BytesServed != 10000 || *a.Bytes != 10000 {
+		t.Fatalf("alice = %+v", a)
+	}
+	if b := got["bob"]; b.Completion != CompletionSampled || *b.BytesServed != 800 {
+		t.Fatalf("bob = %+v", b)
+	}
+	if c := got["carol"]; c.Completion != CompletionPartial || c.Coverage != 0.5 || c.Path != "/d/music/b.flac" {
+		t.Fatalf("carol = %+v", c)
+	}
+	if tracker.completed.Load() != 1 || tracker.partial.Load() != 1 || tracker.sampled.Load() != 1 {
+		t.Fatal("unexpected completion counters")
+	}
+
+	tracker.observe(nil, get("alice", "/d/movies/a.mkv", 206, "bytes 0-99/10000", 100))
+	if tracker.forget("alice") != 1 {
+		t.Fatal("session was not forgotten")
+	}
+}
@@ -0,0 +1,148 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 压缩日志按块写入，缓存达到 compressedBlockSize 时压缩并写出一块
+	compressedBlockSize = 64 << 10
+	// 访问量小的时候定时写出，避免日志长时间停留在内存中
+	compressedFlushInterval = 5 * time.Second
+)
+
+// CompressionCodec 是压缩日志使用的编解码器，NewReader 用于读取 NewWriter 写出的数据
+type CompressionCodec interface {
+	NewWriter(w io.Writer) io.WriteCloser
+	NewReader(r io.Reader) io.ReadCloser
+}
+
+// SnappyCodec 使用 snappy 分帧格式，压缩率较低但几乎不占用 CPU
+type SnappyCodec struct{}
+
+func (SnappyCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return snappy.NewBufferedWriter(w)
+}
+
+func (SnappyCodec) NewReader(r io.Reader) io.ReadCloser {
+	return io.NopCloser(snappy.NewReader(r))
+}
+
+// ZstdCodec 使用 zstd，压缩率明显高于 snappy，适合磁盘 I/O 是瓶颈的场景
+type ZstdCodec struct{}
+
+func (ZstdCodec) NewWriter(w io.Writer) io.WriteCloser {
+	enc, err := zstd.NewWriter(w)
+	if err != nil {
+		return errWriteCloser{err}
+	}
+	return enc
+}
+
+func (ZstdCodec) NewReader(r io.Reader) io.ReadCloser {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return errReadCloser{err}
+	}
+	return dec.IOReadCloser()
+}
+
+// errWriteCloser、errReadCloser 在编解码器创建失败时返回，之后的读写都返回该错误
+type errWriteCloser struct{ err error }
+
+func (e errWriteCloser) Write([]byte) (int, error) { return 0, e.err }
+func (e errWriteCloser) Close() error              { return e.err }
+
+type errReadCloser struct{ err error }
+
+func (e errReadCloser) Read([]byte) (int, error) { return 0, e.err }
+func (e errReadCloser) Close() error             { return e.err }
+
+// CompressedSink 把格式化后的日志行压缩后写入 underlying，
+// 日志行先缓存在内存中，每 compressedBlockSize 压缩写出一块，另外每 compressedFlushInterval 定时写出
+// 进程异常退出时最多丢失一个块，Close 会写出剩余的数据并结束压缩流
+type CompressedSink struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	zw   io.WriteCloser
+	stop chan struct{}
+	done chan struct{}
+}
+
+// CompressedLogSink 创建压缩日志的 sink，使用完毕后需要调用 Close
+func CompressedLogSink(underlying io.Writer, codec CompressionCodec) *CompressedSink {
+	s := &CompressedSink{
+		zw:   codec.NewWriter(underlying),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.buf.Grow(compressedBlockSize)
+	go s.flushLoop(compressedFlushInterval)
+	return s
+}
+
+func (s *CompressedSink) flushLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			err := s.flushLocked()
+			s.mu.Unlock()
+			if err != nil {
+				log.Debugf("failed to flush compressed media log: %+v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *CompressedSink) Write(ev *AccessEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf.WriteString(formatMediaLog(ev))
+	s.buf.WriteByte('\n')
+	if s.buf.Len() < compressedBlockSize {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// flushLocked 压缩缓存的数据并让压缩器写出一个完整的块
+func (s *CompressedSink) flushLocked() error {
+	if s.buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.zw.Write(s.buf.Bytes())
+	s.buf.Reset()
+	if err != nil {
+		return err
+	}
+	if f, ok := s.zw.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close 写出剩余的数据并结束压缩流，不会关闭 underlying
+func (s *CompressedSink) Close() error {
+	close(s.stop)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flushLocked(); err != nil {
+		_ = s.zw.Close()
+		return err
+	}
+	return s.zw.Close()
+}
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompressedLogSink(t *testing.T) {
+	for name, codec := range map[string]CompressionCodec{"snappy": SnappyCodec{}, "zstd": ZstdCodec{}} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			sink := CompressedLogSink(&out, codec)
+			var want strings.Builder
+			// 超过一个块，中间会写出一次
+			for i := 0; out.Len() == 0; i++ {
+				ev := &AccessEvent{Time: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC), Username: "alice",
+					ClientIP: "10.0.0.1", Path: fmt.Sprintf("/movies/%d.mkv", i)}
+				if err := sink.Write(ev); err != nil {
+					t.Fatal(err)
+				}
+				want.WriteString(formatMediaLog(ev) + "\n")
+				if want.Len() > 2*compressedBlockSize {
+					t.Fatal("no block written after exceeding the block size")
+				}
+			}
+			tail := &AccessEvent{Path: "/movies/tail.mkv"}
+			_ = sink.Write(tail)
+			want.WriteString(formatMediaLog(tail) + "\n")
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if out.Len() >= want.Len() {
+				t.Errorf("compressed %d bytes into %d", want.Len(), out.Len())
+			}
+
+			r := codec.NewReader(&out)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want.String() {
+				t.Fatalf("decompressed %d bytes, want %d", len(got), want.Len())
+			}
+		})
+	}
+}
+
+func TestCompressedLogSinkPeriodicFlush(t *testing.T) {
+	var out safeBuffer
+	sink := &CompressedSink{zw: SnappyCodec{}.NewWriter(&out), stop: make(chan struct{}), done: make(chan struct{})}
+	go sink.flushLoop(10 * time.Millisecond)
+	defer sink.Close()
+	_ = sink.Write(&AccessEvent{Path: "/movies/a.mkv"})
+	deadline := time.Now().Add(time.Second)
+	for out.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("buffered line was not flushed by the timer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// safeBuffer 是可以被定时写出的 goroutine 和测试同时访问的 bytes.Buffer
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
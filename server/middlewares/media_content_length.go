@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// contentLengthMaxBuffer 是补充 Content-Length 时最多缓存的响应体大小
+const contentLengthMaxBuffer = 16 << 20
+
+// ContentLengthEnforcerMiddleware 为没有 Content-Length 的媒体文件响应补充该响应头
+// 部分存储返回的媒体文件使用 chunked 传输，浏览器无法拖动视频进度条
+//
+// responseBodyWriter 在捕获的同时就把数据写给客户端，响应头已经发出，无法再补充，
+// 所以这里先缓存响应体，处理完成后设置 Content-Length 再一次写出；
+// 响应体超过 contentLengthMaxBuffer 时放弃缓存，按原样以 chunked 继续传输并输出 Warn 日志
+// 只处理 200 响应，206 响应的长度由 Content-Range 决定，不做修改；
+// 写出响应头时已经有 Content-Length 或者状态码不是 200 时不缓存，直接写给客户端
+func ContentLengthEnforcerMiddleware() gin.HandlerFunc {
+	return contentLengthEnforcer(contentLengthMaxBuffer)
+}
+
+func contentLengthEnforcer(limit int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		w := &contentLengthWriter{ResponseWriter: c.Writer, limit: limit, skipKnownLength: true}
+		c.Writer = w
+		c.Next()
+		if w.truncated {
+			log.Warnf("media content length: response for %s exceeded %d bytes, sent without Content-Length",
+				c.Request.URL.Path, w.limit)
+			return
+		}
+		w.finish()
+	}
+}
+
+// contentLengthWriter 缓存响应体，直到处理完成或超过 limit
+type contentLengthWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+	// 超过 limit 或者处理函数主动 Flush 后不再缓存，直接写给客户端
+	passthrough bool
+	truncated   bool
+	// skipKnownLength 为 true 时，状态码不是 200 或者已经有 Content-Length 的响应不缓存；
+	// 严格校验需要缓存完整的响应体，不设置
+	skipKnownLength bool
+	decided         bool
+}
+
+// WriteHeader 记录状态码，并决定是否需要缓存
+func (w *contentLengthWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+	w.decide()
+}
+
+// decide 在状态码不是 200 或者已经设置了 Content-Length 时切换为直接写出，不再缓存
+func (w *contentLengthWriter) decide() {
+	if w.decided || !w.skipKnownLength {
+		return
+	}
+	w.decided = true
+	if w.Status() != http.StatusOK || w.Header().Get("Content-Length") != "" {
+		w.release()
+	}
+}
+
+func (w *contentLengthWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if !w.passthrough && w.body.Len()+len(data) > w.limit {
+		w.truncated = true
+		w.release()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *contentLengthWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 在缓存期间不写出响应头，finish 时再写
+func (w *contentLengthWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Flush 表示处理函数需要立即发送数据（例如流式响应），之后不再缓存
+func (w *contentLengthWriter) Flush() {
+	w.release()
+	w.ResponseWriter.Flush()
+}
+
+func (w *contentLengthWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *contentLengthWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	if w.body.Len() == 0 {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// release 写出响应头和已缓存的数据，之后的写入直接发给客户端
+func (w *contentLengthWriter) release() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// finish 在处理完成后写出缓存的响应，200 响应缺少 Content-Length 时按缓存的字节数补充
+func (w *contentLengthWriter) finish() {
+	if w.passthrough {
+		return
+	}
+	h := w.Header()
+	if w.Status() == http.StatusOK && h.Get("Content-Length") == "" && w.body.Len() > 0 {
+		h.Del("Transfer-Encoding")
+		h.Set("Content-Length", strconv.Itoa(w.body.Len()))
+	}
+	w.release()
+}
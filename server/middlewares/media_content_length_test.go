@@ -0,0 +1,112 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestContentLengthEnforcerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	r := gin.New()
+	r.Use(contentLengthEnforcer(16))
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/chunked.mp4":
+			c.Header("Transfer-Encoding", "chunked")
+			c.Status(http.StatusOK)
+			_, _ = c.Writer.WriteString("0123")
+			_, _ = c.Writer.Write([]byte("4567"))
+		case "/sized.mp4":
+			c.Header("Content-Length", "8")
+			c.Data(http.StatusOK, "video/mp4", []byte("01234567"))
+		case "/partial.mp4":
+			c.Data(http.StatusPartialContent, "video/mp4", []byte("0123"))
+		case "/large.mp4":
+			c.Status(http.StatusOK)
+			for i := 0; i < 4; i++ {
+				_, _ = c.Writer.WriteString("0123456789")
+			}
+		case "/notes.txt":
+			c.String(http.StatusOK, "notes")
+		}
+	})
+
+	cases := []struct {
+		path          string
+		status        int
+		body          string
+		contentLength string
+	}{
+		{"/d/chunked.mp4", http.StatusOK, "01234567", "8"},
+		{"/d/sized.mp4", http.StatusOK, "01234567", "8"},
+		{"/d/partial.mp4", http.StatusPartialContent, "0123", ""},
+		{"/d/large.mp4", http.StatusOK, strings.Repeat("0123456789", 4), ""},
+		{"/d/notes.txt", http.StatusOK, "notes", ""},
+	}
+	for _, tc := range cases {
+		hook.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.status || w.Body.String() != tc.body {
+			t.Errorf("%s: got %d %q, want %d %q", tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+		if got := w.Header().Get("Content-Length"); got != tc.contentLength {
+			t.Errorf("%s: Content-Length = %q, want %q", tc.path, got, tc.contentLength)
+		}
+		if tc.contentLength != "" && w.Header().Get("Transfer-Encoding") != "" {
+			t.Errorf("%s: Transfer-Encoding should be removed", tc.path)
+		}
+		warned := false
+		for _, entry := range hook.AllEntries() {
+			warned = warned || entry.Level == log.WarnLevel
+		}
+		if want := tc.path == "/d/large.mp4"; warned != want {
+			t.Errorf("%s: warned = %v, want %v", tc.path, warned, want)
+		}
+	}
+}
+
+func TestContentLengthEnforcerPassthrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var w *httptest.ResponseRecorder
+	// sent 为处理函数写出第一块数据后客户端已经收到的字节数
+	sent := map[string]int{}
+	r := gin.New()
+	r.Use(contentLengthEnforcer(1 << 20))
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/sized.mp4":
+			c.Header("Content-Length", "8")
+			c.Status(http.StatusOK)
+		case "/partial.mp4":
+			c.Header("Content-Range", "bytes 0-7/100")
+			c.Status(http.StatusPartialContent)
+		case "/chunked.mp4":
+			c.Status(http.StatusOK)
+		}
+		_, _ = c.Writer.WriteString("0123")
+		sent[c.Param("path")] = w.Body.Len()
+		_, _ = c.Writer.WriteString("4567")
+	})
+	for _, p := range []string{"/sized.mp4", "/partial.mp4", "/chunked.mp4"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d"+p, nil))
+		if w.Body.String() != "01234567" {
+			t.Errorf("%s: body = %q", p, w.Body.String())
+		}
+	}
+	// 已知长度和 206 响应不缓存，没有长度的 200 响应缓存到处理完成
+	if want := map[string]int{"/sized.mp4": 4, "/partial.mp4": 4, "/chunked.mp4": 0}; !reflect.DeepEqual(sent, want) {
+		t.Fatalf("bytes sent before the handler finished = %v, want %v", sent, want)
+	}
+}
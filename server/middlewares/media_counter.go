@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// AccessCountEntry 是 SnapshotTop 返回的一项
+type AccessCountEntry struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+// MediaAccessCounter 统计启动以来每个文件的访问次数，只计入普通访问和跳转下载，内部请求不计入
+type MediaAccessCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func NewMediaAccessCounter() *MediaAccessCounter {
+	return &MediaAccessCounter{counts: make(map[string]int64)}
+}
+
+var mediaAccessCounter = NewMediaAccessCounter()
+
+// GetMediaAccessCounter 返回中间件使用的全局访问计数
+func GetMediaAccessCounter() *MediaAccessCounter {
+	return mediaAccessCounter
+}
+
+// Add 为文件的访问次数加一
+func (c *MediaAccessCounter) Add(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[path]++
+}
+
+// observe 统计一条已经输出的事件
+func (c *MediaAccessCounter) observe(ev *AccessEvent) {
+	if ev.Internal || (ev.Event != EventAccess && ev.Event != EventRedirectDownload) {
+		return
+	}
+	c.Add(mediaVirtualPath(ev.Path))
+}
+
+// Snapshot 返回满足 filter 的文件及访问次数，filter 为 nil 时返回全部，
+// 只复制满足条件的项，文件很多时可以用来查询其中的一小部分
+func (c *MediaAccessCounter) Snapshot(filter func(path string, n int64) bool) map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int64)
+	for p, n := range c.counts {
+		if filter == nil || filter(p, n) {
+			out[p] = n
+		}
+	}
+	return out
+}
+
+// SnapshotTop 返回访问次数最多的 n 个文件，次数相同时按路径排序，
+// 使用大小为 n 的最小堆，不复制全部数据
+func (c *MediaAccessCounter) SnapshotTop(n int) []AccessCountEntry {
+	if n <= 0 {
+		return []AccessCountEntry{}
+	}
+	h := make(accessCountHeap, 0, n)
+	c.mu.Lock()
+	for p, count := range c.counts {
+		e := AccessCountEntry{Path: p, Count: count}
+		if len(h) < n {
+			heap.Push(&h, e)
+		} else if accessCountLess(h[0], e) {
+			h[0] = e
+			heap.Fix(&h, 0)
+		}
+	}
+	c.mu.Unlock()
+	sort.Slice(h, func(i, j int) bool { return accessCountLess(h[j], h[i]) })
+	return h
+}
+
+// accessCountLess 判断 a 是否排在 b 之后：次数更少，或者次数相同时路径更大
+func accessCountLess(a, b AccessCountEntry) bool {
+	if a.Count != b.Count {
+		return a.Count < b.Count
+	}
+	return a.Path > b.Path
+}
+
+// accessCountHeap 是堆顶为排名最后一项的最小堆
+type accessCountHeap []AccessCountEntry
+
+func (h accessCountHeap) Len() int           { return len(h) }
+func (h accessCountHeap) Less(i, j int) bool { return accessCountLess(h[i], h[j]) }
+func (h accessCountHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *accessCountHeap) Push(x any)        { *h = append(*h, x.(AccessCountEntry)) }
+func (h *accessCountHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
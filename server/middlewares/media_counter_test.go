@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestMediaAccessCounterSnapshot(t *testing.T) {
+	c := NewMediaAccessCounter()
+	for i := 0; i < 150; i++ {
+		c.Add("/movies/a.mp4")
+	}
+	for i := 0; i < 50; i++ {
+		c.Add("/movies/b.mp4")
+	}
+	for i := 0; i < 200; i++ {
+		c.Add("/music/c.mkv")
+	}
+
+	got := c.Snapshot(func(p string, n int64) bool { return strings.HasSuffix(p, ".mp4") && n > 100 })
+	if want := map[string]int64{"/movies/a.mp4": 150}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("filtered snapshot = %v, want %v", got, want)
+	}
+	if got = c.Snapshot(nil); len(got) != 3 || got["/movies/b.mp4"] != 50 {
+		t.Fatalf("full snapshot = %v", got)
+	}
+	// 返回的是副本
+	got["/movies/b.mp4"] = 0
+	if c.Snapshot(nil)["/movies/b.mp4"] != 50 {
+		t.Fatal("snapshot shares the counter's map")
+	}
+}
+
+func TestMediaAccessCounterSnapshotTop(t *testing.T) {
+	c := NewMediaAccessCounter()
+	for i := 0; i < 20; i++ {
+		for j := 0; j <= i%10; j++ {
+			c.Add(fmt.Sprintf("/%02d.mp4", i))
+		}
+	}
+
+	// 次数相同时按路径排序
+	want := []AccessCountEntry{{"/09.mp4", 10}, {"/19.mp4", 10}, {"/08.mp4", 9}, {"/18.mp4", 9}, {"/07.mp4", 8}}
+	if got := c.SnapshotTop(5); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SnapshotTop(5) = %v, want %v", got, want)
+	}
+	if got := c.SnapshotTop(100); len(got) != 20 || got[19] != (AccessCountEntry{"/10.mp4", 1}) {
+		t.Fatalf("SnapshotTop(100) = %v", got)
+	}
+	if got := c.SnapshotTop(0); len(got) != 0 {
+		t.Fatalf("SnapshotTop(0) = %v", got)
+	}
+}
+
+func TestMediaAccessCounterFromMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	defer func(c *MediaAccessCounter) { mediaAccessCounter = c }(mediaAccessCounter)
+	mediaAccessCounter = NewMediaAccessCounter()
+
+	logger, _ := logtest.NewNullLogger()
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger)))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	r.GET("/p/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	for _, p := range []string{"/d/movies/a.mp4", "/p/movies/a.mp4", "/d/movies/b.mp4"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	// /d/ 和 /p/ 访问的是同一个文件
+	if got, want := GetMediaAccessCounter().Snapshot(nil), map[string]int64{"/movies/a.mp4": 2, "/movies/b.mp4": 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("counts = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DailySummary 是一天内（UTC）媒体访问的汇总
+// 只统计普通访问和跳转下载，HEAD 探测和后台任务的内部请求不计入，
+// 媒体服务器扫描和爬虫的访问只计入 ScanAccesses、BotAccesses，同步客户端的访问只计入 SyncAccesses 和 TotalBytes
+type DailySummary struct {
+	// 汇总的日期，格式为 2006-01-02
+	Date          string `json:"date"`
+	TotalAccesses int64  `json:"total_accesses"`
+	// 实际传输的字节数，包括同步客户端；跳转下载没有传输数据，不计入
+	TotalBytes  int64  `json:"total_bytes"`
+	UniqueUsers int    `json:"unique_users"`
+	UniqueFiles int    `json:"unique_files"`
+	TopFile     string `json:"top_file,omitempty"`
+	TopUser     string `json:"top_user,omitempty"`
+	// 被识别为扫描媒体库的访问次数，不计入上面的统计
+	ScanAccesses int64 `json:"scan_accesses,omitempty"`
+	// 同步客户端的访问次数，不计入上面的统计
+	SyncAccesses int64 `json:"sync_accesses,omitempty"`
+	// 爬虫的访问次数，不计入上面的统计
+	BotAccesses int64 `json:"bot_accesses,omitempty"`
+	// 内存中的最近事件已经覆盖了当天较早的事件，汇总不完整，可以调大 recent_size
+	Partial bool `json:"partial,omitempty"`
+}
+
+// DailySummaryLogger 每天 UTC 零点汇总内存中最近事件里前一天的访问，作为一条 daily_summary 事件写入 sink
+// 汇总只能覆盖最近事件缓冲区（recent_size）中保留的事件，缓冲区不足一天时汇总标记为 Partial
+// 返回的函数用于停止定时器
+func DailySummaryLogger(sink MediaLogSink) func() {
+	return startDailySummary(sink, recentEvents, time.Now)
+}
+
+func startDailySummary(sink MediaLogSink, ring *recentRing, now func() time.Time) func() {
+	var (
+		mu      sync.Mutex
+		timer   *time.Timer
+		stopped bool
+	)
+	var fire func()
+	fire = func() {
+		t := now()
+		// 定时器可能稍早触发，按最近的零点计算，避免汇总当天
+		day := t.UTC().Add(time.Minute).Truncate(24*time.Hour).AddDate(0, 0, -1)
+		ev := dailySummaryEvent(ring, day, t)
+		if err := sink.Write(ev); err != nil {
+			log.Errorf("failed to write media daily summary: %+v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			timer = time.AfterFunc(untilNextMidnightUTC(now()), fire)
+		}
+	}
+	mu.Lock()
+	timer = time.AfterFunc(untilNextMidnightUTC(now()), fire)
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		timer.Stop()
+	}
+}
+
+// untilNextMidnightUTC 返回距离下一个 UTC 零点的时间
+func untilNextMidnightUTC(t time.Time) time.Duration {
+	next := t.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return next.Sub(t)
+}
+
+// dailySummaryEvent 汇总 day（UTC 零点）开始的一天内的事件
+func dailySummaryEvent(ring *recentRing, day, now time.Time) *AccessEvent {
+	ring.mu.Lock()
+	entries := ring.tailLocked(0)
+	full := ring.full
+	ring.mu.Unlock()
+
+	end := day.Add(24 * time.Hour)
+	summary := &DailySummary{Date: day.Format("2006-01-02")}
+	// 缓冲区已经写满一圈并且最早的事件晚于当天开始，说明有事件被覆盖
+	summary.Partial = full && len(entries) > 0 && entries[0].Time.After(day)
+	files := make(map[string]int64)
+	users := make(map[string]int64)
+	for _, entry := range entries {
+		ev := entry.AccessEvent
+		if ev.Internal || ev.Time.Before(day) || !ev.Time.Before(end) ||
+			(ev.Event != EventAccess && ev.Event != EventRedirectDownload) {
+			continue
+		}
+		switch ev.Traffic {
+		case TrafficScan:
+			summary.ScanAccesses++
+			continue
+		case TrafficBot:
+			summary.BotAccesses++
+			continue
+		}
+		if ev.BytesServed != nil {
+			summary.TotalBytes += *ev.BytesServed
+		}
+		if ev.Traffic == TrafficSync {
+			summary.SyncAccesses++
+			continue
+		}
+		summary.TotalAccesses++
+		files[ev.Path]++
+		users[ev.Username]++
+	}
+	summary.UniqueFiles = len(files)
+	summary.UniqueUsers = len(users)
+	summary.TopFile = topKey(files)
+	summary.TopUser = topKey(users)
+	return &AccessEvent{
+		Event:   EventDailySummary,
+		Time:    now,
+		Summary: summary,
+	}
+}
+
+// topKey 返回次数最多的键，次数相同时返回字典序较小的，保证结果稳定
+func topKey(counts map[string]int64) string {
+	var top string
+	var best int64
+	for k, n := range counts {
+		if n > best || (n == best && k < top) {
+			top, best = k, n
+		}
+	}
+	return top
+}
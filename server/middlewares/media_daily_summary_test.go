@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUntilNextMidnightUTC(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	cases := map[time.Time]time.Duration{
+		time.Date(2025, 7, 12, 23, 0, 0, 0, time.UTC): time.Hour,
+		time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC):  24 * time.Hour,
+		// 本地时间 7 月 13 日 07:30 为 UTC 7 月 12 日 23:30
+		time.Date(2025, 7, 13, 7, 30, 0, 0, cst): 30 * time.Minute,
+	}
+	for now, want := range cases {
+		if got := untilNextMidnightUTC(now); got != want {
+			t.Errorf("untilNextMidnightUTC(%s) = %s, want %s", now, got, want)
+		}
+	}
+}
+
+func TestDailySummaryEvent(t *testing.T) {
+	day := time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)
+	ring := newRecentRing(20)
+	size := func(n int64) *int64 { return &n }
+	for _, ev := range []*AccessEvent{
+		// 前一天的事件不计入
+		{Event: EventAccess, Time: day.Add(-time.Minute), Username: "carol", Path: "/old.mp4"},
+		{Event: EventAccess, Time: day.Add(time.Hour), Username: "alice", Path: "/a.mp4", BytesServed: size(100)},
+		{Event: EventAccess, Time: day.Add(2 * time.Hour), Username: "bob", Path: "/a.mp4", BytesServed: size(50)},
+		{Event: EventRedirectDownload, Time: day.Add(3 * time.Hour), Username: "bob", Path: "/b.mkv"},
+		{Event: EventAccess, Time: day.Add(4 * time.Hour), Username: "bob", Path: "/c.mp4", BytesServed: size(25)},
+		// 扫描媒体库和同步客户端的访问单独计数，同步客户端传输的字节数仍然计入
+		{Event: EventAccess, Time: day.Add(5 * time.Hour), Username: "jellyfin", Path: "/e.mkv", Traffic: TrafficScan},
+		{Event: EventAccess, Time: day.Add(5 * time.Hour), Username: "rclone", Path: "/f.mkv", Traffic: TrafficSync, BytesServed: size(1000)},
+		{Event: EventAccess, Time: day.Add(5 * time.Hour), Path: "/g.mp4", Traffic: TrafficBot, BytesServed: size(500)},
+		// 探测、审计事件和内部请求不计入
+		{Event: EventProbe, Time: day.Add(5 * time.Hour), Username: "alice", Path: "/a.mp4"},
+		{Event: EventDelete, Time: day.Add(5 * time.Hour), Username: "admin", Path: "/a.mp4"},
+		{Event: EventAccess, Time: day.Add(5 * time.Hour), Username: "admin", Path: "/x.mp4", Internal: true},
+		// 当天的事件留到下一次汇总
+		{Event: EventAccess, Time: day.Add(24 * time.Hour), Username: "dave", Path: "/d.mp4"},
+	} {
+		ring.add(ev)
+	}
+
+	ev := dailySummaryEvent(ring, day, day.Add(24*time.Hour))
+	want := DailySummary{
+		Date: "2025-07-12", TotalAccesses: 4, TotalBytes: 1175,
+		UniqueUsers: 2, UniqueFiles: 3, TopFile: "/a.mp4", TopUser: "bob", ScanAccesses: 1, SyncAccesses: 1, BotAccesses: 1,
+	}
+	if ev.Event != EventDailySummary || ev.Summary == nil || *ev.Summary != want {
+		t.Fatalf("summary = %+v, want %+v", ev.Summary, want)
+	}
+
+	// 缓冲区写满后覆盖了当天最早的事件，汇总不完整
+	small := newRecentRing(2)
+	for i := 0; i < 3; i++ {
+		small.add(&AccessEvent{Event: EventAccess, Time: day.Add(time.Duration(i+1) * time.Hour), Path: "/a.mp4"})
+	}
+	if s := dailySummaryEvent(small, day, day.Add(24*time.Hour)).Summary; !s.Partial || s.TotalAccesses != 2 {
+		t.Fatalf("partial summary = %+v", s)
+	}
+}
+
+type chanSink chan *AccessEvent
+
+func (s chanSink) Write(ev *AccessEvent) error {
+	s <- ev
+	return nil
+}
+
+func TestStartDailySummary(t *testing.T) {
+	// 距离零点 50ms 时启动，定时器触发后汇总刚结束的一天
+	start := time.Now()
+	midnight := time.Date(2025, 7, 13, 0, 0, 0, 0, time.UTC)
+	now := func() time.Time { return midnight.Add(-50 * time.Millisecond).Add(time.Since(start)) }
+	ring := newRecentRing(10)
+	ring.add(&AccessEvent{Event: EventAccess, Time: midnight.Add(-time.Hour), Username: "alice", Path: "/a.mp4"})
+	sink := make(chanSink, 1)
+	stop := startDailySummary(sink, ring, now)
+	defer stop()
+
+	select {
+	case ev := <-sink:
+		if ev.Summary.Date != "2025-07-12" || ev.Summary.TotalAccesses != 1 {
+			t.Fatalf("summary = %+v", ev.Summary)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("daily summary was not emitted at midnight")
+	}
+}
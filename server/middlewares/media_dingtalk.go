@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	dingTalkWebhookURL = "https://oapi.dingtalk.com/robot/send"
+	// 自定义机器人每分钟最多发送 20 条消息
+	defaultDingTalkWindow   = 10 * time.Second
+	dingTalkMinInterval     = 3 * time.Second
+	dingTalkMaxMarkdownSize = 4096
+)
+
+// dingTalkSink 通过钉钉自定义机器人发送 markdown 格式的事件摘要
+// 配置了 secret 时使用加签模式，每次发送在 URL 上附加 timestamp 和 sign
+type dingTalkSink struct {
+	url     string
+	secret  string
+	client  *http.Client
+	pacer   botPacer
+	retries atomic.Int64
+}
+
+// newDingTalkSink 创建钉钉机器人 sink，URL 为空时使用官方地址并以 Token 作为 access_token
+func newDingTalkSink(cfg conf.MediaLogNotifier) *dingTalkSink {
+	u := cfg.URL
+	if u == "" {
+		u = dingTalkWebhookURL + "?access_token=" + url.QueryEscape(cfg.Token)
+	}
+	return &dingTalkSink{
+		url:    u,
+		secret: cfg.Secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+		pacer:  botPacer{interval: dingTalkMinInterval},
+	}
+}
+
+// signedURL 按钉钉的规则计算签名：对 "timestamp\nsecret" 做 HmacSHA256 后 Base64，再进行 URL 编码
+func (s *dingTalkSink) signedURL(now time.Time) string {
+	if s.secret == "" {
+		return s.url
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(timestamp + "\n" + s.secret))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	sep := "?"
+	if strings.Contains(s.url, "?") {
+		sep = "&"
+	}
+	return s.url + sep + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+}
+
+func (s *dingTalkSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *dingTalkSink) WriteBatch(evs []*AccessEvent) error {
+	events := coalesceEvents(evs)
+	title := eventFileName(events[0].AccessEvent)
+	if len(events) > 1 {
+		title = fmt.Sprintf("%d 条媒体访问", len(events))
+	}
+	s.pacer.wait()
+	// 签名有效期为一小时，重试时沿用同一个签名即可
+	return postBotMessage(s.client, s.signedURL(time.Now()), map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": title,
+			"text":  botMarkdown(events, dingTalkMaxMarkdownSize),
+		},
+	}, &s.retries)
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestDingTalkSignedURL(t *testing.T) {
+	sink := newDingTalkSink(conf.MediaLogNotifier{Token: "abc", Secret: "SEC123"})
+	u, err := url.Parse(sink.signedURL(time.UnixMilli(1700000000000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("access_token") != "abc" || q.Get("timestamp") != "1700000000000" {
+		t.Fatalf("unexpected query: %v", q)
+	}
+	// printf "1700000000000\nSEC123" | openssl dgst -sha256 -hmac SEC123 -binary | base64
+	if want := "lkcPI1uoxBY1gUnCnnPH1Kkru0Hqjo7rFpA3haIVhEQ="; q.Get("sign") != want {
+		t.Fatalf("sign = %q, want %q", q.Get("sign"), want)
+	}
+
+	if plain := newDingTalkSink(conf.MediaLogNotifier{Token: "abc"}); plain.signedURL(time.Now()) != dingTalkWebhookURL+"?access_token=abc" {
+		t.Fatalf("unsigned url = %q", plain.signedURL(time.Now()))
+	}
+}
@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	defaultDiscordWindow = 10 * time.Second
+	// Discord 单条消息最多包含 10 个 embed
+	discordMaxEmbeds = 10
+)
+
+// discordEventColors 按事件类型区分 embed 的颜色，访问为蓝色，上传、转存为绿色，
+// 删除、清除等破坏性操作和修改设置为橙色，denied、anomaly 等告警事件为红色
+var discordEventColors = map[string]int{
+	EventAccess:           0x3498db,
+	EventRedirectDownload: 0x2980b9,
+	EventProbe:            0x1abc9c,
+	EventDelete:           0xe67e22,
+	EventUpload:           0x2ecc71,
+	EventPurge:            0xd35400,
+	EventOfflineAdded:     0x27ae60,
+	EventRename:           0x9b59b6,
+	EventPlaylist:         0x8e44ad,
+	EventAlbumView:        0x16a085,
+	EventNewUserAgent:     0xf1c40f,
+	EventPlaybackSession:  0x34495e,
+	EventConfigChange:     0xf39c12,
+	EventDailySummary:     0x2c3e50,
+	EventDenied:           0xe74c3c,
+	EventAnomaly:          0xc0392b,
+}
+
+// discordDefaultColor 是未知事件类型使用的灰色
+const discordDefaultColor = 0x95a5a6
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields"`
+	Timestamp   string              `json:"timestamp"`
+}
+
+// discordSink 通过 Discord webhook 把事件以 embed 的形式发送到频道
+// 时间窗口内的相同事件合并为一个带计数的 embed，以免触发 Discord 的频率限制
+type discordSink struct {
+	url    string
+	client *http.Client
+}
+
+func newDiscordSink(cfg conf.MediaLogNotifier) *discordSink {
+	return &discordSink{
+		url:    cfg.URL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *discordSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *discordSink) WriteBatch(evs []*AccessEvent) error {
+	embeds := make([]discordEmbed, 0, len(evs))
+	for _, ce := range coalesceEvents(evs) {
+		embeds = append(embeds, discordEmbedFor(ce))
+	}
+	for len(embeds) > 0 {
+		n := min(len(embeds), discordMaxEmbeds)
+		if err := postNotification(s.client, s.url, map[string]any{"embeds": embeds[:n]}); err != nil {
+			return err
+		}
+		embeds = embeds[n:]
+	}
+	return nil
+}
+
+func discordEmbedFor(ce *coalescedEvent) discordEmbed {
+	color, ok := discordEventColors[ce.Event]
+	if !ok {
+		color = discordDefaultColor
+	}
+	embed := discordEmbed{
+		Title:       eventFileName(ce.AccessEvent),
+		Description: ce.Path,
+		Color:       color,
+		Fields: []discordEmbedField{
+			{Name: "User", Value: orDash(ce.Username), Inline: true},
+			{Name: "IP", Value: orDash(ce.ClientIP), Inline: true},
+			{Name: "Client", Value: orDash(ce.UserAgent)},
+		},
+		Timestamp: ce.Time.Format(time.RFC3339),
+	}
+	if ce.Count > 1 {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "Count", Value: strconv.Itoa(ce.Count), Inline: true})
+	}
+	return embed
+}
+
+// orDash 避免向 Discord 发送空字段，空值会导致整个请求被拒绝
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestDiscordSinkCoalescesAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	sink := newDiscordSink(conf.MediaLogNotifier{Type: "discord", URL: srv.URL})
+	other := testAccessEvent()
+	other.Path = "/movies/Arrival.mkv"
+	if err := sink.WriteBatch([]*AccessEvent{testAccessEvent(), other, testAccessEvent()}); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Embeds []discordEmbed `json:"embeds"`
+	}
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected one retry after 429, got %d calls", calls.Load())
+	}
+	if len(got.Embeds) != 2 {
+		t.Fatalf("expected 2 coalesced embeds, got %d", len(got.Embeds))
+	}
+	first := got.Embeds[0]
+	if first.Title != "Interstellar.mkv" || first.Fields[len(first.Fields)-1].Value != "2" {
+		t.Fatalf("unexpected embed: %+v", first)
+	}
+}
+
+func TestDiscordEventColors(t *testing.T) {
+	// red 表示告警事件应使用红色系，orange 表示破坏性操作应使用橙色系
+	cases := []struct {
+		event string
+		tone  string
+	}{
+		{EventAccess, ""},
+		{EventRedirectDownload, ""},
+		{EventProbe, ""},
+		{EventDelete, "orange"},
+		{EventUpload, ""},
+		{EventPurge, "orange"},
+		{EventOfflineAdded, ""},
+		{EventRename, ""},
+		{EventPlaylist, ""},
+		{EventAlbumView, ""},
+		{EventNewUserAgent, ""},
+		{EventPlaybackSession, ""},
+		{EventConfigChange, "orange"},
+		{EventDailySummary, ""},
+		{EventDenied, "red"},
+		{EventAnomaly, "red"},
+	}
+	if len(cases) != len(cefEventNames) {
+		t.Fatalf("table covers %d event types, want %d", len(cases), len(cefEventNames))
+	}
+	seen := map[int]string{}
+	for _, tc := range cases {
+		color := discordEmbedFor(&coalescedEvent{AccessEvent: &AccessEvent{Event: tc.event}, Count: 1}).Color
+		if color == discordDefaultColor {
+			t.Errorf("%s uses the default color", tc.event)
+		}
+		if other, ok := seen[color]; ok {
+			t.Errorf("%s and %s share color %#06x", tc.event, other, color)
+		}
+		seen[color] = tc.event
+		r, g, b := color>>16, color>>8&0xff, color&0xff
+		switch tc.tone {
+		case "red":
+			if r < 0xb0 || g > 0x60 || b > 0x60 {
+				t.Errorf("%s color %#06x is not red", tc.event, color)
+			}
+		case "orange":
+			if r < 0xd0 || g < 0x50 || g > 0xb0 || b > 0x30 {
+				t.Errorf("%s color %#06x is not orange", tc.event, color)
+			}
+		}
+	}
+	if color := discordEmbedFor(&coalescedEvent{AccessEvent: &AccessEvent{Event: "unknown"}, Count: 1}).Color; color != discordDefaultColor {
+		t.Errorf("unknown event color = %#06x", color)
+	}
+}
@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// errMediaLogDiskLow 表示磁盘空间不足，日志没有写入文件
+var errMediaLogDiskLow = errors.New("media log disk space low")
+
+// diskSpaceGuard 在写日志文件前检查所在磁盘的剩余空间，结果缓存 interval 时间
+// 低于 minFree 时只输出一次警告并尝试切割日志文件释放空间，恢复后再继续写入
+type diskSpaceGuard struct {
+	mu        sync.Mutex
+	dir       string
+	minFree   uint64
+	interval  time.Duration
+	lastCheck time.Time
+	low       bool
+
+	now       func() time.Time
+	freeSpace func(dir string) (uint64, error)
+	// 空间不足时调用一次，用于切割、压缩日志文件
+	reclaim func() error
+}
+
+func newDiskSpaceGuard(dir string, minFree uint64, interval time.Duration, reclaim func() error) *diskSpaceGuard {
+	return &diskSpaceGuard{
+		dir:       dir,
+		minFree:   minFree,
+		interval:  interval,
+		now:       time.Now,
+		freeSpace: freeDiskSpace,
+		reclaim:   reclaim,
+	}
+}
+
+// allow 判断当前是否可以写入日志文件
+func (g *diskSpaceGuard) allow() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	if !g.lastCheck.IsZero() && now.Sub(g.lastCheck) < g.interval {
+		return !g.low
+	}
+	g.lastCheck = now
+	free, err := g.freeSpace(g.dir)
+	if err != nil {
+		// 无法获取剩余空间（例如不支持的平台）时不限制写入
+		log.Debugf("failed to check free space of %s: %+v", g.dir, err)
+		g.low = false
+		return true
+	}
+	switch {
+	case free < g.minFree && !g.low:
+		g.low = true
+		log.Warnf("!!! media log: only %d MB free on %s (minimum %d MB), "+
+			"stop writing the media log file and log to console only until space recovers",
+			free>>20, g.dir, g.minFree>>20)
+		if g.reclaim != nil {
+			if err := g.reclaim(); err != nil {
+				log.Errorf("failed to rotate media log file: %+v", err)
+			}
+		}
+	case free >= g.minFree && g.low:
+		g.low = false
+		log.Infof("media log: free space on %s recovered to %d MB, resume writing the media log file", g.dir, free>>20)
+	}
+	return !g.low
+}
@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestMediaFileLoggerDiskGuard(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	dir := t.TempDir()
+	logger := NewMediaFileLogger(conf.LogConfig{Name: filepath.Join(dir, "media.log"), MaxSize: 10})
+	defer logger.Close()
+	logger.GuardDiskSpace(100<<20, 10*time.Second)
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)}
+	free, checks := uint64(1<<30), 0
+	logger.guard.now = clock.Now
+	logger.guard.freeSpace = func(string) (uint64, error) {
+		checks++
+		return free, nil
+	}
+
+	write := func() error {
+		_, err := logger.Write([]byte("line\n"))
+		return err
+	}
+	if err := write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 检查结果缓存到下一个间隔
+	free = 10 << 20
+	if err := write(); err != nil || checks != 1 {
+		t.Fatalf("write = %v, checks = %d, want cached result", err, checks)
+	}
+	clock.Advance(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if err := write(); !errors.Is(err, errMediaLogDiskLow) {
+			t.Fatalf("write = %v, want errMediaLogDiskLow", err)
+		}
+		clock.Advance(10 * time.Second)
+	}
+	warnings := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.WarnLevel {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Fatalf("got %d warnings, want 1", warnings)
+	}
+	// 空间不足时切割了一次日志文件
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("got %d files after low space, want 2", len(entries))
+	}
+
+	free = 200 << 20
+	if err := write(); err != nil {
+		t.Fatalf("write after recovery = %v", err)
+	}
+}
+
+func TestDiskSpaceGuardIgnoresStatErrors(t *testing.T) {
+	g := newDiskSpaceGuard(t.TempDir(), 1<<62, time.Second, nil)
+	g.freeSpace = func(string) (uint64, error) { return 0, errors.ErrUnsupported }
+	if !g.allow() {
+		t.Fatal("guard should allow writes when free space is unknown")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package middlewares
+
+import "errors"
+
+// freeDiskSpace 在其他平台上不支持，磁盘空间检查不生效
+func freeDiskSpace(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import "sync/atomic"
+
+// MediaDryRun 是试运行模式的状态，试运行时检测和过滤照常进行并计数，
+// 但不输出日志、不发送给任何 sink，KeepRecent 为 true 时仍然保存到最近事件中
+type MediaDryRun struct {
+	Enabled    bool `json:"enabled"`
+	KeepRecent bool `json:"keep_recent"`
+}
+
+var mediaDryRunSource atomic.Pointer[func() MediaDryRun]
+
+// SetMediaDryRunSource 设置读取试运行状态的函数，每个事件输出前调用一次，
+// 因此切换试运行和正常模式不需要重启；传入 nil 表示始终正常输出
+func SetMediaDryRunSource(f func() MediaDryRun) {
+	if f == nil {
+		mediaDryRunSource.Store(nil)
+		return
+	}
+	mediaDryRunSource.Store(&f)
+}
+
+func mediaDryRunMode() MediaDryRun {
+	if f := mediaDryRunSource.Load(); f != nil {
+		return (*f)()
+	}
+	return MediaDryRun{}
+}
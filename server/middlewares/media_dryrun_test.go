@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMediaDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer ResetMediaLogInternalStats()
+	dry := MediaDryRun{Enabled: true, KeepRecent: true}
+	SetMediaDryRunSource(func() MediaDryRun { return dry })
+	defer SetMediaDryRunSource(nil)
+	global := &recordingSink{}
+	SetMediaLogSinks(global)
+	defer SetMediaLogSinks()
+	recentEvents.resize(0)
+	recentEvents.resize(10)
+	defer recentEvents.resize(defaultMediaLogConf.RecentSize)
+
+	local := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(local)))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "video") })
+	serve := func(u string) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+	}
+
+	ResetMediaLogInternalStats()
+	serve("/d/a.mp4")
+	serve("/d/notes.txt")
+	stats := GetMediaLogInternalStats()
+	if !stats.DryRun || stats.EventsDryRun != 1 || stats.EventsDetected != 1 {
+		t.Fatalf("dry-run stats = %+v", stats)
+	}
+	if len(global.paths) != 0 || len(local.events) != 0 {
+		t.Fatalf("sinks received events in dry-run: %v %d", global.paths, len(local.events))
+	}
+	if got := recentEvents.snapshot(0); len(got) != 1 || got[0].Path != "/d/a.mp4" {
+		t.Fatalf("recent = %v", recentPaths(got))
+	}
+
+	// 切换到正常模式立即生效
+	dry = MediaDryRun{}
+	serve("/d/b.mp4")
+	stats = GetMediaLogInternalStats()
+	if stats.DryRun || stats.EventsDryRun != 1 || stats.EventsDetected != 2 {
+		t.Fatalf("live stats = %+v", stats)
+	}
+	if len(global.paths) != 1 || len(local.events) != 1 {
+		t.Fatalf("sinks should receive live events: %v %d", global.paths, len(local.events))
+	}
+}
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// environmentOptions 返回 gin 运行模式对应的默认选项：
+// debug 模式输出带颜色的文本和详细字段，release 和 test 模式输出 JSON 和标准字段
+func environmentOptions(mode string) ([]Option, error) {
+	std := log.StandardLogger()
+	logger := log.New()
+	logger.SetOutput(std.Out)
+	logger.SetLevel(std.GetLevel())
+	switch mode {
+	case gin.DebugMode:
+		logger.SetFormatter(&log.TextFormatter{
+			ForceColors:      true,
+			DisableTimestamp: true, // 文本行中已经包含时间
+		})
+		return []Option{WithLogger(logger), WithLogLevel(LogLevelVerbose)}, nil
+	case gin.ReleaseMode, gin.TestMode:
+		logger.SetFormatter(&log.JSONFormatter{})
+		return []Option{WithLogger(logger), WithLogLevel(LogLevelStandard)}, nil
+	}
+	return nil, fmt.Errorf("media log: unknown gin mode %q", mode)
+}
+
+// ConfigureMediaLoggerForEnvironment 按 gin.Mode() 返回配置好的媒体日志中间件：
+// debug 模式下为 LogLevelVerbose 和带颜色的文本输出，release 模式下为 LogLevelStandard 和 JSON 输出
+// 这些只是默认值，SetDefaultOptions 设置的选项优先；中间件不会注册到 engine 上，由调用方决定挂载位置
+func ConfigureMediaLoggerForEnvironment(engine *gin.Engine) (gin.HandlerFunc, error) {
+	if engine == nil {
+		return nil, errors.New("media log: nil gin engine")
+	}
+	opts, err := environmentOptions(gin.Mode())
+	if err != nil {
+		return nil, err
+	}
+	return mediaLoggerHandler(newMediaLoggerOptionsWithBase(opts)), nil
+}
@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestEnvironmentOptions(t *testing.T) {
+	for mode, want := range map[string]LogLevel{gin.DebugMode: LogLevelVerbose, gin.ReleaseMode: LogLevelStandard} {
+		opts, err := environmentOptions(mode)
+		if err != nil {
+			t.Fatalf("%s: %+v", mode, err)
+		}
+		o := newMediaLoggerOptionsWithBase(opts)
+		if o.level != want {
+			t.Errorf("%s: level = %d, want %d", mode, o.level, want)
+		}
+		switch f := o.logger.Formatter.(type) {
+		case *log.TextFormatter:
+			if mode != gin.DebugMode || !f.ForceColors {
+				t.Errorf("%s: text formatter %+v", mode, f)
+			}
+		case *log.JSONFormatter:
+			if mode != gin.ReleaseMode {
+				t.Errorf("%s: json formatter", mode)
+			}
+		default:
+			t.Errorf("%s: formatter %T", mode, f)
+		}
+	}
+	if _, err := environmentOptions("staging"); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+}
+
+func TestEnvironmentOptionsYieldToDefaults(t *testing.T) {
+	defer ResetDefaultOptions()
+	logger, _ := logtest.NewNullLogger()
+	SetDefaultOptions(WithLogger(logger))
+	opts, _ := environmentOptions(gin.ReleaseMode)
+	if o := newMediaLoggerOptionsWithBase(opts); o.logger != logger || o.level != LogLevelStandard {
+		t.Fatalf("logger %p level %d", o.logger, o.level)
+	}
+}
+
+func TestConfigureMediaLoggerForEnvironment(t *testing.T) {
+	if _, err := ConfigureMediaLoggerForEnvironment(nil); err == nil {
+		t.Fatal("nil engine accepted")
+	}
+	gin.SetMode(gin.TestMode)
+	handler, err := ConfigureMediaLoggerForEnvironment(gin.New())
+	if err != nil || handler == nil {
+		t.Fatalf("handler %v, err %+v", handler, err)
+	}
+}
+
+func TestWithLogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for level, want := range map[LogLevel][]string{
+		LogLevelMinimal:  nil,
+		LogLevelStandard: {"path", "client_ip", "user", "status"},
+		LogLevelVerbose:  {"path", "client_ip", "user", "status", "method", "user_agent", "region", "bytes"},
+	} {
+		logger, hook := logtest.NewNullLogger()
+		r := gin.New()
+		r.Use(MediaLoggerWithOptions(WithLogger(logger), WithLogLevel(level)))
+		r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/a.mp4", nil))
+
+		entry := hook.LastEntry()
+		if entry == nil {
+			t.Fatalf("level %d: no log entry", level)
+		}
+		if len(entry.Data) != len(want) {
+			t.Errorf("level %d: fields %v, want %v", level, entry.Data, want)
+		}
+		for _, key := range want {
+			if _, ok := entry.Data[key]; !ok {
+				t.Errorf("level %d: missing %s in %v", level, key, entry.Data)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// errorSanitizeMaxBuffer 是检查错误响应时最多缓存的响应体大小，错误响应通常只有几百字节
+const errorSanitizeMaxBuffer = 64 << 10
+
+// sanitizedErrorMessage 是替换后返回给客户端的错误信息
+const sanitizedErrorMessage = "internal server error"
+
+// internalPathPattern 匹配错误信息中的服务器本地路径和 Go 的堆栈信息，
+// 例如 open /root/data/movies/a.mkv: permission denied 或 main.go:42
+var internalPathPattern = regexp.MustCompile(
+	`(?:^|[\s"'(:=\[])/(?:root|home|var|etc|tmp|opt|usr|srv|mnt|proc)/|\.go:\d+|goroutine \d+ \[`)
+
+// ErrorSanitizationMiddleware 检查媒体文件请求的 5xx 错误响应，错误信息中包含服务器本地路径或堆栈时
+// 替换为通用的错误信息，原始信息以 Error 级别输出到服务端日志
+// OpenList 的接口出错时大多返回 HTTP 200 和 JSON 中的 code，所以 HTTP 状态码或 JSON code 为 5xx 都会检查；
+// 只缓存 JSON 响应，并且最多缓存 errorSanitizeMaxBuffer，媒体文件的数据不受影响
+func ErrorSanitizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		w := &errorSanitizeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.buffering && !w.passthrough {
+			w.sanitize(c)
+		}
+		w.release()
+	}
+}
+
+// errorSanitizeWriter 在响应为 JSON 时缓存响应体，其他响应直接写给客户端
+type errorSanitizeWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	// 第一次写入时根据 Content-Type 决定是否缓存
+	decided   bool
+	buffering bool
+	// 超过缓存上限或者处理函数主动 Flush 后不再缓存
+	passthrough bool
+}
+
+func (w *errorSanitizeWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.buffering = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	if !w.buffering {
+		w.passthrough = true
+	}
+}
+
+func (w *errorSanitizeWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if !w.passthrough && w.body.Len()+len(data) > errorSanitizeMaxBuffer {
+		w.release()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *errorSanitizeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 在缓存期间不写出响应头，release 时再写
+func (w *errorSanitizeWriter) WriteHeaderNow() {
+	w.decide()
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *errorSanitizeWriter) Flush() {
+	w.release()
+	w.ResponseWriter.Flush()
+}
+
+func (w *errorSanitizeWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *errorSanitizeWriter) Size() int {
+	if w.passthrough || w.body.Len() == 0 {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// release 写出响应头和已缓存的数据，之后的写入直接发给客户端
+func (w *errorSanitizeWriter) release() {
+	if w.passthrough {
+		return
+	}
+	w.decided = true
+	w.passthrough = true
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// sanitize 检查缓存的 JSON 错误响应，message 中包含本地路径时替换
+func (w *errorSanitizeWriter) sanitize(c *gin.Context) {
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(w.body.Bytes(), &resp); err != nil {
+		return
+	}
+	var code int
+	_ = json.Unmarshal(resp["code"], &code)
+	if w.Status() < http.StatusInternalServerError && code < http.StatusInternalServerError {
+		return
+	}
+	var message string
+	if err := json.Unmarshal(resp["message"], &message); err != nil || !internalPathPattern.MatchString(message) {
+		return
+	}
+	log.Errorf("media error sanitization: %s %s: %s", c.Request.Method, c.Request.URL.Path, message)
+	resp["message"], _ = json.Marshal(sanitizedErrorMessage)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	w.body.Reset()
+	w.body.Write(data)
+	if w.Header().Get("Content-Length") != "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	}
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestErrorSanitizationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	r := gin.New()
+	r.Use(ErrorSanitizationMiddleware())
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/leak.mkv":
+			// OpenList 的错误响应为 HTTP 200 和 JSON 中的 code
+			c.JSON(http.StatusOK, gin.H{"code": 500, "message": "failed get link: open /root/data/movies/leak.mkv: permission denied", "data": nil})
+		case "/panic.mkv":
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": errors.New("panic at handles/down.go:42").Error()})
+		case "/plain.mkv":
+			c.JSON(http.StatusOK, gin.H{"code": 500, "message": "storage not found"})
+		case "/notfound.mkv":
+			c.JSON(http.StatusOK, gin.H{"code": 404, "message": "object /home/user/a.mkv not found"})
+		default:
+			c.String(http.StatusOK, "video data /var/x")
+		}
+	})
+	r.GET("/api/other", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": 500, "message": "open /etc/openlist/config.json failed"})
+	})
+
+	get := func(path string) (int, map[string]any, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp, w.Body.String()
+	}
+
+	for _, p := range []string{"/d/leak.mkv", "/d/panic.mkv"} {
+		_, resp, body := get(p)
+		if resp["message"] != sanitizedErrorMessage || resp["code"] != float64(500) {
+			t.Errorf("%s: body %s", p, body)
+		}
+	}
+	if len(hook.AllEntries()) != 2 || hook.LastEntry().Level != log.ErrorLevel ||
+		!strings.Contains(hook.AllEntries()[0].Message, "/root/data/movies/leak.mkv") {
+		t.Fatalf("log entries %+v", hook.AllEntries())
+	}
+
+	// 不包含本地路径的错误、非 5xx 错误、非 JSON 响应和非媒体路径不修改
+	for p, want := range map[string]string{
+		"/d/plain.mkv":    "storage not found",
+		"/d/notfound.mkv": "object /home/user/a.mkv not found",
+		"/api/other":      "open /etc/openlist/config.json failed",
+	} {
+		if _, resp, body := get(p); resp["message"] != want {
+			t.Errorf("%s: body %s", p, body)
+		}
+	}
+	if code, _, body := get("/d/video.mkv"); code != http.StatusOK || body != "video data /var/x" {
+		t.Errorf("media data changed: %d %q", code, body)
+	}
+}
@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessEvent 描述一次媒体文件访问
+// 媒体日志中间件在处理请求前创建事件并放入上下文，后续的中间件可以通过 getAccessEvent 补充字段，
+// 请求处理完成后再填充路径、用户等信息统一输出
+type AccessEvent struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"client_ip"`
+	Username  string    `json:"username"`
+	Method    string    `json:"method"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	FromTor   bool      `json:"from_tor,omitempty"`
+	// OpenList 自身的后台任务发出的请求，只有开启 log_internal 时才会记录
+	Internal bool `json:"internal,omitempty"`
+	// 传输速度远超正常播放所需，可能是批量抓取
+	PossibleScraper bool `json:"possible_scraper,omitempty"`
+	// Accept 头不接受该媒体文件的类型，客户端可能会下载而不是播放
+	NegotiationMismatch bool `json:"negotiation_mismatch,omitempty"`
+	// 条件请求命中缓存，返回了 304
+	NotModified bool `json:"not_modified,omitempty"`
+	// 续传时 If-Range 与当前文件不一致，返回了完整的文件
+	FullResume bool `json:"full_resume,omitempty"`
+	// RangeCaptureMiddleware 记录的 206 响应的 Content-Range，例如 bytes 0-1023/4096；
+	// 请求带有 Range 但返回了 200 时标记 RangeIgnored
+	RequestedRange string `json:"requested_range,omitempty"`
+	RangeIgnored   bool   `json:"range_ignored,omitempty"`
+	// 流量类型，Jellyfin、Emby、Plex 等扫描媒体库的访问为 scan，正常访问为空
+	Traffic string `json:"traffic,omitempty"`
+	// 开启 verify_bots 时，自称搜索引擎爬虫的请求通过了反向 DNS 验证
+	BotVerified bool `json:"bot_verified,omitempty"`
+	// 捕获响应体时复制的字节数和耗时
+	CaptureBytes   int64         `json:"capture_bytes,omitempty"`
+	CaptureLatency time.Duration `json:"capture_latency,omitempty"`
+	// 媒体请求耗时的指数移动平均（毫秒）
+	AvgLatencyMs float64 `json:"avg_latency_ms,omitempty"`
+	// 后端通过 X-Content-Metadata 头提供的媒体信息，Resolution 格式为 宽x高，Bitrate 单位为 bps
+	Resolution string `json:"resolution,omitempty"`
+	Codec      string `json:"codec,omitempty"`
+	Bitrate    int64  `json:"bitrate,omitempty"`
+	// 跳转下载的目标主机名和文件所在存储的驱动
+	RedirectHost string `json:"redirect_host,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	// WithStorageTagging 从上下文中读取的存储驱动名称
+	StorageDriver string `json:"storage_driver,omitempty"`
+	// 部署所在的区域，由 WithRegionLabel 或 OPENLIST_REGION 环境变量设置
+	Region string `json:"region,omitempty"`
+	// 实际传输的字节数，跳转下载等没有传输数据的事件为 null
+	BytesServed *int64 `json:"bytes_served"`
+	// rename 事件中重命名前后的路径，之前的事件仍然使用原路径，通过这两个字段关联
+	SourcePath string `json:"source_path,omitempty"`
+	DestPath   string `json:"dest_path,omitempty"`
+	// offline_added 事件中文件的大小
+	FileSize int64 `json:"file_size,omitempty"`
+	// 文件大小（字节），取自响应的大小、/api/fs/get 返回的 size 或 FileSize，未知时省略
+	Bytes *int64 `json:"bytes,omitempty"`
+	// purge 事件清除的记录条数
+	Purged int64 `json:"purged,omitempty"`
+	// album_view 事件合并的图片数，Bytes 为这些图片的总大小
+	Count int `json:"count,omitempty"`
+	// playback_session 事件中传输的字节覆盖文件的比例（0~1）和分类（sampled、partial、completed），
+	// Bytes 为文件大小，BytesServed 为去掉重复部分后传输的字节数
+	Coverage   float64 `json:"coverage,omitempty"`
+	Completion string  `json:"completion,omitempty"`
+	// config_change 事件中值有变化的设置
+	Diff []SettingDiff `json:"diff,omitempty"`
+	// 合并到本次 GET 的 HEAD 探测请求的时间
+	ProbedAt *time.Time `json:"probed_at,omitempty"`
+	// daily_summary 事件中前一天（UTC）的访问汇总
+	Summary *DailySummary `json:"summary,omitempty"`
+
+	// 请求开始处理的时间，用于计算耗时
+	startedAt time.Time
+	// MatomoAnalyticsMiddleware 使用的文件完整地址和 Accept-Language 头
+	requestURL string
+	language   string
+	// 开启预写日志时由 emitToSinks 设置，sink 写入后通过它确认
+	spool *spoolTicket
+	// 开启追踪时记录中间件的判断过程，同一个请求的多个事件共享
+	trace *mediaTrace
+}
+
+// 事件类型
+const (
+	EventAccess = "access"
+	// /d/ 返回 302 跳转到存储的直链，客户端直接从存储下载
+	EventRedirectDownload = "redirect_download"
+	// 播放器获取文件大小、是否支持 Range 的 HEAD 请求
+	EventProbe = "probe"
+	// 通过 RecordMediaAudit 记录的删除、上传操作
+	EventDelete = "delete"
+	EventUpload = "upload"
+	// 按用户清除已保存的访问记录，只记录清除的条数、操作者和时间
+	EventPurge = "purge"
+	// 离线下载任务完成后转存到存储中的媒体文件
+	EventOfflineAdded = "offline_added"
+	// 通过 /api/fs/rename 重命名媒体文件，Path 为新路径
+	EventRename = "rename"
+	// 通过 PlaylistMiddleware 生成目录的 M3U 播放列表，Path 为目录
+	EventPlaylist = "playlist"
+	// 开启 media_log.album 时，短时间内浏览同一目录下大量图片合并为一条，Path 为目录
+	EventAlbumView = "album_view"
+	// NewUserAgentLogger 记录的第一次出现的 User-Agent，Path 为第一次请求的文件
+	EventNewUserAgent = "new_user_agent"
+	// 开启 media_log.completion 时，一次播放结束后按传输的字节估计的完成度
+	EventPlaybackSession = "playback_session"
+	// SettingChangeLogger 记录的修改设置的请求，Path 为请求的接口
+	EventConfigChange = "config_change"
+	// DailySummaryLogger 每天 UTC 零点输出的前一天的访问汇总
+	EventDailySummary = "daily_summary"
+	// 以下为告警类事件，通知渠道会以更高的优先级发送
+	EventDenied  = "denied"
+	EventAnomaly = "anomaly"
+)
+
+// fillBytes 在 Bytes 未设置时从已知的大小中填写，都未知时保持为空
+func (ev *AccessEvent) fillBytes() {
+	if ev.Bytes != nil {
+		return
+	}
+	switch {
+	case ev.BytesServed != nil && *ev.BytesServed > 0:
+		n := *ev.BytesServed
+		ev.Bytes = &n
+	case ev.FileSize > 0:
+		n := ev.FileSize
+		ev.Bytes = &n
+	}
+}
+
+// isAlertEvent 判断事件是否为告警
+func isAlertEvent(event string) bool {
+	return event == EventDenied || event == EventAnomaly
+}
+
+// isPlainAccessEvent 判断事件是否为普通的访问事件，其他事件（删除、上传、告警等）属于审计事件，
+// 不受记录时间段限制，开启审计链时会加入哈希链
+func isPlainAccessEvent(event string) bool {
+	switch event {
+	case EventAccess, EventProbe, EventRedirectDownload, EventAlbumView:
+		return true
+	}
+	return false
+}
+
+const accessEventKey = "media_access_event"
+
+func newAccessEvent(c *gin.Context) *AccessEvent {
+	ev := &AccessEvent{Method: c.Request.Method, UserAgent: c.Request.UserAgent(), startedAt: time.Now()}
+	c.Set(accessEventKey, ev)
+	return ev
+}
+
+// getAccessEvent 返回当前请求正在构建的访问事件，请求没有经过媒体日志中间件时返回 nil
+func getAccessEvent(c *gin.Context) *AccessEvent {
+	if v, ok := c.Get(accessEventKey); ok {
+		if ev, ok := v.(*AccessEvent); ok {
+			return ev
+		}
+	}
+	return nil
+}
+
+// accessEventFor 在请求处理完成后生成指定文件的访问事件
+// 同一个请求可能对应多个文件（例如目录列表），因此每次返回一个新的副本
+func accessEventFor(c *gin.Context, filePath string) *AccessEvent {
+	ev := AccessEvent{Method: c.Request.Method, UserAgent: c.Request.UserAgent()}
+	if base := getAccessEvent(c); base != nil {
+		ev = *base
+	}
+	if ev.Event == "" {
+		ev.Event = EventAccess
+	}
+	ev.Time = time.Now()
+	ev.ClientIP = c.ClientIP()
+	ev.Username = getUserName(c)
+	ev.Path = filePath
+	ev.Status = c.Writer.Status()
+	return &ev
+}
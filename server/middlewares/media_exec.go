@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultExecTimeout = 10 * time.Second
+	// 记录到日志中的 stderr 最多保留的字节数
+	maxExecStderr = 1024
+)
+
+// execSink 为每个事件执行一次配置的命令，事件的 JSON 写入 stdin，主要字段通过 OPENLIST_* 环境变量传入
+// 命令在后台运行，不阻塞请求；超过频率限制或并发上限的事件直接丢弃并计数，避免短时间内大量访问时不断创建进程
+type execSink struct {
+	name    string
+	command []string
+	timeout time.Duration
+	limiter *rate.Limiter
+	slots   chan struct{}
+	wg      sync.WaitGroup
+
+	started   atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	timeouts  atomic.Int64
+	dropped   atomic.Int64
+}
+
+func newExecSink(cfg conf.MediaLogExec) (*execSink, error) {
+	if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+		return nil, fmt.Errorf("media log exec %q: command is empty", cfg.Name)
+	}
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Command[0]
+	}
+	s := &execSink{
+		name:    name,
+		command: cfg.Command,
+		timeout: defaultExecTimeout,
+	}
+	if cfg.Timeout > 0 {
+		s.timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	maxConcurrent := cfg.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	s.slots = make(chan struct{}, maxConcurrent)
+	limit, burst := cfg.RateLimit, cfg.Burst
+	if limit <= 0 {
+		limit = 1
+	}
+	if burst <= 0 {
+		burst = maxConcurrent
+	}
+	s.limiter = rate.NewLimiter(rate.Limit(limit), burst)
+	return s, nil
+}
+
+func (s *execSink) Write(ev *AccessEvent) error {
+	if !s.limiter.Allow() {
+		s.dropped.Add(1)
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.dropped.Add(1)
+		return nil
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		<-s.slots
+		return err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			<-s.slots
+			s.wg.Done()
+		}()
+		s.run(body, execEnv(ev))
+	}()
+	return nil
+}
+
+// run 执行一次命令，非零退出和超时只计数并输出 debug 日志
+func (s *execSink) run(stdin []byte, env []string) {
+	s.started.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Env = append(execBaseEnv(), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stderr := &limitedBuffer{limit: maxExecStderr}
+	cmd.Stderr = stderr
+	// 脚本启动的子进程可能继承 stderr，超时后不再等待它们关闭输出
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	switch {
+	case err == nil:
+		s.succeeded.Add(1)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		s.timeouts.Add(1)
+		log.Debugf("media log exec %s timed out after %s", s.name, s.timeout)
+	default:
+		s.failed.Add(1)
+		log.Debugf("media log exec %s failed: %+v, stderr: %s", s.name, err, stderr.String())
+	}
+}
+
+// stats 返回命令的运行统计，Queued 为正在运行的命令数
+func (s *execSink) stats() MediaSinkStats {
+	return MediaSinkStats{
+		Delivered: s.succeeded.Load(),
+		Failed:    s.failed.Load(),
+		Dropped:   s.dropped.Load(),
+		Queued:    len(s.slots),
+		Timeouts:  s.timeouts.Load(),
+	}
+}
+
+func (s *execSink) resetCounters() {
+	s.started.Store(0)
+	s.succeeded.Store(0)
+	s.failed.Store(0)
+	s.timeouts.Store(0)
+	s.dropped.Store(0)
+}
+
+// Close 等待正在运行的命令结束
+func (s *execSink) Close() error {
+	s.wg.Wait()
+	return nil
+}
+
+// execBaseEnv 返回命令运行需要的最少环境变量，不传入进程的其他环境变量，
+// 避免把数据库密码、日志加密口令等配置泄露给脚本
+func execBaseEnv() []string {
+	var env []string
+	// Windows 上缺少 SystemRoot 时很多程序无法启动
+	for _, key := range []string{"PATH", "HOME", "SystemRoot"} {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
+
+// execEnv 返回传给命令的事件字段
+func execEnv(ev *AccessEvent) []string {
+	return []string{
+		"OPENLIST_EVENT=" + ev.Event,
+		"OPENLIST_PATH=" + ev.Path,
+		"OPENLIST_USER=" + ev.Username,
+		"OPENLIST_CLIENT_IP=" + ev.ClientIP,
+		"OPENLIST_METHOD=" + ev.Method,
+		"OPENLIST_STATUS=" + strconv.Itoa(ev.Status),
+		"OPENLIST_TIME=" + ev.Time.Format(time.RFC3339),
+	}
+}
+
+// limitedBuffer 只保留写入内容的前 limit 个字节，多余的部分直接丢弃
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
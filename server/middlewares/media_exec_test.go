@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// requireShell 跳过依赖 sh、sleep 等命令的测试
+func requireShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+}
+
+func TestExecSinkPassesEvent(t *testing.T) {
+	requireShell(t)
+	out := filepath.Join(t.TempDir(), "out")
+	sink, err := newExecSink(conf.MediaLogExec{
+		Command: []string{"sh", "-c", `{ cat; echo; echo "$OPENLIST_USER $OPENLIST_PATH"; } > "$1"`, "sh", out},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(&AccessEvent{Event: EventAccess, Username: "alice", Path: "/movies/a.mkv"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Close()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"path":"/movies/a.mkv"`) || lines[1] != "alice /movies/a.mkv" {
+		t.Fatalf("unexpected output: %q", data)
+	}
+	if sink.failed.Load() != 0 || sink.started.Load() != 1 {
+		t.Fatalf("started=%d failed=%d", sink.started.Load(), sink.failed.Load())
+	}
+}
+
+func TestExecSinkCountsFailuresAndTimeouts(t *testing.T) {
+	requireShell(t)
+	sink, err := newExecSink(conf.MediaLogExec{Command: []string{"sh", "-c", "exit 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Write(&AccessEvent{})
+	_ = sink.Close()
+	if sink.failed.Load() != 1 {
+		t.Fatalf("failed = %d, want 1", sink.failed.Load())
+	}
+
+	sink, err = newExecSink(conf.MediaLogExec{Command: []string{"sleep", "5"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.timeout = 50 * time.Millisecond
+	_ = sink.Write(&AccessEvent{})
+	_ = sink.Close()
+	if sink.timeouts.Load() != 1 || sink.failed.Load() != 0 {
+		t.Fatalf("timeouts=%d failed=%d", sink.timeouts.Load(), sink.failed.Load())
+	}
+}
+
+func TestExecSinkLimitsBursts(t *testing.T) {
+	requireShell(t)
+	sink, err := newExecSink(conf.MediaLogExec{Command: []string{"sleep", "0.2"}, MaxConcurrent: 2, RateLimit: 100, Burst: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		_ = sink.Write(&AccessEvent{})
+	}
+	_ = sink.Close()
+	if sink.started.Load() != 2 || sink.dropped.Load() != 8 {
+		t.Fatalf("started=%d dropped=%d", sink.started.Load(), sink.dropped.Load())
+	}
+}
+
+func TestExecSinkEnvironment(t *testing.T) {
+	requireShell(t)
+	t.Setenv("OPENLIST_MEDIA_LOG_FILE_PASSPHRASE", "secret")
+	t.Setenv("OPENLIST_JWT_SECRET", "secret")
+	out := filepath.Join(t.TempDir(), "out")
+	sink, err := newExecSink(conf.MediaLogExec{Command: []string{"sh", "-c", `env > "$1"`, "sh", out}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.Write(&AccessEvent{Event: EventAccess, Username: "alice"})
+	_ = sink.Close()
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := string(data)
+	if strings.Contains(env, "secret") {
+		t.Fatalf("process environment leaked to the command:\n%s", env)
+	}
+	for _, want := range []string{"OPENLIST_EVENT=access", "OPENLIST_USER=alice", "PATH=" + os.Getenv("PATH")} {
+		if !strings.Contains(env, want) {
+			t.Errorf("environment is missing %s", want)
+		}
+	}
+}
+
+func TestExecSinkRequiresCommand(t *testing.T) {
+	if _, err := newExecSink(conf.MediaLogExec{Name: "empty"}); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+}
+
+func TestExecSinkInternalStats(t *testing.T) {
+	requireShell(t)
+	sink, err := newExecSink(conf.MediaLogExec{Name: "notify", Command: []string{"sh", "-c", "exit 3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipelineMetrics.setSinks([]namedSink{{name: "exec:notify", sink: sink}})
+	defer pipelineMetrics.setSinks(nil)
+	defer ResetMediaLogInternalStats()
+	_ = sink.Write(&AccessEvent{})
+	_ = sink.Close()
+	sink.timeouts.Add(2)
+
+	stats := GetMediaLogInternalStats()
+	if len(stats.Sinks) != 1 || stats.Sinks[0].Name != "exec:notify" ||
+		stats.Sinks[0].Failed != 1 || stats.Sinks[0].Timeouts != 2 || stats.Sinks[0].Delivered != 0 {
+		t.Fatalf("sinks = %+v", stats.Sinks)
+	}
+	ResetMediaLogInternalStats()
+	if stats = GetMediaLogInternalStats(); stats.Sinks[0].Failed != 0 || stats.Sinks[0].Timeouts != 0 {
+		t.Fatalf("stats not reset: %+v", stats.Sinks)
+	}
+}
@@ -0,0 +1,594 @@
+package middlewares
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// mediaExpr 是编译后的事件过滤表达式，例如
+//
+//	ext == ".mkv" && bytes > 1<<30 && user != "admin" && hour(time) < 6
+//
+// 表达式在加载配置时编译并做类型检查，求值时只调用编译好的闭包，没有副作用，也不会失败
+//
+// 可用的变量：event、path、ext（小写，包含点）、user、ip、method、ua、provider、redirect_host、traffic（字符串），
+// status、bytes（数字，没有传输数据时 bytes 为 0），tor、scraper（布尔值），time（事件时间）
+// 可用的函数：hour(time)、weekday(time)（0 为星期日）、lower(s)、contains(s, sub)、startsWith(s, prefix)、endsWith(s, suffix)
+// 运算符与 Go 相同：|| && ! == != < <= > >= + - * / % << >>，字符串可以用 + 拼接和比较大小
+type mediaExpr struct {
+	src  string
+	eval func(ev *AccessEvent) bool
+}
+
+// match 对事件求值，nil 表示没有配置表达式，所有事件都通过
+func (e *mediaExpr) match(ev *AccessEvent) bool {
+	return e == nil || e.eval(ev)
+}
+
+// mediaLogExpr 决定事件是否记录，由 InitMediaLog 根据 filter_expr 设置
+var mediaLogExpr atomic.Pointer[mediaExpr]
+
+func setMediaLogExpr(e *mediaExpr) {
+	mediaLogExpr.Store(e)
+}
+
+// EvalMediaExpr 编译表达式并对 ev 求值，用于在保存配置前测试表达式，ev 为 nil 时使用示例事件
+func EvalMediaExpr(src string, ev *AccessEvent) (bool, error) {
+	e, err := compileMediaExpr(src)
+	if err != nil {
+		return false, err
+	}
+	if ev == nil {
+		ev = sampleAccessEvent()
+	}
+	return e.match(ev), nil
+}
+
+// compileMediaExpr 编译表达式，src 为空时返回 nil
+func compileMediaExpr(src string) (*mediaExpr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	p := &exprParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	if n.typ != exprBool {
+		return nil, fmt.Errorf("expression must be a bool, got %s", n.typ)
+	}
+	return &mediaExpr{src: src, eval: n.b}, nil
+}
+
+type exprType int
+
+const (
+	exprBool exprType = iota
+	exprNum
+	exprStr
+	exprTime
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprBool:
+		return "bool"
+	case exprNum:
+		return "number"
+	case exprStr:
+		return "string"
+	default:
+		return "time"
+	}
+}
+
+// exprNode 是编译后的子表达式，按 typ 只有对应的一个求值函数不为 nil
+type exprNode struct {
+	typ exprType
+	b   func(ev *AccessEvent) bool
+	n   func(ev *AccessEvent) float64
+	s   func(ev *AccessEvent) string
+	t   func(ev *AccessEvent) time.Time
+}
+
+var exprVars = map[string]exprNode{
+	"event":         strVar(func(ev *AccessEvent) string { return ev.Event }),
+	"path":          strVar(func(ev *AccessEvent) string { return ev.Path }),
+	"ext":           strVar(func(ev *AccessEvent) string { return strings.ToLower(path.Ext(ev.Path)) }),
+	"user":          strVar(func(ev *AccessEvent) string { return ev.Username }),
+	"ip":            strVar(func(ev *AccessEvent) string { return ev.ClientIP }),
+	"method":        strVar(func(ev *AccessEvent) string { return ev.Method }),
+	"ua":            strVar(func(ev *AccessEvent) string { return ev.UserAgent }),
+	"provider":      strVar(func(ev *AccessEvent) string { return ev.Provider }),
+	"redirect_host": strVar(func(ev *AccessEvent) string { return ev.RedirectHost }),
+	"traffic":       strVar(func(ev *AccessEvent) string { return ev.Traffic }),
+	"status":        {typ: exprNum, n: func(ev *AccessEvent) float64 { return float64(ev.Status) }},
+	"bytes": {typ: exprNum, n: func(ev *AccessEvent) float64 {
+		if ev.BytesServed == nil {
+			return 0
+		}
+		return float64(*ev.BytesServed)
+	}},
+	"tor":     {typ: exprBool, b: func(ev *AccessEvent) bool { return ev.FromTor }},
+	"scraper": {typ: exprBool, b: func(ev *AccessEvent) bool { return ev.PossibleScraper }},
+	"time":    {typ: exprTime, t: func(ev *AccessEvent) time.Time { return ev.Time }},
+}
+
+func strVar(f func(ev *AccessEvent) string) exprNode {
+	return exprNode{typ: exprStr, s: f}
+}
+
+type exprFunc struct {
+	args    []exprType
+	compile func(args []exprNode) exprNode
+}
+
+var exprFuncs = map[string]exprFunc{
+	"hour": {args: []exprType{exprTime}, compile: func(a []exprNode) exprNode {
+		t := a[0].t
+		return exprNode{typ: exprNum, n: func(ev *AccessEvent) float64 { return float64(t(ev).Hour()) }}
+	}},
+	"weekday": {args: []exprType{exprTime}, compile: func(a []exprNode) exprNode {
+		t := a[0].t
+		return exprNode{typ: exprNum, n: func(ev *AccessEvent) float64 { return float64(t(ev).Weekday()) }}
+	}},
+	"lower": {args: []exprType{exprStr}, compile: func(a []exprNode) exprNode {
+		s := a[0].s
+		return strVar(func(ev *AccessEvent) string { return strings.ToLower(s(ev)) })
+	}},
+	"contains":   strPredicate(strings.Contains),
+	"startsWith": strPredicate(strings.HasPrefix),
+	"endsWith":   strPredicate(strings.HasSuffix),
+}
+
+func strPredicate(f func(s, sub string) bool) exprFunc {
+	return exprFunc{args: []exprType{exprStr, exprStr}, compile: func(a []exprNode) exprNode {
+		s, sub := a[0].s, a[1].s
+		return exprNode{typ: exprBool, b: func(ev *AccessEvent) bool { return f(s(ev), sub(ev)) }}
+	}}
+}
+
+type exprTokenKind int
+
+const (
+	tokEOF exprTokenKind = iota
+	tokIdent
+	tokNum
+	tokStr
+	tokOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	i      int
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...any) error {
+	return fmt.Errorf("at position %d: %s", tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+var exprOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func (p *exprParser) tokenize() error {
+	src := p.src
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokIdent, text: src[i:j], pos: i})
+			i = j
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			for j < len(src) && (src[j] == '.' || src[j] == '_' || src[j] >= '0' && src[j] <= '9' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z') {
+				j++
+			}
+			num, err := parseExprNumber(src[i:j])
+			if err != nil {
+				return fmt.Errorf("at position %d: invalid number %q", i+1, src[i:j])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokNum, text: src[i:j], num: num, pos: i})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return fmt.Errorf("at position %d: unterminated string", i+1)
+			}
+			quoted := src[i : j+1]
+			if c == '\'' {
+				quoted = `"` + strings.NewReplacer(`\'`, `'`, `"`, `\"`).Replace(src[i+1:j]) + `"`
+			}
+			s, err := strconv.Unquote(quoted)
+			if err != nil {
+				return fmt.Errorf("at position %d: invalid string %s", i+1, src[i:j+1])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokStr, text: s, pos: i})
+			i = j + 1
+		default:
+			op := ""
+			for _, candidate := range exprOps {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("at position %d: unexpected character %q", i+1, c)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.tokens = append(p.tokens, exprToken{kind: tokEOF, text: "end of expression", pos: len(src)})
+	return nil
+}
+
+// parseExprNumber 解析数字字面量，整数支持 0x 等 Go 的写法
+func parseExprNumber(s string) (float64, error) {
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return float64(n), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept 在下一个记号是 ops 中的运算符时消费并返回它
+func (p *exprParser) accept(ops ...string) (exprToken, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.i++
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+func (p *exprParser) expect(tok exprToken, n exprNode, typ exprType, what string) error {
+	if n.typ != typ {
+		return p.errorf(tok, "%s needs %s, got %s", what, typ, n.typ)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for {
+		tok, ok := p.accept("||")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if err := p.expect(tok, left, exprBool, "||"); err != nil {
+			return left, err
+		}
+		if err := p.expect(tok, right, exprBool, "||"); err != nil {
+			return left, err
+		}
+		l, r := left.b, right.b
+		left = exprNode{typ: exprBool, b: func(ev *AccessEvent) bool { return l(ev) || r(ev) }}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return left, err
+	}
+	for {
+		tok, ok := p.accept("&&")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return right, err
+		}
+		if err := p.expect(tok, left, exprBool, "&&"); err != nil {
+			return left, err
+		}
+		if err := p.expect(tok, right, exprBool, "&&"); err != nil {
+			return left, err
+		}
+		l, r := left.b, right.b
+		left = exprNode{typ: exprBool, b: func(ev *AccessEvent) bool { return l(ev) && r(ev) }}
+	}
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseAdd()
+	if err != nil {
+		return left, err
+	}
+	tok, ok := p.accept("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdd()
+	if err != nil {
+		return right, err
+	}
+	if left.typ != right.typ {
+		return left, p.errorf(tok, "cannot compare %s with %s", left.typ, right.typ)
+	}
+	var cmp func(ev *AccessEvent) int
+	switch left.typ {
+	case exprNum:
+		l, r := left.n, right.n
+		cmp = func(ev *AccessEvent) int {
+			a, b := l(ev), r(ev)
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case exprStr:
+		l, r := left.s, right.s
+		cmp = func(ev *AccessEvent) int { return strings.Compare(l(ev), r(ev)) }
+	case exprBool:
+		if tok.text != "==" && tok.text != "!=" {
+			return left, p.errorf(tok, "operator %s is not defined on bool", tok.text)
+		}
+		l, r := left.b, right.b
+		cmp = func(ev *AccessEvent) int {
+			if l(ev) == r(ev) {
+				return 0
+			}
+			return 1
+		}
+	default:
+		return left, p.errorf(tok, "cannot compare %s values, use hour() or weekday()", left.typ)
+	}
+	var test func(c int) bool
+	switch tok.text {
+	case "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	default:
+		test = func(c int) bool { return c >= 0 }
+	}
+	if _, chained := p.accept("==", "!=", "<", "<=", ">", ">="); chained {
+		return left, p.errorf(tok, "comparisons cannot be chained")
+	}
+	return exprNode{typ: exprBool, b: func(ev *AccessEvent) bool { return test(cmp(ev)) }}, nil
+}
+
+func (p *exprParser) parseAdd() (exprNode, error) {
+	left, err := p.parseMul()
+	if err != nil {
+		return left, err
+	}
+	for {
+		tok, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMul()
+		if err != nil {
+			return right, err
+		}
+		if tok.text == "+" && left.typ == exprStr && right.typ == exprStr {
+			l, r := left.s, right.s
+			left = strVar(func(ev *AccessEvent) string { return l(ev) + r(ev) })
+			continue
+		}
+		if left, err = p.arith(tok, left, right); err != nil {
+			return left, err
+		}
+	}
+}
+
+func (p *exprParser) parseMul() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		tok, ok := p.accept("*", "/", "%", "<<", ">>")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return right, err
+		}
+		if left, err = p.arith(tok, left, right); err != nil {
+			return left, err
+		}
+	}
+}
+
+// arith 编译数字的二元运算，%、<<、>> 按整数计算
+func (p *exprParser) arith(tok exprToken, left, right exprNode) (exprNode, error) {
+	if err := p.expect(tok, left, exprNum, tok.text); err != nil {
+		return left, err
+	}
+	if err := p.expect(tok, right, exprNum, tok.text); err != nil {
+		return left, err
+	}
+	l, r := left.n, right.n
+	var f func(a, b float64) float64
+	switch tok.text {
+	case "+":
+		f = func(a, b float64) float64 { return a + b }
+	case "-":
+		f = func(a, b float64) float64 { return a - b }
+	case "*":
+		f = func(a, b float64) float64 { return a * b }
+	case "/":
+		f = func(a, b float64) float64 { return a / b }
+	case "%":
+		f = func(a, b float64) float64 {
+			if int64(b) == 0 {
+				return 0
+			}
+			return float64(int64(a) % int64(b))
+		}
+	case "<<":
+		f = func(a, b float64) float64 {
+			if b < 0 || b > 62 {
+				return 0
+			}
+			return float64(int64(a) << uint(b))
+		}
+	default:
+		f = func(a, b float64) float64 {
+			if b < 0 || b > 62 {
+				return 0
+			}
+			return float64(int64(a) >> uint(b))
+		}
+	}
+	return exprNode{typ: exprNum, n: func(ev *AccessEvent) float64 { return f(l(ev), r(ev)) }}, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if tok, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		if tok.text == "!" {
+			if err := p.expect(tok, operand, exprBool, "!"); err != nil {
+				return operand, err
+			}
+			b := operand.b
+			return exprNode{typ: exprBool, b: func(ev *AccessEvent) bool { return !b(ev) }}, nil
+		}
+		if err := p.expect(tok, operand, exprNum, "-"); err != nil {
+			return operand, err
+		}
+		n := operand.n
+		return exprNode{typ: exprNum, n: func(ev *AccessEvent) float64 { return -n(ev) }}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNum:
+		v := tok.num
+		return exprNode{typ: exprNum, n: func(*AccessEvent) float64 { return v }}, nil
+	case tokStr:
+		v := tok.text
+		return exprNode{typ: exprStr, s: func(*AccessEvent) string { return v }}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			v := tok.text == "true"
+			return exprNode{typ: exprBool, b: func(*AccessEvent) bool { return v }}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		if v, ok := exprVars[tok.text]; ok {
+			return v, nil
+		}
+		return exprNode{}, p.errorf(tok, "unknown variable %q", tok.text)
+	case tokOp:
+		if tok.text == "(" {
+			n, err := p.parseOr()
+			if err != nil {
+				return n, err
+			}
+			if closing, ok := p.accept(")"); !ok {
+				return n, p.errorf(closing, "expected ), got %q", closing.text)
+			}
+			return n, nil
+		}
+	}
+	return exprNode{}, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return exprNode{}, p.errorf(name, "unknown function %q", name.text)
+	}
+	var args []exprNode
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return arg, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); ok {
+				continue
+			}
+			if closing, ok := p.accept(")"); !ok {
+				return arg, p.errorf(closing, "expected , or ) in call to %s, got %q", name.text, closing.text)
+			}
+			break
+		}
+	}
+	if len(args) != len(fn.args) {
+		return exprNode{}, p.errorf(name, "%s expects %d argument(s), got %d", name.text, len(fn.args), len(args))
+	}
+	for i, typ := range fn.args {
+		if args[i].typ != typ {
+			return exprNode{}, p.errorf(name, "argument %d of %s must be %s, got %s", i+1, name.text, typ, args[i].typ)
+		}
+	}
+	return fn.compile(args), nil
+}
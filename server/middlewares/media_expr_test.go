@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMediaExprEval(t *testing.T) {
+	size := int64(2 << 30)
+	ev := &AccessEvent{
+		Event:       EventAccess,
+		Path:        "/Movies/Interstellar.MKV",
+		Username:    "alice",
+		Status:      200,
+		BytesServed: &size,
+		Time:        time.Date(2025, 7, 12, 3, 0, 0, 0, time.Local),
+	}
+	cases := map[string]bool{
+		`ext == ".mkv" && bytes > 1<<30 && user != "admin" && hour(time) < 6`: true,
+		`ext == ".mkv" && bytes > 4<<30`:                                      false,
+		`user == 'alice' || user == "bob"`:                                    true,
+		`!(status >= 400) && startsWith(path, "/Movies/")`:                    true,
+		`contains(lower(path), "interstellar") && !tor`:                       true,
+		`endsWith(path, ".mp4")`:                                              false,
+		`status % 100 == 0 && -status < 0 && (status / 2) * 2 - 1 == 199`:     true,
+		`weekday(time) == 6`:                                                  true,
+		`"a" + "b" == "ab" && "a" < "b"`:                                      true,
+		`provider == "" && redirect_host == ""`:                               true,
+		`traffic != "scan"`:                                                   true,
+		`true != false`:                                                       true,
+	}
+	for src, want := range cases {
+		got, err := EvalMediaExpr(src, ev)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestMediaExprCompileErrors(t *testing.T) {
+	cases := map[string]string{
+		`ext == `:             "position 8",
+		`ext == 1`:            "cannot compare string with number",
+		`size > 1`:            `unknown variable "size"`,
+		`hour(path) < 6`:      "argument 1 of hour must be time",
+		`foo(path)`:           `unknown function "foo"`,
+		`status + 1`:          "expression must be a bool",
+		`"abc`:                "unterminated string",
+		`user == "a" & true`:  "unexpected character",
+		`(status == 200`:      "expected )",
+		`1 < status < 3`:      "cannot be chained",
+		`time > time`:         "use hour() or weekday()",
+		`contains(path)`:      "expects 2 argument(s), got 1",
+		`status == 200 200`:   `unexpected "200"`,
+		`!status`:             "! needs bool, got number",
+		`tor < true`:          "not defined on bool",
+		`status == 12abc`:     "invalid number",
+		`user == "a" || 1`:    "|| needs bool",
+		`user == "a" && path`: "&& needs bool",
+	}
+	for src, want := range cases {
+		_, err := compileMediaExpr(src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want containing %q", src, err, want)
+		}
+	}
+	if e, err := compileMediaExpr("  "); e != nil || err != nil {
+		t.Errorf("empty expression should compile to nil, got %v %v", e, err)
+	}
+}
+
+func TestMediaLogExprFiltersEvents(t *testing.T) {
+	e, err := compileMediaExpr(`user != "admin"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMediaLogExpr(e)
+	defer setMediaLogExpr(nil)
+	sink := &recordingSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+
+	o := newMediaLoggerOptions()
+	logMediaAccess(o, &AccessEvent{Event: EventAccess, Method: "GET", Username: "admin", Path: "/a.mp4"})
+	logMediaAccess(o, &AccessEvent{Event: EventAccess, Method: "GET", Username: "alice", Path: "/b.mp4"})
+	if len(sink.paths) != 1 || sink.paths[0] != "/b.mp4" {
+		t.Fatalf("logged %v, want [/b.mp4]", sink.paths)
+	}
+}
+
+func BenchmarkMediaExprEval(b *testing.B) {
+	e, err := compileMediaExpr(`ext == ".mkv" && bytes > 1<<30 && user != "admin" && hour(time) < 6`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	size := int64(2 << 30)
+	ev := &AccessEvent{Path: "/Movies/a.mkv", Username: "alice", BytesServed: &size, Time: time.Now()}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e.match(ev)
+	}
+}
@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	feishuWebhookURL = "https://open.feishu.cn/open-apis/bot/v2/hook/"
+	// 自定义机器人限制为每分钟 100 次、每秒 5 次
+	defaultFeishuWindow = 10 * time.Second
+	feishuMinInterval   = time.Second
+	// 卡片中最多列出的事件数，超出的只给出数量
+	feishuMaxCardEvents = 20
+)
+
+// feishuSink 通过飞书自定义机器人发送消息卡片或文本消息
+// 配置了 secret 时在请求体中附带 timestamp 和 sign 用于签名校验
+type feishuSink struct {
+	url     string
+	secret  string
+	text    bool
+	client  *http.Client
+	pacer   botPacer
+	retries atomic.Int64
+}
+
+// newFeishuSink 创建飞书机器人 sink，URL 为空时使用官方地址并以 Token 作为 webhook 的 hook id
+func newFeishuSink(cfg conf.MediaLogNotifier) *feishuSink {
+	u := cfg.URL
+	if u == "" {
+		u = feishuWebhookURL + cfg.Token
+	}
+	return &feishuSink{
+		url:    u,
+		secret: cfg.Secret,
+		text:   cfg.Format == "text",
+		client: &http.Client{Timeout: 10 * time.Second},
+		pacer:  botPacer{interval: feishuMinInterval},
+	}
+}
+
+// sign 按飞书的规则计算签名：以 "timestamp\nsecret" 为密钥对空字符串做 HmacSHA256 后 Base64
+func (s *feishuSink) sign(timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+s.secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *feishuSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *feishuSink) WriteBatch(evs []*AccessEvent) error {
+	events := coalesceEvents(evs)
+	var payload map[string]any
+	if s.text {
+		lines := make([]string, 0, len(events))
+		for _, ce := range events {
+			lines = append(lines, summarizeEvent(ce))
+		}
+		payload = map[string]any{
+			"msg_type": "text",
+			"content":  map[string]string{"text": strings.Join(lines, "\n")},
+		}
+	} else {
+		payload = map[string]any{
+			"msg_type": "interactive",
+			"card":     feishuCard(events),
+		}
+	}
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = s.sign(timestamp)
+	}
+	s.pacer.wait()
+	return postBotMessage(s.client, s.url, payload, &s.retries)
+}
+
+func feishuCard(events []*coalescedEvent) map[string]any {
+	title := eventFileName(events[0].AccessEvent)
+	if len(events) > 1 {
+		title = fmt.Sprintf("%d 条媒体访问", len(events))
+	}
+	color := "blue"
+	elements := make([]map[string]any, 0, min(len(events), feishuMaxCardEvents)+1)
+	for i, ce := range events {
+		if isAlertEvent(ce.Event) {
+			color = "red"
+		}
+		if i >= feishuMaxCardEvents {
+			continue
+		}
+		content := fmt.Sprintf("**路径**：%s\n**用户**：%s\n**IP**：%s\n**时间**：%s",
+			ce.Path, orDash(ce.Username), orDash(ce.ClientIP), ce.Time.Format("2006-01-02 15:04:05"))
+		if ce.Count > 1 {
+			content += fmt.Sprintf("\n**次数**：%d", ce.Count)
+		}
+		if link := mediaHistoryURL(ce.Path); link != "" {
+			content += fmt.Sprintf("\n[查看访问记录](%s)", link)
+		}
+		elements = append(elements, map[string]any{
+			"tag":  "div",
+			"text": map[string]string{"tag": "lark_md", "content": content},
+		})
+	}
+	if rest := len(events) - feishuMaxCardEvents; rest > 0 {
+		elements = append(elements, map[string]any{
+			"tag":  "div",
+			"text": map[string]string{"tag": "lark_md", "content": fmt.Sprintf("…… 还有 %d 条", rest)},
+		})
+	}
+	return map[string]any{
+		"header": map[string]any{
+			"title":    map[string]string{"tag": "plain_text", "content": title},
+			"template": color,
+		},
+		"elements": elements,
+	}
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestFeishuSign(t *testing.T) {
+	sink := newFeishuSink(conf.MediaLogNotifier{Token: "hook", Secret: "SEC123"})
+	if sink.url != feishuWebhookURL+"hook" {
+		t.Fatalf("url = %q", sink.url)
+	}
+	// printf "" | openssl dgst -sha256 -hmac "$(printf "1700000000\nSEC123")" -binary | base64
+	if got, want := sink.sign("1700000000"), "j/tImR0k8vYXRsYw0+GHVQkV1v/J/8obOuMU7PE/KDo="; got != want {
+		t.Fatalf("sign = %q, want %q", got, want)
+	}
+}
+
+func TestFeishuSinkCard(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		_, _ = w.Write([]byte(`{"code":0,"msg":"success"}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	sink := newFeishuSink(conf.MediaLogNotifier{URL: srv.URL, Secret: "s"})
+	if err := sink.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		MsgType   string `json:"msg_type"`
+		Timestamp string `json:"timestamp"`
+		Sign      string `json:"sign"`
+		Card      struct {
+			Elements []struct {
+				Text struct {
+					Content string `json:"content"`
+				} `json:"text"`
+			} `json:"elements"`
+		} `json:"card"`
+	}
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != "interactive" || got.Timestamp == "" || got.Sign != sink.sign(got.Timestamp) {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+	content := got.Card.Elements[0].Text.Content
+	for _, want := range []string{"/movies/Interstellar.mkv", "alice", "10.0.0.1"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("card content %q does not contain %q", content, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package middlewares
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogField 是 WithFieldOrder 中可以输出的字段
+type LogField int
+
+const (
+	// FieldTimestamp 为事件时间，格式为 RFC 3339，例如 2025-07-12T15:10:36+08:00
+	FieldTimestamp LogField = iota
+	FieldIP
+	// FieldPath 为按 URL 编码的路径，空格等字符不会被当作字段分隔
+	FieldPath
+	FieldUsername
+	FieldStatus
+	// FieldBytes 为文件大小的字节数，与结构化输出中的 bytes 字段相同
+	FieldBytes
+	// FieldLatency 为请求开始处理到记录日志的耗时（毫秒）
+	FieldLatency
+	// FieldCategory 为媒体类别：video、audio 或 image
+	FieldCategory
+	// FieldRegion 为 WithRegionLabel 设置的区域
+	FieldRegion
+)
+
+// LogFieldOrder 是文本日志中字段的输出顺序
+type LogFieldOrder []LogField
+
+// WithFieldOrder 让文本日志只按给定顺序输出列出的字段，字段之间以空格分隔，不带标签，
+// 没有值的字段写为 -，方便按位置解析日志的工具使用，例如
+//
+//	WithFieldOrder(FieldIP, FieldUsername, FieldTimestamp, FieldPath, FieldStatus, FieldBytes)
+//
+// 不影响发送给 sink 的事件；不设置时使用默认的中文标签格式
+func WithFieldOrder(order ...LogField) Option {
+	return func(o *mediaLoggerOptions) {
+		o.fieldOrder = append(LogFieldOrder(nil), order...)
+	}
+}
+
+// formatLine 返回事件在文本日志中的一行
+func (o *mediaLoggerOptions) formatLine(ev *AccessEvent) string {
+	if len(o.fieldOrder) == 0 {
+		return formatMediaLog(ev)
+	}
+	return o.fieldOrder.format(ev)
+}
+
+// format 按顺序输出字段，未知的字段被忽略
+func (order LogFieldOrder) format(ev *AccessEvent) string {
+	values := make([]string, 0, len(order))
+	for _, field := range order {
+		if v, ok := logFieldValue(ev, field); ok {
+			if v == "" {
+				v = "-"
+			}
+			values = append(values, v)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func logFieldValue(ev *AccessEvent, field LogField) (string, bool) {
+	switch field {
+	case FieldTimestamp:
+		return ev.Time.Format(time.RFC3339), true
+	case FieldIP:
+		return ev.ClientIP, true
+	case FieldPath:
+		return (&url.URL{Path: ev.Path}).EscapedPath(), true
+	case FieldUsername:
+		if ev.Username == "未知用户" {
+			return "", true
+		}
+		return combinedField(ev.Username), true
+	case FieldStatus:
+		if ev.Status == 0 {
+			return "", true
+		}
+		return strconv.Itoa(ev.Status), true
+	case FieldBytes:
+		if ev.Bytes == nil {
+			return "", true
+		}
+		return strconv.FormatInt(*ev.Bytes, 10), true
+	case FieldLatency:
+		if ev.startedAt.IsZero() {
+			return "", true
+		}
+		return strconv.FormatInt(time.Since(ev.startedAt).Milliseconds(), 10), true
+	case FieldCategory:
+		return mediaCategoryOf(ev.Path), true
+	case FieldRegion:
+		return combinedField(ev.Region), true
+	}
+	return "", false
+}
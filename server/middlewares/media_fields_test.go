@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestWithFieldOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldSlices := conf.SlicesMap
+	conf.SlicesMap = map[string][]string{conf.VideoTypes: {"mp4"}}
+	defer func() { conf.SlicesMap = oldSlices }()
+
+	logger, hook := logtest.NewNullLogger()
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger),
+		WithFieldOrder(FieldIP, FieldUsername, FieldTimestamp, FieldPath, FieldStatus, FieldBytes, FieldLatency, FieldCategory)),
+		func(c *gin.Context) {
+			c.Set("user", &model.User{Username: "alice smith"})
+			c.Next()
+		})
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "video") })
+
+	req := httptest.NewRequest(http.MethodGet, "/d/movies/my%20movie.mp4", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+	want := regexp.MustCompile(`^203\.0\.113\.7 alice\\x20smith (\S+) /d/movies/my%20movie\.mp4 200 5 \d+ video$`)
+	m := want.FindStringSubmatch(entries[0].Message)
+	if m == nil {
+		t.Fatalf("log message %q", entries[0].Message)
+	}
+	if _, err := time.Parse(time.RFC3339, m[1]); err != nil {
+		t.Fatalf("timestamp %q: %v", m[1], err)
+	}
+}
+
+func TestLogFieldOrderMissingValues(t *testing.T) {
+	ev := &AccessEvent{Time: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC), Username: "未知用户", Path: "/docs/a.txt"}
+	order := LogFieldOrder{FieldTimestamp, FieldUsername, FieldStatus, FieldBytes, FieldLatency, FieldCategory, LogField(99)}
+	if got := order.format(ev); got != "2025-07-12T15:10:36Z - - - - -" {
+		t.Fatalf("format = %q", got)
+	}
+	// 默认格式不变
+	if line := (&mediaLoggerOptions{}).formatLine(ev); !strings.HasPrefix(line, "时间：") {
+		t.Fatalf("default line %q", line)
+	}
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密的媒体日志文件由若干独立的块组成，每次写入对应一个块：
+//
+//	magic(4) | salt(16) | nonce(12) | 密文长度(4, 大端) | AES-256-GCM 密文
+//
+// 密钥由口令和 salt 通过 scrypt 派生，同一进程写入的块使用同一个 salt；块头作为附加数据参与校验
+// 每个块都可以单独解密，所以按大小切割、gzip 压缩和按时间清理都不受影响
+// magic 以 0 字节开头，不会和文本日志行混淆，开启加密之前写入的明文日志行解密时原样输出
+var mediaLogChunkMagic = []byte{0, 'O', 'L', 'M'}
+
+const (
+	mediaLogSaltSize   = 16
+	mediaLogHeaderSize = 4 + mediaLogSaltSize + 12 + 4
+	// 单个块的最大长度，用于在文件损坏时避免分配过大的内存
+	mediaLogMaxChunk = 16 << 20
+)
+
+var errMediaLogPassphrase = errors.New("wrong passphrase or corrupted media log")
+
+type mediaLogCipher struct {
+	aead cipher.AEAD
+	salt []byte
+}
+
+// newMediaLogCipher 使用随机 salt 从口令派生密钥
+func newMediaLogCipher(passphrase string) (*mediaLogCipher, error) {
+	if passphrase == "" {
+		return nil, errors.New("media log passphrase is empty")
+	}
+	salt := make([]byte, mediaLogSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := mediaLogAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &mediaLogCipher{aead: aead, salt: salt}, nil
+}
+
+func mediaLogAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 把 p 加密为一个完整的块
+func (m *mediaLogCipher) seal(p []byte) ([]byte, error) {
+	out := make([]byte, mediaLogHeaderSize, mediaLogHeaderSize+len(p)+m.aead.Overhead())
+	copy(out, mediaLogChunkMagic)
+	copy(out[4:], m.salt)
+	nonce := out[4+mediaLogSaltSize : 4+mediaLogSaltSize+12]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(out[mediaLogHeaderSize-4:], uint32(len(p)+m.aead.Overhead()))
+	return m.aead.Seal(out, nonce, p, out[:mediaLogHeaderSize]), nil
+}
+
+// DecryptMediaLog 解密 src 中的媒体日志并写入 dst，src 可以是切割后经过 gzip 压缩的文件
+// 没有加密的日志行原样输出；口令错误或文件损坏时返回错误，此前已解密的内容已经写入 dst
+func DecryptMediaLog(dst io.Writer, src io.Reader, passphrase string) error {
+	r := bufio.NewReader(src)
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = bufio.NewReader(gz)
+	}
+	aeads := make(map[string]cipher.AEAD)
+	header := make([]byte, mediaLogHeaderSize)
+	for offset := int64(0); ; {
+		prefix, err := r.Peek(len(mediaLogChunkMagic))
+		if len(prefix) == 0 && err == io.EOF {
+			return nil
+		}
+		if !bytes.Equal(prefix, mediaLogChunkMagic) {
+			line, err := r.ReadBytes('\n')
+			if _, werr := dst.Write(line); werr != nil {
+				return werr
+			}
+			offset += int64(len(line))
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("truncated media log chunk at offset %d", offset)
+		}
+		size := binary.BigEndian.Uint32(header[mediaLogHeaderSize-4:])
+		if size > mediaLogMaxChunk {
+			return fmt.Errorf("invalid media log chunk at offset %d", offset)
+		}
+		ciphertext := make([]byte, size)
+		if _, err := io.ReadFull(r, ciphertext); err != nil {
+			return fmt.Errorf("truncated media log chunk at offset %d", offset)
+		}
+		salt := string(header[4 : 4+mediaLogSaltSize])
+		aead, ok := aeads[salt]
+		if !ok {
+			if aead, err = mediaLogAEAD(passphrase, []byte(salt)); err != nil {
+				return err
+			}
+			aeads[salt] = aead
+		}
+		plaintext, err := aead.Open(nil, header[4+mediaLogSaltSize:mediaLogHeaderSize-4], ciphertext, header)
+		if err != nil {
+			return fmt.Errorf("media log chunk at offset %d: %w", offset, errMediaLogPassphrase)
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return err
+		}
+		offset += int64(mediaLogHeaderSize) + int64(size)
+	}
+}
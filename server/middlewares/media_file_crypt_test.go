@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestEncryptedMediaFileLogger(t *testing.T) {
+	dir := t.TempDir()
+	logName := filepath.Join(dir, "media.log")
+
+	// 开启加密之前写入的明文日志
+	plain := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if _, err := plain.Write([]byte("plain line\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = plain.Close()
+
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	if err := logger.EncryptWith("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"alice /movies/a.mkv\n", "bob /movies/b.mp4\n"} {
+		if n, err := logger.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	_ = logger.Close()
+
+	data, err := os.ReadFile(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("alice")) {
+		t.Fatal("log file contains plaintext")
+	}
+
+	want := "plain line\nalice /movies/a.mkv\nbob /movies/b.mp4\n"
+	var out bytes.Buffer
+	if err := DecryptMediaLog(&out, bytes.NewReader(data), "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Fatalf("decrypted %q, want %q", out.String(), want)
+	}
+
+	// 切割后压缩的文件
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	out.Reset()
+	if err := DecryptMediaLog(&out, &gz, "correct horse"); err != nil || out.String() != want {
+		t.Fatalf("decrypt gzip = %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	err = DecryptMediaLog(&out, bytes.NewReader(data), "wrong")
+	if !errors.Is(err, errMediaLogPassphrase) {
+		t.Fatalf("wrong passphrase: err = %v", err)
+	}
+	if strings.Contains(err.Error(), "correct horse") {
+		t.Fatalf("error leaks passphrase: %v", err)
+	}
+
+	if err := DecryptMediaLog(&out, bytes.NewReader(data[:len(data)-3]), "correct horse"); err == nil {
+		t.Fatal("expected error for truncated file")
+	}
+}
+
+func TestResolveMediaLogFile(t *testing.T) {
+	logName := filepath.Join("data", "log", "media.log")
+	valid := map[string]string{
+		"":                                     logName,
+		"media.log":                            logName,
+		"media-2025-07-12T15-10-36.000.log":    filepath.Join("data", "log", "media-2025-07-12T15-10-36.000.log"),
+		"media-2025-07-12T15-10-36.000.log.gz": filepath.Join("data", "log", "media-2025-07-12T15-10-36.000.log.gz"),
+	}
+	for name, want := range valid {
+		if got, err := ResolveMediaLogFile(logName, name); err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"../config.json", "media-x.log/../../config.json", "data.db", "media-1.txt", `media-..\config.log`} {
+		if _, err := ResolveMediaLogFile(logName, name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+}
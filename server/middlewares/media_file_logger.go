@@ -0,0 +1,220 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/natefinch/lumberjack"
+	log "github.com/sirupsen/logrus"
+)
+
+// MediaFileLogger 将媒体访问日志单独写入文件，文件按大小自动切割
+type MediaFileLogger struct {
+	logger *lumberjack.Logger
+	// 可选的磁盘空间检查，空间不足时不写文件
+	guard *diskSpaceGuard
+	// 配置了口令时每次写入的内容加密后再写入文件
+	cipher *mediaLogCipher
+	// 开启审计链时审计事件的日志行带有哈希链
+	chain *auditChain
+	// 日志行的格式，为空时与 text 相同
+	format string
+	// w3c 格式写入时判断是否需要写入文件开头的指令，也保护 format 在 SIGHUP 处理时的读取
+	mu sync.Mutex
+}
+
+// NewMediaFileLogger 根据日志配置创建媒体日志文件
+func NewMediaFileLogger(logConfig conf.LogConfig) *MediaFileLogger {
+	return &MediaFileLogger{
+		logger: &lumberjack.Logger{
+			Filename:   logConfig.Name,
+			MaxSize:    logConfig.MaxSize, // megabytes
+			MaxBackups: logConfig.MaxBackups,
+			MaxAge:     logConfig.MaxAge, //days
+			Compress:   logConfig.Compress,
+		},
+	}
+}
+
+func (l *MediaFileLogger) Write(p []byte) (int, error) {
+	if l.guard != nil && !l.guard.allow() {
+		return 0, errMediaLogDiskLow
+	}
+	if l.cipher == nil {
+		return l.logger.Write(p)
+	}
+	chunk, err := l.cipher.seal(p)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := l.logger.Write(chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// EncryptWith 使用口令加密之后写入的日志，加密后的文件可以通过 DecryptMediaLog 解密
+func (l *MediaFileLogger) EncryptWith(passphrase string) error {
+	c, err := newMediaLogCipher(passphrase)
+	if err != nil {
+		return err
+	}
+	l.cipher = c
+	return nil
+}
+
+// SetFormat 设置之后写入的日志行格式，支持 text、combined、nginx、w3c 和 cef，为空时使用 text
+func (l *MediaFileLogger) SetFormat(format string) error {
+	switch format {
+	case "", MediaFileFormatText, MediaFileFormatCombined, MediaFileFormatNginx, MediaFileFormatCEF, MediaFileFormatW3C:
+		l.mu.Lock()
+		l.format = format
+		l.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("unknown media log file format: %s", format)
+}
+
+// EnableAuditChain 为之后写入的审计事件开启哈希链，链头保存在日志文件旁的 .chain 文件中，重启后继续之前的链
+func (l *MediaFileLogger) EnableAuditChain() error {
+	chain, err := loadAuditChain(auditChainHeadPath(l.logger.Filename))
+	if err != nil {
+		return err
+	}
+	l.chain = chain
+	return nil
+}
+
+// writeEntry 写入一行日志，开启审计链时审计事件的日志行会追加链上的哈希
+// combined、nginx 和 w3c 格式只写入普通的访问事件，cef 格式写入所有事件但不使用审计链
+func (l *MediaFileLogger) writeEntry(ev *AccessEvent, line string) error {
+	switch l.format {
+	case MediaFileFormatW3C:
+		if !isPlainAccessEvent(ev.Event) {
+			return nil
+		}
+		return l.writeW3C(ev)
+	case MediaFileFormatCEF:
+		_, err := l.Write([]byte(formatCEF(ev) + "\n"))
+		return err
+	case MediaFileFormatCombined, MediaFileFormatNginx:
+		if !isPlainAccessEvent(ev.Event) {
+			return nil
+		}
+		if l.format == MediaFileFormatNginx {
+			line = formatNginxLog(ev)
+		} else {
+			line = formatCombinedLog(ev)
+		}
+		_, err := l.Write([]byte(line + "\n"))
+		return err
+	}
+	if l.chain == nil || isPlainAccessEvent(ev.Event) {
+		_, err := l.Write([]byte(line + "\n"))
+		return err
+	}
+	return l.chain.append(line, func(sealed string) error {
+		_, err := l.Write([]byte(sealed + "\n"))
+		return err
+	})
+}
+
+// Filename 返回当前日志文件的路径，切割后的文件与它位于同一目录
+func (l *MediaFileLogger) Filename() string {
+	return l.logger.Filename
+}
+
+// GuardDiskSpace 在剩余空间低于 minFree 字节时停止写入文件，剩余空间最多每 interval 检查一次
+// 空间不足时会切割一次日志文件，配置了 MaxBackups、MaxAge、Compress 时旧文件会被清理或压缩
+func (l *MediaFileLogger) GuardDiskSpace(minFree uint64, interval time.Duration) {
+	l.guard = newDiskSpaceGuard(filepath.Dir(l.logger.Filename), minFree, interval, l.Rotate)
+}
+
+// Rotate 关闭当前日志文件并重命名为备份，然后打开新的日志文件
+func (l *MediaFileLogger) Rotate() error {
+	return l.logger.Rotate()
+}
+
+func (l *MediaFileLogger) Close() error {
+	return l.logger.Close()
+}
+
+// ResolveMediaLogFile 返回日志文件 logName 所在目录中名为 name 的日志文件路径，name 为空时返回 logName
+// name 只能是 logName 本身或者它切割后的备份（例如 media-2025-07-12T15-10-36.000.log.gz），不能包含目录
+func ResolveMediaLogFile(logName, name string) (string, error) {
+	base := filepath.Base(logName)
+	if name == "" || name == base {
+		return logName, nil
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if filepath.Base(name) != name || strings.ContainsAny(name, `/\`) ||
+		!strings.HasPrefix(name, stem+"-") ||
+		!(strings.HasSuffix(name, ext) || strings.HasSuffix(name, ext+".gz")) {
+		return "", fmt.Errorf("invalid media log file name: %s", name)
+	}
+	return filepath.Join(filepath.Dir(logName), name), nil
+}
+
+var mediaFileLogger atomic.Pointer[MediaFileLogger]
+
+// SetMediaFileLogger 设置媒体访问日志额外写入的文件，传入 nil 则不再写文件
+func SetMediaFileLogger(l *MediaFileLogger) {
+	mediaFileLogger.Store(l)
+}
+
+func writeMediaFileLog(ev *AccessEvent, line string) {
+	if l := mediaFileLogger.Load(); l != nil {
+		if err := l.writeEntry(ev, line); err != nil && !errors.Is(err, errMediaLogDiskLow) {
+			log.Errorf("failed to write media log file: %+v", err)
+		}
+	}
+}
+
+// textFormat 判断日志行是否为 text 格式
+func (l *MediaFileLogger) textFormat() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.format == "" || l.format == MediaFileFormatText
+}
+
+// RotateOnSignal 收到 SIGHUP 时切割日志文件，配合 logrotate 等外部工具使用
+// 返回的函数用于停止监听信号，可以重复调用
+func RotateOnSignal(logger *MediaFileLogger) func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := logger.Rotate(); err != nil {
+					log.Errorf("failed to rotate media log file: %+v", err)
+					continue
+				}
+				// 其他格式的文件交给其他工具分析，不写入其他内容
+				if logger.textFormat() {
+					_, _ = fmt.Fprintf(logger, "时间：%s log rotated\n", time.Now().Format("2006年1月2日 15:04:05"))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(hup)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package middlewares
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestRotateOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	logName := filepath.Join(dir, "media.log")
+	logger := NewMediaFileLogger(conf.LogConfig{Name: logName, MaxSize: 10})
+	defer logger.Close()
+	if _, err := logger.Write([]byte("before rotate\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := RotateOnSignal(logger)
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(logName)
+		if len(entries) == 2 && strings.Contains(string(data), "log rotated") {
+			if strings.Contains(string(data), "before rotate") {
+				t.Fatalf("new log file still contains old entries: %q", data)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("log file was not rotated after SIGHUP")
+}
+
+func TestRotateOnSignalStopTwice(t *testing.T) {
+	logger := NewMediaFileLogger(conf.LogConfig{Name: filepath.Join(t.TempDir(), "media.log")})
+	defer logger.Close()
+	stop := RotateOnSignal(logger)
+	stop()
+	// 重复调用不会 panic
+	stop()
+}
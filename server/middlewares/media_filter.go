@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"io"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// mediaEventFilter 按路径前缀、事件类型和用户筛选事件，未配置的条件视为不限制
+type mediaEventFilter struct {
+	pathPrefixes []string
+	events       map[string]struct{}
+	users        map[string]struct{}
+}
+
+func newMediaEventFilter(cfg conf.MediaLogFilter) *mediaEventFilter {
+	f := &mediaEventFilter{}
+	for _, prefix := range cfg.PathPrefixes {
+		f.pathPrefixes = append(f.pathPrefixes, normalizeMediaPath(prefix))
+	}
+	if len(cfg.Events) > 0 {
+		f.events = make(map[string]struct{}, len(cfg.Events))
+		for _, event := range cfg.Events {
+			f.events[event] = struct{}{}
+		}
+	}
+	if len(cfg.Users) > 0 {
+		f.users = make(map[string]struct{}, len(cfg.Users))
+		for _, user := range cfg.Users {
+			f.users[user] = struct{}{}
+		}
+	}
+	return f
+}
+
+func (f *mediaEventFilter) match(ev *AccessEvent) bool {
+	if len(f.pathPrefixes) > 0 {
+		// 按虚拟路径匹配，/d/、/p/ 下载的文件和 /api/fs/get 的记录使用同样的前缀；
+		// 原始路径仍然参与匹配，已有的 /d/... 前缀配置继续有效
+		p := mediaVirtualPath(ev.Path)
+		matched := false
+		for _, prefix := range f.pathPrefixes {
+			if strings.HasPrefix(p, prefix) || strings.HasPrefix(ev.Path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.events != nil {
+		if _, ok := f.events[ev.Event]; !ok {
+			return false
+		}
+	}
+	if f.users != nil {
+		if _, ok := f.users[ev.Username]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// filteredSink 只把满足条件的事件交给下层 sink，被过滤掉的事件按 name 计数
+type filteredSink struct {
+	name   string
+	filter *mediaEventFilter
+	inner  MediaLogSink
+	// 可选的过滤表达式，与 filter 同时满足时才写入
+	expr *mediaExpr
+}
+
+func (s *filteredSink) Write(ev *AccessEvent) error {
+	if !s.filter.match(ev) || !s.expr.match(ev) {
+		pipelineMetrics.suppress(s.name)
+		if acksDeferred(s.inner) {
+			ev.spool.ack()
+		}
+		return nil
+	}
+	return s.inner.Write(ev)
+}
+
+func (s *filteredSink) acksDeferred() bool { return acksDeferred(s.inner) }
+
+func (s *filteredSink) Close() error {
+	if closer, ok := s.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
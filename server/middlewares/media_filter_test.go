@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestMediaEventFilter(t *testing.T) {
+	ev := testAccessEvent()
+	cases := []struct {
+		name string
+		cfg  conf.MediaLogFilter
+		want bool
+	}{
+		{"empty", conf.MediaLogFilter{}, true},
+		{"prefix", conf.MediaLogFilter{PathPrefixes: []string{"/music", "/movies"}}, true},
+		{"other prefix", conf.MediaLogFilter{PathPrefixes: []string{"/music"}}, false},
+		{"event", conf.MediaLogFilter{Events: []string{EventAccess}}, true},
+		{"other event", conf.MediaLogFilter{Events: []string{"blocked"}}, false},
+		{"user", conf.MediaLogFilter{Users: []string{"bob", "alice"}}, true},
+		{"other user", conf.MediaLogFilter{Users: []string{"bob"}}, false},
+		{"all", conf.MediaLogFilter{PathPrefixes: []string{"/movies"}, Events: []string{EventAccess}, Users: []string{"bob"}}, false},
+	}
+	for _, tc := range cases {
+		if got := newMediaEventFilter(tc.cfg).match(ev); got != tc.want {
+			t.Errorf("%s: match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMediaEventFilterRoutePrefix(t *testing.T) {
+	f := newMediaEventFilter(conf.MediaLogFilter{PathPrefixes: []string{"/private/"}})
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"/private/a.mp4", true},
+		{"/d/private/a.mp4", true},
+		{"/p/private/a.mp4", true},
+		{"/d/public/private/a.mp4", false},
+		{"/p/public/a.mp4", false},
+	} {
+		if got := f.match(&AccessEvent{Event: EventAccess, Path: tc.path}); got != tc.want {
+			t.Errorf("%s: match = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	// 已有的带路由前缀的配置仍然匹配
+	if !newMediaEventFilter(conf.MediaLogFilter{PathPrefixes: []string{"/d/private/"}}).match(&AccessEvent{Path: "/d/private/a.mp4"}) {
+		t.Error("route prefix in the filter no longer matches")
+	}
+}
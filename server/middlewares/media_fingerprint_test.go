@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContentFingerprintMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(ContentFingerprintMiddleware("s3cret"))
+	r.GET("/d/*path", func(c *gin.Context) {
+		if c.Param("path") == "/error.mp4" {
+			c.JSON(http.StatusOK, gin.H{"code": 401, "message": "unauthorized"})
+			return
+		}
+		c.Data(http.StatusOK, "video/mp4", []byte("data"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil))
+	token := w.Header().Get("X-Content-Token")
+	if token == "" {
+		t.Fatal("missing X-Content-Token")
+	}
+	now := time.Now()
+	if !VerifyContentToken("/d/movies/a.mp4", token, "s3cret", now) {
+		t.Error("token should verify for the served path")
+	}
+	if VerifyContentToken("/d/movies/b.mp4", token, "s3cret", now) {
+		t.Error("token should not verify for another path")
+	}
+	if VerifyContentToken("/d/movies/a.mp4", token, "other", now) {
+		t.Error("token should not verify with another secret")
+	}
+	if VerifyContentToken("/d/movies/a.mp4", token, "s3cret", now.Add(-48*time.Hour)) {
+		t.Error("token should not verify for another day")
+	}
+
+	for _, p := range []string{"/d/error.mp4", "/d/notes.txt"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if got := w.Header().Get("X-Content-Token"); got != "" {
+			t.Errorf("%s: unexpected X-Content-Token %q", p, got)
+		}
+	}
+}
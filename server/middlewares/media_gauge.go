@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// 并发统计的媒体类别，按后台设置中的视频、音频、图片类型划分
+const (
+	MediaCategoryVideo = "video"
+	MediaCategoryAudio = "audio"
+	MediaCategoryImage = "image"
+)
+
+// fileRoutePrefixes 是直接传输文件内容的路由，/api/fs 下的请求只返回文件信息，不计入
+var fileRoutePrefixes = []string{"/d", "/p", "/dav"}
+
+// ConcurrentAccessGauge 统计每个媒体类别正在处理的请求数，
+// 请求开始处理前加一，处理完成（包括传输完文件内容）后减一
+type ConcurrentAccessGauge struct {
+	video atomic.Int64
+	audio atomic.Int64
+	image atomic.Int64
+}
+
+func (g *ConcurrentAccessGauge) counter(category string) *atomic.Int64 {
+	switch category {
+	case MediaCategoryVideo:
+		return &g.video
+	case MediaCategoryAudio:
+		return &g.audio
+	case MediaCategoryImage:
+		return &g.image
+	}
+	return nil
+}
+
+// GaugeSnapshot 返回每个类别当前正在处理的请求数，没有请求的类别为 0
+func (g *ConcurrentAccessGauge) GaugeSnapshot() map[string]int64 {
+	return map[string]int64{
+		MediaCategoryVideo: g.video.Load(),
+		MediaCategoryAudio: g.audio.Load(),
+		MediaCategoryImage: g.image.Load(),
+	}
+}
+
+// Middleware 返回统计并发请求的中间件，后台任务的内部请求不计入
+func (g *ConcurrentAccessGauge) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		counter := g.counter(fileRouteCategory(c.Request.URL.Path))
+		if counter == nil || isInternalRequest(c) {
+			c.Next()
+			return
+		}
+		counter.Add(1)
+		defer counter.Add(-1)
+		c.Next()
+	}
+}
+
+var mediaAccessGauge = &ConcurrentAccessGauge{}
+
+// ConcurrentAccessGaugeMiddleware 使用全局的 ConcurrentAccessGauge 统计并发的视频、音频、图片请求，
+// 结果通过 /api/admin/media-stats 和 /api/admin/media-metrics 查看
+func ConcurrentAccessGaugeMiddleware() gin.HandlerFunc {
+	return mediaAccessGauge.Middleware()
+}
+
+// fileRouteCategory 返回文件路由请求的媒体类别，不是文件路由或者不是媒体文件时返回空
+func fileRouteCategory(p string) string {
+	if conf.URL != nil {
+		if base := strings.TrimSuffix(conf.URL.Path, "/"); base != "" {
+			if !hasRoutePrefix(p, []string{base}) {
+				return ""
+			}
+			p = strings.TrimPrefix(p, base)
+		}
+	}
+	if !hasRoutePrefix(p, fileRoutePrefixes) || isTempDownload(p) {
+		return ""
+	}
+	return mediaCategoryOf(p)
+}
+
+// mediaCategoryOf 按后台设置的文件类型返回文件的媒体类别，不是视频、音频、图片时返回空
+func mediaCategoryOf(name string) string {
+	switch utils.GetFileType(name) {
+	case conf.VIDEO:
+		return MediaCategoryVideo
+	case conf.AUDIO:
+		return MediaCategoryAudio
+	case conf.IMAGE:
+		return MediaCategoryImage
+	}
+	return ""
+}
+
+// WriteMediaPrometheusMetrics 以 Prometheus 文本格式输出媒体访问的指标，供 Prometheus 抓取后在 Grafana 中展示
+func WriteMediaPrometheusMetrics(w io.Writer) error {
+	snapshot := mediaAccessGauge.GaugeSnapshot()
+	categories := make([]string, 0, len(snapshot))
+	for category := range snapshot {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var b strings.Builder
+	b.WriteString("# HELP media_active_requests Number of media requests currently being served, by category.\n")
+	b.WriteString("# TYPE media_active_requests gauge\n")
+	for _, category := range categories {
+		fmt.Fprintf(&b, "media_active_requests{category=%q} %d\n", category, snapshot[category])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
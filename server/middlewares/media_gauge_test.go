@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrentAccessGauge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldSlices := conf.SlicesMap
+	conf.SlicesMap = map[string][]string{
+		conf.VideoTypes: {"mp4", "mkv"},
+		conf.AudioTypes: {"mp3", "flac"},
+		conf.ImageTypes: {"jpg"},
+	}
+	defer func() { conf.SlicesMap = oldSlices }()
+
+	g := &ConcurrentAccessGauge{}
+	// 处理函数在 release 关闭之前一直阻塞，模拟正在传输的请求
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	r := gin.New()
+	r.Use(g.Middleware())
+	handler := func(c *gin.Context) {
+		started.Done()
+		<-release
+		c.Status(http.StatusOK)
+	}
+	r.GET("/d/*path", handler)
+	r.GET("/p/*path", handler)
+	r.POST("/api/fs/get", handler)
+
+	var done sync.WaitGroup
+	serve := func(method, target string) {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+		}()
+	}
+	serve(http.MethodGet, "/d/movies/a.mp4")
+	serve(http.MethodGet, "/p/movies/b.MKV")
+	serve(http.MethodGet, "/d/music/c.flac")
+	serve(http.MethodGet, "/d/docs/readme.txt")
+	serve(http.MethodGet, "/d/movies/a.mp4.part")
+	// /api/fs/get 只返回文件信息，不计入
+	serve(http.MethodPost, "/api/fs/get")
+	started.Wait()
+
+	want := map[string]int64{MediaCategoryVideo: 2, MediaCategoryAudio: 1, MediaCategoryImage: 0}
+	if got := g.GaugeSnapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot while serving = %v, want %v", got, want)
+	}
+	close(release)
+	done.Wait()
+	want = map[string]int64{MediaCategoryVideo: 0, MediaCategoryAudio: 0, MediaCategoryImage: 0}
+	if got := g.GaugeSnapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot after serving = %v, want %v", got, want)
+	}
+}
+
+func TestWriteMediaPrometheusMetrics(t *testing.T) {
+	mediaAccessGauge.video.Add(3)
+	defer mediaAccessGauge.video.Add(-3)
+	var b strings.Builder
+	if err := WriteMediaPrometheusMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP media_active_requests Number of media requests currently being served, by category.\n" +
+		"# TYPE media_active_requests gauge\n" +
+		"media_active_requests{category=\"audio\"} 0\n" +
+		"media_active_requests{category=\"image\"} 0\n" +
+		"media_active_requests{category=\"video\"} 3\n"
+	if b.String() != want {
+		t.Fatalf("metrics:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if stats := GetMediaStats(); stats.ActiveRequests[MediaCategoryVideo] != 3 {
+		t.Fatalf("media stats = %+v", stats)
+	}
+}
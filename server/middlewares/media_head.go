@@ -0,0 +1,183 @@
+package middlewares
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HEAD 请求的处理方式，对应配置 media_log.head_requests
+const (
+	HeadRequestsIgnore = "ignore"
+	HeadRequestsProbe  = "log_as_probe"
+	HeadRequestsMerge  = "merge"
+)
+
+const (
+	// 播放器通常在 HEAD 之后立即发起 GET，超过这个时间没有等到 GET 的 HEAD 单独记录为 probe
+	headMergeWindow = 5 * time.Second
+	// 等待合并的 HEAD 最多保留的条数，超出时最早的一条直接记录
+	headMergeMaxPending = 1024
+)
+
+type headProbeKey struct {
+	user string
+	ip   string
+	path string
+}
+
+func headProbeKeyOf(ev *AccessEvent) headProbeKey {
+	return headProbeKey{user: ev.Username, ip: ev.ClientIP, path: ev.Path}
+}
+
+type pendingProbe struct {
+	key  headProbeKey
+	o    *mediaLoggerOptions
+	ev   *AccessEvent
+	seen time.Time
+}
+
+// headProbeCache 暂存等待与 GET 合并的 HEAD 请求，按到达顺序保存，容量有限
+type headProbeCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	window  time.Duration
+	max     int
+	order   *list.List // *pendingProbe，最早的在前
+	pending map[headProbeKey]*list.Element
+	// 过期或被挤出的 HEAD 通过 flush 输出
+	flush     func(o *mediaLoggerOptions, ev *AccessEvent)
+	sweepOnce sync.Once
+}
+
+func newHeadProbeCache(now func() time.Time, window time.Duration, max int) *headProbeCache {
+	return &headProbeCache{
+		now:     now,
+		window:  window,
+		max:     max,
+		order:   list.New(),
+		pending: make(map[headProbeKey]*list.Element),
+		flush:   writeMediaAccess,
+	}
+}
+
+var headProbes = newHeadProbeCache(time.Now, headMergeWindow, headMergeMaxPending)
+
+// admitHeadRequest 按配置处理 HEAD 请求，返回 false 表示事件暂不输出或不输出
+// merge 模式下 GET 会带上之前暂存的 HEAD 的时间
+func admitHeadRequest(o *mediaLoggerOptions, ev *AccessEvent) bool {
+	mode := mediaLogConf().HeadRequests
+	switch ev.Method {
+	case http.MethodHead:
+		if mode == HeadRequestsIgnore {
+			pipelineMetrics.ignored.Add(1)
+			ev.trace.step("head", ev.Path, "skip", "head_requests is ignore")
+			return false
+		}
+		if ev.Event == EventAccess {
+			ev.Event = EventProbe
+		}
+		if mode == HeadRequestsMerge {
+			ev.trace.step("head", ev.Path, "held", "waiting for a GET to merge into")
+			headProbes.add(o, ev)
+			return false
+		}
+	case http.MethodGet:
+		if mode == HeadRequestsMerge {
+			if probedAt, ok := headProbes.take(headProbeKeyOf(ev)); ok {
+				ev.ProbedAt = &probedAt
+				ev.trace.step("head", ev.Path, "merged", "merged an earlier HEAD probe")
+			}
+		}
+	}
+	return true
+}
+
+// add 暂存一个 HEAD 请求，同一个 key 已有暂存时先输出旧的那条
+func (c *headProbeCache) add(o *mediaLoggerOptions, ev *AccessEvent) {
+	c.sweepOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(c.window)
+			defer ticker.Stop()
+			for range ticker.C {
+				c.flushExpired()
+			}
+		}()
+	})
+	c.mu.Lock()
+	now := c.now()
+	out := c.expireLocked(now)
+	key := headProbeKeyOf(ev)
+	if el, ok := c.pending[key]; ok {
+		out = append(out, c.removeLocked(el))
+	}
+	c.pending[key] = c.order.PushBack(&pendingProbe{key: key, o: o, ev: ev, seen: now})
+	for c.order.Len() > c.max {
+		out = append(out, c.removeLocked(c.order.Front()))
+	}
+	c.mu.Unlock()
+	c.flushAll(out)
+}
+
+// take 取出与 key 对应的未过期 HEAD，返回它的到达时间
+func (c *headProbeCache) take(key headProbeKey) (time.Time, bool) {
+	c.mu.Lock()
+	out := c.expireLocked(c.now())
+	el, ok := c.pending[key]
+	var seen time.Time
+	if ok {
+		seen = c.removeLocked(el).seen
+	}
+	c.mu.Unlock()
+	c.flushAll(out)
+	return seen, ok
+}
+
+// forget 丢弃 username 暂存的 HEAD，不输出，返回丢弃的条数
+func (c *headProbeCache) forget(username string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*pendingProbe).key.user == username {
+			c.removeLocked(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// flushExpired 输出所有超过合并窗口的 HEAD
+func (c *headProbeCache) flushExpired() {
+	c.mu.Lock()
+	out := c.expireLocked(c.now())
+	c.mu.Unlock()
+	c.flushAll(out)
+}
+
+func (c *headProbeCache) expireLocked(now time.Time) []*pendingProbe {
+	var out []*pendingProbe
+	for el := c.order.Front(); el != nil; el = c.order.Front() {
+		if now.Sub(el.Value.(*pendingProbe).seen) < c.window {
+			break
+		}
+		out = append(out, c.removeLocked(el))
+	}
+	return out
+}
+
+func (c *headProbeCache) removeLocked(el *list.Element) *pendingProbe {
+	p := c.order.Remove(el).(*pendingProbe)
+	delete(c.pending, p.key)
+	return p
+}
+
+// flushAll 在锁外输出，避免慢速的 sink 阻塞其他请求
+func (c *headProbeCache) flushAll(probes []*pendingProbe) {
+	for _, p := range probes {
+		c.flush(p.o, p.ev)
+	}
+}
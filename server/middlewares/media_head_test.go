@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestHeadProbeCache(max int) (*headProbeCache, *fakeClock, *[]*AccessEvent) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	c := newHeadProbeCache(clock.Now, headMergeWindow, max)
+	var flushed []*AccessEvent
+	c.flush = func(_ *mediaLoggerOptions, ev *AccessEvent) { flushed = append(flushed, ev) }
+	return c, clock, &flushed
+}
+
+func headEvent(user, ip, path string) *AccessEvent {
+	return &AccessEvent{Event: EventProbe, Method: http.MethodHead, Username: user, ClientIP: ip, Path: path}
+}
+
+func TestHeadProbeCacheMerge(t *testing.T) {
+	c, clock, flushed := newTestHeadProbeCache(16)
+	head := headEvent("alice", "10.0.0.1", "/a.mp4")
+	c.add(nil, head)
+	headTime := clock.Now()
+	clock.Advance(time.Second)
+
+	if _, ok := c.take(headProbeKey{user: "bob", ip: "10.0.0.1", path: "/a.mp4"}); ok {
+		t.Fatal("GET from another user must not merge")
+	}
+	seen, ok := c.take(headProbeKeyOf(head))
+	if !ok || !seen.Equal(headTime) {
+		t.Fatalf("take = %v, %v, want %v, true", seen, ok, headTime)
+	}
+	if _, ok = c.take(headProbeKeyOf(head)); ok {
+		t.Fatal("HEAD merged twice")
+	}
+	if len(*flushed) != 0 {
+		t.Fatalf("merged HEAD should not be logged, got %d entries", len(*flushed))
+	}
+}
+
+func TestHeadProbeCacheExpire(t *testing.T) {
+	c, clock, flushed := newTestHeadProbeCache(16)
+	head := headEvent("alice", "10.0.0.1", "/a.mp4")
+	c.add(nil, head)
+	clock.Advance(headMergeWindow)
+	if _, ok := c.take(headProbeKeyOf(head)); ok {
+		t.Fatal("expired HEAD must not merge")
+	}
+	if len(*flushed) != 1 || (*flushed)[0] != head {
+		t.Fatalf("expired HEAD should be logged as probe, got %v", *flushed)
+	}
+
+	c.add(nil, headEvent("alice", "10.0.0.1", "/b.mp4"))
+	clock.Advance(headMergeWindow + time.Second)
+	c.flushExpired()
+	if len(*flushed) != 2 {
+		t.Fatalf("flushExpired logged %d entries, want 2", len(*flushed))
+	}
+}
+
+func TestHeadProbeCacheBounded(t *testing.T) {
+	c, _, flushed := newTestHeadProbeCache(2)
+	first := headEvent("alice", "10.0.0.1", "/1.mp4")
+	c.add(nil, first)
+	c.add(nil, headEvent("alice", "10.0.0.1", "/2.mp4"))
+	c.add(nil, headEvent("alice", "10.0.0.1", "/3.mp4"))
+	if c.order.Len() != 2 || len(c.pending) != 2 {
+		t.Fatalf("cache holds %d/%d entries, want 2", c.order.Len(), len(c.pending))
+	}
+	if len(*flushed) != 1 || (*flushed)[0] != first {
+		t.Fatalf("oldest HEAD should be evicted and logged, got %v", *flushed)
+	}
+}
+
+func TestHeadProbeCacheForget(t *testing.T) {
+	c, clock, flushed := newTestHeadProbeCache(16)
+	c.add(nil, headEvent("alice", "10.0.0.1", "/a.mp4"))
+	c.add(nil, headEvent("bob", "10.0.0.2", "/a.mp4"))
+	c.add(nil, headEvent("alice", "10.0.0.1", "/b.mp4"))
+	if n := c.forget("alice"); n != 2 {
+		t.Fatalf("forget = %d, want 2", n)
+	}
+	clock.Advance(headMergeWindow)
+	c.flushExpired()
+	if len(*flushed) != 1 || (*flushed)[0].Username != "bob" {
+		t.Fatalf("flushed %+v, want only bob", *flushed)
+	}
+}
+
+func TestHeadRequestModes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(mode string) { defaultMediaLogConf.HeadRequests = mode }(defaultMediaLogConf.HeadRequests)
+
+	serve := func(mode string) []*AccessEvent {
+		defaultMediaLogConf.HeadRequests = mode
+		sink := &eventSink{}
+		r := gin.New()
+		r.Use(MediaLoggerWithOptions(WithSink(sink)))
+		r.Match([]string{http.MethodHead, http.MethodGet}, "/d/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "/d/a.mp4", nil))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/a.mp4", nil))
+		return sink.events
+	}
+
+	if evs := serve(HeadRequestsIgnore); len(evs) != 1 || evs[0].Method != http.MethodGet {
+		t.Errorf("ignore: got %d events", len(evs))
+	}
+	if evs := serve(HeadRequestsProbe); len(evs) != 2 || evs[0].Event != EventProbe || evs[1].Event != EventAccess {
+		t.Errorf("log_as_probe: got %d events", len(evs))
+	}
+	evs := serve(HeadRequestsMerge)
+	if len(evs) != 1 || evs[0].Method != http.MethodGet || evs[0].ProbedAt == nil {
+		t.Errorf("merge: got %d events, want one GET with probed_at", len(evs))
+	}
+}
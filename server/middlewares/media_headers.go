@@ -0,0 +1,126 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerHookWriter 在响应头真正写出之前调用一次 hook，用于根据最终状态码补充响应头
+type headerHookWriter struct {
+	gin.ResponseWriter
+	hook   func(w gin.ResponseWriter)
+	called bool
+}
+
+func (w *headerHookWriter) runHook() {
+	if !w.called && !w.ResponseWriter.Written() {
+		w.called = true
+		w.hook(w.ResponseWriter)
+	}
+}
+
+func (w *headerHookWriter) WriteHeaderNow() {
+	w.runHook()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *headerHookWriter) Write(data []byte) (int, error) {
+	w.runHook()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *headerHookWriter) WriteString(s string) (int, error) {
+	w.runHook()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *headerHookWriter) Flush() {
+	w.runHook()
+	w.ResponseWriter.Flush()
+}
+
+// beforeWriteHeader 替换 c.Writer 并在响应头写出前调用 hook
+// gin 在处理链结束后会直接对原始 writer 调用 WriteHeaderNow，所以没有响应体时需要在 c.Next() 之后补一次
+func beforeWriteHeader(c *gin.Context, hook func(w gin.ResponseWriter)) {
+	w := &headerHookWriter{ResponseWriter: c.Writer, hook: hook}
+	c.Writer = w
+	c.Next()
+	w.runHook()
+}
+
+// isMediaBodyResponse 判断响应是否为正常返回的媒体内容
+// OpenList 的错误响应使用 HTTP 200 加 JSON 的形式返回，需要通过 Content-Type 排除
+func isMediaBodyResponse(w gin.ResponseWriter) bool {
+	status := w.Status()
+	if status != http.StatusOK && status != http.StatusPartialContent {
+		return false
+	}
+	return !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+}
+
+// RangeHeaderMiddleware 为媒体文件响应设置 Accept-Ranges: bytes，
+// 部分浏览器只有在看到这个响应头时才允许拖动视频进度条
+func RangeHeaderMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		beforeWriteHeader(c, func(w gin.ResponseWriter) {
+			if isMediaBodyResponse(w) {
+				w.Header().Set("Accept-Ranges", "bytes")
+			}
+		})
+	}
+}
+
+// mediaVaryHeaders 是媒体响应需要声明的 Vary 字段
+// 响应可能按 Accept-Encoding 压缩；m3u8 播放列表在同一地址上还可能按 Accept 返回不同的码率列表
+var mediaVaryHeaders = []string{"Accept-Encoding", "Accept"}
+
+// VaryHeaderMiddleware 为媒体文件响应添加 Vary: Accept-Encoding, Accept，
+// 避免 CDN 把按编码区分的内容混在一起缓存；已有的 Vary 字段会保留
+func VaryHeaderMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		beforeWriteHeader(c, func(w gin.ResponseWriter) {
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+				addVary(w.Header(), mediaVaryHeaders...)
+			}
+		})
+	}
+}
+
+// addVary 把 fields 合并到 Vary 头中，忽略大小写去重，Vary: * 时不做修改
+func addVary(h http.Header, fields ...string) {
+	var existing []string
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				existing = append(existing, f)
+			}
+		}
+	}
+	merged := existing
+	for _, field := range fields {
+		found := false
+		for _, f := range existing {
+			if f == "*" {
+				return
+			}
+			if strings.EqualFold(f, field) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, field)
+		}
+	}
+	h.Set("Vary", strings.Join(merged, ", "))
+}
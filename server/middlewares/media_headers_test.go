@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRangeHeaderMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RangeHeaderMiddleware())
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/ok.mp4":
+			c.Data(http.StatusOK, "video/mp4", []byte("data"))
+		case "/partial.mp4":
+			c.Data(http.StatusPartialContent, "video/mp4", []byte("da"))
+		case "/empty.mp4":
+			c.Status(http.StatusOK)
+		case "/error.mp4":
+			c.JSON(http.StatusOK, gin.H{"code": 401, "message": "unauthorized"})
+		default:
+			c.Status(http.StatusNotFound)
+		}
+	})
+
+	cases := map[string]bool{
+		"/d/ok.mp4":      true,
+		"/d/partial.mp4": true,
+		"/d/empty.mp4":   true,
+		"/d/error.mp4":   false,
+		"/d/missing.mp4": false,
+		"/d/notes.txt":   false,
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := w.Header().Get("Accept-Ranges") == "bytes"; got != want {
+			t.Errorf("%s (status %d): Accept-Ranges present = %v, want %v", path, w.Code, got, want)
+		}
+	}
+}
+
+func TestVaryHeaderMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(VaryHeaderMiddleware())
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Param("path") {
+		case "/origin.mp4":
+			c.Header("Vary", "Origin, accept-encoding")
+			c.Data(http.StatusOK, "video/mp4", []byte("data"))
+		case "/any.mp4":
+			c.Header("Vary", "*")
+			c.Status(http.StatusOK)
+		case "/error.mp4":
+			c.JSON(http.StatusOK, gin.H{"code": 401, "message": "unauthorized"})
+		default:
+			c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte("#EXTM3U"))
+		}
+	})
+
+	cases := map[string]string{
+		"/d/index.m3u8": "Accept-Encoding, Accept",
+		"/d/empty.mkv":  "Accept-Encoding, Accept",
+		"/d/origin.mp4": "Origin, accept-encoding, Accept",
+		"/d/any.mp4":    "*",
+		"/d/error.mp4":  "",
+		"/d/notes.txt":  "",
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := w.Header().Get("Vary"); got != want {
+			t.Errorf("%s: Vary = %q, want %q", path, got, want)
+		}
+	}
+}
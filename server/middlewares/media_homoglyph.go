@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
+)
+
+// HomoglyphMode 决定媒体路径包含兼容字符时的处理方式
+type HomoglyphMode int
+
+const (
+	// HomoglyphStrict 拒绝请求，返回 400
+	HomoglyphStrict HomoglyphMode = iota
+	// HomoglyphPermissive 使用 NFKC 规范化后的路径继续处理
+	HomoglyphPermissive
+)
+
+// HomoglyphOption 用于配置 HomoglyphSanitizationMiddleware
+type HomoglyphOption func(mode *HomoglyphMode)
+
+// WithHomoglyphMode 指定处理方式，默认为 HomoglyphStrict
+func WithHomoglyphMode(mode HomoglyphMode) HomoglyphOption {
+	return func(m *HomoglyphMode) {
+		*m = mode
+	}
+}
+
+// HomoglyphSanitizationMiddleware 检查媒体文件路径是否包含显示效果相同、但编码不同的字符，
+// 这类路径可能被用来伪装成合法路径。路径经过 NFKC 规范化后与 NFC 形式不同时记录安全告警，
+// 并按 mode 拒绝请求或改用规范化后的路径。与 NFC 比较是为了不把 macOS 上常见的分解形式误判为攻击
+// 注意全角括号、全角数字等在中文文件名中很常见，也会被 NFKC 改写，只在文件名以半角字符为主时启用
+func HomoglyphSanitizationMiddleware(opts ...HomoglyphOption) gin.HandlerFunc {
+	mode := HomoglyphStrict
+	for _, opt := range opts {
+		opt(&mode)
+	}
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if !isMediaFilePath(p) {
+			c.Next()
+			return
+		}
+		normalized := norm.NFKC.String(p)
+		if normalized == norm.NFC.String(p) {
+			c.Next()
+			return
+		}
+		log.Warnf("media homoglyph: path %q from %s normalizes to %q", p, c.ClientIP(), normalized)
+		if ev := getAccessEvent(c); ev != nil {
+			ev.Event = EventAnomaly
+		}
+		if mode == HomoglyphStrict {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.URL.Path = normalized
+		c.Request.URL.RawPath = ""
+		for i := range c.Params {
+			if c.Params[i].Key == "path" {
+				c.Params[i].Value = norm.NFKC.String(c.Params[i].Value)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHomoglyphSanitizationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name     string
+		mode     HomoglyphMode
+		path     string
+		status   int
+		wantPath string
+	}{
+		{"plain path", HomoglyphStrict, "/d/movies/a.mp4", http.StatusOK, "/movies/a.mp4"},
+		{"decomposed accent is not flagged", HomoglyphStrict, "/d/cafe\u0301.mp4", http.StatusOK, "/cafe\u0301.mp4"},
+		{"fullwidth letter rejected", HomoglyphStrict, "/d/ｍovie.mp4", http.StatusBadRequest, ""},
+		{"ligature rejected", HomoglyphStrict, "/d/ﬁlm.mp4", http.StatusBadRequest, ""},
+		{"fullwidth letter normalized", HomoglyphPermissive, "/d/ｍovie.mp4", http.StatusOK, "/movie.mp4"},
+		{"non media path untouched", HomoglyphStrict, "/d/ｍovie.txt", http.StatusOK, "/ｍovie.txt"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			r := gin.New()
+			r.GET("/d/*path", HomoglyphSanitizationMiddleware(WithHomoglyphMode(tc.mode)), func(c *gin.Context) {
+				got = c.Param("path")
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, (&url.URL{Path: tc.path}).EscapedPath(), nil))
+			if w.Code != tc.status || got != tc.wantPath {
+				t.Errorf("status %d path %q, want %d %q", w.Code, got, tc.status, tc.wantPath)
+			}
+		})
+	}
+}
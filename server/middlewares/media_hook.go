@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 其他组件通过 logrus 报告媒体访问时使用的字段名
+const (
+	MediaPathField     = "media_path"
+	MediaUserField     = "username"
+	MediaClientIPField = "client_ip"
+	MediaEventField    = "event"
+	MediaSizeField     = "size"
+)
+
+// MediaLogHook 是一个 logrus.Hook，把带有 media_path 字段的日志作为媒体访问事件送入媒体日志管道，
+// 用于任务、驱动等不经过 gin 的媒体访问，例如
+//
+//	log.AddHook(&middlewares.MediaLogHook{})
+//	log.WithField(middlewares.MediaPathField, "/movies/a.mkv").Info("transcode started")
+type MediaLogHook struct{}
+
+func (h *MediaLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *MediaLogHook) Fire(entry *log.Entry) error {
+	EmitMediaEvent(entry)
+	return nil
+}
+
+// EmitMediaEvent 把日志条目转换为访问事件，经过和 HTTP 请求相同的处理后输出到日志和所有 sink
+// 没有 media_path 字段的条目会被忽略；离线下载会报告任务中的每个文件，只记录其中的媒体文件
+func EmitMediaEvent(entry *log.Entry) {
+	ev := mediaEventFromEntry(entry)
+	if ev == nil {
+		return
+	}
+	if ev.Event == EventOfflineAdded && !isMediaFilePath(ev.Path) {
+		return
+	}
+	logMediaAccess(newMediaLoggerOptions(), ev)
+}
+
+func mediaEventFromEntry(entry *log.Entry) *AccessEvent {
+	p := entryString(entry, MediaPathField)
+	if p == "" {
+		return nil
+	}
+	ev := &AccessEvent{
+		Event:    entryString(entry, MediaEventField),
+		Time:     entry.Time,
+		ClientIP: entryString(entry, MediaClientIPField),
+		Username: entryString(entry, MediaUserField),
+		Path:     p,
+	}
+	if size, ok := entry.Data[MediaSizeField].(int64); ok {
+		ev.FileSize = size
+	}
+	if ev.Event == "" {
+		ev.Event = EventAccess
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	return ev
+}
+
+func entryString(entry *log.Entry, key string) string {
+	v, ok := entry.Data[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestMediaLogHook(t *testing.T) {
+	sink := &recordingSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+
+	logger := log.New()
+	logger.Out = io.Discard
+	logger.AddHook(&MediaLogHook{})
+	logger.WithFields(log.Fields{MediaPathField: "/movies/a.mkv", MediaUserField: "alice"}).Info("transcode started")
+	logger.Info("unrelated entry")
+	logger.WithField(MediaPathField, "").Warn("empty path")
+
+	if want := []string{"/movies/a.mkv"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Fatalf("emitted paths = %v, want %v", sink.paths, want)
+	}
+}
+
+func TestMediaEventFromEntry(t *testing.T) {
+	entry := log.NewEntry(log.New()).WithFields(log.Fields{
+		MediaPathField:     "/a.mp4",
+		MediaClientIPField: "10.0.0.1",
+		MediaEventField:    EventAnomaly,
+	})
+	ev := mediaEventFromEntry(entry)
+	if ev == nil || ev.Path != "/a.mp4" || ev.ClientIP != "10.0.0.1" || ev.Event != EventAnomaly || ev.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
+
+func TestOfflineAddedEvent(t *testing.T) {
+	sink := &eventSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+
+	logger := log.New()
+	logger.Out = io.Discard
+	logger.AddHook(&MediaLogHook{})
+	// 多文件种子的每个文件各报告一次，非媒体文件不记录
+	for _, p := range []string{"/movies/show/e01.mkv", "/movies/show/e01.nfo", "/movies/show/e02.mkv"} {
+		logger.WithFields(log.Fields{
+			MediaEventField: EventOfflineAdded,
+			MediaPathField:  p,
+			MediaUserField:  "alice",
+			MediaSizeField:  int64(1 << 30),
+		}).Info("offline download added")
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("emitted %d events, want 2", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.Event != EventOfflineAdded || ev.Path != "/movies/show/e01.mkv" || ev.Username != "alice" || ev.FileSize != 1<<30 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if line := formatMediaLog(ev); !strings.Contains(line, "操作：离线下载") || !strings.Contains(line, "大小：1.0GB") {
+		t.Fatalf("log line %q", line)
+	}
+}
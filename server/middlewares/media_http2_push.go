@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// HTTP2PushMiddleware 在客户端请求 HLS 播放列表（.m3u8）时，通过 HTTP/2 server push 推送前 maxPushCount 个分片，
+// 减少开始播放前的往返次数。HTTP/1 连接或不支持推送时直接跳过
+func HTTP2PushMiddleware(maxPushCount int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxPushCount <= 0 || !c.Request.ProtoAtLeast(2, 0) ||
+			!strings.EqualFold(filepath.Ext(c.Request.URL.Path), ".m3u8") {
+			c.Next()
+			return
+		}
+		pusher := c.Writer.Pusher()
+		if pusher == nil {
+			c.Next()
+			return
+		}
+
+		responseWriter := &responseBodyWriter{
+			ResponseWriter: c.Writer,
+			body:           &bytes.Buffer{},
+		}
+		c.Writer = responseWriter
+		c.Next()
+		responseWriter.recordCapture(c)
+
+		if !isMediaBodyResponse(responseWriter) {
+			return
+		}
+		for _, target := range playlistSegments(c.Request.URL, c.Request.Host, responseWriter.body.Bytes(), maxPushCount) {
+			if err := pusher.Push(target, nil); err != nil {
+				log.Debugf("failed to push %s: %+v", target, err)
+				return
+			}
+		}
+	}
+}
+
+// playlistSegments 解析播放列表，返回前 n 个与请求同源的分片地址（路径加查询参数）
+// 指向其他主机的分片无法推送，直接忽略
+func playlistSegments(base *url.URL, host string, playlist []byte, n int) []string {
+	var segments []string
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	for scanner.Scan() && len(segments) < n {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ref, err := url.Parse(line)
+		if err != nil {
+			continue
+		}
+		if ref.Host != "" && ref.Host != host {
+			continue
+		}
+		segments = append(segments, base.ResolveReference(ref).RequestURI())
+	}
+	return segments
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPlaylistSegments(t *testing.T) {
+	playlist := []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+
+#EXTINF:10,
+seg0.ts?sign=abc
+#EXTINF:10,
+https://cdn.example.com/seg1.ts
+#EXTINF:10,
+/d/other/seg2.ts
+#EXTINF:10,
+https://openlist.example.com/d/movie/seg3.ts
+#EXTINF:10,
+seg4.ts
+`)
+	base, _ := url.Parse("/d/movie/index.m3u8?sign=xyz")
+	got := playlistSegments(base, "openlist.example.com", playlist, 3)
+	want := []string{"/d/movie/seg0.ts?sign=abc", "/d/other/seg2.ts", "/d/movie/seg3.ts"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("segments = %v, want %v", got, want)
+	}
+}
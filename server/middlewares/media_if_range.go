@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConditionalRangeMiddleware 处理视频文件续传时的 If-Range 条件请求
+// 下载工具续传时同时发送 Range 和 If-Range，If-Range 为之前响应中的 ETag 或 Last-Modified；
+// 与当前响应头中由之前的中间件设置的 ETag（或 LastModifiedMiddleware 设置的 Last-Modified）不一致时，
+// 说明文件已经改变，去掉 Range 和 If-Range 让后续的处理函数返回完整的文件，对应的访问事件标记 FullResume
+// 响应头中没有可以比较的值时不做处理，由后续的处理函数自行判断
+func ConditionalRangeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := c.Request
+		ifRange := req.Header.Get("If-Range")
+		if ifRange == "" || req.Header.Get("Range") == "" || req.Method != http.MethodGet ||
+			mediaCategoryOf(req.URL.Path) != MediaCategoryVideo {
+			c.Next()
+			return
+		}
+		if matched, ok := ifRangeMatches(ifRange, c.Writer.Header()); ok && !matched {
+			req.Header.Del("Range")
+			req.Header.Del("If-Range")
+			if ev := getAccessEvent(c); ev != nil {
+				ev.FullResume = true
+			}
+		}
+		c.Next()
+	}
+}
+
+// ifRangeMatches 按 RFC 9110 比较 If-Range 和响应头，ok 为 false 表示响应头中没有可以比较的值
+// If-Range 为 ETag 时使用强比较，弱 ETag 永远不匹配；为日期时必须与 Last-Modified 完全相同
+func ifRangeMatches(ifRange string, header http.Header) (matched, ok bool) {
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false, false
+		}
+		return !strings.HasPrefix(ifRange, "W/") && !strings.HasPrefix(etag, "W/") && ifRange == etag, true
+	}
+	lastModified := header.Get("Last-Modified")
+	if lastModified == "" {
+		return false, false
+	}
+	since, err := http.ParseTime(ifRange)
+	if err != nil {
+		// 无法解析的 If-Range 按不匹配处理，返回完整的文件
+		return false, true
+	}
+	modTime, err := http.ParseTime(lastModified)
+	return err == nil && since.Equal(modTime), true
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InternalRequestHeader 是 OpenList 自身的后台任务（搜索索引、缩略图预生成等）通过 HTTP 路由读取文件时携带的请求头，
+// 值为进程启动时随机生成的令牌，由 MarkInternalRequest 设置，外部客户端无法伪造
+const InternalRequestHeader = "X-OpenList-Internal"
+
+const internalRequestKey = "media_internal_request"
+
+type internalRequestCtxKey struct{}
+
+var internalRequestToken = newInternalRequestToken()
+
+func newInternalRequestToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MarkInternalRequest 为后台任务发给本进程的请求加上内部标记
+func MarkInternalRequest(req *http.Request) {
+	req.Header.Set(InternalRequestHeader, internalRequestToken)
+}
+
+// WithInternalRequest 返回带有内部标记的 context，用于在进程内直接调用路由的后台任务
+func WithInternalRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, internalRequestCtxKey{}, true)
+}
+
+// isInternalRequest 判断请求是否来自 OpenList 自身的后台任务：必须来自本机回环地址，并且带有内部标记
+// 使用 RemoteIP 而不是 ClientIP，避免通过 X-Forwarded-For 伪造来源；结果缓存在上下文中
+func isInternalRequest(c *gin.Context) bool {
+	if v, ok := c.Get(internalRequestKey); ok {
+		return v.(bool)
+	}
+	internal := false
+	if ip := net.ParseIP(c.RemoteIP()); ip != nil && ip.IsLoopback() {
+		marked, _ := c.Request.Context().Value(internalRequestCtxKey{}).(bool)
+		token := c.GetHeader(InternalRequestHeader)
+		internal = marked || subtle.ConstantTimeCompare([]byte(token), []byte(internalRequestToken)) == 1
+	}
+	c.Set(internalRequestKey, internal)
+	return internal
+}
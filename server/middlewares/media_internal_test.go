@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	old := conf.Conf
+	defer func() { conf.Conf = old }()
+	conf.Conf = &conf.Config{MediaLog: conf.DefaultMediaLogConfig()}
+
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(sink)))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "video") })
+	serve := func(remote string, mark func(*http.Request)) {
+		req := httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil)
+		req.RemoteAddr = remote
+		if mark != nil {
+			mark(req)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	forged := func(req *http.Request) { req.Header.Set(InternalRequestHeader, "guess") }
+	withCtx := func(req *http.Request) { *req = *req.WithContext(WithInternalRequest(req.Context())) }
+
+	serve("127.0.0.1:5000", MarkInternalRequest)
+	serve("[::1]:5000", withCtx)
+	if len(sink.events) != 0 {
+		t.Fatalf("internal requests should be skipped, got %d events", len(sink.events))
+	}
+	// 标记只对本机请求有效，令牌不对时按普通请求处理
+	serve("192.0.2.1:5000", MarkInternalRequest)
+	serve("127.0.0.1:5000", forged)
+	if len(sink.events) != 2 || sink.events[0].Internal || sink.events[1].Internal {
+		t.Fatalf("unexpected events %+v", sink.events)
+	}
+
+	conf.Conf.MediaLog.LogInternal = true
+	serve("127.0.0.1:5000", MarkInternalRequest)
+	if len(sink.events) != 3 || !sink.events[2].Internal {
+		t.Fatalf("internal request should be logged with internal=true, got %+v", sink.events)
+	}
+	if line := formatMediaLog(sink.events[2]); !strings.HasSuffix(line, " 来源：内部任务") {
+		t.Errorf("log line = %s", line)
+	}
+}
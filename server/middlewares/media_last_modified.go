@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileMetaProvider 提供文件的元数据，path 为去掉 /d/ 前缀后的文件路径
+type FileMetaProvider interface {
+	GetLastModified(path string) (time.Time, error)
+}
+
+// LastModifiedMiddleware 为 /d/ 下的文件响应设置 Last-Modified，并处理 If-Modified-Since 条件请求
+// 文件未修改时直接返回 304 而不再调用后续的处理函数，对应的访问事件会标记 NotModified
+// 查询元数据失败时不设置响应头，按普通请求处理
+func LastModifiedMiddleware(metaProvider FileMetaProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !strings.HasPrefix(path, "/d/") ||
+			(c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+		modTime, err := metaProvider.GetLastModified(stripMediaRoutePrefix(path))
+		if err != nil || modTime.IsZero() || modTime.Unix() <= 0 {
+			if err != nil {
+				log.Debugf("failed to get last modified time of %s: %+v", path, err)
+			}
+			c.Next()
+			return
+		}
+		// HTTP 日期只精确到秒
+		modTime = modTime.UTC().Truncate(time.Second)
+		c.Header("Last-Modified", modTime.Format(http.TimeFormat))
+
+		if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !modTime.After(since) {
+			if ev := getAccessEvent(c); ev != nil {
+				ev.NotModified = true
+			}
+			c.AbortWithStatus(http.StatusNotModified)
+			return
+		}
+		c.Next()
+	}
+}
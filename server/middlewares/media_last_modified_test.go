@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeMetaProvider map[string]time.Time
+
+func (p fakeMetaProvider) GetLastModified(path string) (time.Time, error) {
+	if t, ok := p[path]; ok {
+		return t, nil
+	}
+	return time.Time{}, errors.New("object not found")
+}
+
+func TestLastModifiedMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modTime := time.Date(2025, 7, 12, 15, 10, 36, 500, time.UTC)
+	var events []*AccessEvent
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		newAccessEvent(c)
+		c.Next()
+		events = append(events, accessEventFor(c, c.Request.URL.Path))
+	})
+	r.Use(LastModifiedMiddleware(fakeMetaProvider{"/movies/a.mp4": modTime}))
+	handled := 0
+	r.GET("/d/*path", func(c *gin.Context) {
+		handled++
+		c.Data(http.StatusOK, "video/mp4", []byte("data"))
+	})
+	get := func(path, ims string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ims != "" {
+			req.Header.Set("If-Modified-Since", ims)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/d/movies/a.mp4", "")
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "Sat, 12 Jul 2025 15:10:36 GMT" {
+		t.Fatalf("status %d, Last-Modified %q", w.Code, w.Header().Get("Last-Modified"))
+	}
+
+	w = get("/d/movies/a.mp4", "Sat, 12 Jul 2025 15:10:36 GMT")
+	if w.Code != http.StatusNotModified || handled != 1 || !events[1].NotModified {
+		t.Fatalf("status %d, handled %d, not modified %v", w.Code, handled, events[1].NotModified)
+	}
+
+	w = get("/d/movies/a.mp4", "Sat, 12 Jul 2025 15:10:35 GMT")
+	if w.Code != http.StatusOK || handled != 2 || events[2].NotModified {
+		t.Fatalf("modified file: status %d, handled %d", w.Code, handled)
+	}
+
+	w = get("/d/movies/missing.mp4", "Sat, 12 Jul 2025 15:10:36 GMT")
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("missing meta: status %d, Last-Modified %q", w.Code, w.Header().Get("Last-Modified"))
+	}
+}
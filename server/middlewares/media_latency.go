@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emaAlpha 是新样本的权重，越大越敏感
+const emaAlpha = 0.1
+
+// ExponentialMovingAverageLatency 计算响应耗时的指数移动平均，比单次耗时更能反映后端的整体性能
+type ExponentialMovingAverageLatency struct {
+	mu      sync.Mutex
+	value   float64
+	started bool
+}
+
+// Update 加入一个新的耗时样本，第一个样本直接作为初始值
+func (e *ExponentialMovingAverageLatency) Update(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.started {
+		e.value = float64(d)
+		e.started = true
+		return
+	}
+	e.value = emaAlpha*float64(d) + (1-emaAlpha)*e.value
+}
+
+// Current 返回当前的平均耗时，还没有样本时返回 0
+func (e *ExponentialMovingAverageLatency) Current() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.value)
+}
+
+var mediaLatency = &ExponentialMovingAverageLatency{}
+
+// observeMediaLatency 在媒体请求处理完成后更新平均耗时，并记录到当前请求的访问事件中
+// 一个请求可能产生多条日志（例如目录列表），因此每个请求只在这里统计一次
+func observeMediaLatency(c *gin.Context) {
+	ev := getAccessEvent(c)
+	if ev == nil || ev.startedAt.IsZero() || ev.Internal {
+		return
+	}
+	mediaLatency.Update(time.Since(ev.startedAt))
+	ev.AvgLatencyMs = durationMs(mediaLatency.Current())
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// MediaStats 是媒体访问的运行统计
+type MediaStats struct {
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	// 每个媒体类别正在处理的请求数，需要注册 ConcurrentAccessGaugeMiddleware
+	ActiveRequests map[string]int64 `json:"active_requests"`
+	// 启动以来记录的访问次数（普通访问和跳转下载），默认不包含媒体服务器扫描媒体库、同步客户端和爬虫的访问
+	Views int64 `json:"views"`
+	// 被识别为扫描、同步客户端和爬虫的访问次数
+	ScanViews int64 `json:"scan_views"`
+	SyncViews int64 `json:"sync_views"`
+	BotViews  int64 `json:"bot_views"`
+	// 所有访问实际传输的字节数，包括扫描和同步客户端
+	BytesServed int64 `json:"bytes_served"`
+	// 开启 media_log.completion 时，启动以来结束的播放会话按完成度分类的次数
+	CompletedViews int64 `json:"completed_views"`
+	PartialViews   int64 `json:"partial_views"`
+	SampledViews   int64 `json:"sampled_views"`
+}
+
+// GetMediaStats 返回当前的媒体访问统计，includeTraffic 中列出的流量类型（scan、sync、bot）计入 Views
+func GetMediaStats(includeTraffic ...string) MediaStats {
+	scans, syncs, bots := mediaViews.scans.Load(), mediaViews.syncs.Load(), mediaViews.bots.Load()
+	views := mediaViews.views.Load() - scans - syncs - bots
+	for _, traffic := range includeTraffic {
+		switch traffic {
+		case TrafficScan:
+			views += scans
+		case TrafficSync:
+			views += syncs
+		case TrafficBot:
+			views += bots
+		}
+	}
+	return MediaStats{
+		AvgLatencyMs:   durationMs(mediaLatency.Current()),
+		ActiveRequests: mediaAccessGauge.GaugeSnapshot(),
+		Views:          views,
+		ScanViews:      scans,
+		SyncViews:      syncs,
+		BotViews:       bots,
+		BytesServed:    mediaViews.bytes.Load(),
+		CompletedViews: mediaPlayback.completed.Load(),
+		PartialViews:   mediaPlayback.partial.Load(),
+		SampledViews:   mediaPlayback.sampled.Load(),
+	}
+}
@@ -0,0 +1,159 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// AlertLatencyDegraded 是 BaselineLatencyAlertMiddleware 发出的告警类型
+const AlertLatencyDegraded = "latency_degraded"
+
+// 未指定时使用的窗口大小和倍数
+const (
+	defaultLatencyWindow     = 100
+	defaultLatencyMultiplier = 2
+)
+
+// latencyRing 是固定大小的环形缓冲区，保存最近的耗时（纳秒）
+// scratch 用于计算中位数时复制样本，和 samples 一样只分配一次
+type latencyRing struct {
+	samples []int64
+	scratch []int64
+	next    int
+	full    bool
+	// 已经告警，耗时恢复到阈值以下之前不再告警
+	alerting bool
+}
+
+func newLatencyRing(size int) *latencyRing {
+	return &latencyRing{samples: make([]int64, size), scratch: make([]int64, size)}
+}
+
+func (r *latencyRing) add(ns int64) {
+	r.samples[r.next] = ns
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// median 返回样本的中位数，样本数为偶数时取中间两个的平均值
+func (r *latencyRing) median() int64 {
+	n := len(r.samples)
+	if !r.full {
+		n = r.next
+	}
+	s := r.scratch[:n]
+	copy(s, r.samples[:n])
+	slices.Sort(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// latencyBaseline 按路径前缀保存最近的耗时
+type latencyBaseline struct {
+	mu         sync.Mutex
+	windowSize int
+	multiplier float64
+	rings      map[string]*latencyRing
+}
+
+func newLatencyBaseline(windowSize int, multiplier float64) *latencyBaseline {
+	if windowSize <= 0 {
+		windowSize = defaultLatencyWindow
+	}
+	if multiplier <= 1 {
+		multiplier = defaultLatencyMultiplier
+	}
+	return &latencyBaseline{windowSize: windowSize, multiplier: multiplier, rings: make(map[string]*latencyRing)}
+}
+
+// observe 记录一次耗时，超过基线的 multiplier 倍并且之前没有告警时返回基线和 true
+// 窗口写满之前没有可靠的基线，只记录不告警
+func (b *latencyBaseline) observe(prefix string, latency time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ring := b.rings[prefix]
+	if ring == nil {
+		ring = newLatencyRing(b.windowSize)
+		b.rings[prefix] = ring
+	}
+	defer ring.add(int64(latency))
+	if !ring.full {
+		return 0, false
+	}
+	baseline := ring.median()
+	if float64(latency) <= float64(baseline)*b.multiplier {
+		ring.alerting = false
+		return 0, false
+	}
+	if ring.alerting {
+		return 0, false
+	}
+	ring.alerting = true
+	return time.Duration(baseline), true
+}
+
+// latencyPrefix 返回统计耗时使用的路径前缀，为虚拟路径的第一级目录，通常对应一个存储，
+// 例如 /d/movies/a.mp4 返回 /movies，根目录下的文件返回 /
+func latencyPrefix(p string) string {
+	p = mediaVirtualPath(p)
+	if i := strings.IndexByte(p[1:], '/'); i >= 0 {
+		return p[:i+1]
+	}
+	return "/"
+}
+
+// BaselineLatencyAlertMiddleware 按路径前缀统计最近 windowSize 次媒体请求的耗时，以中位数作为基线，
+// 本次耗时超过基线的 multiplier 倍时调用 alert，通常说明对应存储的后端出现了问题
+// 同一个前缀持续变慢时只告警一次，耗时恢复后重新开始判断；变慢的请求同样计入窗口，
+// 持续变慢超过半个窗口后基线会随之升高。出错的请求和后台任务的内部请求不计入
+// windowSize <= 0 时为 100，multiplier <= 1 时为 2；alert 为 nil 时只输出警告日志
+func BaselineLatencyAlertMiddleware(windowSize int, multiplier float64, alert AlertSink) gin.HandlerFunc {
+	return baselineLatencyAlert(newLatencyBaseline(windowSize, multiplier), alert, time.Now)
+}
+
+func baselineLatencyAlert(baseline *latencyBaseline, alert AlertSink, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !isMediaFilePath(path) {
+			c.Next()
+			return
+		}
+		start := now()
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest || isInternalRequest(c) {
+			return
+		}
+		latency := now().Sub(start)
+		prefix := latencyPrefix(path)
+		base, exceeded := baseline.observe(prefix, latency)
+		if !exceeded {
+			return
+		}
+		a := MediaAlert{
+			Kind:     AlertLatencyDegraded,
+			ClientIP: c.ClientIP(),
+			Username: getUserName(c),
+			Path:     path,
+			Count:    baseline.windowSize,
+			Time:     now(),
+			Latency:  latency,
+			Baseline: base,
+		}
+		log.Warnf("media latency: %s took %s, more than %.1f× the median %s of the last %d requests under %s",
+			path, latency, baseline.multiplier, base, baseline.windowSize, prefix)
+		if alert != nil {
+			alert.Alert(a)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLatencyRingMedian(t *testing.T) {
+	r := newLatencyRing(4)
+	for _, ns := range []int64{50, 10, 40} {
+		r.add(ns)
+	}
+	if got := r.median(); got != 40 {
+		t.Fatalf("median of 3 samples = %d, want 40", got)
+	}
+	// 写满后覆盖最早的样本 50
+	r.add(20)
+	r.add(30)
+	if got := r.median(); got != 25 {
+		t.Fatalf("median after wrapping = %d, want 25", got)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { r.add(60); r.median() }); allocs != 0 {
+		t.Fatalf("add and median allocate %v times", allocs)
+	}
+}
+
+func TestLatencyPrefix(t *testing.T) {
+	cases := map[string]string{
+		"/d/movies/2025/a.mp4": "/movies",
+		"/p/music/a.flac":      "/music",
+		"/d/a.mp4":             "/",
+		"/movies/a.mp4":        "/movies",
+	}
+	for p, want := range cases {
+		if got := latencyPrefix(p); got != want {
+			t.Errorf("latencyPrefix(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestBaselineLatencyAlertMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	var alerts []MediaAlert
+	r := gin.New()
+	r.Use(baselineLatencyAlert(newLatencyBaseline(5, 2), AlertSinkFunc(func(a MediaAlert) {
+		alerts = append(alerts, a)
+	}), clock.Now))
+	r.GET("/d/*path", func(c *gin.Context) {
+		d, _ := time.ParseDuration(c.Query("took"))
+		clock.Advance(d)
+		if c.Query("fail") != "" {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, "video")
+	})
+	serve := func(target string) {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	// 窗口写满之前没有基线
+	serve("/d/movies/a.mp4?took=1s")
+	for i := 0; i < 4; i++ {
+		serve("/d/movies/a.mp4?took=100ms")
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("alerted before the window was full: %+v", alerts)
+	}
+
+	// 不超过基线的 2 倍、出错的请求和其他存储的请求不告警
+	serve("/d/movies/b.mp4?took=200ms")
+	serve("/d/movies/b.mp4?took=5s&fail=1")
+	serve("/d/music/a.flac?took=5s")
+	if len(alerts) != 0 {
+		t.Fatalf("unexpected alerts: %+v", alerts)
+	}
+
+	serve("/d/movies/c.mp4?took=300ms")
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if a := alerts[0]; a.Kind != AlertLatencyDegraded || a.Path != "/d/movies/c.mp4" ||
+		a.Latency != 300*time.Millisecond || a.Baseline != 100*time.Millisecond {
+		t.Fatalf("alert = %+v", a)
+	}
+
+	// 持续变慢时只告警一次，恢复之后再次变慢重新告警
+	serve("/d/movies/c.mp4?took=300ms")
+	serve("/d/movies/a.mp4?took=100ms")
+	serve("/d/movies/c.mp4?took=1s")
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want 2", len(alerts))
+	}
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialMovingAverageLatency(t *testing.T) {
+	var ema ExponentialMovingAverageLatency
+	if ema.Current() != 0 {
+		t.Fatalf("initial value = %v, want 0", ema.Current())
+	}
+	ema.Update(100 * time.Millisecond)
+	if ema.Current() != 100*time.Millisecond {
+		t.Fatalf("first sample should be used as is, got %v", ema.Current())
+	}
+	ema.Update(200 * time.Millisecond)
+	if ema.Current() != 110*time.Millisecond {
+		t.Fatalf("after second sample = %v, want 110ms", ema.Current())
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
+	stdpath "path"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
 	"github.com/OpenListTeam/OpenList/v4/internal/model"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
 )
 
 // MediaLogger 是一个专门记录媒体文件访问的日志中间件
@@ -21,9 +27,9 @@ import (
 func init() {
 	// 设置日志格式为纯文本，不带颜色
 	log.SetFormatter(&log.TextFormatter{
-		DisableColors: true,
+		DisableColors:    true,
 		DisableTimestamp: true, // 禁用默认时间戳，我们将自己格式化
-		FullTimestamp: false,
+		FullTimestamp:    false,
 	})
 }
 
@@ -40,7 +46,7 @@ var mediaExtensions = map[string]bool{
 	".tiff": true,
 	".ico":  true,
 	".heic": true,
-	
+
 	// 视频格式
 	".mp4":  true,
 	".avi":  true,
@@ -77,16 +83,93 @@ type fsObject struct {
 	Name string `json:"name"`
 	Path string `json:"path"`
 	Type int    `json:"type"`
+	Size int64  `json:"size"`
 }
 
+// fsListResponse 对应 common.Resp[FsListResp]，文件列表位于 data.content
 type fsListResponse struct {
-	Code    int       `json:"code"`
-	Content []fsObject `json:"content"`
+	Code int `json:"code"`
+	Data struct {
+		Content []fsObject `json:"content"`
+	} `json:"data"`
+}
+
+// listItemPath 返回列表中文件的完整路径，列表项的 path 字段不一定可靠，优先使用请求的目录拼接
+func listItemPath(dir string, item fsObject) string {
+	if dir == "" {
+		dir = item.Path
+	}
+	return stdpath.Join("/", dir, item.Name)
+}
+
+// decodePartialFSList 流式解析可能在任意位置被截断的列表响应，
+// 返回截断前已经完整解析的 code 和文件，遇到截断或格式错误时停止
+func decodePartialFSList(data []byte) fsListResponse {
+	var resp fsListResponse
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !expectDelim(dec, '{') {
+		return resp
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return resp
+		}
+		switch key {
+		case "code":
+			if dec.Decode(&resp.Code) != nil {
+				return resp
+			}
+		case "data":
+			if !expectDelim(dec, '{') {
+				return resp
+			}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return resp
+				}
+				if key != "content" {
+					if dec.Decode(&json.RawMessage{}) != nil {
+						return resp
+					}
+					continue
+				}
+				if !expectDelim(dec, '[') {
+					return resp
+				}
+				for dec.More() {
+					var item fsObject
+					if dec.Decode(&item) != nil {
+						return resp
+					}
+					resp.Data.Content = append(resp.Data.Content, item)
+				}
+				if _, err := dec.Token(); err != nil {
+					return resp
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				return resp
+			}
+		default:
+			if dec.Decode(&json.RawMessage{}) != nil {
+				return resp
+			}
+		}
+	}
+	return resp
+}
+
+// expectDelim 读取下一个 token 并判断是否为指定的分隔符
+func expectDelim(dec *json.Decoder, delim json.Delim) bool {
+	tok, err := dec.Token()
+	return err == nil && tok == delim
 }
 
 type fsGetResponse struct {
-	Code    int     `json:"code"`
-	Data    fsObject `json:"data"`
+	Code int      `json:"code"`
+	Data fsObject `json:"data"`
 }
 
 // 获取用户名
@@ -98,7 +181,7 @@ func getUserName(c *gin.Context) string {
 		if user, ok := userObj.(*model.User); ok && user != nil {
 			return user.Username
 		}
-		
+
 		// 尝试从map中获取username
 		if userMap, ok := userObj.(map[string]interface{}); ok {
 			if username, exists := userMap["username"]; exists {
@@ -108,60 +191,368 @@ func getUserName(c *gin.Context) string {
 			}
 		}
 	}
-	
+
 	// 尝试从Authorization头获取token并解析
 	authHeader := c.GetHeader("Authorization")
 	if strings.HasPrefix(authHeader, "Bearer ") {
 		return "已认证用户"
 	}
-	
+
 	// 如果无法获取用户名，返回未知用户
 	return "未知用户"
 }
 
 // 格式化日志信息为标准格式
-func formatMediaLog(timestamp time.Time, clientIP string, filePath string, username string) string {
+func formatMediaLog(ev *AccessEvent) string {
 	// 格式化为"时间：XXXX年X月X日 访问IP：XXX.XXX.XXX.XXX 用户：XXX 访问路径：XXX.mp4"
-	return fmt.Sprintf("时间：%s 访问IP：%s 用户：%s 访问路径：%s", 
-		timestamp.Format("2006年1月2日 15:04:05"), 
-		clientIP,
-		username,
-		filePath)
+	line := fmt.Sprintf("时间：%s 访问IP：%s 用户：%s 访问路径：%s",
+		ev.Time.Format("2006年1月2日 15:04:05"),
+		ev.ClientIP,
+		escapeLogValue(ev.Username),
+		logPathValue(ev.Path, mediaLogConf().MaxPathLength))
+	if action, ok := mediaAuditActions[ev.Event]; ok {
+		line += " 操作：" + action
+	}
+	if ev.Event == EventPurge {
+		line += fmt.Sprintf(" 条数：%d", ev.Purged)
+	}
+	if ev.Event == EventAlbumView {
+		line += fmt.Sprintf(" 图片数：%d", ev.Count)
+	}
+	if ev.Event == EventNewUserAgent {
+		line += " 客户端：" + escapeLogValue(ev.UserAgent)
+	}
+	if ev.Event == EventConfigChange && len(ev.Diff) > 0 {
+		keys := make([]string, len(ev.Diff))
+		for i, d := range ev.Diff {
+			keys[i] = d.Key
+		}
+		line += " 设置：" + escapeLogValue(strings.Join(keys, ","))
+	}
+	if ev.Event == EventPlaybackSession {
+		line += fmt.Sprintf(" 完成度：%.0f%%（%s）", ev.Coverage*100, ev.Completion)
+	}
+	if ev.SourcePath != "" {
+		line += " 原路径：" + logPathValue(ev.SourcePath, mediaLogConf().MaxPathLength)
+	}
+	if ev.Bytes != nil {
+		line += " 大小：" + humanizeBytes(*ev.Bytes)
+	}
+	if ev.FromTor {
+		line += " 来源：Tor出口节点"
+	}
+	if ev.Internal {
+		line += " 来源：内部任务"
+	}
+	if ev.PossibleScraper {
+		line += " 标记：疑似抓取"
+	}
+	switch ev.Traffic {
+	case TrafficScan:
+		line += " 标记：媒体库扫描"
+	case TrafficSync:
+		line += " 标记：同步客户端"
+	case TrafficBot:
+		line += " 标记：爬虫"
+	}
+	if ev.RedirectHost != "" {
+		line += " 跳转：" + escapeLogValue(ev.RedirectHost)
+	}
+	if ev.Resolution != "" {
+		line += " 分辨率：" + ev.Resolution
+	}
+	if ev.Codec != "" {
+		line += " 编码：" + escapeLogValue(ev.Codec)
+	}
+	if ev.Bitrate > 0 {
+		line += fmt.Sprintf(" 码率：%dkbps", ev.Bitrate/1000)
+	}
+	return line
+}
+
+// humanizeBytes 把字节数转换为便于阅读的大小，按 1024 进位，保留一位小数，例如 1.4GB
+func humanizeBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	v := float64(n)
+	units := []string{"KB", "MB", "GB", "TB", "PB", "EB"}
+	i := -1
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
+
+// mediaAuditActions 是审计事件在文本日志中显示的操作名称
+var mediaAuditActions = map[string]string{
+	EventDelete:   "删除",
+	EventUpload:   "上传",
+	EventPurge:    "清除用户访问记录",
+	EventRename:   "重命名",
+	EventPlaylist: "生成播放列表",
+	// 合并的相册浏览
+	EventAlbumView:    "浏览相册",
+	EventNewUserAgent: "新客户端",
+	// 播放会话结束
+	EventPlaybackSession: "播放结束",
+	EventConfigChange:    "修改设置",
+	// 离线下载完成
+	EventOfflineAdded: "离线下载",
+}
+
+// mediaLogConf 返回当前的媒体日志配置，配置文件尚未加载时（例如测试中）使用默认配置
+func mediaLogConf() *conf.MediaLogConfig {
+	if conf.Conf != nil {
+		return &conf.Conf.MediaLog
+	}
+	return &defaultMediaLogConf
+}
+
+var defaultMediaLogConf = conf.DefaultMediaLogConfig()
+
+// truncateMiddle 把超过 maxRunes 的路径从中间截断并用省略号代替，
+// 尽量保留开头的根目录和结尾的文件名，按 rune 截断避免切开多字节字符
+func truncateMiddle(p string, maxRunes int) string {
+	if maxRunes <= 0 || utf8.RuneCountInString(p) <= maxRunes {
+		return p
+	}
+	runes := []rune(p)
+	budget := maxRunes - 1 // 留一个位置给省略号
+	if budget <= 0 {
+		return "…"
+	}
+	head := budget / 2
+	tail := budget - head
+	base := utf8.RuneCountInString(p[strings.LastIndex(p, "/")+1:]) + 1
+	root := utf8.RuneCountInString(firstPathSegment(p))
+	if tail < base {
+		tail = min(base, budget)
+		head = budget - tail
+	}
+	if head < root && root+base <= budget {
+		head = root
+		tail = budget - head
+	}
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// logPathValue 转义并截断路径，转义后的长度不超过 maxRunes
+// 控制字符转义后会变长，所以二分查找转义后仍然不超过 maxRunes 的最大截断长度；
+// 截断在转义之前进行，不会切开转义序列
+func logPathValue(p string, maxRunes int) string {
+	out := escapeLogValue(truncateMiddle(p, maxRunes))
+	if maxRunes <= 0 || utf8.RuneCountInString(out) <= maxRunes {
+		return out
+	}
+	lo, hi := 1, maxRunes-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if utf8.RuneCountInString(escapeLogValue(truncateMiddle(p, mid))) <= maxRunes {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return escapeLogValue(truncateMiddle(p, lo))
+}
+
+// firstPathSegment 返回路径的第一级目录，例如 /movies/a/b.mp4 返回 /movies
+func firstPathSegment(p string) string {
+	rest := strings.TrimPrefix(p, "/")
+	if idx := strings.Index(rest, "/"); idx >= 0 {
+		return p[:len(p)-len(rest)+idx]
+	}
+	return p
+}
+
+// escapeLogValue 转义换行、回车以及其他不可打印字符
+// 对象存储允许文件名中包含 \n 或 ANSI 转义序列，原样写入文本日志会伪造日志行或污染终端
+// JSON 输出由 encoding/json 负责转义，不需要经过这里
+func escapeLogValue(s string) string {
+	needEscape := false
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsGraphic(r) {
+			needEscape = true
+			break
+		}
+	}
+	if !needEscape {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, "\\x%02x", s[i])
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '\t':
+			b.WriteString("\\t")
+		case r < 0x80 && !unicode.IsGraphic(r):
+			fmt.Fprintf(&b, "\\x%02x", r)
+		case !unicode.IsGraphic(r):
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// normalizeMediaPath 统一记录到日志中的路径形式
+// macOS 客户端会发送 NFD 分解形式的文件名，而存储端一般是 NFC，
+// 不统一的话同一个文件会在日志和统计中出现两条字节不同的路径
+func normalizeMediaPath(p string) string {
+	return norm.NFC.String(p)
 }
 
 // 输出日志到前台和日志文件
-func logMediaAccess(timestamp time.Time, clientIP string, filePath string, username string) {
-	logMsg := formatMediaLog(timestamp, clientIP, filePath, username)
-	
+func logMediaAccess(o *mediaLoggerOptions, ev *AccessEvent) {
+	ev.Path = normalizeMediaPath(ev.Path)
+	// 所在存储关闭了媒体日志
+	if !mediaMountAllowed(ev.Path) {
+		pipelineMetrics.ignored.Add(1)
+		ev.trace.step("mount", ev.Path, "skip", "media log disabled for this storage")
+		return
+	}
+	tagTraffic(ev)
+	if dropTraffic(ev.Traffic) {
+		pipelineMetrics.suppress(ev.Traffic)
+		ev.trace.step("traffic", ev.Path, "skip", "drop_"+ev.Traffic+"_traffic is enabled")
+		return
+	}
+	if !mediaLogExpr.Load().match(ev) {
+		pipelineMetrics.ignored.Add(1)
+		ev.trace.step("filter_expr", ev.Path, "skip", mediaLogConf().FilterExpr)
+		return
+	}
+	if !mediaSchedule.Load().allow(ev) {
+		pipelineMetrics.ignored.Add(1)
+		ev.trace.step("schedule", ev.Path, "skip", "outside the logging windows")
+		return
+	}
+	if !admitHeadRequest(o, ev) || !admitAlbumImage(o, ev) {
+		return
+	}
+	writeMediaAccess(o, ev)
+}
+
+// writeMediaAccess 输出一条已经确定需要记录的访问事件
+func writeMediaAccess(o *mediaLoggerOptions, ev *AccessEvent) {
+	pipelineMetrics.detected.Add(1)
+	ev.Path = o.redactPath(ev.Path)
+	if n := mediaLogConf().MaxEventPathLength; n > 0 {
+		// 结构化输出默认保留完整路径，只在设置了上限时截断
+		ev.Path = truncateMiddle(ev.Path, n)
+		ev.SourcePath = truncateMiddle(ev.SourcePath, n)
+		ev.DestPath = truncateMiddle(ev.DestPath, n)
+	}
+	ev.fillBytes()
+	ev.Region = o.region
+	if o.anonymizeIP != nil {
+		ev.ClientIP = o.anonymizeIP(ev.ClientIP)
+	}
+	// 试运行时只计数，不输出日志也不发送给 sink
+	if dry := mediaDryRunMode(); dry.Enabled {
+		pipelineMetrics.dryRun.Add(1)
+		ev.trace.step("dry_run", ev.Path, "skip", "dry-run mode, not emitted")
+		if dry.KeepRecent {
+			recentEvents.add(ev)
+		}
+		return
+	}
+	mediaViews.count(ev)
+	mediaAccessCounter.observe(ev)
+	mediaTrending.observe(ev)
+	if mediaLogConf().Completion.Enable {
+		mediaPlayback.observe(o, ev)
+	}
+	logMsg := o.formatLine(ev)
+
 	// 输出到日志文件 - 使用纯文本格式，不带前缀
-	log.Info(logMsg)
-	
+	o.logger.WithFields(o.logFields(ev)).Info(logMsg)
+
 	// 输出到前台控制台
 	fmt.Println(logMsg)
+
+	// 输出到单独的媒体日志文件（如果已配置）
+	writeMediaFileLog(ev, logMsg)
+
+	ev.trace.logged(ev.Path)
+
+	// 保存到内存中的最近事件
+	recentEvents.add(ev)
+
+	// 发送给 webhook 等 sink
+	emitToSinks(ev)
+	for _, sink := range o.sinks {
+		if err := sink.Write(ev); err != nil {
+			log.Debugf("media log sink write error: %+v", err)
+		}
+	}
 }
 
 // MediaLoggerMiddleware 返回一个只记录媒体文件访问的日志中间件
 func MediaLoggerMiddleware() gin.HandlerFunc {
+	return MediaLoggerWithOptions()
+}
+
+// MediaLoggerWithOptions 和 MediaLoggerMiddleware 相同，但可以通过 Option 定制输出
+func MediaLoggerWithOptions(opts ...Option) gin.HandlerFunc {
+	return mediaLoggerHandler(newMediaLoggerOptions(opts...))
+}
+
+func mediaLoggerHandler(o *mediaLoggerOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 开启追踪时记录每一步判断
+		tr := mediaTraces.begin(c)
+		defer mediaTraces.finish(c, tr)
+
 		// 如果是静态资源或其他忽略的路径，直接跳过
 		path := c.Request.URL.Path
 		for _, prefix := range ignoredPaths {
 			if strings.HasPrefix(path, prefix) {
+				pipelineMetrics.ignored.Add(1)
+				tr.step("ignored_path", path, "skip", prefix)
 				c.Next()
 				return
 			}
 		}
 
+		// 后台任务的请求默认不记录
+		internal := isInternalRequest(c)
+		if internal && !mediaLogConf().LogInternal {
+			pipelineMetrics.ignored.Add(1)
+			tr.step("internal", path, "skip", "request from an OpenList background job")
+			c.Next()
+			return
+		}
+
+		// 创建访问事件，后续中间件可以补充字段
+		base := newAccessEvent(c)
+		base.trace = tr
+		base.Internal = internal
+
 		// 检查是否是直接访问媒体文件的路径
 		if isMediaFilePath(path) {
+			tr.step("extension", path, "media", filepath.Ext(path))
 			// 记录直接访问媒体文件的日志
 			c.Next()
-			
-			clientIP := c.ClientIP()
-			username := getUserName(c)
-			
+			if applyMediaLogOverride(c, o) {
+				return
+			}
+			observeMediaLatency(c)
+
 			// 使用新的日志格式记录
-			logMediaAccess(time.Now(), clientIP, path, username)
+			ev := o.eventFor(c, path)
+			annotateFileResponse(c, ev)
+			logMediaAccess(o, ev)
 			return
 		}
 
@@ -169,25 +560,31 @@ func MediaLoggerMiddleware() gin.HandlerFunc {
 		if strings.HasPrefix(path, "/api/") {
 			// 如果是 /api/fs/list 或 /api/fs/get，需要特殊处理
 			if path == "/api/fs/list" || strings.HasPrefix(path, "/api/fs/list?") {
-				handleFSListRequest(c)
+				tr.step("route", path, "fs_list", "")
+				handleFSListRequest(c, o)
 				return
 			} else if path == "/api/fs/get" || strings.HasPrefix(path, "/api/fs/get?") {
-				handleFSGetRequest(c)
+				tr.step("route", path, "fs_get", "")
+				handleFSGetRequest(c, o)
 				return
 			}
-			
-			// 其他API调用不记录日志
+
+			// 其他API调用不记录日志，除非处理函数明确标记
+			tr.step("route", path, "api", "not logged unless marked by the handler")
 			c.Next()
+			applyMediaLogOverride(c, o)
 			return
 		}
 
 		// 默认情况下不记录日志
+		tr.step("extension", path, "not_media", filepath.Ext(path))
 		c.Next()
+		applyMediaLogOverride(c, o)
 	}
 }
 
 // 处理 /api/fs/list 请求
-func handleFSListRequest(c *gin.Context) {
+func handleFSListRequest(c *gin.Context, o *mediaLoggerOptions) {
 	// 保存请求体
 	var requestBody []byte
 	if c.Request.Body != nil {
@@ -198,14 +595,19 @@ func handleFSListRequest(c *gin.Context) {
 
 	// 创建响应体捕获器
 	responseWriter := &responseBodyWriter{
-		ResponseWriter: c.Writer,
-		body:           &bytes.Buffer{},
+		ResponseWriter:  c.Writer,
+		body:            &bytes.Buffer{},
+		maxCaptureBytes: o.listCaptureBytes,
 	}
 	c.Writer = responseWriter
-	
+
 	// 处理请求
 	c.Next()
-	
+	responseWriter.recordCapture(c)
+	if applyMediaLogOverride(c, o) {
+		return
+	}
+
 	// 检查请求体中是否包含媒体文件路径
 	var req fsRequest
 	if len(requestBody) > 0 {
@@ -215,37 +617,40 @@ func handleFSListRequest(c *gin.Context) {
 	// 检查响应体中是否包含媒体文件
 	responseData := responseWriter.body.Bytes()
 	var resp fsListResponse
-	if len(responseData) > 0 {
+	if o.listCaptureBytes > 0 {
+		// 只捕获了开头的一部分，流式解析到截断处为止
+		resp = decodePartialFSList(responseData)
+	} else if len(responseData) > 0 {
 		_ = json.Unmarshal(responseData, &resp)
 	}
 
 	// 检查响应中是否包含媒体文件
 	hasMediaFile := false
 	mediaFiles := []string{}
-	
-	if resp.Code == 200 && len(resp.Content) > 0 {
-		for _, item := range resp.Content {
+
+	if c.Writer.Status() == http.StatusOK && resp.Code == 200 {
+		for _, item := range resp.Data.Content {
 			if isMediaFileName(item.Name) {
 				hasMediaFile = true
-				mediaFiles = append(mediaFiles, item.Path+"/"+item.Name)
+				mediaFiles = append(mediaFiles, listItemPath(req.Path, item))
 			}
 		}
 	}
 
+	traceOf(c).step("list", req.Path, "media_files", fmt.Sprintf("status %d, code %d, %d media files", c.Writer.Status(), resp.Code, len(mediaFiles)))
+
 	// 如果包含媒体文件，记录日志
 	if hasMediaFile {
-		clientIP := c.ClientIP()
-		username := getUserName(c)
-		
+		observeMediaLatency(c)
 		// 对每个媒体文件记录一条日志
 		for _, mediaPath := range mediaFiles {
-			logMediaAccess(time.Now(), clientIP, mediaPath, username)
+			logMediaAccess(o, o.eventFor(c, mediaPath))
 		}
 	}
 }
 
 // 处理 /api/fs/get 请求
-func handleFSGetRequest(c *gin.Context) {
+func handleFSGetRequest(c *gin.Context, o *mediaLoggerOptions) {
 	// 保存请求体
 	var requestBody []byte
 	if c.Request.Body != nil {
@@ -263,7 +668,11 @@ func handleFSGetRequest(c *gin.Context) {
 
 	// 处理请求
 	c.Next()
-	
+	responseWriter.recordCapture(c)
+	if applyMediaLogOverride(c, o) {
+		return
+	}
+
 	// 检查请求体中是否包含媒体文件路径
 	var req fsRequest
 	if len(requestBody) > 0 {
@@ -278,46 +687,95 @@ func handleFSGetRequest(c *gin.Context) {
 	}
 
 	// 检查响应中是否包含媒体文件
+	if resp.Code != 200 {
+		traceOf(c).step("get", req.Path, "skip", fmt.Sprintf("code %d", resp.Code))
+	} else if !isMediaFileName(resp.Data.Name) {
+		traceOf(c).step("extension", resp.Data.Path, "not_media", filepath.Ext(resp.Data.Name))
+	}
 	if resp.Code == 200 && isMediaFileName(resp.Data.Name) {
-		clientIP := c.ClientIP()
-		mediaPath := resp.Data.Path
-		username := getUserName(c)
-		
+		observeMediaLatency(c)
 		// 使用新的日志格式记录
-		logMediaAccess(time.Now(), clientIP, mediaPath, username)
+		ev := o.eventFor(c, resp.Data.Path)
+		if size := resp.Data.Size; size > 0 {
+			ev.Bytes = &size
+		}
+		logMediaAccess(o, ev)
+	}
+}
+
+// isTempDownload 判断是否为离线下载、同步工具正在写入的临时文件，例如 movie.mp4.part
+func isTempDownload(name string) bool {
+	for _, suffix := range mediaLogConf().TempSuffixes {
+		if len(name) >= len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+			return true
+		}
 	}
+	return false
 }
 
 // 检查路径是否为媒体文件
 func isMediaFilePath(path string) bool {
+	if isTempDownload(path) {
+		return false
+	}
 	ext := strings.ToLower(filepath.Ext(path))
 	return mediaExtensions[ext]
 }
 
 // 检查文件名是否为媒体文件
 func isMediaFileName(filename string) bool {
+	if isTempDownload(filename) {
+		return false
+	}
 	ext := strings.ToLower(filepath.Ext(filename))
 	return mediaExtensions[ext]
 }
 
 // responseBodyWriter 是一个用于捕获响应体的包装器
+// 同时统计复制到缓冲区的字节数和耗时，用于评估捕获响应体带来的额外开销
 type responseBodyWriter struct {
 	gin.ResponseWriter
-	body *bytes.Buffer
+	body           *bytes.Buffer
+	captureBytes   int64
+	captureLatency time.Duration
+	// 最多捕获的字节数，为 0 时不限制，超过的部分只写给客户端
+	maxCaptureBytes int
+}
+
+// captureLimit 返回 n 字节中还可以捕获的字节数
+func (w *responseBodyWriter) captureLimit(n int) int {
+	if w.maxCaptureBytes <= 0 {
+		return n
+	}
+	return max(min(n, w.maxCaptureBytes-w.body.Len()), 0)
 }
 
 // Write 实现 ResponseWriter 接口
 func (w *responseBodyWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	start := time.Now()
+	n, _ := w.body.Write(b[:w.captureLimit(len(b))])
+	w.captureLatency += time.Since(start)
+	w.captureBytes += int64(n)
 	return w.ResponseWriter.Write(b)
 }
 
 // WriteString 实现 ResponseWriter 接口
 func (w *responseBodyWriter) WriteString(s string) (int, error) {
-	w.body.WriteString(s)
+	start := time.Now()
+	n, _ := w.body.WriteString(s[:w.captureLimit(len(s))])
+	w.captureLatency += time.Since(start)
+	w.captureBytes += int64(n)
 	return w.ResponseWriter.WriteString(s)
 }
 
+// recordCapture 把捕获开销记录到当前请求的访问事件中
+func (w *responseBodyWriter) recordCapture(c *gin.Context) {
+	if ev := getAccessEvent(c); ev != nil {
+		ev.CaptureBytes += w.captureBytes
+		ev.CaptureLatency += w.captureLatency
+	}
+}
+
 // Status 获取状态码
 func (w *responseBodyWriter) Status() int {
 	return w.ResponseWriter.Status()
@@ -325,10 +783,12 @@ func (w *responseBodyWriter) Status() int {
 
 // 启用调试模式的日志记录器
 func MediaLoggerWithDebug() gin.HandlerFunc {
+	o := newMediaLoggerOptions()
 	return func(c *gin.Context) {
 		// 记录所有请求的开始信息
 		path := c.Request.URL.Path
-		
+		newAccessEvent(c)
+
 		// 获取请求体
 		var requestBody []byte
 		if c.Request.Body != nil && c.Request.Method != "GET" {
@@ -336,55 +796,58 @@ func MediaLoggerWithDebug() gin.HandlerFunc {
 			// 恢复请求体，以便后续处理
 			c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 		}
-		
+
 		// 创建响应体捕获器
 		responseWriter := &responseBodyWriter{
 			ResponseWriter: c.Writer,
 			body:           &bytes.Buffer{},
 		}
 		c.Writer = responseWriter
-		
+
 		// 处理请求
 		c.Next()
-		
+		responseWriter.recordCapture(c)
+		if applyMediaLogOverride(c, o) {
+			return
+		}
+
 		// 检查是否为媒体文件访问
 		isMedia := false
 		mediaFilePath := path
-		
+
 		// 检查路径
 		if isMediaFilePath(path) {
 			isMedia = true
 		}
-		
+
 		// 检查请求体
 		if !isMedia && len(requestBody) > 0 {
 			var req fsRequest
 			if err := json.Unmarshal(requestBody, &req); err == nil && req.Path != "" {
-				if strings.Contains(req.Path, ".") {
-					ext := strings.ToLower(filepath.Ext(req.Path))
-					if mediaExtensions[ext] {
-						isMedia = true
-						mediaFilePath = req.Path
-					}
+				if isMediaFilePath(req.Path) {
+					isMedia = true
+					mediaFilePath = req.Path
 				}
 			}
 		}
-		
+
 		// 检查响应体
 		responseData := responseWriter.body.Bytes()
 		if !isMedia && len(responseData) > 0 {
 			// 尝试解析为列表响应
 			var listResp fsListResponse
 			if err := json.Unmarshal(responseData, &listResp); err == nil && listResp.Code == 200 {
-				for _, item := range listResp.Content {
+				var req fsRequest
+				_ = json.Unmarshal(requestBody, &req)
+				for _, item := range listResp.Data.Content {
 					if isMediaFileName(item.Name) {
 						isMedia = true
-						mediaFilePath = item.Path + "/" + item.Name
+						mediaFilePath = listItemPath(req.Path, item)
 						break
 					}
 				}
 			}
-			
+
 			// 尝试解析为单文件响应
 			if !isMedia {
 				var getResp fsGetResponse
@@ -396,12 +859,11 @@ func MediaLoggerWithDebug() gin.HandlerFunc {
 				}
 			}
 		}
-		
+
 		// 记录媒体文件访问日志
 		if isMedia {
-			clientIP := c.ClientIP()
-			username := getUserName(c)
-			logMediaAccess(time.Now(), clientIP, mediaFilePath, username)
+			observeMediaLatency(c)
+			logMediaAccess(o, o.eventFor(c, mediaFilePath))
 		}
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,451 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestEscapeLogValue(t *testing.T) {
+	cases := map[string]string{
+		"/movies/普通 文件.mp4":                 "/movies/普通 文件.mp4",
+		"/movies/全角　空格.mp4":                 "/movies/全角　空格.mp4",
+		"/a.mp4\n时间：2025年1月1日 访问IP：1.2.3.4": `/a.mp4\n时间：2025年1月1日 访问IP：1.2.3.4`,
+		"/a\r\nb.mkv":               `/a\r\nb.mkv`,
+		"/tab\there.jpg":            `/tab\there.jpg`,
+		"/\x1b[31mred\x1b[0m.png":   `/\x1b[31mred\x1b[0m.png`,
+		"/bell\a.mp4":               `/bell\x07.mp4`,
+		"/invalid\xff\xfe.mp4":      `/invalid\xff\xfe.mp4`,
+		"/rlo\u202egpj.exe":         `/rlo\u202egpj.exe`,
+		"/del\x7f.mp4":              `/del\x7f.mp4`,
+		"/next-line\u0085.mp4":      `/next-line\u0085.mp4`,
+		"/line-separator\u2028.mp4": `/line-separator\u2028.mp4`,
+		"/emoji🎬.mp4":               "/emoji🎬.mp4",
+		"/already\\n-escaped.mp4":   `/already\n-escaped.mp4`,
+		"":                          "",
+	}
+	for input, expected := range cases {
+		if got := escapeLogValue(input); got != expected {
+			t.Errorf("escapeLogValue(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
+
+func TestFormatMediaLogHostileFilename(t *testing.T) {
+	ts := time.Date(2025, 7, 12, 15, 10, 36, 0, time.Local)
+	line := formatMediaLog(&AccessEvent{
+		Time:     ts,
+		ClientIP: "10.0.0.1",
+		Path:     "/movies/evil.mp4\n时间：2025年7月12日 15:10:36 访问IP：6.6.6.6 用户：admin 访问路径：/fake.mp4",
+		Username: "bob\x1b[2J",
+	})
+	if strings.ContainsAny(line, "\n\r\x1b") {
+		t.Fatalf("formatted line still contains control characters: %q", line)
+	}
+	if strings.Count(line, "时间：") != 2 || !strings.HasPrefix(line, "时间：2025年7月12日 15:10:36 ") {
+		t.Fatalf("unexpected formatted line: %q", line)
+	}
+	if !strings.Contains(line, `用户：bob\x1b[2J`) {
+		t.Fatalf("username not escaped: %q", line)
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	longDir := strings.Repeat("很长的目录名/", 200)
+	p := "/电影/" + longDir + "星际穿越.mkv"
+	got := truncateMiddle(p, 64)
+	if !utf8.ValidString(got) {
+		t.Fatalf("truncated path is not valid utf-8: %q", got)
+	}
+	if n := utf8.RuneCountInString(got); n != 64 {
+		t.Fatalf("truncated path has %d runes, want 64", n)
+	}
+	if !strings.HasPrefix(got, "/电影/") || !strings.HasSuffix(got, "/星际穿越.mkv") || !strings.Contains(got, "…") {
+		t.Fatalf("root folder or filename lost: %q", got)
+	}
+
+	if got = truncateMiddle(p, 0); got != p {
+		t.Fatalf("limit 0 should disable truncation")
+	}
+	if got = truncateMiddle("/a/b.mp4", 64); got != "/a/b.mp4" {
+		t.Fatalf("short path should not be truncated: %q", got)
+	}
+
+	longName := "/dir/" + strings.Repeat("名", 100) + ".mp4"
+	got = truncateMiddle(longName, 20)
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != 20 || !strings.HasSuffix(got, ".mp4") {
+		t.Fatalf("unexpected truncation of long filename: %q", got)
+	}
+}
+
+type recordingSink struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (s *recordingSink) Write(ev *AccessEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, ev.Path)
+	return nil
+}
+
+const fsListBody = `{"code":200,"message":"success","data":{"content":[
+	{"name":"test.mp4","is_dir":false,"type":2},
+	{"name":"notes.txt","is_dir":false,"type":4},
+	{"name":"image.jpg","is_dir":false,"type":5},
+	{"name":"archive.zip","is_dir":false,"type":1}
+],"total":4}}`
+
+func serveFSList(t *testing.T, status int, body string, opts ...Option) *recordingSink {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	sink := &recordingSink{}
+	o := newMediaLoggerOptions(append(opts, WithSink(sink))...)
+	r := gin.New()
+	r.POST("/api/fs/list", func(c *gin.Context) {
+		handleFSListRequest(c, o)
+	}, func(c *gin.Context) {
+		c.Data(status, "application/json; charset=utf-8", []byte(body))
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/fs/list", strings.NewReader(`{"path":"/movies"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return sink
+}
+
+func TestLogPathValueEscapedLength(t *testing.T) {
+	// 每个控制字符转义后变成 4 个字符
+	p := "/movies/" + strings.Repeat("\x01", 200) + "/a.mp4"
+	for _, maxRunes := range []int{1, 10, 50, 100} {
+		got := logPathValue(p, maxRunes)
+		if n := utf8.RuneCountInString(got); n > maxRunes {
+			t.Errorf("logPathValue(%d) has %d runes: %q", maxRunes, n, got)
+		}
+		if strings.ContainsRune(got, 0x01) {
+			t.Errorf("logPathValue(%d) = %q is not escaped", maxRunes, got)
+		}
+	}
+	if got := logPathValue(p, 50); !strings.HasSuffix(got, "/a.mp4") || !strings.Contains(got, "…") {
+		t.Errorf("logPathValue(50) = %q", got)
+	}
+	if got := logPathValue("/a\n.mp4", 0); got != `/a\n.mp4` {
+		t.Errorf("logPathValue without limit = %q", got)
+	}
+}
+
+func TestMaxEventPathLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	defer func(n int) { defaultMediaLogConf.MaxEventPathLength = n }(defaultMediaLogConf.MaxEventPathLength)
+
+	long := "/d/movies/" + strings.Repeat("x", 2000) + "/a.mp4"
+	logger, _ := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/d/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// 默认保留完整路径
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, long, nil))
+	defaultMediaLogConf.MaxEventPathLength = 100
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, long, nil))
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	if sink.events[0].Path != long {
+		t.Fatalf("path without cap was truncated to %d runes", utf8.RuneCountInString(sink.events[0].Path))
+	}
+	if p := sink.events[1].Path; utf8.RuneCountInString(p) != 100 || !strings.HasSuffix(p, "/a.mp4") {
+		t.Fatalf("capped path = %q", p)
+	}
+}
+
+func TestHandleFSListRequestLogsMediaOnly(t *testing.T) {
+	sink := serveFSList(t, http.StatusOK, fsListBody)
+	want := []string{"/movies/test.mp4", "/movies/image.jpg"}
+	if !reflect.DeepEqual(sink.paths, want) {
+		t.Fatalf("logged paths = %v, want %v", sink.paths, want)
+	}
+}
+
+func TestHandleFSListRequestPartialCapture(t *testing.T) {
+	// 截断在 image.jpg 这一项中间，只记录之前完整解析的文件
+	limit := strings.Index(fsListBody, "image.jpg")
+	sink := serveFSList(t, http.StatusOK, fsListBody, WithPartialListCapture(limit))
+	if want := []string{"/movies/test.mp4"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Fatalf("logged paths = %v, want %v", sink.paths, want)
+	}
+
+	sink = serveFSList(t, http.StatusOK, fsListBody, WithPartialListCapture(len(fsListBody)+1))
+	if want := []string{"/movies/test.mp4", "/movies/image.jpg"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Fatalf("logged paths = %v, want %v", sink.paths, want)
+	}
+
+	// 还没有读到 code 时不记录
+	sink = serveFSList(t, http.StatusOK, fsListBody, WithPartialListCapture(5))
+	if len(sink.paths) != 0 {
+		t.Fatalf("response cut before code should not be logged, got %v", sink.paths)
+	}
+}
+
+func TestFSListCaptureCost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+
+	logger, _ := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.POST("/api/fs/list", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(fsListBody))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/fs/list", strings.NewReader(`{"path":"/movies"}`)))
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	for _, ev := range sink.events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			CaptureBytes   int64 `json:"capture_bytes"`
+			CaptureLatency int64 `json:"capture_latency"`
+		}
+		if err = json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		// 捕获的字节数等于写给客户端的响应大小
+		if out.CaptureBytes != int64(w.Body.Len()) || out.CaptureBytes != int64(len(fsListBody)) {
+			t.Fatalf("%s: capture_bytes = %d, response size %d", ev.Path, out.CaptureBytes, w.Body.Len())
+		}
+		if out.CaptureLatency <= 0 {
+			t.Fatalf("%s: capture_latency = %d", ev.Path, out.CaptureLatency)
+		}
+	}
+}
+
+func TestDecodePartialFSList(t *testing.T) {
+	body := `{"code":200,"message":"success","data":{"total":3,"content":[{"name":"a.mp4"},{"name":"b.mkv"},{"na`
+	resp := decodePartialFSList([]byte(body))
+	if resp.Code != 200 || len(resp.Data.Content) != 2 || resp.Data.Content[1].Name != "b.mkv" {
+		t.Fatalf("decoded %+v", resp)
+	}
+}
+
+func TestHandleFSListRequestSkipsServerError(t *testing.T) {
+	sink := serveFSList(t, http.StatusInternalServerError, fsListBody)
+	if len(sink.paths) != 0 {
+		t.Fatalf("500 response should not be logged, got %v", sink.paths)
+	}
+	sink = serveFSList(t, http.StatusOK, `{"code":500,"message":"failed get objs","data":null}`)
+	if len(sink.paths) != 0 {
+		t.Fatalf("error response should not be logged, got %v", sink.paths)
+	}
+}
+
+func TestMediaLoggerMiddlewareEndToEnd(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, hook := logtest.NewNullLogger()
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger)), func(c *gin.Context) {
+		c.Set("user", &model.User{Username: "alice"})
+		c.Next()
+	})
+	r.GET("/video.mp4", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want 1", len(entries))
+	}
+	msg := entries[0].Message
+	for _, want := range []string{"访问IP：203.0.113.7", "用户：alice", "访问路径：/video.mp4"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("log message %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestMediaLoggerNormalizesNFD(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/d/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// macOS 客户端发送的分解形式
+	nfd, nfc := "/d/movies/Cafe\u0301.mkv", "/d/movies/Caf\u00e9.mkv"
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, nfd, nil))
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 || !strings.Contains(entries[0].Message, "访问路径："+nfc) {
+		t.Fatalf("log entries = %+v", entries)
+	}
+	if len(sink.events) != 1 || sink.events[0].Path != nfc {
+		t.Fatalf("events = %+v", sink.events)
+	}
+	data, err := json.Marshal(sink.events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"path":"`+nfc+`"`) || strings.Contains(string(data), "\u0301") {
+		t.Fatalf("JSON event = %s", data)
+	}
+}
+
+func TestHumanizeBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:          "0B",
+		1023:       "1023B",
+		1024:       "1.0KB",
+		1536:       "1.5KB",
+		1503238553: "1.4GB",
+		5 << 40:    "5.0TB",
+		1<<63 - 1:  "8.0EB",
+	}
+	for n, want := range cases {
+		if got := humanizeBytes(n); got != want {
+			t.Errorf("humanizeBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestMediaLogSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &eventSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(log.New())))
+	r.GET("/d/*path", func(c *gin.Context) {
+		if strings.HasPrefix(c.Param("path"), "/cloud/") {
+			c.Redirect(http.StatusFound, "https://cdn.example.com/c.mp4")
+			return
+		}
+		c.String(http.StatusOK, strings.Repeat("v", 2048))
+	})
+	r.POST("/api/fs/get", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"name": "b.mkv", "path": "/movies/b.mkv", "size": 1503238553}})
+	})
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil),
+		httptest.NewRequest(http.MethodPost, "/api/fs/get", strings.NewReader(`{"path":"/movies/b.mkv"}`)),
+		httptest.NewRequest(http.MethodGet, "/d/cloud/c.mp4", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(sink.events) != 3 {
+		t.Fatalf("emitted %d events, want 3", len(sink.events))
+	}
+	for i, want := range []string{" 大小：2.0KB", " 大小：1.4GB", ""} {
+		ev := sink.events[i]
+		line := formatMediaLog(ev)
+		if want == "" {
+			// 跳转下载没有传输数据，大小未知
+			if ev.Bytes != nil || strings.Contains(line, "大小") {
+				t.Errorf("%s: unexpected size in %q", ev.Path, line)
+			}
+			continue
+		}
+		if !strings.Contains(line, want) || ev.Bytes == nil {
+			t.Errorf("%s: log line %q, want %q", ev.Path, line, want)
+		}
+	}
+	if *sink.events[1].Bytes != 1503238553 {
+		t.Errorf("fs/get bytes = %d", *sink.events[1].Bytes)
+	}
+}
+
+func TestIsMediaFilePathSkipsTempDownloads(t *testing.T) {
+	cases := map[string]bool{
+		"/movies/a.mp4":            true,
+		"/movies/a.mp4.part":       false,
+		"/movies/a.mp4.aria2":      false,
+		"/movies/a.mkv.crdownload": false,
+		"/movies/a.mkv.!qB":        false,
+		"/movies/a.mkv.!QB":        false,
+		"/movies/a.mp4.TMP":        false,
+		"/movies/a.part.mp4":       true,
+	}
+	for p, want := range cases {
+		if got := isMediaFilePath(p); got != want {
+			t.Errorf("isMediaFilePath(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if keepRequestPath("/d/movies/a.mp4.part") {
+		t.Error("log filter should drop temp download paths")
+	}
+}
+
+// benchmarkMediaLogger 使用丢弃输出的 logger 和 sink 反复请求 path，控制台输出重定向到 /dev/null
+func benchmarkMediaLogger(b *testing.B, method, route, path, body string, handler gin.HandlerFunc) {
+	gin.SetMode(gin.TestMode)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		_ = devNull.Close()
+	}()
+	logger := log.New()
+	logger.Out = io.Discard
+
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(DiscardSink{})))
+	r.Handle(method, route, handler)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkMediaLoggerMiddleware(b *testing.B) {
+	data := make([]byte, 4096)
+	benchmarkMediaLogger(b, http.MethodGet, "/d/*path", "/d/movies/Interstellar%20(2014)/Interstellar.mp4", "", func(c *gin.Context) {
+		c.Data(http.StatusOK, "video/mp4", data)
+	})
+}
+
+func BenchmarkMediaLoggerMiddleware_ListEndpoint(b *testing.B) {
+	var content []string
+	for i := 0; i < 50; i++ {
+		ext := []string{"mp4", "mkv", "jpg", "srt", "nfo"}[i%5]
+		content = append(content, fmt.Sprintf(`{"name":"file-%02d.%s","size":%d,"is_dir":false,"type":2}`, i, ext, i<<20))
+	}
+	resp := []byte(`{"code":200,"message":"success","data":{"content":[` + strings.Join(content, ",") + `],"total":50}}`)
+	benchmarkMediaLogger(b, http.MethodPost, "/api/fs/list", "/api/fs/list", `{"path":"/movies","page":1,"per_page":50}`, func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", resp)
+	})
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import "github.com/gin-gonic/gin"
+
+const (
+	markMediaAccessKey  = "media_log_mark_path"
+	suppressMediaLogKey = "media_log_suppress"
+	mediaAuditKey       = "media_log_audit"
+)
+
+type mediaAuditRecord struct {
+	event  string
+	path   string
+	purged int64
+}
+
+// RecordMediaAudit 由处理函数在删除、上传等操作成功后调用，记录一条 event 类型的审计事件
+// 一个请求可以记录多条，不受 SuppressMediaLog 和文件类型的影响
+func RecordMediaAudit(c *gin.Context, event, path string) {
+	records, _ := c.Value(mediaAuditKey).([]mediaAuditRecord)
+	c.Set(mediaAuditKey, append(records, mediaAuditRecord{event: event, path: path}))
+}
+
+// RecordMediaPurge 在清除某个用户的访问记录后调用，记录一条 purge 审计事件，
+// 事件的用户为执行清除的管理员，不包含被清除的用户和记录内容
+func RecordMediaPurge(c *gin.Context, count int64) {
+	records, _ := c.Value(mediaAuditKey).([]mediaAuditRecord)
+	c.Set(mediaAuditKey, append(records, mediaAuditRecord{event: EventPurge, purged: count}))
+}
+
+// MarkMediaAccess 由处理函数调用，明确把当前请求记录为对 path 的媒体访问，
+// 用于只有处理函数才知道真实文件名的情况（例如驱动在处理函数中才把 ID 解析为文件名）
+// 媒体日志中间件在 c.Next() 之后只记录这一条，不再按路径、请求体和响应体检测
+func MarkMediaAccess(c *gin.Context, path string) {
+	c.Set(markMediaAccessKey, path)
+}
+
+// SuppressMediaLog 由处理函数调用，明确表示当前请求不记录媒体日志
+// 优先级高于 MarkMediaAccess：两者都调用时不记录
+func SuppressMediaLog(c *gin.Context) {
+	c.Set(suppressMediaLogKey, true)
+}
+
+// applyMediaLogOverride 在 c.Next() 之后检查处理函数是否做出了明确的决定，
+// 返回 true 表示已经按决定处理（记录或跳过），调用方不需要再进行检测
+func applyMediaLogOverride(c *gin.Context, o *mediaLoggerOptions) bool {
+	tr := traceOf(c)
+	if records, ok := c.Value(mediaAuditKey).([]mediaAuditRecord); ok {
+		for _, record := range records {
+			tr.step("override", record.path, "audit", record.event)
+			ev := o.eventFor(c, record.path)
+			ev.Event = record.event
+			ev.Purged = record.purged
+			logMediaAccess(o, ev)
+		}
+	}
+	if c.GetBool(suppressMediaLogKey) {
+		tr.step("override", "", "suppressed", "handler called SuppressMediaLog")
+		return true
+	}
+	if p := c.GetString(markMediaAccessKey); p != "" {
+		tr.step("override", p, "marked", "handler called MarkMediaAccess")
+		observeMediaLatency(c)
+		logMediaAccess(o, o.eventFor(c, p))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMediaLogMarkAndSuppress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name     string
+		path     string
+		mark     string
+		suppress bool
+		want     []string
+	}{
+		{"media path detected", "/d/video.mp4", "", false, []string{"/d/video.mp4"}},
+		{"other api ignored", "/api/drive/123", "", false, nil},
+		{"mark other api", "/api/drive/123", "/movies/a.mkv", false, []string{"/movies/a.mkv"}},
+		{"mark overrides detected path", "/d/video.mp4", "/movies/real.mp4", false, []string{"/movies/real.mp4"}},
+		{"mark non api path", "/share/abc", "/movies/a.mkv", false, []string{"/movies/a.mkv"}},
+		{"suppress media path", "/d/video.mp4", "", true, nil},
+		{"suppress wins over mark", "/api/drive/123", "/movies/a.mkv", true, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			r := gin.New()
+			r.Use(MediaLoggerWithOptions(WithSink(sink)))
+			r.NoRoute(func(c *gin.Context) {
+				if tc.mark != "" {
+					MarkMediaAccess(c, tc.mark)
+				}
+				if tc.suppress {
+					SuppressMediaLog(c)
+				}
+				c.Status(http.StatusOK)
+			})
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+			if !reflect.DeepEqual(sink.paths, tc.want) {
+				t.Errorf("logged %v, want %v", sink.paths, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	stdpath "path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Matomo 批量跟踪接口单次请求的最大条数
+	matomoMaxBatch = 50
+	// 合并请求的时间窗口
+	matomoBatchWindow = 5 * time.Second
+)
+
+// MatomoAnalyticsMiddleware 把媒体文件访问通过 Matomo HTTP Tracking API 记录为页面访问
+// 每次访问发送 idsite、url（文件的完整地址）、uid（用户名）、cip（客户端 IP），有 Accept-Language 头时发送 lang
+// 访问记录通过异步队列合并后使用批量接口发送，每次最多 matomoMaxBatch 条，不会阻塞请求处理
+// cip 和 cdt（访问时间，批量发送时需要）要求 authToken 有对应站点的写权限
+func MatomoAnalyticsMiddleware(matomoURL, siteID, authToken string) gin.HandlerFunc {
+	sink := newBatchingAsyncSink(newMatomoSink(matomoURL, siteID, authToken), defaultSinkQueueSize, matomoBatchWindow)
+	return matomoAnalytics(sink)
+}
+
+func matomoAnalytics(sink MediaLogSink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if !isMediaFilePath(p) {
+			c.Next()
+			return
+		}
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		ev := accessEventFor(c, p)
+		ev.requestURL = common.GetApiUrlFormRequest(c.Request) + (&url.URL{Path: p}).EscapedPath()
+		ev.language = c.GetHeader("Accept-Language")
+		_ = sink.Write(ev)
+	}
+}
+
+// matomoSink 使用 Matomo 的批量跟踪接口发送访问记录
+type matomoSink struct {
+	endpoint  string
+	siteID    string
+	authToken string
+	client    *http.Client
+}
+
+func newMatomoSink(matomoURL, siteID, authToken string) *matomoSink {
+	endpoint := strings.TrimSuffix(matomoURL, "/")
+	if !strings.HasSuffix(endpoint, ".php") {
+		endpoint += "/matomo.php"
+	}
+	return &matomoSink{
+		endpoint:  endpoint,
+		siteID:    siteID,
+		authToken: authToken,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// trackingQuery 生成单次访问的跟踪参数
+func (s *matomoSink) trackingQuery(ev *AccessEvent) string {
+	q := url.Values{}
+	q.Set("idsite", s.siteID)
+	q.Set("rec", "1")
+	q.Set("apiv", "1")
+	q.Set("url", ev.requestURL)
+	q.Set("action_name", stdpath.Base(ev.Path))
+	if ev.Username != "" {
+		q.Set("uid", ev.Username)
+	}
+	if ev.ClientIP != "" {
+		q.Set("cip", ev.ClientIP)
+	}
+	if ev.language != "" {
+		q.Set("lang", ev.language)
+	}
+	if ev.UserAgent != "" {
+		q.Set("ua", ev.UserAgent)
+	}
+	q.Set("cdt", strconv.FormatInt(ev.Time.Unix(), 10))
+	return "?" + q.Encode()
+}
+
+func (s *matomoSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+// WriteBatch 按 matomoMaxBatch 分批发送，某一批失败时返回错误，之前的批次已经发送
+func (s *matomoSink) WriteBatch(evs []*AccessEvent) error {
+	for len(evs) > 0 {
+		n := min(len(evs), matomoMaxBatch)
+		if err := s.send(evs[:n]); err != nil {
+			return err
+		}
+		evs = evs[n:]
+	}
+	return nil
+}
+
+func (s *matomoSink) send(evs []*AccessEvent) error {
+	requests := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		requests = append(requests, s.trackingQuery(ev))
+	}
+	body, err := json.Marshal(map[string]any{
+		"requests":   requests,
+		"token_auth": s.authToken,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("matomo %s responded with %s", s.endpoint, resp.Status)
+	}
+	return nil
+}
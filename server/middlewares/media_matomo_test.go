@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatomoAnalyticsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	old := conf.Conf
+	conf.Conf = &conf.Config{}
+	defer func() { conf.Conf = old }()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(matomoAnalytics(sink))
+	r.NoRoute(func(c *gin.Context) {
+		if c.Request.URL.Path == "/d/missing.mp4" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, p := range []string{"/d/movies/my%20film.mp4", "/d/missing.mp4", "/d/readme.txt"} {
+		req := httptest.NewRequest(http.MethodGet, "http://media.example.com"+p, nil)
+		req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("tracked %d events, want 1", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.requestURL != "http://media.example.com/d/movies/my%20film.mp4" || ev.language != "zh-CN,zh;q=0.9" {
+		t.Fatalf("event = %+v", ev)
+	}
+}
+
+func TestMatomoSinkBatches(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches []url.Values
+		sizes   []int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/matomo.php" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body struct {
+			Requests  []string `json:"requests"`
+			TokenAuth string   `json:"token_auth"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.TokenAuth != "token" {
+			t.Errorf("body = %+v, %v", body, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(body.Requests))
+		q, _ := url.ParseQuery(body.Requests[0][1:])
+		batches = append(batches, q)
+	}))
+	defer srv.Close()
+
+	sink := newMatomoSink(srv.URL+"/", "3", "token")
+	evs := make([]*AccessEvent, 120)
+	for i := range evs {
+		evs[i] = &AccessEvent{
+			Username:   "alice",
+			ClientIP:   "203.0.113.7",
+			Path:       "/movies/a.mp4",
+			Time:       time.Unix(1700000000, 0),
+			requestURL: "https://media.example.com/d/movies/a.mp4",
+			language:   "en",
+		}
+	}
+	evs[0].language = ""
+	if err := sink.WriteBatch(evs); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 3 || sizes[0] != 50 || sizes[1] != 50 || sizes[2] != 20 {
+		t.Fatalf("batch sizes = %v", sizes)
+	}
+	q := batches[0]
+	want := map[string]string{
+		"idsite": "3",
+		"url":    "https://media.example.com/d/movies/a.mp4",
+		"uid":    "alice",
+		"cip":    "203.0.113.7",
+		"cdt":    "1700000000",
+		"rec":    "1",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if q.Has("lang") || batches[1].Get("lang") != "en" {
+		t.Errorf("lang = %q / %q", q.Get("lang"), batches[1].Get("lang"))
+	}
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 部分对象存储会在视频文件的响应中附带媒体信息，例如
+	// X-Content-Metadata: {"codec":"h264","width":1920,"height":1080}
+	contentMetadataHeader = "X-Content-Metadata"
+	// 头部过长时不做解析
+	maxContentMetadataSize = 4096
+)
+
+type contentMetadata struct {
+	Codec   string `json:"codec"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Bitrate int64  `json:"bitrate"`
+}
+
+// MediaMetadataLogger 在请求处理完成后读取后端返回的 X-Content-Metadata 头，
+// 把分辨率、编码和码率补充到访问事件中，用于统计（例如当前有多少 4K 播放）而不需要对每个请求运行 ffprobe
+// 需要注册在媒体日志中间件之后，头部不存在或无法解析时不做任何处理
+func MediaMetadataLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		ev := getAccessEvent(c)
+		if ev == nil {
+			return
+		}
+		if md, ok := parseContentMetadata(c.Writer.Header().Get(contentMetadataHeader)); ok {
+			if md.Width > 0 && md.Height > 0 {
+				ev.Resolution = fmt.Sprintf("%dx%d", md.Width, md.Height)
+			}
+			ev.Codec = md.Codec
+			ev.Bitrate = md.Bitrate
+		}
+	}
+}
+
+func parseContentMetadata(header string) (contentMetadata, bool) {
+	var md contentMetadata
+	if header == "" || len(header) > maxContentMetadataSize {
+		return md, false
+	}
+	if err := json.Unmarshal([]byte(header), &md); err != nil {
+		return md, false
+	}
+	return md, true
+}
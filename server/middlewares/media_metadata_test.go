@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMediaMetadataLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		header     string
+		resolution string
+		codec      string
+		bitrate    int64
+	}{
+		{`{"codec":"h264","width":1920,"height":1080}`, "1920x1080", "h264", 0},
+		{`{"codec":"hevc","width":3840,"height":2160,"bitrate":25000000}`, "3840x2160", "hevc", 25000000},
+		{`{"codec":"av1"}`, "", "av1", 0},
+		{`not json`, "", "", 0},
+		{"", "", "", 0},
+	}
+	for _, tc := range cases {
+		var ev *AccessEvent
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			ev = newAccessEvent(c)
+			c.Next()
+		}, MediaMetadataLogger())
+		r.GET("/d/video.mp4", func(c *gin.Context) {
+			if tc.header != "" {
+				c.Header(contentMetadataHeader, tc.header)
+			}
+			c.Status(http.StatusOK)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/video.mp4", nil))
+		if ev.Resolution != tc.resolution || ev.Codec != tc.codec || ev.Bitrate != tc.bitrate {
+			t.Errorf("header %q: got %q %q %d, want %q %q %d", tc.header,
+				ev.Resolution, ev.Codec, ev.Bitrate, tc.resolution, tc.codec, tc.bitrate)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mediaPipelineMetrics 统计媒体日志管道自身的运行状况，例如检测到的事件数、被过滤的事件数，
+// 以及每个 sink 的投递情况，用于发现长期静默失败的 webhook 等问题
+type mediaPipelineMetrics struct {
+	detected atomic.Int64
+	// 试运行模式下本应输出的事件数
+	dryRun atomic.Int64
+	// 命中 ignoredPaths 被排除的请求数
+	ignored atomic.Int64
+	// 过滤器名称 -> *atomic.Int64
+	suppressed sync.Map
+	since      atomic.Pointer[time.Time]
+
+	sinksMu sync.RWMutex
+	sinks   []namedSink
+}
+
+// statsSink 是可以在统计中显示投递情况的 sink，例如 asyncSink 和 execSink
+type statsSink interface {
+	stats() MediaSinkStats
+	resetCounters()
+}
+
+type namedSink struct {
+	name string
+	sink statsSink
+}
+
+var pipelineMetrics = newMediaPipelineMetrics()
+
+func newMediaPipelineMetrics() *mediaPipelineMetrics {
+	m := &mediaPipelineMetrics{}
+	now := time.Now()
+	m.since.Store(&now)
+	return m
+}
+
+func (m *mediaPipelineMetrics) suppress(filter string) {
+	v, _ := m.suppressed.LoadOrStore(filter, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+func (m *mediaPipelineMetrics) setSinks(sinks []namedSink) {
+	m.sinksMu.Lock()
+	defer m.sinksMu.Unlock()
+	m.sinks = sinks
+}
+
+// NamedSinkStats 是带名称的 sink 投递统计
+type NamedSinkStats struct {
+	Name string `json:"name"`
+	MediaSinkStats
+}
+
+// MediaLogInternalStats 是媒体日志管道自身的统计
+type MediaLogInternalStats struct {
+	Since          time.Time `json:"since"`
+	EventsDetected int64     `json:"events_detected"`
+	// DryRun 为 true 时事件不会输出，EventsDryRun 为试运行期间本应输出的事件数
+	DryRun           bool             `json:"dry_run"`
+	EventsDryRun     int64            `json:"events_dry_run"`
+	RequestsExcluded int64            `json:"requests_excluded"`
+	Suppressed       map[string]int64 `json:"suppressed"`
+	Sinks            []NamedSinkStats `json:"sinks"`
+}
+
+// GetMediaLogInternalStats 返回媒体日志管道自上次重置以来的统计
+func GetMediaLogInternalStats() MediaLogInternalStats {
+	m := pipelineMetrics
+	stats := MediaLogInternalStats{
+		Since:            *m.since.Load(),
+		EventsDetected:   m.detected.Load(),
+		DryRun:           mediaDryRunMode().Enabled,
+		EventsDryRun:     m.dryRun.Load(),
+		RequestsExcluded: m.ignored.Load(),
+		Suppressed:       make(map[string]int64),
+		Sinks:            []NamedSinkStats{},
+	}
+	m.suppressed.Range(func(k, v any) bool {
+		stats.Suppressed[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	m.sinksMu.RLock()
+	for _, s := range m.sinks {
+		stats.Sinks = append(stats.Sinks, NamedSinkStats{Name: s.name, MediaSinkStats: s.sink.stats()})
+	}
+	m.sinksMu.RUnlock()
+	sort.Slice(stats.Sinks, func(i, j int) bool { return stats.Sinks[i].Name < stats.Sinks[j].Name })
+	return stats
+}
+
+// ResetMediaLogInternalStats 清零所有计数，队列长度和熔断状态反映的是当前状态，不受影响
+func ResetMediaLogInternalStats() {
+	m := pipelineMetrics
+	m.detected.Store(0)
+	m.dryRun.Store(0)
+	m.ignored.Store(0)
+	m.suppressed.Range(func(_, v any) bool {
+		v.(*atomic.Int64).Store(0)
+		return true
+	})
+	m.sinksMu.RLock()
+	for _, s := range m.sinks {
+		s.sink.resetCounters()
+	}
+	m.sinksMu.RUnlock()
+	now := time.Now()
+	m.since.Store(&now)
+}
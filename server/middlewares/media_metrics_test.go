@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+type failingSink struct{}
+
+func (failingSink) Write(*AccessEvent) error { return errors.New("endpoint down") }
+
+func TestMediaLogInternalStats(t *testing.T) {
+	async := newAsyncSink(failingSink{}, 4)
+	pipelineMetrics.setSinks([]namedSink{{name: "webhook:down", sink: async}})
+	defer pipelineMetrics.setSinks(nil)
+	defer ResetMediaLogInternalStats()
+
+	sink := &filteredSink{
+		name:   "webhook:down",
+		filter: newMediaEventFilter(conf.MediaLogFilter{Users: []string{"alice"}}),
+		inner:  async,
+	}
+	other := testAccessEvent()
+	other.Username = "bob"
+	_ = sink.Write(testAccessEvent())
+	_ = sink.Write(other)
+	_ = async.Close()
+
+	stats := GetMediaLogInternalStats()
+	if stats.Suppressed["webhook:down"] != 1 {
+		t.Fatalf("suppressed = %v", stats.Suppressed)
+	}
+	if len(stats.Sinks) != 1 || stats.Sinks[0].Failed != 1 {
+		t.Fatalf("sinks = %+v", stats.Sinks)
+	}
+
+	before := stats.Since
+	time.Sleep(time.Millisecond)
+	ResetMediaLogInternalStats()
+	stats = GetMediaLogInternalStats()
+	if stats.Suppressed["webhook:down"] != 0 || stats.Sinks[0].Failed != 0 || !stats.Since.After(before) {
+		t.Fatalf("stats not reset: %+v", stats)
+	}
+}
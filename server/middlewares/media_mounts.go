@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// 下载、代理和 WebDAV 路由，去掉后得到挂载路径下的虚拟路径
+var mediaFileRoutes = []string{"/d", "/p", "/dav"}
+
+var mediaMountFilter atomic.Pointer[func(virtualPath string) bool]
+
+// SetMediaMountFilter 设置按存储判断是否记录的函数，参数为去掉 /d、/p、/dav 路由前缀后的虚拟路径，
+// 返回 false 的事件在进入日志管道之前被丢弃；传入 nil 表示全部记录
+func SetMediaMountFilter(f func(virtualPath string) bool) {
+	if f == nil {
+		mediaMountFilter.Store(nil)
+		return
+	}
+	mediaMountFilter.Store(&f)
+}
+
+// mediaMountAllowed 判断事件路径所在的存储是否开启了媒体日志，不对应文件的事件（例如 purge）始终允许
+func mediaMountAllowed(p string) bool {
+	f := mediaMountFilter.Load()
+	if f == nil || p == "" {
+		return true
+	}
+	return (*f)(mediaVirtualPath(p))
+}
+
+// mediaVirtualPath 去掉站点路径和文件路由前缀，例如 /d/movies/a.mp4 返回 /movies/a.mp4
+// /api/fs/list 等接口记录的已经是虚拟路径，原样返回
+func mediaVirtualPath(p string) string {
+	if conf.URL != nil {
+		if base := strings.TrimSuffix(conf.URL.Path, "/"); base != "" && hasRoutePrefix(p, []string{base}) {
+			p = strings.TrimPrefix(p, base)
+		}
+	}
+	for _, route := range mediaFileRoutes {
+		if hasRoutePrefix(p, []string{route}) {
+			p = strings.TrimPrefix(p, route)
+			if p == "" {
+				p = "/"
+			}
+			break
+		}
+	}
+	return p
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMediaVirtualPath(t *testing.T) {
+	cases := map[string]string{
+		"/d/movies/a.mp4":   "/movies/a.mp4",
+		"/p/movies/a.mp4":   "/movies/a.mp4",
+		"/dav/movies/a.mp4": "/movies/a.mp4",
+		"/movies/a.mp4":     "/movies/a.mp4",
+		"/download/a.mp4":   "/download/a.mp4",
+		"/d":                "/",
+	}
+	for p, want := range cases {
+		if got := mediaVirtualPath(p); got != want {
+			t.Errorf("mediaVirtualPath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestMediaMountFilter(t *testing.T) {
+	defer SetMediaMountFilter(nil)
+	var seen []string
+	SetMediaMountFilter(func(p string) bool {
+		seen = append(seen, p)
+		return !strings.HasPrefix(p, "/backup/")
+	})
+	sink := &recordingSink{}
+	o := newMediaLoggerOptions(WithSink(sink))
+	for _, p := range []string{"/d/movies/a.mp4", "/d/backup/b.mp4", "/photos/c.jpg"} {
+		logMediaAccess(o, &AccessEvent{Path: p})
+	}
+	if want := []string{"/d/movies/a.mp4", "/photos/c.jpg"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Errorf("logged %v, want %v", sink.paths, want)
+	}
+	if want := []string{"/movies/a.mp4", "/backup/b.mp4", "/photos/c.jpg"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("filter saw %v, want %v", seen, want)
+	}
+}
@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentNegotiationLogger 标记 Accept 头与媒体文件类型不匹配的访问
+// 例如用 Accept: text/html 请求 mp4 时浏览器通常会下载而不是直接播放，
+// 这类事件可以帮助发现配置有误、需要特殊处理的播放器
+func ContentNegotiationLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if isMediaFilePath(path) {
+			expected := mime.TypeByExtension(filepath.Ext(path))
+			if expected != "" && !acceptsMIME(c.GetHeader("Accept"), expected) {
+				if ev := getAccessEvent(c); ev != nil {
+					ev.NegotiationMismatch = true
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// acceptsMIME 判断 Accept 头是否接受指定的 MIME 类型，支持 */* 和 type/* 通配
+// 没有 Accept 头等同于 */*，q=0 的项表示明确拒绝，不算作匹配
+func acceptsMIME(accept, mimeType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	major, _, _ := strings.Cut(mimeType, "/")
+	for _, item := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(item, ";")
+		if isZeroQuality(params) {
+			continue
+		}
+		mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+		if mediaRange == "*/*" || mediaRange == "*" || mediaRange == mimeType || mediaRange == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroQuality(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(key, "q") {
+			value = strings.TrimRight(strings.TrimSpace(value), "0")
+			return value == "" || value == "0." || value == "0"
+		}
+	}
+	return false
+}
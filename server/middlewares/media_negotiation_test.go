@@ -0,0 +1,26 @@
+package middlewares
+
+import "testing"
+
+func TestAcceptsMIME(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   bool
+	}{
+		{"", true},
+		{"*/*", true},
+		{"video/*", true},
+		{"video/mp4", true},
+		{"VIDEO/MP4;q=0.8", true},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", true},
+		{"text/html", false},
+		{"text/html, audio/*", false},
+		{"video/mp4;q=0, text/html", false},
+		{"video/mp4;q=0.0", false},
+	}
+	for _, tc := range cases {
+		if got := acceptsMIME(tc.accept, "video/mp4"); got != tc.want {
+			t.Errorf("acceptsMIME(%q) = %v, want %v", tc.accept, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	// 被限流时最多重试的次数和单次等待的上限
+	maxRateLimitRetries = 3
+	maxRetryAfter       = time.Minute
+)
+
+// coalescedEvent 是时间窗口内合并后的一组相同事件
+type coalescedEvent struct {
+	*AccessEvent
+	Count int
+}
+
+// coalesceEvents 把同一用户对同一文件的同类事件合并为一条，保持首次出现的顺序
+func coalesceEvents(evs []*AccessEvent) []*coalescedEvent {
+	type key struct{ event, user, path string }
+	index := make(map[key]*coalescedEvent, len(evs))
+	var result []*coalescedEvent
+	for _, ev := range evs {
+		k := key{ev.Event, ev.Username, ev.Path}
+		if ce, ok := index[k]; ok {
+			ce.Count++
+			continue
+		}
+		ce := &coalescedEvent{AccessEvent: ev, Count: 1}
+		index[k] = ce
+		result = append(result, ce)
+	}
+	return result
+}
+
+// eventFileName 返回事件对应的文件名，用于通知标题
+func eventFileName(ev *AccessEvent) string {
+	return path.Base(ev.Path)
+}
+
+// retryAfter 解析限流响应中的等待时间，优先使用 Retry-After 头，
+// 其次是 Discord 等平台在响应体中返回的 retry_after 字段（单位为秒）
+func retryAfter(resp *http.Response, body []byte) time.Duration {
+	var d time.Duration
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			d = time.Duration(secs * float64(time.Second))
+		}
+	}
+	if d == 0 {
+		var data struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		if json.Unmarshal(body, &data) == nil {
+			d = time.Duration(data.RetryAfter * float64(time.Second))
+		}
+	}
+	if d <= 0 {
+		d = time.Second
+	}
+	return min(d, maxRetryAfter)
+}
+
+// postNotification 以 JSON 格式发送 payload
+func postNotification(client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return sendNotification(client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// sendNotification 发送 newRequest 创建的请求，遇到 429 时按服务端给出的时间等待后重试
+// 每次重试都会重新创建请求，因此 newRequest 不能依赖已经读取过的请求体
+func sendNotification(client *http.Client, newRequest func() (*http.Request, error)) error {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+			time.Sleep(retryAfter(resp, respBody))
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("notification to %s failed: %s %s", req.URL.Redacted(), resp.Status, respBody)
+		}
+		return nil
+	}
+}
+
+const (
+	botMaxAttempts    = 4
+	botInitialBackoff = time.Second
+)
+
+// botPacer 保证两次发送之间至少间隔 interval，用于遵守机器人每分钟的消息数限制
+type botPacer struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func (p *botPacer) wait() {
+	if d := time.Until(p.last.Add(p.interval)); d > 0 {
+		time.Sleep(d)
+	}
+	p.last = time.Now()
+}
+
+// postBotMessage 发送企业微信、钉钉等机器人消息
+// 这些平台通过响应体中的 errcode 表示错误（包括限流），失败后按指数退避重试，每次重试计入 retries
+func postBotMessage(client *http.Client, url string, payload any, retries *atomic.Int64) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	backoff := botInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err = postBotMessageOnce(client, url, body)
+		if err == nil || attempt >= botMaxAttempts {
+			return err
+		}
+		retries.Add(1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postBotMessageOnce(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("bot message failed: %s %s", resp.Status, respBody)
+	}
+	// 企业微信和钉钉使用 errcode/errmsg，飞书使用 code/msg
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    int    `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if err = json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("invalid bot response %q: %w", respBody, err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("bot message failed: errcode %d, %s", result.ErrCode, result.ErrMsg)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("bot message failed: code %d, %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// truncateUTF8 把 s 截断到不超过 n 字节，不会截断多字节字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// botMarkdown 生成不超过 maxBytes 字节的 markdown 事件列表，放不下的事件只给出数量
+func botMarkdown(events []*coalescedEvent, maxBytes int) string {
+	// 为末尾的“还有 N 条”预留空间
+	const reserved = 64
+	var b strings.Builder
+	fmt.Fprintf(&b, "### OpenList 媒体访问（%d）\n", len(events))
+	for i, ce := range events {
+		line := fmt.Sprintf("> **%s** %s `%s`", orDash(ce.Username), ce.Path, orDash(ce.ClientIP))
+		if ce.Count > 1 {
+			line += fmt.Sprintf(" ×%d", ce.Count)
+		}
+		line += "\n"
+		if b.Len()+len(line) > maxBytes-reserved {
+			if i == 0 {
+				// 单条事件就超长（例如路径特别长）时截断这一条
+				b.WriteString(truncateUTF8(line, maxBytes-reserved-b.Len()-1) + "\n")
+				i++
+			}
+			if i < len(events) {
+				fmt.Fprintf(&b, "> …… 还有 %d 条\n", len(events)-i)
+			}
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// mediaHistoryURL 返回查询该文件访问记录的管理接口地址，未配置 site_url 时返回空字符串
+func mediaHistoryURL(p string) string {
+	if conf.Conf == nil || conf.Conf.SiteURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(conf.Conf.SiteURL, "/") + "/api/admin/media-log/search?field=path&q=" + url.QueryEscape(p)
+}
+
+// summarizeEvent 生成一行事件摘要，用于纯文本的推送渠道
+func summarizeEvent(ce *coalescedEvent) string {
+	line := fmt.Sprintf("%s %s %s (%s)", orDash(ce.Username), ce.Event, ce.Path, orDash(ce.ClientIP))
+	if ce.Count > 1 {
+		line += fmt.Sprintf(" ×%d", ce.Count)
+	}
+	return line
+}
+
+// newNotifier 根据类型创建通知渠道，同时返回该渠道默认的合并时间窗口
+func newNotifier(cfg conf.MediaLogNotifier) (mediaBatchSink, time.Duration, error) {
+	switch cfg.Type {
+	case "discord":
+		return newDiscordSink(cfg), defaultDiscordWindow, nil
+	case "slack":
+		sink, err := newSlackSink(cfg)
+		return sink, defaultSlackWindow, err
+	case "ntfy", "gotify":
+		return newPushSink(cfg), defaultPushWindow, nil
+	case "wecom":
+		return newWeComSink(cfg), defaultWeComWindow, nil
+	case "dingtalk":
+		return newDingTalkSink(cfg), defaultDingTalkWindow, nil
+	case "feishu":
+		return newFeishuSink(cfg), defaultFeishuWindow, nil
+	case "bark":
+		return newBarkSink(cfg), defaultBarkWindow, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown media log notifier type: %s", cfg.Type)
+	}
+}
+
+// newNotifierSink 创建通知渠道并包装为异步批量发送
+func newNotifierSink(cfg conf.MediaLogNotifier) (*asyncSink, error) {
+	sink, window, err := newNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CoalesceWindow > 0 {
+		window = time.Duration(cfg.CoalesceWindow) * time.Second
+	}
+	return newBatchingAsyncSink(sink, defaultSinkQueueSize, window), nil
+}
+
+// SendTestNotification 同步发送一条测试通知，用于在保存配置前验证 webhook 是否可用
+func SendTestNotification(cfg conf.MediaLogNotifier) error {
+	sink, _, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	return sink.Write(sampleAccessEvent())
+}
+
+// sampleAccessEvent 返回用于测试配置的示例事件
+func sampleAccessEvent() *AccessEvent {
+	return &AccessEvent{
+		Event:    EventAccess,
+		Time:     time.Now(),
+		ClientIP: "127.0.0.1",
+		Username: "admin",
+		Method:   http.MethodGet,
+		Path:     "/OpenList/test notification.mp4",
+		Status:   http.StatusOK,
+	}
+}
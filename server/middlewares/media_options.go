@@ -0,0 +1,219 @@
+package middlewares
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Option 用于配置 MediaLoggerWithOptions 创建的中间件
+type Option func(o *mediaLoggerOptions)
+
+type mediaLoggerOptions struct {
+	logger      *log.Logger
+	anonymizeIP func(ip string) string
+	sinks       []MediaLogSink
+	redactions  []*regexp.Regexp
+	// 读取存储驱动名称的上下文键，为空时不记录
+	storageKey string
+	// /api/fs/list 响应最多捕获的字节数，为 0 时捕获全部
+	listCaptureBytes int
+	// 文本日志按顺序输出的字段，为空时使用默认格式
+	fieldOrder LogFieldOrder
+	// 写入每个事件的区域标签
+	region string
+	// 文本日志之外附加到 logrus 条目上的字段
+	level LogLevel
+}
+
+// WithLogger 指定输出文本日志使用的 logrus 实例，默认为标准 logger
+func WithLogger(logger *log.Logger) Option {
+	return func(o *mediaLoggerOptions) {
+		o.logger = logger
+	}
+}
+
+// WithIPAnonymizer 在输出日志和发送事件之前对客户端 IP 做脱敏处理
+func WithIPAnonymizer(anonymize func(ip string) string) Option {
+	return func(o *mediaLoggerOptions) {
+		o.anonymizeIP = anonymize
+	}
+}
+
+// WithSink 为当前中间件额外添加一个 sink，全局通过 SetMediaLogSinks 设置的 sink 仍然会收到事件
+func WithSink(sink MediaLogSink) Option {
+	return func(o *mediaLoggerOptions) {
+		o.sinks = append(o.sinks, sink)
+	}
+}
+
+// redactedSegment 替换被脱敏的路径段
+const redactedSegment = "[REDACTED]"
+
+// WithPathRedaction 对日志中的路径做脱敏，路径中匹配任一正则表达式的目录或文件名整段替换为 [REDACTED]，
+// 例如 `^\d{8}$` 可以隐藏 /users/12345678/private/video.mp4 中的用户 ID
+// 只影响记录的路径，路由和权限校验仍然使用完整路径；无法编译的表达式会被忽略并输出警告
+func WithPathRedaction(patterns []string) Option {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Warnf("media log: invalid path redaction pattern %q: %+v", pattern, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return func(o *mediaLoggerOptions) {
+		o.redactions = append(o.redactions, compiled...)
+	}
+}
+
+// redactPath 按 WithPathRedaction 的配置替换路径中的敏感段
+func (o *mediaLoggerOptions) redactPath(p string) string {
+	if len(o.redactions) == 0 {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		for _, re := range o.redactions {
+			if re.MatchString(segment) {
+				segments[i] = redactedSegment
+				break
+			}
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// StorageDriverContextKey 是 SetMediaProvider 保存存储驱动名称使用的上下文键
+const StorageDriverContextKey = "storage_driver"
+
+// WithStorageTagging 在事件的 StorageDriver 中记录提供文件的存储驱动，便于按存储统计访问量
+// 驱动名称从上下文中读取，默认使用 StorageDriverContextKey，也可以传入其他路由设置的键；
+// 上下文中的值需要是字符串或实现了 fmt.Stringer
+func WithStorageTagging(contextKey ...string) Option {
+	key := StorageDriverContextKey
+	if len(contextKey) > 0 && contextKey[0] != "" {
+		key = contextKey[0]
+	}
+	return func(o *mediaLoggerOptions) {
+		o.storageKey = key
+	}
+}
+
+// WithPartialListCapture 只捕获 /api/fs/list 响应的前 firstNBytes 字节，
+// 并用流式解析读取截断前的文件，适合只需要知道目录开头有没有媒体文件的场景，
+// 超过限制之后的文件不会记录；firstNBytes <= 0 时捕获全部
+func WithPartialListCapture(firstNBytes int) Option {
+	return func(o *mediaLoggerOptions) {
+		o.listCaptureBytes = max(firstNBytes, 0)
+	}
+}
+
+// regionEnv 是未通过 WithRegionLabel 设置区域时读取的环境变量
+const regionEnv = "OPENLIST_REGION"
+
+// defaultRegion 返回 OPENLIST_REGION 环境变量的值，未设置时为 unknown
+func defaultRegion() string {
+	if region := strings.TrimSpace(os.Getenv(regionEnv)); region != "" {
+		return region
+	}
+	return "unknown"
+}
+
+// WithRegionLabel 为中间件输出的每个事件设置区域（例如 us-east、eu-west），
+// 多个区域的日志汇总到同一个 Loki 时可以按 region 字段区分
+// 不设置时使用 OPENLIST_REGION 环境变量，都未设置时为 unknown
+func WithRegionLabel(region string) Option {
+	return func(o *mediaLoggerOptions) {
+		o.region = region
+	}
+}
+
+// WithLogLevel 控制附加到每条 logrus 日志上的结构化字段，配合 JSONFormatter 等格式使用：
+// LogLevelMinimal 只输出文本行（默认），LogLevelStandard 附加路径、客户端 IP、用户和状态码，
+// LogLevelVerbose 额外附加请求方法、User-Agent、文件大小和区域
+func WithLogLevel(level LogLevel) Option {
+	return func(o *mediaLoggerOptions) {
+		o.level = level
+	}
+}
+
+// logFields 返回按 WithLogLevel 附加到日志条目上的字段
+func (o *mediaLoggerOptions) logFields(ev *AccessEvent) log.Fields {
+	if o.level < LogLevelStandard {
+		return nil
+	}
+	fields := log.Fields{"path": ev.Path, "client_ip": ev.ClientIP, "user": ev.Username, "status": ev.Status}
+	if o.level >= LogLevelVerbose {
+		fields["method"] = ev.Method
+		fields["user_agent"] = ev.UserAgent
+		fields["region"] = ev.Region
+		if ev.Bytes != nil {
+			fields["bytes"] = *ev.Bytes
+		}
+	}
+	return fields
+}
+
+// eventFor 生成访问事件，并按选项补充上下文中的信息
+func (o *mediaLoggerOptions) eventFor(c *gin.Context, filePath string) *AccessEvent {
+	ev := accessEventFor(c, filePath)
+	if o.storageKey != "" {
+		switch v := c.Value(o.storageKey).(type) {
+		case string:
+			ev.StorageDriver = v
+		case fmt.Stringer:
+			ev.StorageDriver = v.String()
+		}
+	}
+	return ev
+}
+
+var (
+	defaultOptionsMu sync.RWMutex
+	defaultOptions   []Option
+)
+
+// SetDefaultOptions 设置所有媒体日志中间件共用的默认选项，
+// 创建中间件时默认选项先于调用方传入的选项应用，因此调用方的选项优先
+// 只影响之后创建的中间件
+func SetDefaultOptions(opts ...Option) {
+	defaultOptionsMu.Lock()
+	defer defaultOptionsMu.Unlock()
+	defaultOptions = append([]Option(nil), opts...)
+}
+
+// ResetDefaultOptions 清除 SetDefaultOptions 设置的默认选项，主要用于测试
+func ResetDefaultOptions() {
+	SetDefaultOptions()
+}
+
+func newMediaLoggerOptions(opts ...Option) *mediaLoggerOptions {
+	return newMediaLoggerOptionsWithBase(nil, opts...)
+}
+
+// newMediaLoggerOptionsWithBase 在 SetDefaultOptions 之前先应用 base，用于比全局默认值优先级更低的预设
+func newMediaLoggerOptionsWithBase(base []Option, opts ...Option) *mediaLoggerOptions {
+	o := &mediaLoggerOptions{logger: log.StandardLogger(), region: defaultRegion()}
+	for _, opt := range base {
+		opt(o)
+	}
+	defaultOptionsMu.RLock()
+	for _, opt := range defaultOptions {
+		opt(o)
+	}
+	defaultOptionsMu.RUnlock()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
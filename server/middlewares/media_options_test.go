@@ -0,0 +1,118 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetDefaultOptions(t *testing.T) {
+	defer ResetDefaultOptions()
+
+	mask := func(string) string { return "masked" }
+	keep := func(ip string) string { return ip }
+	SetDefaultOptions(WithIPAnonymizer(mask))
+
+	if o := newMediaLoggerOptions(); o.anonymizeIP == nil || o.anonymizeIP("10.0.0.1") != "masked" {
+		t.Fatal("default option was not applied")
+	}
+	if o := newMediaLoggerOptions(WithIPAnonymizer(keep)); o.anonymizeIP("10.0.0.1") != "10.0.0.1" {
+		t.Fatal("caller option should take precedence over default option")
+	}
+
+	ResetDefaultOptions()
+	if o := newMediaLoggerOptions(); o.anonymizeIP != nil {
+		t.Fatal("ResetDefaultOptions should clear default options")
+	}
+}
+
+func TestWithPathRedaction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &recordingSink{}
+	var handlerPath string
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(sink), WithPathRedaction([]string{`^\d{8}$`, `^acct-`, `(`})))
+	r.GET("/d/*path", func(c *gin.Context) {
+		handlerPath = c.Param("path")
+		c.Status(http.StatusOK)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/users/12345678/acct-99/private/video.mp4", nil))
+
+	if handlerPath != "/users/12345678/acct-99/private/video.mp4" {
+		t.Errorf("handler saw %q, redaction must not change the request path", handlerPath)
+	}
+	if want := []string{"/d/users/[REDACTED]/[REDACTED]/private/video.mp4"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Errorf("logged %v, want %v", sink.paths, want)
+	}
+}
+
+func TestWithStorageTagging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(opt Option, handler gin.HandlerFunc) *AccessEvent {
+		sink := &eventSink{}
+		r := gin.New()
+		r.Use(MediaLoggerWithOptions(opt, WithSink(sink)))
+		r.GET("/d/*path", handler)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil))
+		if len(sink.events) != 1 {
+			t.Fatalf("got %d events, want 1", len(sink.events))
+		}
+		return sink.events[0]
+	}
+
+	ev := serve(WithStorageTagging(), func(c *gin.Context) {
+		SetMediaProvider(c, "S3")
+		c.Status(http.StatusOK)
+	})
+	if ev.StorageDriver != "S3" {
+		t.Errorf("StorageDriver = %q, want S3", ev.StorageDriver)
+	}
+
+	ev = serve(WithStorageTagging("backend"), func(c *gin.Context) {
+		c.Set("backend", "Local")
+		c.Status(http.StatusOK)
+	})
+	if ev.StorageDriver != "Local" {
+		t.Errorf("StorageDriver = %q, want Local", ev.StorageDriver)
+	}
+
+	// 没有启用选项时不记录
+	ev = serve(WithIPAnonymizer(nil), func(c *gin.Context) {
+		SetMediaProvider(c, "S3")
+		c.Status(http.StatusOK)
+	})
+	if ev.StorageDriver != "" {
+		t.Errorf("StorageDriver = %q, want empty", ev.StorageDriver)
+	}
+}
+
+func TestWithRegionLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(opts ...Option) string {
+		sink := &eventSink{}
+		r := gin.New()
+		r.Use(MediaLoggerWithOptions(append(opts, WithSink(sink))...))
+		r.GET("/d/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil))
+		if len(sink.events) != 1 {
+			t.Fatalf("got %d events, want 1", len(sink.events))
+		}
+		return sink.events[0].Region
+	}
+
+	t.Setenv(regionEnv, "")
+	if got := serve(); got != "unknown" {
+		t.Errorf("region = %q, want unknown", got)
+	}
+	t.Setenv(regionEnv, "eu-west")
+	if got := serve(); got != "eu-west" {
+		t.Errorf("region = %q, want eu-west from %s", got, regionEnv)
+	}
+	// 选项优先于环境变量
+	if got := serve(WithRegionLabel("us-east")); got != "us-east" {
+		t.Errorf("region = %q, want us-east", got)
+	}
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type pathTypeRule struct {
+	prefix  string
+	allowed map[string]bool
+	list    []string
+}
+
+// PathTypeEnforcerMiddleware 按路径前缀限制允许访问的文件类型，例如
+//
+//	middlewares.PathTypeEnforcerMiddleware(map[string][]string{"/d/images/": {".jpg", ".png"}})
+//
+// 命中前缀但扩展名不在列表中的请求返回 403，并输出 Warn 日志；扩展名不区分大小写，可以省略开头的点
+// 多个前缀都匹配时使用最长的那个，目录（以 / 结尾的路径）不受限制
+func PathTypeEnforcerMiddleware(rules map[string][]string) gin.HandlerFunc {
+	compiled := make([]pathTypeRule, 0, len(rules))
+	for prefix, exts := range rules {
+		rule := pathTypeRule{prefix: prefix, allowed: make(map[string]bool, len(exts))}
+		for _, ext := range exts {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext != "" && !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			rule.allowed[ext] = true
+			rule.list = append(rule.list, ext)
+		}
+		compiled = append(compiled, rule)
+	}
+	sort.Slice(compiled, func(i, j int) bool { return len(compiled[i].prefix) > len(compiled[j].prefix) })
+
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if strings.HasSuffix(p, "/") {
+			c.Next()
+			return
+		}
+		for _, rule := range compiled {
+			if !strings.HasPrefix(p, rule.prefix) {
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(p))
+			if !rule.allowed[ext] {
+				log.WithFields(log.Fields{
+					"path":      p,
+					"extension": ext,
+					"allowed":   rule.list,
+					"client_ip": c.ClientIP(),
+				}).Warnf("media path type: %s is not allowed under %s", ext, rule.prefix)
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			break
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPathTypeEnforcerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(PathTypeEnforcerMiddleware(map[string][]string{
+		"/d/images/":        {".jpg", "png"},
+		"/d/images/videos/": {".mp4"},
+	}))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := map[string]int{
+		"/d/images/a.jpg":        http.StatusOK,
+		"/d/images/a.PNG":        http.StatusOK,
+		"/d/images/setup.exe":    http.StatusForbidden,
+		"/d/images/a.mp4":        http.StatusForbidden,
+		"/d/images/noext":        http.StatusForbidden,
+		"/d/images/videos/a.mp4": http.StatusOK,
+		"/d/images/videos/a.jpg": http.StatusForbidden,
+		"/d/images/sub/":         http.StatusOK,
+		"/d/movies/setup.exe":    http.StatusOK,
+	}
+	for p, want := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d", p, w.Code, want)
+		}
+	}
+}
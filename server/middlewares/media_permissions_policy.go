@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionsPolicy 是 Permissions-Policy 的配置，键为特性名，值为允许的来源列表
+// 来源可以是 self、*、src 或带引号的完整源（例如 https://example.com），空列表表示完全禁用
+// 本身就是普通的 map，可以直接作为管理配置序列化为 JSON，例如 {"camera":[],"autoplay":["self"]}
+type PermissionsPolicy map[string][]string
+
+// DefaultPermissionsPolicy 返回媒体文件响应的默认策略：禁用定位、摄像头和麦克风，只允许本站自动播放和全屏
+func DefaultPermissionsPolicy() PermissionsPolicy {
+	return PermissionsPolicy{
+		"geolocation": {},
+		"camera":      {},
+		"microphone":  {},
+		"autoplay":    {"self"},
+		"fullscreen":  {"self"},
+	}
+}
+
+// String 生成 Permissions-Policy 头的值，特性按名称排序，保证输出稳定
+// 例如 autoplay=(self), camera=(), fullscreen=(self), geolocation=(), microphone=()
+func (p PermissionsPolicy) String() string {
+	features := make([]string, 0, len(p))
+	for feature := range p {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	directives := make([]string, 0, len(features))
+	for _, feature := range features {
+		origins := make([]string, 0, len(p[feature]))
+		for _, origin := range p[feature] {
+			origins = append(origins, permissionsPolicyOrigin(origin))
+		}
+		directives = append(directives, feature+"=("+strings.Join(origins, " ")+")")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// permissionsPolicyOrigin 关键字原样输出，完整的源需要加引号
+func permissionsPolicyOrigin(origin string) string {
+	switch origin {
+	case "self", "*", "src":
+		return origin
+	}
+	return `"` + strings.Trim(origin, `"`) + `"`
+}
+
+// PermissionsPolicyMiddleware 为媒体文件响应设置 Permissions-Policy 头，policy 为空时使用 DefaultPermissionsPolicy
+// 头的值在创建时生成一次，之后的请求直接复用
+func PermissionsPolicyMiddleware(policy map[string][]string) gin.HandlerFunc {
+	if len(policy) == 0 {
+		policy = DefaultPermissionsPolicy()
+	}
+	header := PermissionsPolicy(policy).String()
+	return func(c *gin.Context) {
+		if isMediaFilePath(c.Request.URL.Path) {
+			c.Header("Permissions-Policy", header)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPermissionsPolicyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		policy map[string][]string
+		path   string
+		want   string
+	}{
+		{nil, "/d/a.mp4", "autoplay=(self), camera=(), fullscreen=(self), geolocation=(), microphone=()"},
+		{map[string][]string{"fullscreen": {"self", "https://player.example.com"}, "payment": {}}, "/d/a.mp4",
+			`fullscreen=(self "https://player.example.com"), payment=()`},
+		{nil, "/d/readme.txt", ""},
+	}
+	for _, tc := range cases {
+		r := gin.New()
+		r.Use(PermissionsPolicyMiddleware(tc.policy))
+		r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if got := w.Header().Get("Permissions-Policy"); got != tc.want {
+			t.Errorf("%s: Permissions-Policy = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestPermissionsPolicyJSON(t *testing.T) {
+	policy := DefaultPermissionsPolicy()
+	data, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PermissionsPolicy
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, policy) || decoded.String() != policy.String() {
+		t.Fatalf("round trip %s = %v, want %v", data, decoded, policy)
+	}
+}
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/server/common"
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistRoute 是 PlaylistMiddleware 处理的路径，不包含站点路径
+const PlaylistRoute = "/playlist.m3u"
+
+var playlistHandler atomic.Pointer[http.Handler]
+
+// SetPlaylistHandler 设置 PlaylistMiddleware 获取目录列表使用的 HTTP 处理器，通常为注册了全部路由的 gin.Engine
+func SetPlaylistHandler(h http.Handler) {
+	if h == nil {
+		playlistHandler.Store(nil)
+		return
+	}
+	playlistHandler.Store(&h)
+}
+
+// PlaylistMiddleware 处理 /playlist.m3u?path=/movies/ 请求，返回目录中所有视频文件的 M3U 播放列表，
+// 可以直接用 VLC 等播放器打开。目录列表通过内部请求调用 /api/fs/list 获取，
+// 转发调用方的 Authorization 头，权限和目录密码（password 参数）与网页中浏览目录时相同；
+// 内部请求带有 MarkInternalRequest 的标记，不会在媒体日志中重复记录目录中的文件
+// 生成播放列表记录为一条 playlist 事件，路径为目录
+func PlaylistMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		base := ""
+		if conf.URL != nil {
+			base = strings.TrimSuffix(conf.URL.Path, "/")
+		}
+		if c.Request.URL.Path != base+PlaylistRoute {
+			c.Next()
+			return
+		}
+		h := playlistHandler.Load()
+		if h == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		dir := c.Query("path")
+		if dir == "" {
+			dir = "/"
+		}
+		resp, err := listDirectory(*h, c, base, dir)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"code": http.StatusBadGateway, "message": err.Error()})
+			return
+		}
+		if resp.Code != http.StatusOK {
+			c.AbortWithStatusJSON(http.StatusOK, resp)
+			return
+		}
+		body := buildM3U(common.GetApiUrlFormRequest(c.Request), dir, resp.Data.Content)
+		RecordMediaAudit(c, EventPlaylist, dir)
+		c.Header("Content-Disposition", `inline; filename="playlist.m3u"`)
+		c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", body)
+		c.Abort()
+	}
+}
+
+// playlistListResponse 只解析生成播放列表需要的字段
+type playlistListResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Content []playlistItem `json:"content"`
+	} `json:"data"`
+}
+
+type playlistItem struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	Sign  string `json:"sign"`
+	Type  int    `json:"type"`
+}
+
+// listDirectory 通过内部请求调用 /api/fs/list 获取目录中的全部文件
+func listDirectory(h http.Handler, c *gin.Context, base, dir string) (*playlistListResponse, error) {
+	reqBody, _ := json.Marshal(map[string]any{"path": dir, "password": c.Query("password")})
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, base+"/api/fs/list", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Host = c.Request.Host
+	req.Header.Set("Content-Type", "application/json")
+	for _, header := range []string{"Authorization", "X-Forwarded-Proto", "X-Forwarded-Host"} {
+		if v := c.GetHeader(header); v != "" {
+			req.Header.Set(header, v)
+		}
+	}
+	MarkInternalRequest(req)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("list %s: status %d", dir, w.Code)
+	}
+	var resp playlistListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("list %s: %w", dir, err)
+	}
+	return &resp, nil
+}
+
+// buildM3U 生成扩展 M3U 播放列表，每个视频文件一项，地址为 /d/ 下载链接，需要签名时带上 sign 参数
+func buildM3U(apiURL, dir string, items []playlistItem) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	for _, item := range items {
+		if item.IsDir || item.Type != conf.VIDEO {
+			continue
+		}
+		u := apiURL + "/d" + (&url.URL{Path: listItemPath(dir, fsObject{Name: item.Name})}).EscapedPath()
+		if item.Sign != "" {
+			u += "?sign=" + url.QueryEscape(item.Sign)
+		}
+		// 标题中的换行会破坏播放列表格式
+		title := strings.NewReplacer("\r", " ", "\n", " ").Replace(item.Name)
+		fmt.Fprintf(&b, "#EXTINF:-1,%s\n%s\n", title, u)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlaylistMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oldConf := conf.Conf
+	conf.Conf = &conf.Config{MediaLog: conf.DefaultMediaLogConfig()}
+	defer func() { conf.Conf = oldConf }()
+	sink := &eventSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+
+	var listAuth string
+	var listInternal bool
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(), PlaylistMiddleware())
+	r.POST("/api/fs/list", func(c *gin.Context) {
+		listAuth = c.GetHeader("Authorization")
+		listInternal = isInternalRequest(c)
+		var req struct {
+			Path string `json:"path"`
+		}
+		_ = c.ShouldBindJSON(&req)
+		if req.Path != "/movies" {
+			c.JSON(http.StatusOK, gin.H{"code": 403, "message": "permission denied"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"content": []gin.H{
+			{"name": "Season 1", "is_dir": true, "type": 1},
+			{"name": "a b.mp4", "type": conf.VIDEO, "sign": "s1"},
+			{"name": "cover.jpg", "type": conf.IMAGE},
+			{"name": "c.mkv", "type": conf.VIDEO},
+		}}})
+	})
+	SetPlaylistHandler(r)
+	defer SetPlaylistHandler(nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/playlist.m3u?path=/movies", nil)
+	req.Host = "example.com"
+	req.Header.Set("Authorization", "token-a")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "audio/x-mpegurl") {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "#EXTM3U\n" +
+		"#EXTINF:-1,a b.mp4\nhttp://example.com/d/movies/a%20b.mp4?sign=s1\n" +
+		"#EXTINF:-1,c.mkv\nhttp://example.com/d/movies/c.mkv\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("playlist:\n%s\nwant:\n%s", got, want)
+	}
+	if listAuth != "token-a" || !listInternal {
+		t.Fatalf("list request auth %q internal %v", listAuth, listInternal)
+	}
+	// 内部的列表请求不记录，只记录一条 playlist 事件
+	if len(sink.events) != 1 || sink.events[0].Event != EventPlaylist || sink.events[0].Path != "/movies" {
+		t.Fatalf("events = %+v", sink.events)
+	}
+	if line := formatMediaLog(sink.events[0]); !strings.Contains(line, "操作：生成播放列表") {
+		t.Fatalf("log line %q", line)
+	}
+
+	// 列表失败时返回错误，不记录事件
+	req = httptest.NewRequest(http.MethodGet, "/playlist.m3u?path=/private", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "permission denied") || len(sink.events) != 1 {
+		t.Fatalf("denied list: body %q, %d events", w.Body.String(), len(sink.events))
+	}
+}
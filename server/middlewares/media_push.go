@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const defaultPushWindow = 30 * time.Second
+
+// pushPriorities 是各推送服务的默认优先级、告警优先级和最高优先级
+var pushPriorities = map[string]struct{ normal, alert, max int }{
+	"ntfy":   {normal: 3, alert: 5, max: 5},
+	"gotify": {normal: 5, alert: 8, max: 10},
+}
+
+// pushSink 把事件摘要推送到 ntfy 主题或 Gotify 服务器，适合自建的推送服务
+// 一批事件合并为一条消息，优先级取其中最高的一个，告警事件比普通访问的优先级更高
+type pushSink struct {
+	kind     string
+	url      string
+	token    string
+	priority int
+	client   *http.Client
+}
+
+func newPushSink(cfg conf.MediaLogNotifier) *pushSink {
+	s := &pushSink{
+		kind:     cfg.Type,
+		url:      cfg.URL,
+		token:    cfg.Token,
+		priority: cfg.Priority,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.priority <= 0 {
+		s.priority = pushPriorities[s.kind].normal
+	}
+	return s
+}
+
+// priorityFor 返回事件的优先级，告警事件至少使用告警优先级
+func (s *pushSink) priorityFor(event string) int {
+	if !isAlertEvent(event) {
+		return s.priority
+	}
+	p := pushPriorities[s.kind]
+	return min(max(s.priority+2, p.alert), p.max)
+}
+
+func (s *pushSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *pushSink) WriteBatch(evs []*AccessEvent) error {
+	events := coalesceEvents(evs)
+	lines := make([]string, 0, len(events))
+	priority := 0
+	for _, ce := range events {
+		lines = append(lines, summarizeEvent(ce))
+		priority = max(priority, s.priorityFor(ce.Event))
+	}
+	title := "OpenList: " + eventFileName(events[0].AccessEvent)
+	if len(events) > 1 {
+		title = fmt.Sprintf("OpenList: %d media events", len(events))
+	}
+	message := strings.Join(lines, "\n")
+
+	if s.kind == "gotify" {
+		return s.sendGotify(title, message, priority)
+	}
+	return s.sendNtfy(title, message, priority)
+}
+
+func (s *pushSink) sendNtfy(title, message string, priority int) error {
+	return sendNotification(s.client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, s.url, strings.NewReader(message))
+		if err != nil {
+			return nil, err
+		}
+		// 文件名可能包含非 ASCII 字符，ntfy 支持 RFC 2047 编码的请求头
+		req.Header.Set("Title", mime.QEncoding.Encode("utf-8", title))
+		req.Header.Set("Priority", strconv.Itoa(priority))
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+		return req, nil
+	})
+}
+
+func (s *pushSink) sendGotify(title, message string, priority int) error {
+	body, err := json.Marshal(map[string]any{
+		"title":    title,
+		"message":  message,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(s.url, "/") + "/message"
+	return sendNotification(s.client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gotify-Key", s.token)
+		return req, nil
+	})
+}
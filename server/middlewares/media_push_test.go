@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestPushSinkPriority(t *testing.T) {
+	ntfy := newPushSink(conf.MediaLogNotifier{Type: "ntfy"})
+	if p := ntfy.priorityFor(EventAccess); p != 3 {
+		t.Errorf("ntfy access priority = %d, want 3", p)
+	}
+	if p := ntfy.priorityFor(EventDenied); p != 5 {
+		t.Errorf("ntfy alert priority = %d, want 5", p)
+	}
+	gotify := newPushSink(conf.MediaLogNotifier{Type: "gotify", Priority: 7})
+	if p := gotify.priorityFor(EventAnomaly); p != 9 {
+		t.Errorf("gotify alert priority = %d, want 9", p)
+	}
+}
+
+func TestPushSinkNtfyAndGotify(t *testing.T) {
+	type request struct {
+		path   string
+		header http.Header
+		body   string
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{path: r.URL.Path, header: r.Header, body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+
+	denied := testAccessEvent()
+	denied.Event = EventDenied
+	ntfy := newPushSink(conf.MediaLogNotifier{Type: "ntfy", URL: srv.URL + "/media", Token: "tk"})
+	if err := ntfy.WriteBatch([]*AccessEvent{testAccessEvent(), denied}); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.header.Get("Priority") != "5" || req.header.Get("Authorization") != "Bearer tk" {
+		t.Fatalf("unexpected ntfy headers: %v", req.header)
+	}
+	if !strings.Contains(req.body, "alice access /movies/Interstellar.mkv") {
+		t.Fatalf("unexpected ntfy body: %s", req.body)
+	}
+
+	gotify := newPushSink(conf.MediaLogNotifier{Type: "gotify", URL: srv.URL + "/", Token: "app"})
+	if err := gotify.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	req = <-requests
+	var msg struct {
+		Title    string `json:"title"`
+		Priority int    `json:"priority"`
+	}
+	if err := json.Unmarshal([]byte(req.body), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if req.path != "/message" || req.header.Get("X-Gotify-Key") != "app" || msg.Priority != 5 || msg.Title != "OpenList: Interstellar.mkv" {
+		t.Fatalf("unexpected gotify request: %s %v %+v", req.path, req.header, msg)
+	}
+}
@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RangeCaptureMiddleware 记录媒体文件 Range 请求实际返回的范围
+// 响应为 206 时把 Content-Range（格式为 bytes X-Y/Total）写入访问事件的 RequestedRange，
+// 多段范围的响应没有 Content-Range 头，这时记录请求的 Range；
+// 请求带有 Range 但响应为 200 时标记 RangeIgnored，说明客户端没有得到续传和拖动进度的支持
+// 因 If-Range 不匹配而返回完整文件的请求已经标记为 FullResume，不再标记 RangeIgnored
+func RangeCaptureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rangeHeader := c.GetHeader("Range")
+		if rangeHeader == "" || c.Request.Method != http.MethodGet || !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		c.Next()
+		ev := getAccessEvent(c)
+		if ev == nil {
+			return
+		}
+		switch c.Writer.Status() {
+		case http.StatusPartialContent:
+			ev.RequestedRange = c.Writer.Header().Get("Content-Range")
+			if ev.RequestedRange == "" {
+				ev.RequestedRange = rangeHeader
+			}
+		case http.StatusOK:
+			ev.RangeIgnored = !ev.FullResume
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRangeCaptureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var events []*AccessEvent
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		newAccessEvent(c)
+		if c.Query("resume") != "" {
+			getAccessEvent(c).FullResume = true
+		}
+		c.Next()
+		events = append(events, accessEventFor(c, c.Request.URL.Path))
+	})
+	r.Use(RangeCaptureMiddleware())
+	r.GET("/d/*path", func(c *gin.Context) {
+		switch c.Query("mode") {
+		case "ignore":
+			c.String(http.StatusOK, "0123456789")
+		case "multipart":
+			c.Header("Content-Type", "multipart/byteranges; boundary=x")
+			c.String(http.StatusPartialContent, "--x--")
+		default:
+			c.Header("Content-Range", "bytes 5-9/10")
+			c.String(http.StatusPartialContent, "56789")
+		}
+	})
+
+	cases := []struct {
+		target, rangeHeader string
+		requestedRange      string
+		ignored             bool
+	}{
+		{"/d/movies/a.mp4", "bytes=5-", "bytes 5-9/10", false},
+		{"/d/movies/a.mp4?mode=multipart", "bytes=0-1,5-6", "bytes=0-1,5-6", false},
+		{"/d/movies/a.mp4?mode=ignore", "bytes=5-", "", true},
+		// If-Range 不匹配返回完整文件的请求已经标记为 FullResume
+		{"/d/movies/a.mp4?mode=ignore&resume=1", "bytes=5-", "", false},
+		// 没有 Range 的请求和非媒体文件不记录
+		{"/d/movies/a.mp4?mode=ignore", "", "", false},
+		{"/d/docs/a.txt", "bytes=5-", "", false},
+	}
+	for i, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.rangeHeader != "" {
+			req.Header.Set("Range", tc.rangeHeader)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if ev := events[i]; ev.RequestedRange != tc.requestedRange || ev.RangeIgnored != tc.ignored {
+			t.Errorf("%s Range %q: requested range %q, range ignored %v", tc.target, tc.rangeHeader, ev.RequestedRange, ev.RangeIgnored)
+		}
+	}
+}
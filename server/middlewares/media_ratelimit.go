@@ -0,0 +1,130 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// 超过该时间没有请求的 IP 会从按 IP 限流的表中清除
+const ipLimiterIdleTimeout = 10 * time.Minute
+
+// RateLimiter 判断是否允许当前请求通过，*rate.Limiter 满足该接口
+type RateLimiter interface {
+	Allow() bool
+}
+
+// rateLimitMiddleware 是全局限流和按 IP 限流共用的实现，limiterFor 返回当前请求使用的限流器
+func rateLimitMiddleware(limiterFor func(c *gin.Context) RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiterFor(c).Allow() {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
+
+// GlobalRateLimiter 对所有请求共用一个令牌桶，不区分 IP，
+// 适合开发环境或单用户实例等不需要按 IP 区分的场景
+func GlobalRateLimiter(rps float64, burst int) gin.HandlerFunc {
+	limiter := rate.NewLimiter(rate.Limit(rps), burst)
+	return rateLimitMiddleware(func(*gin.Context) RateLimiter {
+		return limiter
+	})
+}
+
+// PerIPRateLimiter 为每个客户端 IP 单独维护一个令牌桶
+// 清理空闲 IP 的后台任务在服务器退出时由 CloseMediaMiddlewares 停止
+func PerIPRateLimiter(rps float64, burst int) gin.HandlerFunc {
+	limiter := NewIPRateLimiter(rps, burst)
+	closeOnShutdown(limiter)
+	return limiter.Middleware()
+}
+
+// IPRateLimiter 按客户端 IP 限流，后台每分钟清除一次空闲的 IP，Close 停止清除
+type IPRateLimiter struct {
+	limiters *ipRateLimiters
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewIPRateLimiter 创建按 IP 的限流器，参数与 PerIPRateLimiter 相同
+func NewIPRateLimiter(rps float64, burst int) *IPRateLimiter {
+	l := &IPRateLimiter{
+		limiters: &ipRateLimiters{
+			limit:    rate.Limit(rps),
+			burst:    burst,
+			limiters: make(map[string]*ipRateLimiter),
+		},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.stopped)
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				l.limiters.sweep(now)
+			case <-l.done:
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// Middleware 返回限流中间件
+func (l *IPRateLimiter) Middleware() gin.HandlerFunc {
+	return rateLimitMiddleware(func(c *gin.Context) RateLimiter {
+		return l.limiters.get(c.ClientIP(), time.Now())
+	})
+}
+
+// Close 停止清除空闲的 IP，可以重复调用
+func (l *IPRateLimiter) Close() error {
+	l.once.Do(func() { close(l.done) })
+	<-l.stopped
+	return nil
+}
+
+type ipRateLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+type ipRateLimiters struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*ipRateLimiter
+}
+
+func (l *ipRateLimiters) get(ip string, now time.Time) RateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.limiters[ip]
+	if !ok {
+		limiter = &ipRateLimiter{Limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = limiter
+	}
+	limiter.lastSeen = now
+	return limiter
+}
+
+// sweep 清除长时间没有请求的 IP，避免长期运行时占用内存
+func (l *ipRateLimiters) sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, limiter := range l.limiters {
+		if now.Sub(limiter.lastSeen) > ipLimiterIdleTimeout {
+			delete(l.limiters, ip)
+		}
+	}
+}
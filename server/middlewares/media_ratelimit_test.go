@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func rateLimitedEngine(limiter gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(limiter)
+	r.GET("/d/video.mp4", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func serveFrom(r *gin.Engine, remoteAddr string) int {
+	req := httptest.NewRequest(http.MethodGet, "/d/video.mp4", nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestGlobalRateLimiter(t *testing.T) {
+	r := rateLimitedEngine(GlobalRateLimiter(0.001, 2))
+	want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	addrs := []string{"10.0.0.1:1000", "10.0.0.2:1000", "10.0.0.3:1000", "10.0.0.1:1000"}
+	for i, addr := range addrs {
+		if got := serveFrom(r, addr); got != want[i] {
+			t.Errorf("request %d from %s: status %d, want %d", i, addr, got, want[i])
+		}
+	}
+}
+
+func TestPerIPRateLimiter(t *testing.T) {
+	r := rateLimitedEngine(PerIPRateLimiter(0.001, 1))
+	cases := []struct {
+		addr string
+		want int
+	}{
+		{"10.0.0.1:1000", http.StatusOK},
+		{"10.0.0.1:1001", http.StatusTooManyRequests},
+		{"10.0.0.2:1000", http.StatusOK},
+		{"10.0.0.2:1000", http.StatusTooManyRequests},
+	}
+	for i, tc := range cases {
+		if got := serveFrom(r, tc.addr); got != tc.want {
+			t.Errorf("request %d from %s: status %d, want %d", i, tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestIPRateLimitersSweep(t *testing.T) {
+	l := &ipRateLimiters{limit: 1, burst: 1, limiters: make(map[string]*ipRateLimiter)}
+	now := time.Now()
+	l.get("10.0.0.1", now.Add(-ipLimiterIdleTimeout-time.Second))
+	l.get("10.0.0.2", now)
+	l.sweep(now)
+	if _, ok := l.limiters["10.0.0.1"]; ok {
+		t.Error("idle limiter was not removed")
+	}
+	if _, ok := l.limiters["10.0.0.2"]; !ok {
+		t.Error("active limiter was removed")
+	}
+}
+
+func TestCloseMediaMiddlewares(t *testing.T) {
+	PerIPRateLimiter(1, 1)
+	MediaAuthBruteForceMiddleware(3, time.Minute)
+	shutdownMu.Lock()
+	closers := append([]io.Closer(nil), shutdownClosers...)
+	shutdownMu.Unlock()
+	if len(closers) < 2 {
+		t.Fatalf("got %d registered closers", len(closers))
+	}
+
+	CloseMediaMiddlewares()
+	// 后台任务已经退出
+	for _, c := range closers {
+		var stopped chan struct{}
+		switch c := c.(type) {
+		case *IPRateLimiter:
+			stopped = c.stopped
+		case *MediaAuthBruteForce:
+			stopped = c.stopped
+		default:
+			continue
+		}
+		select {
+		case <-stopped:
+		default:
+			t.Fatalf("%T is still running", c)
+		}
+	}
+	shutdownMu.Lock()
+	left := len(shutdownClosers)
+	shutdownMu.Unlock()
+	if left != 0 {
+		t.Fatalf("%d closers left after shutdown", left)
+	}
+}
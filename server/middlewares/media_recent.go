@@ -0,0 +1,181 @@
+package middlewares
+
+import (
+	"sort"
+	"sync"
+)
+
+// recentRing 是固定大小的环形缓冲区，保存最近输出的事件
+// 写入和读取都只在复制指针时短暂持有锁，事件输出后不会再被修改，可以直接共享
+type recentRing struct {
+	mu      sync.Mutex
+	entries []RecentMediaEvent
+	// next 为下一次写入的位置，full 表示已经写满一圈
+	next int
+	full bool
+	// lastID 为最后写入的事件序号，从 1 开始递增，调整大小时不变
+	lastID uint64
+	// evictedID 为被覆盖或缩小时丢弃的最后一个事件的序号，用于判断重连时是否错过了事件；
+	// forget 清除的事件不算错过
+	evictedID uint64
+	// 订阅新事件的 tail 连接
+	subscribers map[chan RecentMediaEvent]struct{}
+}
+
+// RecentMediaEvent 是带有环形缓冲区序号的事件，序号用作 SSE 的事件 ID
+type RecentMediaEvent struct {
+	ID uint64 `json:"id"`
+	*AccessEvent
+}
+
+// recentEvents 不随配置重新加载而清空，InitMediaLog 只调整它的大小
+var recentEvents = newRecentRing(1000)
+
+func newRecentRing(size int) *recentRing {
+	return &recentRing{
+		entries:     make([]RecentMediaEvent, size),
+		subscribers: make(map[chan RecentMediaEvent]struct{}),
+	}
+}
+
+func (r *recentRing) add(ev *AccessEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID++
+	entry := RecentMediaEvent{ID: r.lastID, AccessEvent: ev}
+	r.addLocked(entry)
+	for ch := range r.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			// 跟不上的连接直接断开，客户端可以带上 Last-Event-ID 重连补齐
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (r *recentRing) addLocked(entry RecentMediaEvent) {
+	if len(r.entries) == 0 {
+		r.evictedID = entry.ID
+		return
+	}
+	if r.full {
+		r.evictedID = r.entries[r.next].ID
+	}
+	r.entries[r.next] = entry
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot 按从新到旧的顺序返回最多 limit 条事件，limit <= 0 时返回全部
+func (r *recentRing) snapshot(limit int) []*AccessEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.snapshotLocked(limit)
+	out := make([]*AccessEvent, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.AccessEvent)
+	}
+	return out
+}
+
+func (r *recentRing) snapshotLocked(limit int) []RecentMediaEvent {
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	out := make([]RecentMediaEvent, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return out
+}
+
+// tailLocked 按从旧到新的顺序返回最后 n 条事件
+func (r *recentRing) tailLocked(n int) []RecentMediaEvent {
+	out := r.snapshotLocked(n)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// sinceLocked 按从旧到新的顺序返回序号大于 id 的事件，
+// 中间有事件已经被覆盖时返回 false
+func (r *recentRing) sinceLocked(id uint64) ([]RecentMediaEvent, bool) {
+	if id > r.lastID || id < r.evictedID {
+		return nil, false
+	}
+	all := r.tailLocked(0)
+	i := sort.Search(len(all), func(i int) bool { return all[i].ID > id })
+	return all[i:], true
+}
+
+func (r *recentRing) capacity() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// resize 调整缓冲区大小，保留最新的事件；size <= 0 时停用
+func (r *recentRing) resize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	if size == len(r.entries) {
+		return
+	}
+	all := r.tailLocked(0)
+	if dropped := len(all) - size; dropped > 0 {
+		r.evictedID = max(r.evictedID, all[dropped-1].ID)
+		all = all[dropped:]
+	}
+	r.rebuildLocked(size, all)
+}
+
+// rebuildLocked 用按从旧到新排列的 entries 重建大小为 size 的缓冲区，entries 不能超过 size 条
+func (r *recentRing) rebuildLocked(size int, entries []RecentMediaEvent) {
+	r.entries = make([]RecentMediaEvent, size)
+	r.next, r.full = 0, false
+	for _, entry := range entries {
+		r.addLocked(entry)
+	}
+}
+
+// forget 删除 username 的事件，返回删除的条数；之后的事件序号不变，重连的 tail 连接不会因此重新发送全部事件
+func (r *recentRing) forget(username string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := r.tailLocked(0)
+	kept := all[:0]
+	for _, entry := range all {
+		if entry.Username != username {
+			kept = append(kept, entry)
+		}
+	}
+	n := len(all) - len(kept)
+	if n > 0 {
+		r.rebuildLocked(len(r.entries), kept)
+	}
+	return n
+}
+
+// RecentMediaEvents 是内存中最近事件的快照
+type RecentMediaEvents struct {
+	Capacity int            `json:"capacity"`
+	Items    []*AccessEvent `json:"items"`
+}
+
+// GetRecentMediaEvents 按从新到旧的顺序返回最多 limit 条最近的事件
+func GetRecentMediaEvents(limit int) RecentMediaEvents {
+	return RecentMediaEvents{Capacity: recentEvents.capacity(), Items: recentEvents.snapshot(limit)}
+}
@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func recentPaths(evs []*AccessEvent) []string {
+	paths := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		paths = append(paths, ev.Path)
+	}
+	return paths
+}
+
+func TestRecentRing(t *testing.T) {
+	r := newRecentRing(3)
+	if got := r.snapshot(0); len(got) != 0 {
+		t.Fatalf("empty ring returned %v", recentPaths(got))
+	}
+	for i := 1; i <= 5; i++ {
+		r.add(&AccessEvent{Path: fmt.Sprintf("/%d.mp4", i)})
+	}
+	if got, want := recentPaths(r.snapshot(0)), []string{"/5.mp4", "/4.mp4", "/3.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot = %v, want %v", got, want)
+	}
+	if got, want := recentPaths(r.snapshot(2)), []string{"/5.mp4", "/4.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot(2) = %v, want %v", got, want)
+	}
+
+	// 扩大后保留已有的事件
+	r.resize(5)
+	r.add(&AccessEvent{Path: "/6.mp4"})
+	if got, want := recentPaths(r.snapshot(0)), []string{"/6.mp4", "/5.mp4", "/4.mp4", "/3.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after grow = %v, want %v", got, want)
+	}
+	// 缩小后只保留最新的
+	r.resize(2)
+	if got, want := recentPaths(r.snapshot(0)), []string{"/6.mp4", "/5.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after shrink = %v, want %v", got, want)
+	}
+	r.add(&AccessEvent{Path: "/7.mp4"})
+	if got, want := recentPaths(r.snapshot(0)), []string{"/7.mp4", "/6.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after shrink and add = %v, want %v", got, want)
+	}
+
+	r.resize(0)
+	r.add(&AccessEvent{Path: "/8.mp4"})
+	if got := r.snapshot(0); len(got) != 0 || r.capacity() != 0 {
+		t.Fatalf("disabled ring returned %v", recentPaths(got))
+	}
+}
+
+func TestRecentRingForget(t *testing.T) {
+	r := newRecentRing(4)
+	for i, user := range []string{"alice", "bob", "alice", "bob", "alice"} {
+		r.add(&AccessEvent{Username: user, Path: fmt.Sprintf("/%d.mp4", i+1)})
+	}
+	if n := r.forget("alice"); n != 2 {
+		t.Fatalf("forget = %d, want 2", n)
+	}
+	if got, want := recentPaths(r.snapshot(0)), []string{"/4.mp4", "/2.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("after forget = %v, want %v", got, want)
+	}
+	// 清除的事件不算错过，重连时只补发之后的事件
+	r.add(&AccessEvent{Username: "bob", Path: "/6.mp4"})
+	r.mu.Lock()
+	since, ok := r.sinceLocked(3)
+	r.mu.Unlock()
+	if !ok || len(since) != 2 || since[0].ID != 4 || since[1].ID != 6 {
+		t.Fatalf("since(3) = %v, %v", since, ok)
+	}
+	// 被覆盖的事件仍然算错过
+	for i := 7; i <= 9; i++ {
+		r.add(&AccessEvent{Username: "bob", Path: fmt.Sprintf("/%d.mp4", i)})
+	}
+	r.mu.Lock()
+	_, ok = r.sinceLocked(3)
+	r.mu.Unlock()
+	if ok {
+		t.Fatal("overwritten events were treated as resumable")
+	}
+}
+
+func TestPurgedUserNotRecentlyWatched(t *testing.T) {
+	recentEvents.resize(0)
+	recentEvents.resize(20)
+	defer recentEvents.resize(defaultMediaLogConf.RecentSize)
+
+	served := int64(100)
+	recentEvents.add(&AccessEvent{Event: EventAccess, Username: "alice", Path: "/d/a.mkv", Status: 200, BytesServed: &served})
+	recentEvents.add(&AccessEvent{Event: EventAccess, Username: "bob", Path: "/d/b.mkv", Status: 200, BytesServed: &served})
+	recentEvents.forget("alice")
+	if got := GetRecentlyWatched("alice", 20); len(got) != 0 {
+		t.Fatalf("purged user still has %+v", got)
+	}
+	for _, ev := range GetRecentMediaEvents(0).Items {
+		if ev.Username == "alice" {
+			t.Fatalf("purged user still in recent events: %+v", ev)
+		}
+	}
+	if got := GetRecentlyWatched("bob", 20); len(got) != 1 {
+		t.Fatalf("bob = %+v", got)
+	}
+}
+
+func BenchmarkRecentRingAdd(b *testing.B) {
+	r := newRecentRing(1000)
+	ev := &AccessEvent{Path: "/a.mp4"}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.add(ev)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// SetMediaProvider 由下载处理函数调用，记录当前请求的文件所在存储使用的驱动，例如 "115 Cloud"
+// 驱动名称同时保存在上下文的 StorageDriverContextKey 中，供 WithStorageTagging 读取
+func SetMediaProvider(c *gin.Context, provider string) {
+	c.Set(StorageDriverContextKey, provider)
+	if ev := getAccessEvent(c); ev != nil {
+		ev.Provider = provider
+	}
+}
+
+// annotateFileResponse 根据直接访问媒体文件的响应补充事件字段
+// 存储不走代理时 /d/ 只返回 302 跳转到网盘的直链，没有实际传输数据，记录为 redirect_download，
+// 只保留跳转目标的主机名（完整地址带有签名），并且不填写传输字节数，避免影响流量统计
+func annotateFileResponse(c *gin.Context, ev *AccessEvent) {
+	location := c.Writer.Header().Get("Location")
+	if isRedirectStatus(c.Writer.Status()) && location != "" && isDownloadRoute(c.Request.URL.Path) {
+		if ev.Event == EventAccess {
+			ev.Event = EventRedirectDownload
+		}
+		ev.RedirectHost = redirectHost(location)
+		return
+	}
+	if size := c.Writer.Size(); size >= 0 {
+		n := int64(size)
+		ev.BytesServed = &n
+	}
+}
+
+// isRedirectStatus 判断是否为跳转响应，304 等其他 3xx 状态码不算
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// isDownloadRoute 判断是否为 /d/ 下载路由，考虑站点路径
+func isDownloadRoute(p string) bool {
+	if conf.URL != nil {
+		if base := strings.TrimSuffix(conf.URL.Path, "/"); base != "" {
+			if !hasRoutePrefix(p, []string{base}) {
+				return false
+			}
+			p = strings.TrimPrefix(p, base)
+		}
+	}
+	return hasRoutePrefix(p, []string{"/d"})
+}
+
+func redirectHost(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type eventSink struct {
+	events []*AccessEvent
+}
+
+func (s *eventSink) Write(ev *AccessEvent) error {
+	s.events = append(s.events, ev)
+	return nil
+}
+
+func TestRedirectDownloadEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(sink)))
+	r.GET("/d/*path", func(c *gin.Context) {
+		SetMediaProvider(c, "115 Cloud")
+		if c.Query("proxy") != "" {
+			c.String(http.StatusOK, "video")
+			return
+		}
+		c.Redirect(http.StatusFound, "https://cdn.example.com/file/a.mp4?sign=secret&t=1")
+	})
+	r.GET("/p/*path", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "https://proxy.example.com/a.mp4")
+	})
+	for _, u := range []string{"/d/movies/a.mp4", "/d/movies/a.mp4?proxy=1", "/p/movies/a.mp4"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+	}
+	if len(sink.events) != 3 {
+		t.Fatalf("got %d events, want 3", len(sink.events))
+	}
+
+	redirect := sink.events[0]
+	if redirect.Event != EventRedirectDownload || redirect.RedirectHost != "cdn.example.com" ||
+		redirect.Provider != "115 Cloud" || redirect.BytesServed != nil {
+		t.Errorf("unexpected redirect event %+v", redirect)
+	}
+	data, _ := json.Marshal(redirect)
+	if !strings.Contains(string(data), `"bytes_served":null`) || strings.Contains(string(data), "secret") {
+		t.Errorf("redirect event json %s", data)
+	}
+
+	proxied := sink.events[1]
+	if proxied.Event != EventAccess || proxied.BytesServed == nil || *proxied.BytesServed != int64(len("video")) {
+		t.Errorf("unexpected proxied event %+v", proxied)
+	}
+	if other := sink.events[2]; other.Event != EventAccess || other.RedirectHost != "" {
+		t.Errorf("3xx outside /d/ should stay an access event, got %+v", other)
+	}
+}
+
+func TestNotModifiedIsNotRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	modTime := time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(sink)), LastModifiedMiddleware(fakeMetaProvider{"/movies/a.mp4": modTime}))
+	r.GET("/d/*path", func(c *gin.Context) {
+		// 没有 Location 的跳转状态码也不是跳转下载
+		if c.Query("bare") != "" {
+			c.Status(http.StatusFound)
+			return
+		}
+		c.String(http.StatusOK, "video")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil)
+	req.Header.Set("If-Modified-Since", modTime.Format(http.TimeFormat))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/movies/b.mp4?bare=1", nil))
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	for _, ev := range sink.events {
+		if ev.Event != EventAccess || ev.RedirectHost != "" {
+			t.Errorf("%s logged as %s", ev.Path, ev.Event)
+		}
+	}
+	if !sink.events[0].NotModified {
+		t.Error("304 response was not marked not_modified")
+	}
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	stdpath "path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renameRequest 对应 handles.RenameReq
+type renameRequest struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// RenameTrackerMiddleware 在 /api/fs/rename 成功重命名媒体文件后记录一条 rename 事件，
+// Path 和 DestPath 为新路径，SourcePath 为原路径；已经记录的事件保留原路径，日志分析时通过这条事件关联新旧路径
+func RenameTrackerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path != "/api/fs/rename" || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		var req renameRequest
+		if json.Unmarshal(body, &req) != nil || req.Path == "" || req.Name == "" {
+			c.Next()
+			return
+		}
+		oldPath := stdpath.Join("/", req.Path)
+		newPath := stdpath.Join(stdpath.Dir(oldPath), req.Name)
+		if oldPath == newPath || !isMediaFileName(stdpath.Base(oldPath)) && !isMediaFileName(req.Name) {
+			c.Next()
+			return
+		}
+
+		w := &responseBodyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = w
+		c.Next()
+		var resp struct {
+			Code int `json:"code"`
+		}
+		if c.Writer.Status() != http.StatusOK || json.Unmarshal(w.body.Bytes(), &resp) != nil || resp.Code != 200 {
+			return
+		}
+		ev := accessEventFor(c, newPath)
+		ev.Event = EventRename
+		ev.SourcePath = oldPath
+		ev.DestPath = newPath
+		logMediaAccess(newMediaLoggerOptions(), ev)
+	}
+}
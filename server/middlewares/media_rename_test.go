@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenameTrackerMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &eventSink{}
+	SetMediaLogSinks(sink)
+	defer SetMediaLogSinks()
+
+	r := gin.New()
+	r.Use(RenameTrackerMiddleware())
+	r.POST("/api/fs/rename", func(c *gin.Context) {
+		var req renameRequest
+		_ = c.ShouldBindJSON(&req)
+		if strings.Contains(req.Name, "exists") {
+			c.JSON(http.StatusOK, gin.H{"code": 403, "message": "file exists"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 200, "message": "success"})
+	})
+
+	for _, body := range []string{
+		`{"path":"/movies/old.mkv","name":"new.mkv"}`,
+		`{"path":"/movies/old.mkv","name":"exists.mkv"}`,
+		`{"path":"/docs/a.txt","name":"b.txt"}`,
+		// 改名为媒体文件也记录
+		`{"path":"/movies/clip.tmp","name":"clip.mp4"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/fs/rename", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", body, w.Code)
+		}
+	}
+
+	if len(sink.events) != 2 {
+		t.Fatalf("emitted %d events, want 2", len(sink.events))
+	}
+	ev := sink.events[0]
+	if ev.Event != EventRename || ev.SourcePath != "/movies/old.mkv" || ev.DestPath != "/movies/new.mkv" || ev.Path != "/movies/new.mkv" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if line := formatMediaLog(ev); !strings.Contains(line, "操作：重命名") || !strings.Contains(line, "原路径：/movies/old.mkv") {
+		t.Fatalf("log line %q", line)
+	}
+	if sink.events[1].SourcePath != "/movies/clip.tmp" {
+		t.Fatalf("unexpected event %+v", sink.events[1])
+	}
+}
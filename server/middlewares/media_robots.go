@@ -0,0 +1,181 @@
+package middlewares
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// mediaRobotsRule 是策略文件中的一条规则，格式类似 robots.txt：
+//
+//	rules:
+//	  - user_agent: "curl/*"
+//	    disallow: ["/premium/", "/paid/"]
+//	    allow: ["/public/"]
+type mediaRobotsRule struct {
+	UserAgent string   `yaml:"user_agent"`
+	Disallow  []string `yaml:"disallow"`
+	Allow     []string `yaml:"allow"`
+}
+
+type mediaRobotsPolicy struct {
+	Rules []mediaRobotsRule `yaml:"rules"`
+}
+
+func loadMediaRobotsPolicy(policyPath string) (*mediaRobotsPolicy, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+	var policy mediaRobotsPolicy
+	if err = yaml.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// allowed 判断指定 User-Agent 是否可以访问该路径
+// 使用第一条匹配 User-Agent 的规则，规则内按最长前缀匹配，长度相同时 allow 优先
+func (p *mediaRobotsPolicy) allowed(userAgent, filePath string) bool {
+	for _, rule := range p.Rules {
+		if !matchUserAgent(rule.UserAgent, userAgent) {
+			continue
+		}
+		allowLen := longestPrefix(rule.Allow, filePath)
+		disallowLen := longestPrefix(rule.Disallow, filePath)
+		return disallowLen < 0 || allowLen >= disallowLen
+	}
+	return true
+}
+
+func longestPrefix(prefixes []string, s string) int {
+	longest := -1
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) && len(prefix) > longest {
+			longest = len(prefix)
+		}
+	}
+	return longest
+}
+
+// matchUserAgent 对 User-Agent 做不区分大小写的通配匹配，* 可以匹配任意字符（包括 /）
+func matchUserAgent(pattern, userAgent string) bool {
+	pattern = strings.ToLower(pattern)
+	userAgent = strings.ToLower(userAgent)
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == userAgent
+	}
+	if !strings.HasPrefix(userAgent, parts[0]) {
+		return false
+	}
+	userAgent = userAgent[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		idx := strings.Index(userAgent, part)
+		if idx < 0 {
+			return false
+		}
+		userAgent = userAgent[idx+len(part):]
+	}
+	return strings.HasSuffix(userAgent, parts[len(parts)-1])
+}
+
+// stripMediaRoutePrefix 去掉 /d/、/p/ 等下载路由前缀，得到存储中的文件路径
+func stripMediaRoutePrefix(path string) string {
+	for _, prefix := range []string{"/d/", "/p/"} {
+		if strings.HasPrefix(path, prefix) {
+			return path[len(prefix)-1:]
+		}
+	}
+	return path
+}
+
+// MediaRobotsMiddleware 按策略文件禁止特定 User-Agent 访问特定目录下的媒体文件
+// 策略文件在收到 SIGHUP 时重新加载，加载失败时保留上一次的策略
+// 监听信号的后台任务在服务器退出时由 CloseMediaMiddlewares 停止
+func MediaRobotsMiddleware(policyPath string) gin.HandlerFunc {
+	robots := NewMediaRobots(policyPath)
+	closeOnShutdown(robots)
+	return robots.Middleware()
+}
+
+// MediaRobots 保存当前的媒体访问策略，收到 SIGHUP 时重新加载，Close 停止监听信号
+type MediaRobots struct {
+	policyPath string
+	current    atomic.Pointer[mediaRobotsPolicy]
+	hup        chan os.Signal
+	done       chan struct{}
+	stopped    chan struct{}
+	once       sync.Once
+}
+
+// NewMediaRobots 立即加载策略文件并开始监听 SIGHUP，参数与 MediaRobotsMiddleware 相同
+func NewMediaRobots(policyPath string) *MediaRobots {
+	r := &MediaRobots{
+		policyPath: policyPath,
+		hup:        make(chan os.Signal, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	r.reload()
+	signal.Notify(r.hup, syscall.SIGHUP)
+	go func() {
+		defer close(r.stopped)
+		for {
+			select {
+			case <-r.hup:
+				r.reload()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *MediaRobots) reload() {
+	policy, err := loadMediaRobotsPolicy(r.policyPath)
+	if err != nil {
+		log.Errorf("failed to load media robots policy %s: %+v", r.policyPath, err)
+		return
+	}
+	r.current.Store(policy)
+	log.Infof("loaded media robots policy %s with %d rules", r.policyPath, len(policy.Rules))
+}
+
+// Middleware 返回按策略拒绝访问的中间件，停止监听后继续使用最后一次加载的策略
+func (r *MediaRobots) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		policy := r.current.Load()
+		if policy == nil || !isMediaFilePath(path) {
+			c.Next()
+			return
+		}
+		userAgent := c.Request.UserAgent()
+		if !policy.allowed(userAgent, stripMediaRoutePrefix(path)) {
+			log.Infof("media robots policy denied %s for user agent %q", path, userAgent)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Close 停止监听 SIGHUP，可以重复调用
+func (r *MediaRobots) Close() error {
+	r.once.Do(func() {
+		signal.Stop(r.hup)
+		close(r.done)
+	})
+	<-r.stopped
+	return nil
+}
@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatchUserAgent(t *testing.T) {
+	cases := []struct {
+		pattern, ua string
+		want        bool
+	}{
+		{"curl/*", "curl/8.5.0", true},
+		{"curl/*", "Curl/8.5.0", true},
+		{"curl/*", "libcurl/8.5.0", false},
+		{"*bot*", "Mozilla/5.0 (compatible; Googlebot/2.1)", true},
+		{"*bot*", "mpv 0.38.0", false},
+		{"Wget/1.*", "Wget/1.21.4", true},
+		{"Wget/1.*", "Wget/2.0", false},
+		{"*/*/*", "a/b/c", true},
+		{"*", "", true},
+		{"mpv", "mpv", true},
+		{"mpv", "mpv 0.38.0", false},
+	}
+	for _, tc := range cases {
+		if got := matchUserAgent(tc.pattern, tc.ua); got != tc.want {
+			t.Errorf("matchUserAgent(%q, %q) = %v, want %v", tc.pattern, tc.ua, got, tc.want)
+		}
+	}
+}
+
+func TestMediaRobotsPolicyAllowed(t *testing.T) {
+	policy := &mediaRobotsPolicy{Rules: []mediaRobotsRule{
+		{UserAgent: "curl/*", Disallow: []string{"/premium/", "/paid/"}, Allow: []string{"/premium/trailers/", "/paid/"}},
+		{UserAgent: "*", Disallow: []string{"/private/"}},
+	}}
+	cases := []struct {
+		ua, path string
+		want     bool
+	}{
+		{"curl/8.5.0", "/premium/a.mp4", false},
+		// 更长的 allow 覆盖 disallow
+		{"curl/8.5.0", "/premium/trailers/a.mp4", true},
+		// 长度相同时 allow 优先
+		{"curl/8.5.0", "/paid/a.mp4", true},
+		{"curl/8.5.0", "/public/a.mp4", true},
+		// 只使用第一条匹配的规则
+		{"curl/8.5.0", "/private/a.mp4", true},
+		{"mpv 0.38.0", "/private/a.mp4", false},
+		{"mpv 0.38.0", "/premium/a.mp4", true},
+	}
+	for _, tc := range cases {
+		if got := policy.allowed(tc.ua, tc.path); got != tc.want {
+			t.Errorf("allowed(%q, %q) = %v, want %v", tc.ua, tc.path, got, tc.want)
+		}
+	}
+}
+
+func writeRobotsPolicy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRobotsRouter(t *testing.T, policyPath string) *gin.Engine {
+	t.Helper()
+	robots := NewMediaRobots(policyPath)
+	t.Cleanup(func() { _ = robots.Close() })
+	r := gin.New()
+	r.Use(robots.Middleware())
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	return r
+}
+
+func robotsStatus(r *gin.Engine, path, ua string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("User-Agent", ua)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestMediaRobotsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policyPath := filepath.Join(t.TempDir(), "robots.yaml")
+	writeRobotsPolicy(t, policyPath, `rules:
+  - user_agent: "curl/*"
+    disallow: ["/premium/"]
+    allow: ["/premium/trailers/"]
+`)
+	r := newRobotsRouter(t, policyPath)
+	cases := []struct {
+		path, ua string
+		want     int
+	}{
+		{"/d/premium/a.mp4", "curl/8.5.0", http.StatusForbidden},
+		{"/p/premium/a.mkv", "curl/8.5.0", http.StatusForbidden},
+		{"/d/premium/trailers/a.mp4", "curl/8.5.0", http.StatusOK},
+		// 不是媒体文件的请求和没有匹配规则的客户端不受限制
+		{"/d/premium/readme.txt", "curl/8.5.0", http.StatusOK},
+		{"/api/fs/list", "curl/8.5.0", http.StatusOK},
+		{"/d/premium/a.mp4", "mpv 0.38.0", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := robotsStatus(r, tc.path, tc.ua); got != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.ua, tc.path, got, tc.want)
+		}
+	}
+
+	// 策略文件不存在时放行所有请求
+	r = newRobotsRouter(t, filepath.Join(t.TempDir(), "missing.yaml"))
+	if got := robotsStatus(r, "/d/premium/a.mp4", "curl/8.5.0"); got != http.StatusOK {
+		t.Errorf("missing policy: status %d", got)
+	}
+}
+
+func TestMediaRobotsClose(t *testing.T) {
+	robots := NewMediaRobots(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err := robots.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 重复调用不会 panic
+	if err := robots.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
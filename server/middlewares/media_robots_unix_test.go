@@ -0,0 +1,53 @@
+//go:build !windows
+
+package middlewares
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMediaRobotsReloadOnSignal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policyPath := filepath.Join(t.TempDir(), "robots.yaml")
+	writeRobotsPolicy(t, policyPath, "rules: []\n")
+	r := newRobotsRouter(t, policyPath)
+	if got := robotsStatus(r, "/d/premium/a.mp4", "curl/8.5.0"); got != http.StatusOK {
+		t.Fatalf("status before reload = %d", got)
+	}
+
+	writeRobotsPolicy(t, policyPath, `rules:
+  - user_agent: "curl/*"
+    disallow: ["/premium/"]
+`)
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for robotsStatus(r, "/d/premium/a.mp4", "curl/8.5.0") != http.StatusForbidden {
+		if time.Now().After(deadline) {
+			t.Fatal("policy was not reloaded after SIGHUP")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// 加载失败时保留上一次的策略
+	writeRobotsPolicy(t, policyPath, "rules: [")
+	if err = p.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := robotsStatus(r, "/d/premium/a.mp4", "curl/8.5.0"); got != http.StatusForbidden {
+		t.Fatalf("status after invalid policy = %d", got)
+	}
+}
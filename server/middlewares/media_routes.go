@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+)
+
+// mediaRoutePrefixes 是可能产生媒体访问的路由，其他路由（例如管理接口）不可能是媒体访问
+var mediaRoutePrefixes = []string{"/api/fs", "/d", "/p", "/dav"}
+
+// UseMediaLogger 只在给定的路由组上注册媒体日志中间件，例如
+//
+//	middlewares.UseMediaLogger(g.Group("/api/fs"), g.Group("/d"), g.Group("/p"), g.Group("/dav"))
+//
+// 路由组需要在注册路由之前传入，所有组共用同一个中间件实例
+func UseMediaLogger(groups ...gin.IRoutes) {
+	handler := MediaLoggerMiddleware()
+	for _, g := range groups {
+		g.Use(handler)
+	}
+}
+
+// MediaRouteLogger 是可以全局注册的媒体日志中间件，只处理 mediaRoutePrefixes 下的请求，
+// 其他请求直接交给后续处理，不创建访问事件也不包装 ResponseWriter
+func MediaRouteLogger(opts ...Option) gin.HandlerFunc {
+	inner := MediaLoggerWithOptions(opts...)
+	base := ""
+	if conf.URL != nil {
+		base = strings.TrimSuffix(conf.URL.Path, "/")
+	}
+	prefixes := make([]string, len(mediaRoutePrefixes))
+	for i, p := range mediaRoutePrefixes {
+		prefixes[i] = base + p
+	}
+	return func(c *gin.Context) {
+		if !hasRoutePrefix(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+		inner(c)
+	}
+}
+
+// hasRoutePrefix 按路径段匹配前缀，/d 匹配 /d 和 /d/a.mp4，但不匹配 /download
+func hasRoutePrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(p, prefix) && (len(p) == len(prefix) || p[len(prefix)] == '/') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHasRoutePrefix(t *testing.T) {
+	cases := map[string]bool{
+		"/d/movies/a.mp4":        true,
+		"/d":                     true,
+		"/p/a.mkv":               true,
+		"/dav/movies/a.mp4":      true,
+		"/api/fs/list":           true,
+		"/download/a.mp4":        false,
+		"/davx/a.mp4":            false,
+		"/api/fsx":               false,
+		"/api/admin/setting/get": false,
+		"/assets/a.png":          false,
+	}
+	for p, want := range cases {
+		if got := hasRoutePrefix(p, mediaRoutePrefixes); got != want {
+			t.Errorf("hasRoutePrefix(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestMediaRouteLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sink := &recordingSink{}
+	r := gin.New()
+	r.Use(MediaRouteLogger(WithSink(sink)))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, p := range []string{"/d/a.mp4", "/other/b.mp4", "/p/c.mkv", "/api/admin/d.mp4"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+	if want := []string{"/d/a.mp4", "/p/c.mkv"}; !reflect.DeepEqual(sink.paths, want) {
+		t.Errorf("logged %v, want %v", sink.paths, want)
+	}
+}
+
+func TestUseMediaLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var logged bool
+	d := r.Group("/d")
+	UseMediaLogger(d)
+	d.GET("/*path", func(c *gin.Context) { logged = getAccessEvent(c) != nil })
+	r.GET("/api/admin/*path", func(c *gin.Context) { logged = getAccessEvent(c) != nil })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/a.txt", nil))
+	if !logged {
+		t.Error("media logger not installed on /d group")
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/x", nil))
+	if logged {
+		t.Error("media logger should not run outside registered groups")
+	}
+}
+
+func BenchmarkMediaLoggerNonMediaRoute(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	bench := func(b *testing.B, mw gin.HandlerFunc) {
+		r := gin.New()
+		r.Use(mw)
+		r.GET("/api/admin/setting/list", func(c *gin.Context) {})
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/setting/list", nil)
+		w := httptest.NewRecorder()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			r.ServeHTTP(w, req)
+		}
+	}
+	b.Run("global", func(b *testing.B) { bench(b, MediaLoggerMiddleware()) })
+	b.Run("routes", func(b *testing.B) { bench(b, MediaRouteLogger()) })
+	b.Run("none", func(b *testing.B) { bench(b, func(c *gin.Context) { c.Next() }) })
+}
@@ -0,0 +1,159 @@
+package middlewares
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 同一个客户端在 scanBurstWindow 内读取了至少 scanBurstFiles 个不同的文件，
+	// 并且每次只有 HEAD 或者不超过 scanSmallBytes 的少量数据，判定为扫描
+	scanBurstWindow = 30 * time.Second
+	scanBurstFiles  = 10
+	scanSmallBytes  = 1 << 20
+	// 判定为扫描后，在这段时间内同一个客户端的访问都标记为扫描，每次访问都会延长
+	scanCooldown = 2 * time.Minute
+	// 单次传输超过 scanSmallBytes，或者同一个客户端持续读取一个文件累计超过 scanPlaybackBytes、
+	// scanPlaybackReads 次时视为播放，例如 ffmpeg 转封装时的长时间读取和按顺序发出的 Range 请求，
+	// 即使 User-Agent 是扫描器也不标记；ffprobe 读取文件头和文件末尾的索引通常只有两三次请求
+	scanPlaybackBytes = 16 << 20
+	scanPlaybackReads = 4
+	// 最多跟踪的客户端数和每个客户端最多跟踪的文件数，超过时清理过期的记录
+	scanMaxClients = 4096
+	scanMaxStreams = 32
+)
+
+// scanStream 是客户端对一个文件的连续读取，间隔超过 scanCooldown 后重新统计
+type scanStream struct {
+	bytes int64
+	reads int
+	last  time.Time
+}
+
+type scanClient struct {
+	windowStart time.Time
+	files       map[string]struct{}
+	// 判定为扫描的截止时间
+	scanUntil time.Time
+	streams   map[string]*scanStream
+}
+
+// playback 记录一次读取，返回该文件是否正在被持续读取（播放或转封装）
+func (c *scanClient) playback(path string, bytes int64, now time.Time) bool {
+	s := c.streams[path]
+	if s == nil || now.Sub(s.last) > scanCooldown {
+		if len(c.streams) >= scanMaxStreams {
+			for p, old := range c.streams {
+				if now.Sub(old.last) > scanCooldown {
+					delete(c.streams, p)
+				}
+			}
+			if len(c.streams) >= scanMaxStreams {
+				c.streams = make(map[string]*scanStream)
+			}
+		}
+		s = &scanStream{}
+		c.streams[path] = s
+	}
+	s.bytes += bytes
+	s.reads++
+	s.last = now
+	return s.bytes > scanPlaybackBytes || s.reads >= scanPlaybackReads
+}
+
+// scanDetector 识别媒体服务器的扫描流量：User-Agent 在分类表中为 scan，
+// 或者短时间内读取大量不同文件、每次只读取很少的数据（读取文件头获取时长、编码等信息）
+// 传输大量数据或持续读取同一个文件的访问是播放，始终不标记为扫描
+type scanDetector struct {
+	mu      sync.Mutex
+	clients map[string]*scanClient
+}
+
+func newScanDetector() *scanDetector {
+	return &scanDetector{clients: make(map[string]*scanClient)}
+}
+
+var mediaScanDetector = newScanDetector()
+
+func scanClientKey(ip, username, userAgent string) string {
+	return ip + "\x00" + username + "\x00" + userAgent
+}
+
+// detect 返回事件是否为扫描流量，同时把事件计入所属客户端的统计
+func (d *scanDetector) detect(ev *AccessEvent) bool {
+	knownScanner := classifyUserAgent(ev.UserAgent) == TrafficScan
+	if !isPlainAccessEvent(ev.Event) || ev.ClientIP == "" {
+		return knownScanner
+	}
+	now := ev.Time
+	probe := ev.Method == http.MethodHead || ev.Event == EventProbe
+	var bytes int64
+	if ev.BytesServed != nil {
+		bytes = *ev.BytesServed
+	}
+	small := probe || (ev.BytesServed != nil && bytes <= scanSmallBytes)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := scanClientKey(ev.ClientIP, ev.Username, ev.UserAgent)
+	client := d.clients[key]
+	if client == nil {
+		if len(d.clients) >= scanMaxClients {
+			d.sweepLocked(now)
+		}
+		client = &scanClient{windowStart: now, files: make(map[string]struct{}), streams: make(map[string]*scanStream)}
+		d.clients[key] = client
+	}
+	if !probe && client.playback(ev.Path, bytes, now) || ev.BytesServed != nil && !small {
+		return false
+	}
+	scanning := knownScanner || now.Before(client.scanUntil)
+	// 相册页面本来就会一次加载大量小图片，图片不参与按数量的判断
+	if small && mediaCategoryOf(ev.Path) != MediaCategoryImage {
+		if now.Sub(client.windowStart) > scanBurstWindow {
+			client.windowStart = now
+			client.files = make(map[string]struct{})
+		}
+		if len(client.files) < scanBurstFiles {
+			client.files[ev.Path] = struct{}{}
+		}
+		if len(client.files) >= scanBurstFiles {
+			scanning = true
+		}
+	}
+	if scanning {
+		client.scanUntil = now.Add(scanCooldown)
+	}
+	return scanning
+}
+
+// scanning 判断客户端是否处于扫描的冷却时间内，不计入统计
+func (d *scanDetector) scanning(ip, username, userAgent string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	client := d.clients[scanClientKey(ip, username, userAgent)]
+	return client != nil && now.Before(client.scanUntil)
+}
+
+// sweepLocked 清理窗口和冷却时间都已经结束的客户端，仍然超过上限时全部清空
+func (d *scanDetector) sweepLocked(now time.Time) {
+	for key, client := range d.clients {
+		if now.Sub(client.windowStart) > scanBurstWindow && !now.Before(client.scanUntil) {
+			delete(d.clients, key)
+		}
+	}
+	if len(d.clients) >= scanMaxClients {
+		d.clients = make(map[string]*scanClient)
+	}
+}
+
+// isScanRequest 判断请求是否来自扫描媒体库的客户端，供异常检测排除扫描
+// 按 User-Agent 和媒体日志中间件记录的客户端扫描状态判断，不计入扫描统计
+func isScanRequest(c *gin.Context) bool {
+	ua := c.Request.UserAgent()
+	return classifyUserAgent(ua) == TrafficScan ||
+		mediaScanDetector.scanning(c.ClientIP(), getUserName(c), ua, time.Now())
+}
@@ -0,0 +1,207 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestScanDetectorUserAgent(t *testing.T) {
+	d := newScanDetector()
+	for ua, want := range map[string]bool{
+		"Jellyfin-Server/10.9.7":                    true,
+		"Emby Server/4.8.8.0":                       true,
+		"PlexMediaServer/1.40.4.8679-424562606":     true,
+		"Lavf/60.16.100":                            true,
+		"ffprobe/6.1":                               true,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64)": false,
+		// Jellyfin 客户端播放时不是扫描
+		"Jellyfin Media Player/1.11.1": false,
+	} {
+		ev := &AccessEvent{Event: EventAccess, Time: time.Now(), ClientIP: "192.0.2.1", UserAgent: ua, Path: "/a.mp4"}
+		if got := d.detect(ev); got != want {
+			t.Errorf("detect(%q) = %v, want %v", ua, got, want)
+		}
+	}
+}
+
+func TestScanDetectorBurst(t *testing.T) {
+	d := newScanDetector()
+	start := time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)
+	small := int64(64 << 10)
+	large := int64(200 << 20)
+	ev := func(at time.Duration, ip, path string, bytes int64) *AccessEvent {
+		return &AccessEvent{Event: EventAccess, Time: start.Add(at), ClientIP: ip, Method: http.MethodGet,
+			UserAgent: "VLC/3.0.20", Path: path, BytesServed: &bytes}
+	}
+
+	// 每个文件只读取文件头，第 10 个不同的文件时判定为扫描
+	for i := 0; i < scanBurstFiles; i++ {
+		got := d.detect(ev(time.Duration(i)*time.Second, "192.0.2.1", fmt.Sprintf("/tv/e%02d.mkv", i), small))
+		if want := i == scanBurstFiles-1; got != want {
+			t.Fatalf("file %d: detect = %v, want %v", i, got, want)
+		}
+	}
+	// 冷却时间内同一个客户端读取文件头的访问都标记为扫描，传输大量数据的仍然是播放
+	if !d.detect(ev(time.Minute, "192.0.2.1", "/tv/e20.mkv", small)) {
+		t.Fatal("access during the cooldown was not tagged")
+	}
+	if d.detect(ev(time.Minute, "192.0.2.1", "/tv/e00.mkv", large)) {
+		t.Fatal("playback during the cooldown was tagged")
+	}
+	if d.detect(ev(10*time.Minute, "192.0.2.1", "/tv/e21.mkv", small)) {
+		t.Fatal("access after the cooldown was tagged")
+	}
+
+	// 正常播放：反复读取同一个文件，或者在窗口外零散地读取不同的文件
+	for i := 0; i < 2*scanBurstFiles; i++ {
+		if d.detect(ev(time.Duration(i)*time.Second, "192.0.2.2", "/movie.mkv", small)) {
+			t.Fatal("seeking within one file was tagged as a scan")
+		}
+		if d.detect(ev(time.Duration(i)*time.Minute, "192.0.2.3", fmt.Sprintf("/music/%02d.flac", i), small)) {
+			t.Fatal("slow browsing was tagged as a scan")
+		}
+		if d.detect(ev(time.Duration(i)*time.Second, "192.0.2.4", fmt.Sprintf("/tv/e%02d.mkv", i), large)) {
+			t.Fatal("full downloads were tagged as a scan")
+		}
+	}
+}
+
+func TestMediaLogScanTraffic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	views, scans := mediaViews.views.Load(), mediaViews.scans.Load()
+
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	for _, ua := range []string{"Jellyfin-Server/10.9.7", "Mozilla/5.0"} {
+		req := httptest.NewRequest(http.MethodGet, "/d/tv/e01.mkv", nil)
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.events) != 2 || sink.events[0].Traffic != TrafficScan || sink.events[1].Traffic != "" {
+		t.Fatalf("events %+v", sink.events)
+	}
+	if entries := hook.AllEntries(); len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	if got := mediaViews.views.Load() - views; got != 2 {
+		t.Fatalf("views = %d, want 2", got)
+	}
+	if got := mediaViews.scans.Load() - scans; got != 1 {
+		t.Fatalf("scan views = %d, want 1", got)
+	}
+	stats := GetMediaStats()
+	if withScan := GetMediaStats(TrafficScan); withScan.Views-stats.Views != stats.ScanViews {
+		t.Fatalf("views %d, including scans %d, scans %d", stats.Views, withScan.Views, stats.ScanViews)
+	}
+}
+
+func TestScanDetectorPlayback(t *testing.T) {
+	d := newScanDetector()
+	start := time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)
+	read := func(at time.Duration, path string, bytes int64) bool {
+		return d.detect(&AccessEvent{Event: EventAccess, Time: start.Add(at), ClientIP: "192.0.2.1", Username: "jellyfin",
+			Method: http.MethodGet, UserAgent: "Lavf/60.16.100", Path: path, BytesServed: &bytes})
+	}
+
+	// ffprobe 读取每个文件的开头和末尾的索引，是扫描
+	for i := 0; i < 3; i++ {
+		p := fmt.Sprintf("/tv/e%02d.mp4", i)
+		if !read(time.Duration(i)*time.Second, p, 256<<10) || !read(time.Duration(i)*time.Second, p, 64<<10) {
+			t.Fatalf("ffprobe reading %s was not tagged", p)
+		}
+	}
+
+	// 同一个媒体服务器用 ffmpeg 转封装播放：从头开始的长时间读取，拖动进度后从新的位置继续读取
+	for i, bytes := range []int64{300 << 20, 80 << 20, 2 << 30} {
+		if read(time.Minute+time.Duration(i)*time.Second, "/movies/a.mkv", bytes) {
+			t.Fatalf("remux stream read %d was tagged", i)
+		}
+	}
+
+	// 按顺序的 Range 请求：开头几次与 ffprobe 无法区分，持续读取后视为播放，之后的每个分块都不标记
+	for i := 0; i < 50; i++ {
+		got := read(2*time.Minute+time.Duration(i)*time.Second, "/movies/b.mkv", 512<<10)
+		if want := i < scanPlaybackReads-1; got != want {
+			t.Fatalf("range read %d: tagged = %v, want %v", i, got, want)
+		}
+	}
+	// 大块的 Range 请求从第一次就视为播放
+	for i := 0; i < 10; i++ {
+		if read(3*time.Minute+time.Duration(i)*time.Second, "/movies/c.mkv", 4<<20) {
+			t.Fatalf("range read %d was tagged", i)
+		}
+	}
+}
+
+func TestDropScanTraffic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	defer func(drop bool) { mediaLogConf().DropScanTraffic = drop }(mediaLogConf().DropScanTraffic)
+	mediaLogConf().DropScanTraffic = true
+	defer ResetMediaLogInternalStats()
+	ResetMediaLogInternalStats()
+
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	for _, ua := range []string{"Emby Server/4.8.8.0", "PlexMediaServer/1.40.4", "Mozilla/5.0"} {
+		req := httptest.NewRequest(http.MethodGet, "/d/tv/e01.mkv", nil)
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(sink.events) != 1 || sink.events[0].UserAgent != "Mozilla/5.0" || len(hook.AllEntries()) != 1 {
+		t.Fatalf("scan traffic was not dropped: %+v", sink.events)
+	}
+	if got := GetMediaLogInternalStats().Suppressed[TrafficScan]; got != 2 {
+		t.Fatalf("suppressed scan = %d, want 2", got)
+	}
+}
+
+func TestSessionBreadthMonitorIgnoresScan(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	var alerts []MediaAlert
+	logger, _ := logtest.NewNullLogger()
+	r := gin.New()
+	r.Use(sessionBreadthMonitor(newBreadthTracker(5, time.Minute), AlertSinkFunc(func(a MediaAlert) {
+		alerts = append(alerts, a)
+	}), time.Now), MediaLoggerWithOptions(WithLogger(logger)))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "header") })
+	serve := func(ip, ua string, i int) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/d/tv/e%02d.mkv", i), nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// 媒体服务器刷新媒体库不告警，普通客户端打开大量文件仍然告警
+	for i := 0; i < 30; i++ {
+		serve("192.0.2.1", "Jellyfin-Server/10.9.7", i)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("library scan raised alerts: %+v", alerts)
+	}
+	for i := 0; i < 30; i++ {
+		serve("192.0.2.2", "Mozilla/5.0", i)
+	}
+	if len(alerts) != 1 || alerts[0].ClientIP != "192.0.2.2" {
+		t.Fatalf("alerts = %+v, want one for 192.0.2.2", alerts)
+	}
+}
@@ -0,0 +1,112 @@
+package middlewares
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// scheduleWeekdays 按星期的英文缩写和全称查找，不区分大小写
+var scheduleWeekdays = func() map[string]time.Weekday {
+	m := make(map[string]time.Weekday, 14)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		m[name] = d
+		m[name[:3]] = d
+	}
+	return m
+}()
+
+// scheduleWindow 是编译后的记录时间段，start、end 为一天中的分钟数
+type scheduleWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+// contains 判断 weekday 当天 minute 分钟是否在时间段内，跨午夜的时间段在第二天的凌晨部分按前一天计算
+func (w scheduleWindow) contains(weekday time.Weekday, minute int) bool {
+	if w.start < w.end {
+		return w.days[weekday] && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.days[weekday]
+	}
+	return minute < w.end && w.days[(weekday+6)%7]
+}
+
+// mediaLogSchedule 决定普通访问事件是否记录，按配置时区的本地时间判断，夏令时切换时以墙上时间为准
+type mediaLogSchedule struct {
+	loc     *time.Location
+	windows []scheduleWindow
+	now     func() time.Time
+}
+
+func newMediaLogSchedule(cfg conf.MediaLogSchedule, now func() time.Time) (*mediaLogSchedule, error) {
+	if len(cfg.Windows) == 0 {
+		return nil, nil
+	}
+	s := &mediaLogSchedule{loc: time.Local, now: now}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+		s.loc = loc
+	}
+	for i, cw := range cfg.Windows {
+		var w scheduleWindow
+		var err error
+		if w.start, err = parseScheduleTime(cw.Start); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+		if w.end, err = parseScheduleTime(cw.End); err != nil {
+			return nil, fmt.Errorf("window %d: %w", i+1, err)
+		}
+		if len(cw.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, day := range cw.Days {
+			weekday, ok := scheduleWeekdays[strings.ToLower(strings.TrimSpace(day))]
+			if !ok {
+				return nil, fmt.Errorf("window %d: invalid day %q", i+1, day)
+			}
+			w.days[weekday] = true
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// parseScheduleTime 解析 HH:MM，24:00 表示当天结束
+func parseScheduleTime(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || h < 0 || m < 0 || m > 59 || h > 24 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// allow 判断事件是否需要记录，nil 表示没有配置时间段；告警等审计事件始终记录
+func (s *mediaLogSchedule) allow(ev *AccessEvent) bool {
+	if s == nil || !isPlainAccessEvent(ev.Event) {
+		return true
+	}
+	t := s.now().In(s.loc)
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.contains(t.Weekday(), minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaSchedule 由 InitMediaLog 根据 media_log.schedule 设置
+var mediaSchedule atomic.Pointer[mediaLogSchedule]
+
+func setMediaLogSchedule(s *mediaLogSchedule) {
+	mediaSchedule.Store(s)
+}
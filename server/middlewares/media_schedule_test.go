@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestMediaLogScheduleAroundMidnight(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	clock := &fakeClock{}
+	// 工作日晚上 22:00 到第二天早上 07:00，周末全天
+	s, err := newMediaLogSchedule(conf.MediaLogSchedule{
+		Windows: []conf.MediaLogWindow{
+			{Days: []string{"mon", "tue", "wed", "thu", "Friday"}, Start: "22:00", End: "07:00"},
+			{Days: []string{"sat", "sun"}, Start: "00:00", End: "24:00"},
+		},
+	}, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.loc = loc
+
+	access := &AccessEvent{Event: EventAccess}
+	cases := []struct {
+		at   string
+		want bool
+	}{
+		{"2025-07-14 21:59", false}, // 周一
+		{"2025-07-14 22:00", true},
+		{"2025-07-14 23:59", true},
+		{"2025-07-15 00:00", true}, // 周二凌晨，属于周一的时间段
+		{"2025-07-15 06:59", true},
+		{"2025-07-15 07:00", false},
+		{"2025-07-14 03:00", false}, // 周一凌晨，周日的时间段不跨午夜
+		{"2025-07-18 23:30", true},  // 周五晚上
+		{"2025-07-19 06:00", true},  // 周六凌晨，同时在周五和周六的时间段内
+		{"2025-07-19 12:00", true},
+		{"2025-07-21 00:30", false}, // 周一凌晨，周日的时间段在 24:00 结束
+	}
+	for _, tc := range cases {
+		at, err := time.ParseInLocation("2006-01-02 15:04", tc.at, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock.t = at
+		if got := s.allow(access); got != tc.want {
+			t.Errorf("%s (%s): allow = %v, want %v", tc.at, at.Weekday(), got, tc.want)
+		}
+	}
+
+	clock.t = time.Date(2025, 7, 14, 12, 0, 0, 0, loc)
+	if s.allow(access) {
+		t.Fatal("access during working hours should not be recorded")
+	}
+	for _, event := range []string{EventDenied, EventAnomaly} {
+		if !s.allow(&AccessEvent{Event: event}) {
+			t.Errorf("%s event should always be recorded", event)
+		}
+	}
+}
+
+func TestMediaLogScheduleDST(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("tzdata not available:", err)
+	}
+	clock := &fakeClock{}
+	s, err := newMediaLogSchedule(conf.MediaLogSchedule{
+		Timezone: "America/New_York",
+		Windows:  []conf.MediaLogWindow{{Start: "01:00", End: "03:30"}},
+	}, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access := &AccessEvent{Event: EventAccess}
+	cases := []struct {
+		utc  string
+		want bool
+	}{
+		// 2025-03-09 02:00 EST 跳到 03:00 EDT
+		{"2025-03-09T06:59:00Z", true},  // 01:59 EST
+		{"2025-03-09T07:00:00Z", true},  // 03:00 EDT
+		{"2025-03-09T07:29:00Z", true},  // 03:29 EDT
+		{"2025-03-09T07:30:00Z", false}, // 03:30 EDT
+		// 2025-11-02 02:00 EDT 回到 01:00 EST，01:00-02:00 出现两次
+		{"2025-11-02T05:30:00Z", true},  // 01:30 EDT
+		{"2025-11-02T06:30:00Z", true},  // 01:30 EST
+		{"2025-11-02T08:29:00Z", true},  // 03:29 EST
+		{"2025-11-02T08:30:00Z", false}, // 03:30 EST
+	}
+	for _, tc := range cases {
+		at, err := time.Parse(time.RFC3339, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock.t = at
+		if got := s.allow(access); got != tc.want {
+			t.Errorf("%s: allow = %v, want %v", tc.utc, got, tc.want)
+		}
+	}
+}
+
+func TestMediaLogScheduleConfig(t *testing.T) {
+	if s, err := newMediaLogSchedule(conf.MediaLogSchedule{}, time.Now); s != nil || err != nil {
+		t.Fatalf("empty schedule = %v, %v, want nil", s, err)
+	}
+	if !(*mediaLogSchedule)(nil).allow(&AccessEvent{Event: EventAccess}) {
+		t.Fatal("nil schedule should allow everything")
+	}
+	invalid := []conf.MediaLogSchedule{
+		{Timezone: "Mars/Olympus", Windows: []conf.MediaLogWindow{{Start: "00:00", End: "01:00"}}},
+		{Windows: []conf.MediaLogWindow{{Start: "25:00", End: "01:00"}}},
+		{Windows: []conf.MediaLogWindow{{Start: "00:00", End: "1am"}}},
+		{Windows: []conf.MediaLogWindow{{Days: []string{"someday"}, Start: "00:00", End: "01:00"}}},
+	}
+	for _, cfg := range invalid {
+		if _, err := newMediaLogSchedule(cfg, time.Now); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
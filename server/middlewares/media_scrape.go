@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// scrapeMinPlayback 是参与检测的最短估算播放时长，播放器预读的小范围请求本来就会很快完成，不做检测
+const scrapeMinPlayback = time.Minute
+
+// ScrapeDetectionMiddleware 检测传输速度远超正常播放的媒体文件下载，标记为疑似抓取
+// 按 media_log.scrape_bitrates_kbps 中扩展名对应的典型码率估算传输的字节数可以播放多久，
+// 实际传输耗时小于 估算播放时长 / multiplier 时设置 AccessEvent.PossibleScraper 并输出 Warn 日志
+// 例如 5Mbps 的 30 分钟视频约 1.1GB，multiplier 为 10 时 3 分钟内传完即会被标记
+// 需要放在媒体日志中间件之后，才能把标记写入访问事件
+func ScrapeDetectionMiddleware(multiplier float64) gin.HandlerFunc {
+	return scrapeDetection(multiplier, time.Now)
+}
+
+func scrapeDetection(multiplier float64, now func() time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if !isMediaFilePath(p) || isInternalRequest(c) {
+			c.Next()
+			return
+		}
+		kbps := mediaLogConf().ScrapeBitrates[strings.ToLower(filepath.Ext(p))]
+		if kbps <= 0 {
+			c.Next()
+			return
+		}
+		start := now()
+		c.Next()
+		status := c.Writer.Status()
+		size := c.Writer.Size()
+		if status != http.StatusOK && status != http.StatusPartialContent || size <= 0 {
+			return
+		}
+		playback := time.Duration(float64(size) * 8 / float64(kbps*1000) * float64(time.Second))
+		if playback < scrapeMinPlayback {
+			return
+		}
+		elapsed := now().Sub(start)
+		if float64(elapsed) >= float64(playback)/multiplier {
+			return
+		}
+		if ev := getAccessEvent(c); ev != nil {
+			ev.PossibleScraper = true
+		}
+		log.WithFields(log.Fields{
+			"path":      p,
+			"client_ip": c.ClientIP(),
+			"user":      getUserName(c),
+			"bytes":     size,
+			"elapsed":   elapsed.String(),
+			"playback":  playback.String(),
+		}).Warn("media scrape detection: transfer much faster than playback, possible scraper")
+	}
+}
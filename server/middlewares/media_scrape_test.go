@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestScrapeDetectionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	old := conf.Conf
+	conf.Conf = &conf.Config{MediaLog: conf.DefaultMediaLogConfig()}
+	// 8kbps 即每秒 1000 字节，120000 字节估算可以播放 2 分钟
+	conf.Conf.MediaLog.ScrapeBitrates = map[string]int{".mp4": 8}
+	defer func() { conf.Conf = old }()
+
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	var elapsed time.Duration
+	var got *AccessEvent
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		got = newAccessEvent(c)
+		c.Next()
+	}, scrapeDetection(10, clock.Now))
+	r.NoRoute(func(c *gin.Context) {
+		clock.Advance(elapsed)
+		size := 120000
+		if c.Request.URL.Path == "/d/small.mp4" {
+			size = 1000
+		}
+		c.Data(http.StatusOK, "video/mp4", bytes.Repeat([]byte{0}, size))
+	})
+
+	cases := []struct {
+		path    string
+		elapsed time.Duration
+		scraper bool
+	}{
+		{"/d/a.mp4", 5 * time.Second, true},
+		{"/d/a.mp4", 30 * time.Second, false},
+		// 估算播放时长太短
+		{"/d/small.mp4", 0, false},
+		// 没有配置码率的扩展名
+		{"/d/a.mkv", 0, false},
+		{"/d/a.jpg", 0, false},
+	}
+	for _, tc := range cases {
+		hook.Reset()
+		elapsed = tc.elapsed
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if got.PossibleScraper != tc.scraper {
+			t.Errorf("%s in %s: PossibleScraper = %v, want %v", tc.path, tc.elapsed, got.PossibleScraper, tc.scraper)
+		}
+		if warned := hook.LastEntry() != nil; warned != tc.scraper {
+			t.Errorf("%s in %s: warned = %v", tc.path, tc.elapsed, warned)
+		}
+	}
+}
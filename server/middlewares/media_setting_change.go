@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/OpenListTeam/OpenList/v4/internal/op"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	settingChangePathPrefix = "/api/admin/setting/"
+	// 只解析这个大小以内的请求体，超出时仍然记录事件但没有 Diff
+	settingChangeMaxBody = 1 << 20
+	// 私有设置（令牌、密钥等）的值不写入日志
+	settingRedactedValue = "***"
+	// 判断保存是否成功时最多捕获的响应体大小，common.Resp 的 code 在最前面
+	settingChangeMaxResp = 4 << 10
+)
+
+// SettingDiff 是一项设置修改前后的值，新增的设置 Old 为空，私有设置的值显示为 ***
+type SettingDiff struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// SettingChangeLogger 把 /api/admin/setting/ 下保存成功的 POST 请求记录为 config_change 事件写入 sink，
+// Diff 为请求体中的设置与请求前缓存的设置比较后值有变化的项；
+// 保存失败（HTTP 状态码不小于 400 或者响应的 code 不是 200）时不写入 sink，只以 Warn 级别输出，不包含 Diff；
+// 不是管理员的用户发出的请求无论是否成功都以 Error 级别输出
+func SettingChangeLogger(sink MediaLogSink) gin.HandlerFunc {
+	return settingChangeLogger(sink, op.GetSettingItems)
+}
+
+func settingChangeLogger(sink MediaLogSink, current func() ([]model.SettingItem, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if c.Request.Method != http.MethodPost || !strings.HasPrefix(p, settingChangePathPrefix) {
+			c.Next()
+			return
+		}
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(c.Request.Body, settingChangeMaxBody+1))
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+		}
+		// 处理函数保存设置后会清空缓存，需要在之前取快照
+		before, err := current()
+		if err != nil {
+			log.Errorf("failed to get current settings: %+v", err)
+		}
+		w := &responseBodyWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}, maxCaptureBytes: settingChangeMaxResp}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		ev := accessEventFor(c, p)
+		user, _ := c.Value("user").(*model.User)
+		admin := user != nil && user.IsAdmin()
+		if code, ok := responseCode(w.body.Bytes()); ev.Status >= http.StatusBadRequest || ok && code != http.StatusOK {
+			entry := log.WithFields(log.Fields{"path": p, "user": ev.Username, "status": ev.Status, "code": code})
+			if !admin {
+				entry.Error("settings change by a non-admin user was rejected")
+			} else {
+				entry.Warn("failed to change settings")
+			}
+			return
+		}
+
+		ev.Event = EventConfigChange
+		if len(body) <= settingChangeMaxBody {
+			ev.Diff = settingDiff(before, body)
+		}
+		entry := log.WithFields(log.Fields{"path": p, "user": ev.Username, "status": ev.Status, "diff": ev.Diff})
+		if !admin {
+			entry.Error("settings change requested by a non-admin user")
+		} else {
+			entry.Info("settings changed")
+		}
+		if err := sink.Write(ev); err != nil {
+			log.Errorf("failed to write setting change: %+v", err)
+		}
+	}
+}
+
+// responseCode 读取 common.Resp 响应体中的 code，响应体为空或者没有 code 时返回 false
+func responseCode(data []byte) (int, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !expectDelim(dec, '{') {
+		return 0, false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, false
+		}
+		if key == "code" {
+			var code int
+			if dec.Decode(&code) != nil {
+				return 0, false
+			}
+			return code, true
+		}
+		if dec.Decode(&json.RawMessage{}) != nil {
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// settingDiff 比较请求体中的设置（[{"key": ..., "value": ...}]）和当前的设置，请求体不是这个格式时返回 nil
+func settingDiff(before []model.SettingItem, body []byte) []SettingDiff {
+	var req []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil
+	}
+	current := make(map[string]model.SettingItem, len(before))
+	for _, item := range before {
+		current[item.Key] = item
+	}
+	diff := make([]SettingDiff, 0, len(req))
+	for _, r := range req {
+		item, ok := current[r.Key]
+		if ok && item.Value == r.Value {
+			continue
+		}
+		d := SettingDiff{Key: r.Key, Old: item.Value, New: r.Value}
+		if item.Flag == model.PRIVATE {
+			d.Old, d.New = settingRedactedValue, settingRedactedValue
+		}
+		diff = append(diff, d)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	return diff
+}
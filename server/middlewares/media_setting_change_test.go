@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSettingChangeLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	current := func() ([]model.SettingItem, error) {
+		return []model.SettingItem{
+			{Key: "site_title", Value: "OpenList"},
+			{Key: "max_upload_size", Value: "100"},
+			{Key: "token", Value: "old-token", Flag: model.PRIVATE},
+		}, nil
+	}
+	sink := &eventSink{}
+	var handlerBody string
+	serve := func(user *model.User, body string) {
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("user", user) }, settingChangeLogger(sink, current))
+		r.POST("/api/admin/setting/save", func(c *gin.Context) {
+			b, _ := io.ReadAll(c.Request.Body)
+			handlerBody = string(b)
+			c.Status(http.StatusOK)
+		})
+		r.GET("/api/admin/setting/list", func(c *gin.Context) { c.Status(http.StatusOK) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/setting/save", strings.NewReader(body)))
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/admin/setting/list", nil))
+	}
+
+	body := `[{"key":"site_title","value":"OpenList"},{"key":"max_upload_size","value":"200"},{"key":"token","value":"new-token"},{"key":"new_key","value":"x"}]`
+	serve(&model.User{Username: "admin", Role: model.ADMIN}, body)
+	if handlerBody != body {
+		t.Fatalf("handler got body %q", handlerBody)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(sink.events))
+	}
+	ev := sink.events[0]
+	want := []SettingDiff{
+		{Key: "max_upload_size", Old: "100", New: "200"},
+		{Key: "new_key", Old: "", New: "x"},
+		{Key: "token", Old: settingRedactedValue, New: settingRedactedValue},
+	}
+	if ev.Event != EventConfigChange || ev.Username != "admin" || ev.Path != "/api/admin/setting/save" || len(ev.Diff) != len(want) {
+		t.Fatalf("event = %+v", ev)
+	}
+	for i := range want {
+		if ev.Diff[i] != want[i] {
+			t.Fatalf("diff = %+v, want %+v", ev.Diff, want)
+		}
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != log.InfoLevel {
+		t.Fatalf("admin change logged as %+v", entry)
+	}
+	if line := formatMediaLog(ev); !strings.Contains(line, "操作：修改设置 设置：max_upload_size,new_key,token") ||
+		strings.Contains(line, "new-token") {
+		t.Fatalf("text log = %q", line)
+	}
+
+	serve(&model.User{Username: "guest", Role: model.GUEST}, `[{"key":"site_title","value":"pwned"}]`)
+	if len(sink.events) != 2 || sink.events[1].Diff[0].New != "pwned" {
+		t.Fatalf("events = %+v", sink.events)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != log.ErrorLevel {
+		t.Fatalf("non-admin change logged as %+v", entry)
+	}
+
+	// 不是设置列表的请求体没有 Diff
+	serve(&model.User{Username: "admin", Role: model.ADMIN}, `{"uri":"http://localhost:6800/jsonrpc"}`)
+	if len(sink.events) != 3 || sink.events[2].Diff != nil {
+		t.Fatalf("events = %+v", sink.events)
+	}
+}
+
+func TestSettingChangeLoggerFailedSave(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	current := func() ([]model.SettingItem, error) {
+		return []model.SettingItem{{Key: "site_title", Value: "OpenList"}}, nil
+	}
+	cases := []struct {
+		name   string
+		user   *model.User
+		status int
+		resp   string
+		logged bool
+		level  log.Level
+	}{
+		{"saved", &model.User{Username: "admin", Role: model.ADMIN}, http.StatusOK, `{"code":200,"message":"success","data":null}`, true, log.InfoLevel},
+		{"invalid value", &model.User{Username: "admin", Role: model.ADMIN}, http.StatusOK, `{"code":500,"message":"invalid value","data":null}`, false, log.WarnLevel},
+		{"http error", &model.User{Username: "admin", Role: model.ADMIN}, http.StatusBadRequest, `bad request`, false, log.WarnLevel},
+		{"not admin", &model.User{Username: "guest", Role: model.GUEST}, http.StatusOK, `{"code":403,"message":"You are not an admin","data":null}`, false, log.ErrorLevel},
+	}
+	for _, tc := range cases {
+		hook.Reset()
+		sink := &eventSink{}
+		r := gin.New()
+		r.Use(func(c *gin.Context) { c.Set("user", tc.user) }, settingChangeLogger(sink, current))
+		r.POST("/api/admin/setting/save", func(c *gin.Context) {
+			c.Data(tc.status, "application/json; charset=utf-8", []byte(tc.resp))
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/setting/save",
+			strings.NewReader(`[{"key":"site_title","value":"changed"}]`)))
+		if w.Body.String() != tc.resp {
+			t.Fatalf("%s: response = %q", tc.name, w.Body.String())
+		}
+		if got := len(sink.events) == 1; got != tc.logged {
+			t.Fatalf("%s: got %d events", tc.name, len(sink.events))
+		}
+		entry := hook.LastEntry()
+		if entry == nil || entry.Level != tc.level {
+			t.Fatalf("%s: logged as %+v", tc.name, entry)
+		}
+		// 失败的保存不输出 Diff
+		if _, ok := entry.Data["diff"]; ok != tc.logged {
+			t.Fatalf("%s: log fields %v", tc.name, entry.Data)
+		}
+	}
+}
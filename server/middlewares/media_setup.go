@@ -0,0 +1,225 @@
+package middlewares
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultSinkQueueSize = 1024
+
+// 离线下载等后台任务通过 MediaLogHook 报告事件，重新初始化时不重复注册
+var mediaLogHookOnce sync.Once
+
+// 由 PerIPRateLimiter 等函数创建的中间件的后台任务，服务器退出时统一停止
+var (
+	shutdownMu      sync.Mutex
+	shutdownClosers []io.Closer
+)
+
+func closeOnShutdown(c io.Closer) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownClosers = append(shutdownClosers, c)
+}
+
+// CloseMediaMiddlewares 停止 PerIPRateLimiter、MediaAuthBruteForceMiddleware、MediaRobotsMiddleware 创建的后台任务，在服务器退出时调用
+func CloseMediaMiddlewares() {
+	shutdownMu.Lock()
+	closers := shutdownClosers
+	shutdownClosers = nil
+	shutdownMu.Unlock()
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
+
+// InitMediaLog 根据配置初始化媒体日志的输出文件和 sink
+// 返回的函数用于在退出时关闭文件并等待异步队列写完
+func InitMediaLog(cfg conf.MediaLogConfig) (func(), error) {
+	// 表达式在打开文件和启动 sink 之前编译，配置有误时直接返回
+	filterExpr, err := compileMediaExpr(cfg.FilterExpr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media_log.filter_expr: %w", err)
+	}
+	notifyExpr, err := compileMediaExpr(cfg.NotifyExpr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media_log.notify_expr: %w", err)
+	}
+	schedule, err := newMediaLogSchedule(cfg.Schedule, time.Now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media_log.schedule: %w", err)
+	}
+	trafficRules, err := compileTrafficRules(cfg.TrafficClients)
+	if err != nil {
+		return nil, fmt.Errorf("invalid media_log.traffic_clients: %w", err)
+	}
+
+	var closers []func()
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
+	if cfg.File.Enable {
+		fileLogger := NewMediaFileLogger(cfg.File)
+		if err := fileLogger.SetFormat(cfg.FileFormat); err != nil {
+			_ = fileLogger.Close()
+			return nil, fmt.Errorf("invalid media_log.file_format: %w", err)
+		}
+		if cfg.FilePassphrase != "" {
+			if err := fileLogger.EncryptWith(cfg.FilePassphrase); err != nil {
+				_ = fileLogger.Close()
+				return nil, fmt.Errorf("failed to init media log encryption: %w", err)
+			}
+		}
+		if cfg.AuditChain {
+			if err := fileLogger.EnableAuditChain(); err != nil {
+				_ = fileLogger.Close()
+				return nil, fmt.Errorf("failed to init media log audit chain: %w", err)
+			}
+		}
+		if cfg.MinFreeSpace > 0 {
+			fileLogger.GuardDiskSpace(uint64(cfg.MinFreeSpace)<<20, time.Duration(cfg.DiskCheckInterval)*time.Second)
+		}
+		SetMediaFileLogger(fileLogger)
+		stopRotate := RotateOnSignal(fileLogger)
+		closers = append(closers, func() {
+			stopRotate()
+			SetMediaFileLogger(nil)
+			_ = fileLogger.Close()
+		})
+	}
+
+	setMediaLogExpr(filterExpr)
+	setMediaLogSchedule(schedule)
+	setMediaTrafficRules(trafficRules)
+	recentEvents.resize(cfg.RecentSize)
+	mediaLogHookOnce.Do(func() { log.AddHook(&MediaLogHook{}) })
+	closers = append(closers, func() {
+		setMediaLogExpr(nil)
+		setMediaLogSchedule(nil)
+	})
+	mediaTrending.configure(time.Duration(cfg.Trending.HalfLife)*time.Hour, cfg.Trending.MaxFiles)
+	if cfg.Store.Enable && cfg.Trending.PersistInterval > 0 {
+		stopTrending := startTrendingPersistence(mediaTrending, time.Duration(cfg.Trending.PersistInterval)*time.Minute)
+		closers = append(closers, stopTrending)
+	}
+	if cfg.VerifyBots {
+		verifier := newBotVerifier()
+		stopVerifier := verifier.start()
+		mediaBotVerifier.Store(verifier)
+		closers = append(closers, func() {
+			mediaBotVerifier.Store(nil)
+			stopVerifier()
+		})
+	}
+
+	// 预写日志最后关闭，这样关闭 sink 时队列中写完的事件仍然可以确认
+	var spool *mediaSpool
+	if cfg.Spool.Enable {
+		spool, err = openMediaSpool(cfg.Spool, time.Now)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("failed to open media log spool: %w", err)
+		}
+		closers = append(closers, func() {
+			setMediaSpool(nil)
+			_ = spool.Close()
+		})
+	}
+
+	var (
+		sinks []MediaLogSink
+		named []namedSink
+	)
+	closers = append(closers, func() {
+		SetMediaLogSinks()
+		setMediaWebhooks(nil)
+		pipelineMetrics.setSinks(nil)
+		for _, sink := range sinks {
+			if closer, ok := sink.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+	})
+
+	var webhooks []*webhookEndpoint
+	for i, webhook := range cfg.Webhooks {
+		endpoint, err := newWebhookEndpoint(webhook)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		name := sinkName("webhook", webhook.Name, webhook.URL, i)
+		webhooks = append(webhooks, endpoint)
+		named = append(named, namedSink{name: name, sink: endpoint.async})
+		sinks = append(sinks, &filteredSink{name: name, filter: newMediaEventFilter(webhook.Filter), inner: endpoint})
+	}
+	setMediaWebhooks(webhooks)
+
+	if cfg.Store.Enable {
+		store := newBatchingAsyncSink(mediaStoreSink{}, defaultSinkQueueSize, mediaStoreFlushInterval)
+		named = append(named, namedSink{name: "store", sink: store})
+		sinks = append(sinks, store)
+	}
+
+	for i, notifier := range cfg.Notifiers {
+		sink, err := newNotifierSink(notifier)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		name := sinkName(notifier.Type, notifier.Name, notifier.URL, i)
+		named = append(named, namedSink{name: name, sink: sink})
+		sinks = append(sinks, &filteredSink{name: name, filter: newMediaEventFilter(notifier.Filter), inner: sink, expr: notifyExpr})
+	}
+	// 外部命令只在配置了 execs 时启用
+	for _, cfgExec := range cfg.Execs {
+		sink, err := newExecSink(cfgExec)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		name := "exec:" + sink.name
+		named = append(named, namedSink{name: name, sink: sink})
+		sinks = append(sinks, &filteredSink{name: name, filter: newMediaEventFilter(cfgExec.Filter), inner: sink})
+	}
+	pipelineMetrics.setSinks(named)
+	SetMediaLogSinks(sinks...)
+	if spool != nil {
+		if n := replayMediaSpool(spool); n > 0 {
+			log.Infof("media log spool: replayed %d pending events", n)
+		}
+		setMediaSpool(spool)
+	}
+	return closeAll, nil
+}
+
+// sinkName 返回 sink 在统计和日志中显示的名称，例如 webhook:alerts，
+// 未配置名称时只使用 URL 的 scheme 和主机名（Discord、Slack 等的 URL 路径中带有密钥），
+// URL 也无法使用时按在配置中的位置命名，例如 webhook[0]
+func sinkName(kind, name, rawURL string, index int) string {
+	if name != "" {
+		return kind + ":" + name
+	}
+	if origin := urlOrigin(rawURL); origin != "" {
+		return kind + ":" + origin
+	}
+	return fmt.Sprintf("%s[%d]", kind, index)
+}
+
+// urlOrigin 返回 URL 的 scheme://host 部分，用于在日志中代替可能带有密钥的完整 URL，无法解析时返回空
+func urlOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
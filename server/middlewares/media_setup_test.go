@@ -0,0 +1,23 @@
+package middlewares
+
+import "testing"
+
+func TestSinkName(t *testing.T) {
+	cases := []struct {
+		kind, name, url string
+		index           int
+		want            string
+	}{
+		{"webhook", "alerts", "https://discord.com/api/webhooks/1/token", 0, "webhook:alerts"},
+		// URL 路径中的密钥不出现在名称中
+		{"webhook", "", "https://discord.com/api/webhooks/1/token", 0, "webhook:https://discord.com"},
+		{"slack", "", "https://hooks.slack.com/services/T0/B0/secret", 2, "slack:https://hooks.slack.com"},
+		{"bark", "", "", 1, "bark[1]"},
+		{"webhook", "", "not a url", 3, "webhook[3]"},
+	}
+	for _, tc := range cases {
+		if got := sinkName(tc.kind, tc.name, tc.url, tc.index); got != tc.want {
+			t.Errorf("sinkName(%q, %q, %q, %d) = %q, want %q", tc.kind, tc.name, tc.url, tc.index, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package middlewares
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MediaLogSink 接收媒体访问事件，例如 webhook、文件等
+// 事件在多个 sink 之间共享，实现时不能修改事件内容
+type MediaLogSink interface {
+	Write(ev *AccessEvent) error
+}
+
+// DiscardSink 丢弃所有事件，用于基准测试或临时停用某个 sink
+type DiscardSink struct{}
+
+func (DiscardSink) Write(*AccessEvent) error { return nil }
+
+var (
+	mediaSinksMu sync.RWMutex
+	mediaSinks   []MediaLogSink
+)
+
+// SetMediaLogSinks 替换当前所有的 sink
+func SetMediaLogSinks(sinks ...MediaLogSink) {
+	mediaSinksMu.Lock()
+	defer mediaSinksMu.Unlock()
+	mediaSinks = sinks
+}
+
+func emitToSinks(ev *AccessEvent) {
+	var ticket *spoolTicket
+	if spool := activeMediaSpool.Load(); spool != nil {
+		ticket = &spoolTicket{spool: spool}
+	}
+	emitTracked(ev, ticket)
+}
+
+// emitTracked 把事件交给所有 sink，ticket 不为空时先写入预写日志（重新投递时已经写过），
+// 由 sink 在写入后确认
+func emitTracked(ev *AccessEvent, ticket *spoolTicket) {
+	mediaSinksMu.RLock()
+	defer mediaSinksMu.RUnlock()
+	if ticket != nil {
+		if len(mediaSinks) == 0 {
+			ticket.spool.complete(ticket.seq)
+			ticket = nil
+		} else if ticket.seq == 0 {
+			seq, err := ticket.spool.append(ev)
+			if err != nil {
+				log.Debugf("media log spool write error: %+v", err)
+			}
+			ticket.seq = seq
+			if seq == 0 {
+				ticket = nil
+			}
+		}
+	}
+	if ticket != nil {
+		// 事件可能已经被其他地方引用，复制一份再带上 ticket
+		tracked := *ev
+		tracked.spool = ticket
+		ev = &tracked
+		ticket.pending.Store(int32(len(mediaSinks)))
+	}
+	for _, sink := range mediaSinks {
+		if err := sink.Write(ev); err != nil {
+			log.Debugf("media log sink write error: %+v", err)
+		}
+		if !acksDeferred(sink) {
+			ticket.ack()
+		}
+	}
+}
+
+const (
+	circuitFailureThreshold = 5
+	circuitCooldown         = 30 * time.Second
+)
+
+// asyncSink 使用有界队列异步写入下层 sink，避免慢速的网络请求阻塞请求处理
+// 队列满时直接丢弃事件并计数；连续失败达到阈值后熔断一段时间，期间的事件直接丢弃，
+// 这样某个端点宕机时不会一直占满队列，也不会影响其他 sink
+type asyncSink struct {
+	inner     MediaLogSink
+	queue     chan *AccessEvent
+	delivered atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	// 连续失败次数和熔断结束时间（UnixNano）
+	consecutiveFailures atomic.Int64
+	openUntil           atomic.Int64
+	done                chan struct{}
+}
+
+func newAsyncSink(inner MediaLogSink, queueSize int) *asyncSink {
+	s := &asyncSink{
+		inner: inner,
+		queue: make(chan *AccessEvent, queueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// mediaBatchSink 一次接收一批事件，适合有频率限制的聊天机器人等通知渠道
+type mediaBatchSink interface {
+	MediaLogSink
+	WriteBatch(evs []*AccessEvent) error
+}
+
+// newBatchingAsyncSink 和 newAsyncSink 相同，但会把 window 时间内到达的事件合并成一批写入
+func newBatchingAsyncSink(inner mediaBatchSink, queueSize int, window time.Duration) *asyncSink {
+	s := &asyncSink{
+		inner: inner,
+		queue: make(chan *AccessEvent, queueSize),
+		done:  make(chan struct{}),
+	}
+	go s.runBatch(inner, window)
+	return s
+}
+
+func (s *asyncSink) run() {
+	defer close(s.done)
+	for ev := range s.queue {
+		s.deliver(1, func() error { return s.inner.Write(ev) })
+		ev.spool.ack()
+	}
+}
+
+func (s *asyncSink) runBatch(inner mediaBatchSink, window time.Duration) {
+	defer close(s.done)
+	for ev := range s.queue {
+		batch := []*AccessEvent{ev}
+		timer := time.NewTimer(window)
+	collect:
+		for {
+			select {
+			case ev, ok := <-s.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, ev)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		s.deliver(int64(len(batch)), func() error { return inner.WriteBatch(batch) })
+		for _, ev := range batch {
+			ev.spool.ack()
+		}
+	}
+}
+
+// deliver 调用 write 写入 n 个事件并更新计数和熔断状态
+func (s *asyncSink) deliver(n int64, write func() error) {
+	if s.circuitOpen() {
+		s.dropped.Add(n)
+		return
+	}
+	if err := write(); err != nil {
+		s.failed.Add(n)
+		if s.consecutiveFailures.Add(1) >= circuitFailureThreshold {
+			s.openUntil.Store(time.Now().Add(circuitCooldown).UnixNano())
+			s.consecutiveFailures.Store(0)
+		}
+		log.Debugf("async media log sink write error: %+v", err)
+		return
+	}
+	s.delivered.Add(n)
+	s.consecutiveFailures.Store(0)
+}
+
+func (s *asyncSink) circuitOpen() bool {
+	return time.Now().UnixNano() < s.openUntil.Load()
+}
+
+func (s *asyncSink) Write(ev *AccessEvent) error {
+	if s.circuitOpen() {
+		s.dropped.Add(1)
+		ev.spool.ack()
+		return nil
+	}
+	select {
+	case s.queue <- ev:
+	default:
+		s.dropped.Add(1)
+		ev.spool.ack()
+	}
+	return nil
+}
+
+// 事件在队列中写入下层 sink 之后才确认
+func (s *asyncSink) acksDeferred() bool { return true }
+
+// Close 等待队列中剩余的事件写完
+func (s *asyncSink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
+
+// MediaSinkStats 是单个 sink 的投递统计
+type MediaSinkStats struct {
+	Delivered   int64 `json:"delivered"`
+	Failed      int64 `json:"failed"`
+	Dropped     int64 `json:"dropped"`
+	Queued      int   `json:"queued"`
+	CircuitOpen bool  `json:"circuit_open"`
+	// Timeouts 只用于外部命令，是超时被终止的次数
+	Timeouts int64 `json:"timeouts,omitempty"`
+}
+
+func (s *asyncSink) stats() MediaSinkStats {
+	return MediaSinkStats{
+		Delivered:   s.delivered.Load(),
+		Failed:      s.failed.Load(),
+		Dropped:     s.dropped.Load(),
+		Queued:      len(s.queue),
+		CircuitOpen: s.circuitOpen(),
+	}
+}
+
+func (s *asyncSink) resetCounters() {
+	s.delivered.Store(0)
+	s.failed.Store(0)
+	s.dropped.Store(0)
+}
@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSlackWindow = 10 * time.Second
+	// Slack 单条消息最多 50 个 block，每个事件占用 2 个
+	slackMaxEventsPerMessage = 25
+)
+
+const defaultSlackTemplate = `*{{.Path}}*{{if gt .Count 1}} ×{{.Count}}{{end}}`
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// slackSink 通过 Slack incoming webhook 以 Block Kit 消息发送事件
+// 每种事件类型可以配置不同的模板，模板的数据为合并后的事件，可以使用 .Count 获取次数
+type slackSink struct {
+	url       string
+	channel   string
+	templates map[string]*template.Template
+	fallback  *template.Template
+	client    *http.Client
+}
+
+func newSlackSink(cfg conf.MediaLogNotifier) (*slackSink, error) {
+	s := &slackSink{
+		url:       cfg.URL,
+		channel:   cfg.Channel,
+		templates: make(map[string]*template.Template, len(cfg.Templates)),
+		fallback:  template.Must(template.New("slack").Parse(defaultSlackTemplate)),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	for event, text := range cfg.Templates {
+		tmpl, err := template.New(event).Funcs(webhookTemplateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slack template for event %s: %w", event, err)
+		}
+		s.templates[event] = tmpl
+	}
+	return s, nil
+}
+
+func (s *slackSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *slackSink) WriteBatch(evs []*AccessEvent) error {
+	events := coalesceEvents(evs)
+	for len(events) > 0 {
+		n := min(len(events), slackMaxEventsPerMessage)
+		payload := map[string]any{
+			"text":   fmt.Sprintf("%d media event(s)", n),
+			"blocks": s.blocks(events[:n]),
+		}
+		if s.channel != "" {
+			payload["channel"] = s.channel
+		}
+		if err := postNotification(s.client, s.url, payload); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+func (s *slackSink) blocks(events []*coalescedEvent) []slackBlock {
+	blocks := make([]slackBlock, 0, len(events)*2)
+	for _, ce := range events {
+		blocks = append(blocks,
+			slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: s.render(ce)}},
+			slackBlock{Type: "context", Elements: []slackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("%s · %s · %s", orDash(ce.Username), orDash(ce.ClientIP), ce.Time.Format(time.RFC3339))},
+			}},
+		)
+	}
+	return blocks
+}
+
+// render 使用事件类型对应的模板生成消息正文，渲染失败时退回默认模板
+func (s *slackSink) render(ce *coalescedEvent) string {
+	var buf bytes.Buffer
+	if tmpl, ok := s.templates[ce.Event]; ok {
+		err := tmpl.Execute(&buf, ce)
+		if err == nil {
+			return buf.String()
+		}
+		log.Debugf("failed to render slack template for event %s: %+v", ce.Event, err)
+		buf.Reset()
+	}
+	_ = s.fallback.Execute(&buf, ce)
+	return buf.String()
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestSlackSinkBlocks(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+
+	sink, err := newSlackSink(conf.MediaLogNotifier{
+		Type:      "slack",
+		URL:       srv.URL,
+		Channel:   "#media",
+		Templates: map[string]string{EventAccess: "{{.Username}} played {{.Path}} {{.Count}}x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.WriteBatch([]*AccessEvent{testAccessEvent(), testAccessEvent()}); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Channel string       `json:"channel"`
+		Blocks  []slackBlock `json:"blocks"`
+	}
+	if err = json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Channel != "#media" {
+		t.Fatalf("channel = %q", got.Channel)
+	}
+	if len(got.Blocks) != 2 || got.Blocks[0].Text.Text != "alice played /movies/Interstellar.mkv 2x" {
+		t.Fatalf("unexpected blocks: %+v", got.Blocks)
+	}
+
+	if _, err = newSlackSink(conf.MediaLogNotifier{Templates: map[string]string{EventAccess: "{{.Path"}}); err == nil {
+		t.Fatal("expected template parse error")
+	}
+}
@@ -0,0 +1,361 @@
+package middlewares
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+// 预写日志的刷盘方式
+const (
+	spoolFsyncAlways   = "always"
+	spoolFsyncInterval = "interval"
+	spoolFsyncNever    = "never"
+)
+
+const spoolFsyncPeriod = time.Second
+
+// spoolRecord 是预写日志中的一行：事件行带 Event，完成行只有 Done
+type spoolRecord struct {
+	Seq   uint64       `json:"seq,omitempty"`
+	At    int64        `json:"at,omitempty"`
+	Event *AccessEvent `json:"event,omitempty"`
+	Done  uint64       `json:"done,omitempty"`
+}
+
+// spoolEntry 是尚未被所有 sink 确认的事件，line 为写入文件时的原始内容，压缩时原样写回
+type spoolEntry struct {
+	at   time.Time
+	line []byte
+	ev   *AccessEvent
+}
+
+// mediaSpool 在事件交给 sink 之前把它追加到预写日志，所有 sink 确认后追加一行完成标记
+// 启动时读取预写日志，跳过已完成和过期的事件，剩余事件重新交给 sink
+type mediaSpool struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	size    int64
+	maxSize int64
+	maxAge  time.Duration
+	fsync   string
+	dirty   bool
+	nextSeq uint64
+	pending map[uint64]*spoolEntry
+	now     func() time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// openMediaSpool 打开预写日志并压缩，返回的 spool 中 pending 即为需要重新投递的事件
+func openMediaSpool(cfg conf.MediaLogSpool, now func() time.Time) (*mediaSpool, error) {
+	switch cfg.Fsync {
+	case "":
+		cfg.Fsync = spoolFsyncInterval
+	case spoolFsyncAlways, spoolFsyncInterval, spoolFsyncNever:
+	default:
+		return nil, fmt.Errorf("unknown fsync mode %q", cfg.Fsync)
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+	s := &mediaSpool{
+		path:    cfg.Path,
+		maxSize: int64(cfg.MaxSize) << 20,
+		maxAge:  time.Duration(cfg.MaxAge) * time.Hour,
+		fsync:   cfg.Fsync,
+		pending: make(map[uint64]*spoolEntry),
+		now:     now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	err := s.compactLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if s.fsync == spoolFsyncInterval {
+		go s.syncLoop()
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+// load 读取已有的预写日志，无法解析的行（例如崩溃时写了一半的最后一行）直接跳过
+func (s *mediaSpool) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	skipped := 0
+	for scanner.Scan() {
+		var rec spoolRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			skipped++
+			continue
+		}
+		if rec.Done > 0 {
+			delete(s.pending, rec.Done)
+			continue
+		}
+		if rec.Seq == 0 || rec.Event == nil {
+			skipped++
+			continue
+		}
+		s.pending[rec.Seq] = &spoolEntry{
+			at:   time.Unix(0, rec.At),
+			line: append([]byte(nil), scanner.Bytes()...),
+			ev:   rec.Event,
+		}
+		if rec.Seq >= s.nextSeq {
+			s.nextSeq = rec.Seq
+		}
+	}
+	if skipped > 0 {
+		log.Warnf("media log spool: skipped %d unreadable lines in %s", skipped, s.path)
+	}
+	return scanner.Err()
+}
+
+// append 把事件写入预写日志并返回序号，文件已关闭时返回 0
+func (s *mediaSpool) append(ev *AccessEvent) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return 0, nil
+	}
+	s.nextSeq++
+	seq := s.nextSeq
+	at := s.now()
+	line, err := json.Marshal(spoolRecord{Seq: seq, At: at.UnixNano(), Event: ev})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.writeLocked(line); err != nil {
+		return 0, err
+	}
+	s.pending[seq] = &spoolEntry{at: at, line: line, ev: ev}
+	if s.maxSize > 0 && s.size > s.maxSize {
+		if err := s.compactLocked(); err != nil {
+			log.Warnf("media log spool: failed to compact: %+v", err)
+		}
+	}
+	return seq, nil
+}
+
+// complete 在所有 sink 确认后写入完成标记
+func (s *mediaSpool) complete(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[seq]; !ok {
+		return
+	}
+	delete(s.pending, seq)
+	if s.file == nil {
+		return
+	}
+	line, _ := json.Marshal(spoolRecord{Done: seq})
+	if err := s.writeLocked(line); err != nil {
+		log.Debugf("media log spool: failed to mark %d done: %+v", seq, err)
+	}
+}
+
+func (s *mediaSpool) writeLocked(line []byte) error {
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	switch s.fsync {
+	case spoolFsyncAlways:
+		return s.file.Sync()
+	case spoolFsyncInterval:
+		s.dirty = true
+	}
+	return nil
+}
+
+// compactLocked 丢弃过期事件后，把仍未完成的事件按序号写入新文件并替换原文件
+// 压缩后仍超过大小上限时从最早的事件开始丢弃
+func (s *mediaSpool) compactLocked() error {
+	seqs := make([]uint64, 0, len(s.pending))
+	expired := 0
+	for seq, entry := range s.pending {
+		if s.maxAge > 0 && s.now().Sub(entry.at) > s.maxAge {
+			delete(s.pending, seq)
+			expired++
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	var total int64
+	for _, seq := range seqs {
+		total += int64(len(s.pending[seq].line)) + 1
+	}
+	overflow := 0
+	for s.maxSize > 0 && total > s.maxSize && len(seqs) > 0 {
+		total -= int64(len(s.pending[seqs[0]].line)) + 1
+		delete(s.pending, seqs[0])
+		seqs = seqs[1:]
+		overflow++
+	}
+	if expired > 0 || overflow > 0 {
+		log.Warnf("media log spool: dropped %d expired and %d overflowing events", expired, overflow)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, seq := range seqs {
+		_, _ = w.Write(s.pending[seq].line)
+		_ = w.WriteByte('\n')
+	}
+	err = w.Flush()
+	if err == nil && s.fsync != spoolFsyncNever {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = file
+	s.size = total
+	s.dirty = false
+	return nil
+}
+
+func (s *mediaSpool) syncLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(spoolFsyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.file != nil {
+				_ = s.file.Sync()
+				s.dirty = false
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// takePending 返回启动时读到的未完成事件，按序号排列
+func (s *mediaSpool) takePending() []*spoolTicket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tickets := make([]*spoolTicket, 0, len(s.pending))
+	for seq, entry := range s.pending {
+		tickets = append(tickets, &spoolTicket{spool: s, seq: seq, ev: entry.ev})
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].seq < tickets[j].seq })
+	return tickets
+}
+
+// Close 停止定时刷盘并关闭文件，之后到达的确认会被忽略，未完成的事件在下次启动时重新投递
+func (s *mediaSpool) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
+
+// spoolTicket 跟踪一个事件还有多少个 sink 没有确认，全部确认后写入完成标记
+type spoolTicket struct {
+	spool   *mediaSpool
+	seq     uint64
+	ev      *AccessEvent
+	pending atomic.Int32
+}
+
+// ack 由 sink 在事件写入、丢弃或被过滤后调用，nil 时什么都不做
+func (t *spoolTicket) ack() {
+	if t == nil {
+		return
+	}
+	if t.pending.Add(-1) == 0 {
+		t.spool.complete(t.seq)
+	}
+}
+
+// deferredAcker 由把事件放入队列稍后写入的 sink 实现，这些 sink 在真正写入后自己调用 ack
+type deferredAcker interface {
+	acksDeferred() bool
+}
+
+func acksDeferred(sink MediaLogSink) bool {
+	d, ok := sink.(deferredAcker)
+	return ok && d.acksDeferred()
+}
+
+var activeMediaSpool atomic.Pointer[mediaSpool]
+
+func setMediaSpool(s *mediaSpool) {
+	activeMediaSpool.Store(s)
+}
+
+// replayMediaSpool 把上次退出前没有完成的事件重新交给当前的 sink
+func replayMediaSpool(s *mediaSpool) int {
+	tickets := s.takePending()
+	for _, ticket := range tickets {
+		emitTracked(ticket.ev, ticket)
+	}
+	return len(tickets)
+}
@@ -0,0 +1,162 @@
+package middlewares
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// blockingSink 在 gate 关闭之前不返回，用来模拟还在队列中没有写完的事件
+type blockingSink struct {
+	gate chan struct{}
+}
+
+func (s blockingSink) Write(*AccessEvent) error {
+	<-s.gate
+	return nil
+}
+
+func pendingPaths(s *mediaSpool) []string {
+	var paths []string
+	for _, ticket := range s.takePending() {
+		paths = append(paths, ticket.ev.Path)
+	}
+	return paths
+}
+
+func TestMediaSpoolReplay(t *testing.T) {
+	cfg := conf.MediaLogSpool{Path: filepath.Join(t.TempDir(), "spool.ndjson"), MaxSize: 1, Fsync: spoolFsyncAlways}
+	spool, err := openMediaSpool(cfg, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMediaSpool(spool)
+	defer setMediaSpool(nil)
+
+	done := &recordingSink{}
+	gate := make(chan struct{})
+	stuck := newAsyncSink(blockingSink{gate: gate}, 4)
+	defer func() {
+		close(gate)
+		_ = stuck.Close()
+	}()
+	SetMediaLogSinks(done, &filteredSink{
+		name:   "webhook:bob",
+		filter: newMediaEventFilter(conf.MediaLogFilter{Users: []string{"bob"}}),
+		inner:  stuck,
+	})
+	defer SetMediaLogSinks()
+
+	// alice 的事件被 webhook 过滤掉，所有 sink 都已确认；bob 的事件还在队列中
+	emitToSinks(&AccessEvent{Path: "/alice.mp4", Username: "alice"})
+	emitToSinks(&AccessEvent{Path: "/bob.mp4", Username: "bob"})
+	// 模拟崩溃：不等队列写完直接关闭
+	setMediaSpool(nil)
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	spool, err = openMediaSpool(cfg, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := &recordingSink{}
+	SetMediaLogSinks(replayed)
+	if n := replayMediaSpool(spool); n != 1 {
+		t.Fatalf("replayed %d events, want 1", n)
+	}
+	if want := []string{"/bob.mp4"}; !reflect.DeepEqual(replayed.paths, want) {
+		t.Fatalf("replayed %v, want %v", replayed.paths, want)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新投递并确认后不再重复投递
+	spool, err = openMediaSpool(cfg, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	if got := pendingPaths(spool); len(got) != 0 {
+		t.Fatalf("pending after replay = %v", got)
+	}
+}
+
+func TestMediaSpoolMaxAge(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	cfg := conf.MediaLogSpool{Path: filepath.Join(t.TempDir(), "spool.ndjson"), MaxAge: 24, Fsync: spoolFsyncNever}
+	spool, err := openMediaSpool(cfg, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spool.append(&AccessEvent{Path: "/old.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(23 * time.Hour)
+	if _, err := spool.append(&AccessEvent{Path: "/new.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = spool.Close()
+
+	clock.Advance(2 * time.Hour)
+	spool, err = openMediaSpool(cfg, clock.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	if got, want := pendingPaths(spool), []string{"/new.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending = %v, want %v", got, want)
+	}
+}
+
+func TestMediaSpoolCompaction(t *testing.T) {
+	cfg := conf.MediaLogSpool{Path: filepath.Join(t.TempDir(), "spool.ndjson"), Fsync: spoolFsyncNever}
+	spool, err := openMediaSpool(cfg, time.Now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+
+	var seqs []uint64
+	for _, p := range []string{"/1.mp4", "/2.mp4", "/3.mp4", "/4.mp4"} {
+		seq, err := spool.append(&AccessEvent{Path: p})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	for _, seq := range seqs[:2] {
+		spool.complete(seq)
+	}
+	// 上限只够保存两条事件，压缩时丢弃已完成的事件，仍然超过上限时丢弃最早的
+	info, err := os.Stat(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool.maxSize = info.Size() / 2
+	if _, err := spool.append(&AccessEvent{Path: "/5.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pendingPaths(spool), []string{"/4.mp4", "/5.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pending = %v, want %v", got, want)
+	}
+	compacted, err := os.Stat(cfg.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted.Size() > spool.maxSize {
+		t.Fatalf("compacted size %d exceeds cap %d", compacted.Size(), spool.maxSize)
+	}
+}
+
+func TestMediaSpoolInvalidFsync(t *testing.T) {
+	_, err := openMediaSpool(conf.MediaLogSpool{Path: filepath.Join(t.TempDir(), "spool.ndjson"), Fsync: "sometimes"}, time.Now)
+	if err == nil {
+		t.Fatal("expected error for unknown fsync mode")
+	}
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 合并写入数据库的时间窗口，避免每个事件一次 INSERT
+	mediaStoreFlushInterval = 2 * time.Second
+	// 按用户清除访问记录时每批删除的条数
+	mediaStorePurgeBatch = 500
+)
+
+// mediaStoreSink 把访问事件保存到数据库，用于管理接口中的搜索
+type mediaStoreSink struct{}
+
+func (mediaStoreSink) Write(ev *AccessEvent) error {
+	return mediaStoreSink{}.WriteBatch([]*AccessEvent{ev})
+}
+
+func (mediaStoreSink) WriteBatch(evs []*AccessEvent) error {
+	logs := make([]model.MediaAccessLog, 0, len(evs))
+	for _, ev := range evs {
+		// 后台任务的请求不计入用户的访问记录
+		if ev.Internal {
+			continue
+		}
+		logs = append(logs, model.MediaAccessLog{
+			Event:     ev.Event,
+			Time:      ev.Time,
+			ClientIP:  ev.ClientIP,
+			Username:  ev.Username,
+			Method:    ev.Method,
+			Path:      ev.Path,
+			Status:    ev.Status,
+			UserAgent: ev.UserAgent,
+			Traffic:   ev.Traffic,
+		})
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	return db.CreateMediaAccessLogs(logs)
+}
+
+// PurgeMediaUser 删除 username 保存在数据库中的所有访问记录，并丢弃内存中暂存的和最近事件中该用户的事件，返回删除的条数
+// 清除时仍在写入队列中的事件会在下一次合并写入时保存，所以在写入窗口过后再清除一次
+func PurgeMediaUser(username string) (int64, error) {
+	headProbes.forget(username)
+	albumViews.forget(username)
+	mediaPlayback.forget(username)
+	recentEvents.forget(username)
+	n, err := db.DeleteMediaAccessLogsByUser(username, mediaStorePurgeBatch)
+	if err != nil {
+		return n, err
+	}
+	time.AfterFunc(2*mediaStoreFlushInterval, func() {
+		if _, err := db.DeleteMediaAccessLogsByUser(username, mediaStorePurgeBatch); err != nil {
+			log.Errorf("failed to purge queued media access logs: %+v", err)
+		}
+	})
+	return n, nil
+}
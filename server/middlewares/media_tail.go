@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// 断开后在这段时间内带上 Last-Event-ID 重连，只补发错过的事件
+	mediaTailResumeWindow = 60 * time.Second
+	// 每个 tail 连接最多缓存的未发送事件，超过后断开连接
+	mediaTailBuffer = 256
+)
+
+// tailResumer 记录 tail 连接断开时最后发送的事件序号和断开时间
+type tailResumer struct {
+	mu     sync.Mutex
+	window time.Duration
+	now    func() time.Time
+	marks  map[uint64]time.Time
+}
+
+var mediaTailResumer = &tailResumer{window: mediaTailResumeWindow, now: time.Now, marks: make(map[uint64]time.Time)}
+
+func (r *tailResumer) mark(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for markID, at := range r.marks {
+		if now.Sub(at) > r.window {
+			delete(r.marks, markID)
+		}
+	}
+	r.marks[id] = now
+}
+
+// resumable 判断断开时最后发送的是 id 的连接是否在窗口内重连
+func (r *tailResumer) resumable(id uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	at, ok := r.marks[id]
+	return ok && r.now().Sub(at) <= r.window
+}
+
+// MediaTail 是一个 tail 连接：Backlog 为连接时需要先发送的事件（从旧到新），
+// 之后的新事件从 Updates 读取，Updates 被关闭说明连接跟不上，需要断开
+type MediaTail struct {
+	Backlog []RecentMediaEvent
+	// Resumed 为 true 时 Backlog 只包含重连前错过的事件
+	Resumed bool
+	Updates <-chan RecentMediaEvent
+
+	ring    *recentRing
+	resumer *tailResumer
+	ch      chan RecentMediaEvent
+	once    sync.Once
+}
+
+// TailMediaEvents 按从旧到新的顺序返回最后 n 条事件
+func TailMediaEvents(n int) []RecentMediaEvent {
+	recentEvents.mu.Lock()
+	defer recentEvents.mu.Unlock()
+	return recentEvents.tailLocked(n)
+}
+
+// SubscribeMediaTail 返回最后 n 条事件并订阅之后的新事件
+// lastEventID 为客户端重连时带上的 Last-Event-ID，断开不超过一分钟且错过的事件仍在缓冲区中时只补发错过的事件
+func SubscribeMediaTail(n int, lastEventID string) *MediaTail {
+	return recentEvents.subscribe(mediaTailResumer, n, lastEventID)
+}
+
+func (r *recentRing) subscribe(resumer *tailResumer, n int, lastEventID string) *MediaTail {
+	t := &MediaTail{ring: r, resumer: resumer, ch: make(chan RecentMediaEvent, mediaTailBuffer)}
+	t.Updates = t.ch
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil && resumer.resumable(id) {
+		t.Backlog, t.Resumed = r.sinceLocked(id)
+	}
+	if !t.Resumed {
+		t.Backlog = r.tailLocked(n)
+	}
+	r.subscribers[t.ch] = struct{}{}
+	return t
+}
+
+// Close 取消订阅，lastID 为最后发送给客户端的事件序号，用于之后的重连
+func (t *MediaTail) Close(lastID uint64) {
+	t.once.Do(func() {
+		t.ring.mu.Lock()
+		if _, ok := t.ring.subscribers[t.ch]; ok {
+			delete(t.ring.subscribers, t.ch)
+			close(t.ch)
+		}
+		t.ring.mu.Unlock()
+		t.resumer.mark(lastID)
+	})
+}
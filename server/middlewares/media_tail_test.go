@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tailPaths(evs []RecentMediaEvent) []string {
+	paths := make([]string, 0, len(evs))
+	for _, ev := range evs {
+		paths = append(paths, ev.Path)
+	}
+	return paths
+}
+
+func TestMediaTailResume(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	resumer := &tailResumer{window: mediaTailResumeWindow, now: clock.Now, marks: make(map[uint64]time.Time)}
+	r := newRecentRing(4)
+	for i := 1; i <= 3; i++ {
+		r.add(&AccessEvent{Path: fmt.Sprintf("/%d.mp4", i)})
+	}
+
+	tail := r.subscribe(resumer, 2, "")
+	if tail.Resumed {
+		t.Fatal("new connection should not resume")
+	}
+	if got, want := tailPaths(tail.Backlog), []string{"/2.mp4", "/3.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("backlog = %v, want %v", got, want)
+	}
+	r.add(&AccessEvent{Path: "/4.mp4"})
+	ev := <-tail.Updates
+	if ev.ID != 4 || ev.Path != "/4.mp4" {
+		t.Fatalf("update = %d %s", ev.ID, ev.Path)
+	}
+	tail.Close(ev.ID)
+	if _, ok := <-tail.Updates; ok {
+		t.Fatal("updates should be closed after Close")
+	}
+
+	// 断开期间的事件在重连时补发
+	r.add(&AccessEvent{Path: "/5.mp4"})
+	clock.Advance(30 * time.Second)
+	tail = r.subscribe(resumer, 2, "4")
+	if !tail.Resumed {
+		t.Fatal("reconnect within the window should resume")
+	}
+	if got, want := tailPaths(tail.Backlog), []string{"/5.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resumed backlog = %v, want %v", got, want)
+	}
+
+	// 超过一分钟后重新发送最后 n 条
+	clock.Advance(31 * time.Second)
+	tail = r.subscribe(resumer, 2, "4")
+	if tail.Resumed {
+		t.Fatal("reconnect after the window should not resume")
+	}
+	if got, want := tailPaths(tail.Backlog), []string{"/4.mp4", "/5.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("backlog = %v, want %v", got, want)
+	}
+}
+
+func TestMediaTailMissedOverwritten(t *testing.T) {
+	resumer := &tailResumer{window: mediaTailResumeWindow, now: time.Now, marks: make(map[uint64]time.Time)}
+	r := newRecentRing(2)
+	r.add(&AccessEvent{Path: "/1.mp4"})
+	resumer.mark(1)
+	for i := 2; i <= 4; i++ {
+		r.add(&AccessEvent{Path: fmt.Sprintf("/%d.mp4", i)})
+	}
+	// /2.mp4 已经被覆盖，无法只补发错过的事件
+	tail := r.subscribe(resumer, 10, "1")
+	if tail.Resumed {
+		t.Fatal("should not resume when missed events were overwritten")
+	}
+	if got, want := tailPaths(tail.Backlog), []string{"/3.mp4", "/4.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("backlog = %v, want %v", got, want)
+	}
+}
+
+func TestMediaTailSlowSubscriber(t *testing.T) {
+	r := newRecentRing(1)
+	tail := r.subscribe(&tailResumer{window: mediaTailResumeWindow, now: time.Now, marks: make(map[uint64]time.Time)}, 1, "")
+	for i := 0; i <= mediaTailBuffer; i++ {
+		r.add(&AccessEvent{Path: "/a.mp4"})
+	}
+	n := 0
+	for range tail.Updates {
+		n++
+	}
+	if n != mediaTailBuffer {
+		t.Fatalf("received %d updates before disconnect, want %d", n, mediaTailBuffer)
+	}
+}
@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ThrottledResponseWriter 使用令牌桶限制响应的写入速度
+// 桶的容量为一秒的流量，令牌不足时 sleep 等待补充，因此单次 Write 会被拆分为不超过桶容量的小块
+type ThrottledResponseWriter struct {
+	gin.ResponseWriter
+	ctx         context.Context
+	bytesPerSec int64
+	tokens      float64
+	last        time.Time
+}
+
+// NewThrottledResponseWriter 创建限速为 bytesPerSec 字节每秒的 writer，ctx 取消后不再等待
+func NewThrottledResponseWriter(ctx context.Context, w gin.ResponseWriter, bytesPerSec int64) *ThrottledResponseWriter {
+	return &ThrottledResponseWriter{
+		ResponseWriter: w,
+		ctx:            ctx,
+		bytesPerSec:    bytesPerSec,
+		tokens:         float64(bytesPerSec),
+		last:           time.Now(),
+	}
+}
+
+// wait 等待桶中至少有 n 个令牌并消耗掉，n 不能超过桶容量
+func (w *ThrottledResponseWriter) wait(n int) error {
+	now := time.Now()
+	w.tokens = min(float64(w.bytesPerSec), w.tokens+now.Sub(w.last).Seconds()*float64(w.bytesPerSec))
+	w.last = now
+	if lack := float64(n) - w.tokens; lack > 0 {
+		time.Sleep(time.Duration(lack / float64(w.bytesPerSec) * float64(time.Second)))
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		w.tokens += lack
+		w.last = time.Now()
+	}
+	w.tokens -= float64(n)
+	return nil
+}
+
+func (w *ThrottledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := int(min(int64(len(p)), w.bytesPerSec))
+		if err := w.wait(chunk); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[chunk:]
+	}
+	return written, nil
+}
+
+func (w *ThrottledResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// SpeedLimitMiddleware 按用户限制媒体文件的下载速度，例如区分付费用户和免费用户
+// 每个请求都会重新调用 getUserSpeedLimit，用户等级变化后立即生效；返回值不大于 0 表示不限速
+func SpeedLimitMiddleware(getUserSpeedLimit func(username string) int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isMediaFilePath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		if limit := getUserSpeedLimit(getUserName(c)); limit > 0 {
+			c.Writer = NewThrottledResponseWriter(c.Request.Context(), c.Writer, limit)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSpeedLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limits := map[string]int64{"未知用户": 10 << 10}
+	r := gin.New()
+	r.Use(SpeedLimitMiddleware(func(username string) int64 { return limits[username] }))
+	payload := bytes.Repeat([]byte("x"), 25<<10)
+	r.GET("/d/*path", func(c *gin.Context) {
+		c.Data(http.StatusOK, "video/mp4", payload)
+	})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movie.mp4", nil))
+	// 桶初始为满，25KB 在 10KB/s 下需要约 1.5 秒
+	if elapsed := time.Since(start); elapsed < 1400*time.Millisecond {
+		t.Fatalf("throttled response finished in %v", elapsed)
+	}
+	if w.Body.Len() != len(payload) {
+		t.Fatalf("body length = %d, want %d", w.Body.Len(), len(payload))
+	}
+
+	// 限速在每个请求时重新计算
+	limits["未知用户"] = 0
+	start = time.Now()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d/movie.mp4", nil))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("unlimited response took %v", elapsed)
+	}
+}
@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogLevel 是按路径分级记录访问日志时的详细程度
+type LogLevel int
+
+const (
+	// LogLevelMinimal 只记录路径和状态码
+	LogLevelMinimal LogLevel = iota
+	// LogLevelStandard 额外记录客户端 IP 和用户
+	LogLevelStandard
+	// LogLevelVerbose 额外记录 User-Agent 和完整的请求头，认证相关的请求头会被隐藏
+	LogLevelVerbose
+)
+
+// PathTier 指定某个路径前缀下的请求使用的日志详细程度
+type PathTier struct {
+	Prefix string
+	Level  LogLevel
+}
+
+// tieredRedactedHeaders 是详细日志中不输出原值的请求头
+var tieredRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// TieredLoggingMiddleware 按路径前缀选择访问日志的详细程度，例如 /premium/ 下的请求需要详细记录用于计费，
+// /public/ 下只需要最少的信息；tiers 按顺序匹配，使用第一个匹配的前缀，都不匹配的请求不记录
+func TieredLoggingMiddleware(tiers []PathTier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		p := c.Request.URL.Path
+		tier, ok := matchPathTier(tiers, p)
+		if !ok {
+			return
+		}
+		fields := log.Fields{"path": p, "status": c.Writer.Status()}
+		if tier.Level >= LogLevelStandard {
+			fields["client_ip"] = c.ClientIP()
+			fields["user"] = getUserName(c)
+		}
+		if tier.Level >= LogLevelVerbose {
+			fields["user_agent"] = c.Request.UserAgent()
+			fields["headers"] = tieredLogHeaders(c.Request.Header)
+		}
+		log.WithFields(fields).Info("access")
+	}
+}
+
+// matchPathTier 返回第一个前缀匹配 p 的 tier
+func matchPathTier(tiers []PathTier, p string) (PathTier, bool) {
+	for _, tier := range tiers {
+		if strings.HasPrefix(p, tier.Prefix) {
+			return tier, true
+		}
+	}
+	return PathTier{}, false
+}
+
+// tieredLogHeaders 复制请求头并隐藏认证信息
+func tieredLogHeaders(h http.Header) http.Header {
+	headers := h.Clone()
+	for _, name := range tieredRedactedHeaders {
+		if headers.Get(name) != "" {
+			headers.Set(name, "[REDACTED]")
+		}
+	}
+	return headers
+}
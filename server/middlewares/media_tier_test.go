@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTieredLoggingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	r := gin.New()
+	r.Use(TieredLoggingMiddleware([]PathTier{
+		{Prefix: "/premium/", Level: LogLevelVerbose},
+		{Prefix: "/public/", Level: LogLevelMinimal},
+		// 前面的 /premium/ 先匹配，这一项不会生效
+		{Prefix: "/premium/trial/", Level: LogLevelMinimal},
+	}))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		path   string
+		fields []string
+	}{
+		{"/public/a.mp4", []string{"path", "status"}},
+		{"/premium/trial/a.mp4", []string{"path", "status", "client_ip", "user", "user_agent", "headers"}},
+	}
+	for _, tc := range cases {
+		hook.Reset()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "secret-token")
+		req.Header.Set("User-Agent", "VLC/3.0")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		entry := hook.LastEntry()
+		if entry == nil {
+			t.Fatalf("%s: no log entry", tc.path)
+		}
+		if len(entry.Data) != len(tc.fields) {
+			t.Errorf("%s: fields %v, want %v", tc.path, entry.Data, tc.fields)
+		}
+		for _, f := range tc.fields {
+			if _, ok := entry.Data[f]; !ok {
+				t.Errorf("%s: missing field %s", tc.path, f)
+			}
+		}
+		if headers, ok := entry.Data["headers"].(http.Header); ok {
+			if got := headers.Get("Authorization"); got != "[REDACTED]" {
+				t.Errorf("%s: Authorization logged as %q", tc.path, got)
+			}
+			if req.Header.Get("Authorization") != "secret-token" {
+				t.Errorf("%s: request header was modified", tc.path)
+			}
+		}
+	}
+}
+
+func TestTieredLoggingMiddlewareNoMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	r := gin.New()
+	r.Use(TieredLoggingMiddleware([]PathTier{{Prefix: "/premium/", Level: LogLevelVerbose}}))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+	// 没有匹配任何前缀的请求（例如列目录的轮询）不记录
+	for _, path := range []string{"/other/a.mp4", "/api/fs/list"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "access" {
+			t.Fatalf("unmatched request was logged: %+v", entry.Data)
+		}
+	}
+}
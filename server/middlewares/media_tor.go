@@ -0,0 +1,140 @@
+package middlewares
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+var torExitListURL = "https://check.torproject.org/torbulkexitlist"
+
+// refreshInterval 不是正数时使用的刷新间隔
+const torDefaultRefreshInterval = time.Hour
+
+// torExitNodes 缓存 Tor 出口节点 IP
+type torExitNodes struct {
+	ips sync.Map
+}
+
+func (t *torExitNodes) contains(ip string) bool {
+	_, ok := t.ips.Load(ip)
+	return ok
+}
+
+func (t *torExitNodes) refresh(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, torExitListURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	latest := make(map[string]struct{})
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || net.ParseIP(line) == nil {
+			continue
+		}
+		latest[line] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	for ip := range latest {
+		t.ips.Store(ip, struct{}{})
+	}
+	t.ips.Range(func(key, _ any) bool {
+		if _, ok := latest[key.(string)]; !ok {
+			t.ips.Delete(key)
+		}
+		return true
+	})
+	log.Debugf("refreshed tor exit node list: %d nodes", len(latest))
+	return nil
+}
+
+// TorDetectionMiddleware 标记来自 Tor 出口节点的媒体文件访问
+// 出口节点列表按 refreshInterval 定期刷新，不是正数时每小时刷新一次；下载失败时保留旧列表并继续放行请求
+// 刷新一直运行到进程退出，需要停止时使用 NewTorDetector
+func TorDetectionMiddleware(refreshInterval time.Duration) gin.HandlerFunc {
+	return NewTorDetector(refreshInterval).Middleware()
+}
+
+// TorDetector 在后台定期刷新 Tor 出口节点列表，Stop 停止刷新
+type TorDetector struct {
+	nodes *torExitNodes
+	stop  func()
+}
+
+// NewTorDetector 立即开始在后台下载出口节点列表，refreshInterval 不是正数时每小时刷新一次
+func NewTorDetector(refreshInterval time.Duration) *TorDetector {
+	if refreshInterval <= 0 {
+		refreshInterval = torDefaultRefreshInterval
+	}
+	nodes := &torExitNodes{}
+	stop := nodes.start(&http.Client{Timeout: 30 * time.Second}, refreshInterval)
+	return &TorDetector{nodes: nodes, stop: stop}
+}
+
+// Middleware 返回标记 Tor 访问的中间件，停止刷新后继续使用最后一次下载的列表
+func (d *TorDetector) Middleware() gin.HandlerFunc {
+	return torDetection(d.nodes)
+}
+
+// Stop 停止刷新并等待正在进行的下载结束，可以重复调用
+func (d *TorDetector) Stop() {
+	d.stop()
+}
+
+// start 在后台立即下载一次列表，之后按 interval 刷新，返回的函数停止刷新并等待正在进行的下载结束
+func (t *torExitNodes) start(client *http.Client, interval time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := t.refresh(ctx, client); err != nil && ctx.Err() == nil {
+				log.Warnf("failed to download tor exit node list: %+v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+func torDetection(nodes *torExitNodes) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isMediaFilePath(c.Request.URL.Path) && nodes.contains(c.ClientIP()) {
+			if ev := getAccessEvent(c); ev != nil {
+				ev.FromTor = true
+			}
+		}
+		c.Next()
+	}
+}
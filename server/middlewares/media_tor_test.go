@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func serveTorExitList(t *testing.T, status int, body *string) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(*body))
+	}))
+	t.Cleanup(srv.Close)
+	old := torExitListURL
+	torExitListURL = srv.URL
+	t.Cleanup(func() { torExitListURL = old })
+}
+
+func TestTorExitNodesRefresh(t *testing.T) {
+	body := "# exit nodes\n185.220.101.1\n\nnot-an-ip\n 2001:db8::1 \n"
+	serveTorExitList(t, http.StatusOK, &body)
+
+	nodes := &torExitNodes{}
+	if err := nodes.refresh(context.Background(), http.DefaultClient); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"185.220.101.1": true, "2001:db8::1": true, "not-an-ip": false, "10.0.0.1": false} {
+		if got := nodes.contains(ip); got != want {
+			t.Errorf("contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// 不再出现在列表中的节点被移除
+	body = "185.220.101.2\n"
+	if err := nodes.refresh(context.Background(), http.DefaultClient); err != nil {
+		t.Fatal(err)
+	}
+	if nodes.contains("185.220.101.1") || !nodes.contains("185.220.101.2") {
+		t.Fatal("list was not replaced")
+	}
+}
+
+func TestTorDetectionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := "185.220.101.1\n"
+	serveTorExitList(t, http.StatusOK, &body)
+	nodes := &torExitNodes{}
+	if err := nodes.refresh(context.Background(), http.DefaultClient); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, _ := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)), torDetection(nodes))
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	for _, ip := range []string{"185.220.101.1", "203.0.113.7"} {
+		req := httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil)
+		req.RemoteAddr = ip + ":40000"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(sink.events) != 2 {
+		t.Fatalf("got %d events, want 2", len(sink.events))
+	}
+	if !sink.events[0].FromTor || sink.events[1].FromTor {
+		t.Fatalf("from_tor = %v, %v", sink.events[0].FromTor, sink.events[1].FromTor)
+	}
+}
+
+func TestTorDetectionFailOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	body := "unavailable"
+	serveTorExitList(t, http.StatusServiceUnavailable, &body)
+
+	// 刷新间隔不是正数时使用默认值，不会 panic
+	detector := NewTorDetector(0)
+	defer detector.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if entry := hook.LastEntry(); entry != nil && entry.Level == log.WarnLevel {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("download failure was not logged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	r := gin.New()
+	r.Use(detector.Middleware())
+	r.GET("/d/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/d/movies/a.mp4", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	// 停止后可以重复调用
+	detector.Stop()
+	detector.Stop()
+}
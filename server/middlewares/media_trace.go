@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 只追踪管理员带上该请求头的请求
+	MediaTraceHeader = "X-Media-Log-Trace"
+	// 最多保留的追踪记录条数
+	maxMediaTraces = 200
+	// 追踪最长开启时间，到期后自动关闭，避免忘记关闭
+	maxMediaTraceTimeout = time.Hour
+)
+
+// MediaTraceStep 是媒体日志中间件对请求做出的一次判断
+// Path 为判断针对的文件，目录列表等一个请求对应多个文件时用来区分
+type MediaTraceStep struct {
+	Stage  string `json:"stage"`
+	Path   string `json:"path,omitempty"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// MediaTrace 是一个请求的完整判断过程，Logged 为最终记录的路径
+type MediaTrace struct {
+	Time     time.Time        `json:"time"`
+	Method   string           `json:"method"`
+	URL      string           `json:"url"`
+	Username string           `json:"username"`
+	Steps    []MediaTraceStep `json:"steps"`
+	Logged   []string         `json:"logged"`
+}
+
+// mediaTrace 在请求处理过程中收集判断，HEAD 合并等步骤可能在其他 goroutine 中追加
+type mediaTrace struct {
+	mu    sync.Mutex
+	trace MediaTrace
+}
+
+// step 追加一次判断，tr 为 nil（未开启追踪）时什么都不做
+func (tr *mediaTrace) step(stage, path, result, detail string) {
+	if tr == nil {
+		return
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.trace.Steps = append(tr.trace.Steps, MediaTraceStep{Stage: stage, Path: path, Result: result, Detail: detail})
+}
+
+func (tr *mediaTrace) logged(path string) {
+	if tr == nil {
+		return
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.trace.Logged = append(tr.trace.Logged, path)
+}
+
+func (tr *mediaTrace) snapshot() MediaTrace {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	out := tr.trace
+	out.Steps = append([]MediaTraceStep(nil), tr.trace.Steps...)
+	out.Logged = append([]string(nil), tr.trace.Logged...)
+	return out
+}
+
+// traceOf 返回当前请求的追踪记录
+func traceOf(c *gin.Context) *mediaTrace {
+	if ev := getAccessEvent(c); ev != nil {
+		return ev.trace
+	}
+	return nil
+}
+
+// mediaTracer 控制追踪的开启，追踪满 remaining 个请求或到达 until 后自动关闭
+type mediaTracer struct {
+	mu         sync.Mutex
+	remaining  int
+	until      time.Time
+	headerOnly bool
+	traces     []*mediaTrace
+	now        func() time.Time
+}
+
+var mediaTraces = &mediaTracer{now: time.Now}
+
+// MediaTraceStatus 是追踪的状态和已经收集的记录，记录按从旧到新排列
+type MediaTraceStatus struct {
+	Active     bool         `json:"active"`
+	Remaining  int          `json:"remaining"`
+	Until      *time.Time   `json:"until,omitempty"`
+	HeaderOnly bool         `json:"header_only"`
+	Traces     []MediaTrace `json:"traces"`
+}
+
+// StartMediaTrace 开始追踪之后的 n 个请求，timeout 后自动关闭，最长一小时
+// headerOnly 为 true 时只追踪管理员带上 X-Media-Log-Trace 请求头的请求
+// 重新开始时清空之前的记录
+func StartMediaTrace(n int, timeout time.Duration, headerOnly bool) {
+	mediaTraces.start(n, timeout, headerOnly)
+}
+
+// StopMediaTrace 立即关闭追踪，已经收集的记录仍然保留
+func StopMediaTrace() {
+	mediaTraces.mu.Lock()
+	defer mediaTraces.mu.Unlock()
+	mediaTraces.remaining = 0
+}
+
+// GetMediaTraces 返回追踪状态和记录
+func GetMediaTraces() MediaTraceStatus {
+	return mediaTraces.status()
+}
+
+func (t *mediaTracer) start(n int, timeout time.Duration, headerOnly bool) {
+	if timeout <= 0 || timeout > maxMediaTraceTimeout {
+		timeout = maxMediaTraceTimeout
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remaining = n
+	t.until = t.now().Add(timeout)
+	t.headerOnly = headerOnly
+	t.traces = nil
+}
+
+func (t *mediaTracer) activeLocked() bool {
+	if t.remaining > 0 && !t.now().Before(t.until) {
+		t.remaining = 0
+	}
+	return t.remaining > 0
+}
+
+// begin 在追踪开启时为请求创建追踪记录，请求结束后由 finish 决定是否保留
+func (t *mediaTracer) begin(c *gin.Context) *mediaTrace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.activeLocked() || (t.headerOnly && c.GetHeader(MediaTraceHeader) == "") {
+		return nil
+	}
+	return &mediaTrace{trace: MediaTrace{Time: t.now(), Method: c.Request.Method, URL: c.Request.URL.String()}}
+}
+
+// finish 保留请求的追踪记录并计数，只追踪带请求头的请求时，处理完成后才知道用户是否为管理员
+func (t *mediaTracer) finish(c *gin.Context, tr *mediaTrace) {
+	if tr == nil {
+		return
+	}
+	user, _ := c.Value("user").(*model.User)
+	tr.mu.Lock()
+	tr.trace.Username = getUserName(c)
+	tr.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.activeLocked() || (t.headerOnly && (user == nil || !user.IsAdmin())) {
+		return
+	}
+	t.remaining--
+	if len(t.traces) == maxMediaTraces {
+		t.traces = t.traces[1:]
+	}
+	t.traces = append(t.traces, tr)
+}
+
+func (t *mediaTracer) status() MediaTraceStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := MediaTraceStatus{
+		Active:     t.activeLocked(),
+		Remaining:  t.remaining,
+		HeaderOnly: t.headerOnly,
+		Traces:     make([]MediaTrace, 0, len(t.traces)),
+	}
+	if s.Active {
+		until := t.until
+		s.Until = &until
+	}
+	for _, tr := range t.traces {
+		s.Traces = append(s.Traces, tr.snapshot())
+	}
+	return s
+}
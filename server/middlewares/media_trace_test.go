@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+func traceStages(tr MediaTrace) []string {
+	stages := make([]string, 0, len(tr.Steps))
+	for _, step := range tr.Steps {
+		stages = append(stages, step.Stage+":"+step.Result)
+	}
+	return stages
+}
+
+func TestMediaTraceDecisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e, err := compileMediaExpr(`ext != ".mkv"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMediaLogExpr(e)
+	defer setMediaLogExpr(nil)
+	StartMediaTrace(3, time.Minute, false)
+	defer StopMediaTrace()
+
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(&eventSink{})))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	for _, u := range []string{"/d/a.mp4", "/d/b.mkv", "/index.html", "/d/c.mp4"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, u, nil))
+	}
+
+	status := GetMediaTraces()
+	if status.Active || len(status.Traces) != 3 {
+		t.Fatalf("active = %v, %d traces, want inactive with 3", status.Active, len(status.Traces))
+	}
+	if got, want := status.Traces[0].Logged, []string{"/d/a.mp4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logged = %v, want %v", got, want)
+	}
+	if got, want := traceStages(status.Traces[1]), []string{"extension:media", "filter_expr:skip"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mkv stages = %v, want %v", got, want)
+	}
+	if len(status.Traces[1].Logged) != 0 {
+		t.Errorf("filtered request logged %v", status.Traces[1].Logged)
+	}
+	if got, want := traceStages(status.Traces[2]), []string{"extension:not_media"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("html stages = %v, want %v", got, want)
+	}
+}
+
+func TestMediaTraceHeaderOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	StartMediaTrace(5, time.Minute, true)
+	defer StopMediaTrace()
+
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithSink(&eventSink{})))
+	r.GET("/*path", func(c *gin.Context) {
+		if c.Query("admin") != "" {
+			c.Set("user", &model.User{Username: "admin", Role: model.ADMIN})
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	for _, tc := range []struct {
+		url    string
+		header bool
+	}{
+		{"/d/a.mp4?admin=1", false},
+		{"/d/b.mp4", true},
+		{"/d/c.mp4?admin=1", true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+		if tc.header {
+			req.Header.Set(MediaTraceHeader, "1")
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	status := GetMediaTraces()
+	if len(status.Traces) != 1 || status.Traces[0].Username != "admin" || status.Remaining != 4 {
+		t.Fatalf("got %d traces, remaining %d, want only the admin request", len(status.Traces), status.Remaining)
+	}
+}
+
+func TestMediaTraceTimeout(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC)}
+	tracer := &mediaTracer{now: clock.Now}
+	tracer.start(10, 10*time.Minute, false)
+	if !tracer.status().Active {
+		t.Fatal("tracer should be active after start")
+	}
+	clock.Advance(10 * time.Minute)
+	if status := tracer.status(); status.Active || status.Remaining != 0 {
+		t.Fatalf("tracer still active after timeout: %+v", status)
+	}
+
+	// 超时时间不能超过一小时
+	tracer.start(10, 24*time.Hour, false)
+	clock.Advance(maxMediaTraceTimeout)
+	if tracer.status().Active {
+		t.Fatal("timeout should be capped")
+	}
+}
@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+// 访问事件的流量类型，正常观看的访问为空
+const (
+	// TrafficScan 是媒体服务器扫描媒体库产生的访问
+	TrafficScan = "scan"
+	// TrafficSync 是 rclone 挂载、同步任务和 WebDAV 同步客户端的访问，读取文件时没有人在观看
+	TrafficSync = "sync"
+	// TrafficBot 是搜索引擎爬虫和 curl、wget 等工具的访问
+	TrafficBot = "bot"
+)
+
+// trafficRule 把 User-Agent 匹配 pattern 的客户端归为 traffic 类型
+type trafficRule struct {
+	pattern *regexp.Regexp
+	traffic string
+}
+
+// builtinTrafficRules 是内置的客户端分类表，scanDetector、同步客户端和爬虫的标记共用
+var builtinTrafficRules = []trafficRule{
+	{regexp.MustCompile(`(?i)jellyfin-server|emby ?server|plexmediaserver|\blavf/|ffprobe`), TrafficScan},
+	{regexp.MustCompile(`(?i)\brclone/|goodsync|cyberduck|mountain ?duck|freefilesync|davfs2`), TrafficSync},
+	{regexp.MustCompile(`(?i)googlebot|bingbot|baiduspider|yandex(bot|images|video)|applebot|duckduckbot|yahoo! slurp|` +
+		`bytespider|petalbot|ahrefsbot|semrushbot|mj12bot|facebookexternalhit|\b(crawler|spider)\b|^curl/|^wget/`), TrafficBot},
+}
+
+// mediaTrafficRules 由 InitMediaLog 根据 media_log.traffic_clients 设置，配置的规则在内置规则之前
+var mediaTrafficRules atomic.Pointer[[]trafficRule]
+
+func setMediaTrafficRules(rules []trafficRule) {
+	mediaTrafficRules.Store(&rules)
+}
+
+// compileTrafficRules 编译配置的分类规则并追加内置规则
+func compileTrafficRules(clients []conf.MediaTrafficClient) ([]trafficRule, error) {
+	rules := make([]trafficRule, 0, len(clients)+len(builtinTrafficRules))
+	for _, client := range clients {
+		if client.Traffic != TrafficScan && client.Traffic != TrafficSync && client.Traffic != TrafficBot {
+			return nil, fmt.Errorf("unknown traffic %q for pattern %q", client.Traffic, client.Pattern)
+		}
+		re, err := regexp.Compile("(?i)" + client.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", client.Pattern, err)
+		}
+		rules = append(rules, trafficRule{pattern: re, traffic: client.Traffic})
+	}
+	return append(rules, builtinTrafficRules...), nil
+}
+
+// classifyUserAgent 返回第一条匹配的规则的流量类型，都不匹配时返回空
+func classifyUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return ""
+	}
+	rules := builtinTrafficRules
+	if p := mediaTrafficRules.Load(); p != nil {
+		rules = *p
+	}
+	for _, rule := range rules {
+		if rule.pattern.MatchString(userAgent) {
+			return rule.traffic
+		}
+	}
+	return ""
+}
+
+// tagTraffic 为同步客户端、爬虫和扫描媒体库的访问设置 Traffic
+func tagTraffic(ev *AccessEvent) {
+	if ev.Traffic != "" {
+		return
+	}
+	switch classifyUserAgent(ev.UserAgent) {
+	case TrafficSync:
+		ev.Traffic = TrafficSync
+		ev.trace.step("traffic", ev.Path, "tagged", "sync client")
+		return
+	case TrafficBot:
+		if tagBot(ev) {
+			ev.trace.step("traffic", ev.Path, "tagged", "bot")
+			return
+		}
+	}
+	if mediaScanDetector.detect(ev) {
+		ev.Traffic = TrafficScan
+		ev.trace.step("scan", ev.Path, "tagged", "media server library scan")
+	}
+}
+
+// dropTraffic 判断配置是否要求丢弃该流量类型的事件
+func dropTraffic(traffic string) bool {
+	cfg := mediaLogConf()
+	return traffic == TrafficScan && cfg.DropScanTraffic || traffic == TrafficBot && cfg.DropBotTraffic
+}
+
+// mediaViewCounter 统计启动以来记录的访问次数，scans、syncs、bots 为其中扫描、同步客户端和爬虫的访问
+// bytes 为所有访问实际传输的字节数，包括以上流量
+type mediaViewCounter struct {
+	views atomic.Int64
+	scans atomic.Int64
+	syncs atomic.Int64
+	bots  atomic.Int64
+	bytes atomic.Int64
+}
+
+var mediaViews = &mediaViewCounter{}
+
+// count 统计一条已经输出的事件，只计入普通访问和跳转下载，内部请求不计入
+func (c *mediaViewCounter) count(ev *AccessEvent) {
+	if ev.Internal || (ev.Event != EventAccess && ev.Event != EventRedirectDownload) {
+		return
+	}
+	c.views.Add(1)
+	switch ev.Traffic {
+	case TrafficScan:
+		c.scans.Add(1)
+	case TrafficSync:
+		c.syncs.Add(1)
+	case TrafficBot:
+		c.bots.Add(1)
+	}
+	if ev.BytesServed != nil {
+		c.bytes.Add(*ev.BytesServed)
+	}
+}
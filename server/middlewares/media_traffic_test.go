@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	defer mediaTrafficRules.Store(nil)
+	cases := map[string]string{
+		"rclone/v1.66.0":                        TrafficSync,
+		"GoodSync":                              TrafficSync,
+		"Cyberduck/8.8.2.41257 (Mac OS X/14.5)": TrafficSync,
+		"Mountain Duck/4.15.6":                  TrafficSync,
+		"Jellyfin-Server/10.9.7":                TrafficScan,
+		"Mozilla/5.0 (Windows NT 10.0)":         "",
+		"MySyncTool/2.0":                        "",
+		"":                                      "",
+	}
+	for ua, want := range cases {
+		if got := classifyUserAgent(ua); got != want {
+			t.Errorf("classifyUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+
+	// 配置的规则优先于内置规则
+	rules, err := compileTrafficRules([]conf.MediaTrafficClient{
+		{Pattern: `^mysynctool/`, Traffic: TrafficSync},
+		{Pattern: `^rclone/`, Traffic: TrafficScan},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMediaTrafficRules(rules)
+	cases["MySyncTool/2.0"] = TrafficSync
+	cases["rclone/v1.66.0"] = TrafficScan
+	for ua, want := range cases {
+		if got := classifyUserAgent(ua); got != want {
+			t.Errorf("with custom rules classifyUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+
+	for _, bad := range []conf.MediaTrafficClient{{Pattern: `(`, Traffic: TrafficSync}, {Pattern: `wget`, Traffic: "robot"}} {
+		if _, err := compileTrafficRules([]conf.MediaTrafficClient{bad}); err == nil {
+			t.Errorf("compileTrafficRules(%+v) should fail", bad)
+		}
+	}
+}
+
+func TestMediaLogSyncTraffic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+	views, syncs, bytes := mediaViews.views.Load(), mediaViews.syncs.Load(), mediaViews.bytes.Load()
+
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "0123456789") })
+	// rclone 在短时间内读取大量文件的开头，仍然标记为同步而不是扫描
+	for i := 0; i < 2*scanBurstFiles; i++ {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/d/tv/e%02d.mkv", i), nil)
+		req.Header.Set("User-Agent", "rclone/v1.66.0")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, ev := range sink.events {
+		if ev.Traffic != TrafficSync {
+			t.Fatalf("event %s tagged %q, want sync", ev.Path, ev.Traffic)
+		}
+	}
+	if msg := hook.LastEntry().Message; !strings.Contains(msg, "标记：同步客户端") {
+		t.Fatalf("log message %q", msg)
+	}
+	n := int64(len(sink.events))
+	if mediaViews.views.Load()-views != n || mediaViews.syncs.Load()-syncs != n {
+		t.Fatalf("sync accesses were not counted separately")
+	}
+	// 流量仍然计入传输的字节数
+	if got := mediaViews.bytes.Load() - bytes; got != 10*n {
+		t.Fatalf("bytes served = %d, want %d", got, 10*n)
+	}
+	stats := GetMediaStats()
+	if all := GetMediaStats(TrafficScan, TrafficSync); all.Views-stats.Views != stats.ScanViews+stats.SyncViews {
+		t.Fatalf("views %d, including scan and sync %d", stats.Views, all.Views)
+	}
+}
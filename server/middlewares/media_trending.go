@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTrendingHalfLife = 72 * time.Hour
+	defaultTrendingMaxFiles = 10000
+	// 超出上限时一次淘汰到上限的 90%，避免之后每次访问新文件都重新排序
+	trendingEvictRatio = 0.9
+)
+
+// TrendingFile 是热门文件列表中的一项，Score 为按当前时间衰减后的得分
+type TrendingFile struct {
+	Path       string    `json:"path"`
+	Score      float64   `json:"score"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+type trendingEntry struct {
+	// score 为 at 时刻的得分，读取时再按经过的时间衰减
+	score float64
+	at    time.Time
+}
+
+// trendingTable 保存每个文件按时间衰减的访问得分，只在访问和读取时计算衰减
+type trendingTable struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	halfLife time.Duration
+	max      int
+	entries  map[string]*trendingEntry
+}
+
+func newTrendingTable(now func() time.Time, halfLife time.Duration, max int) *trendingTable {
+	return &trendingTable{now: now, halfLife: halfLife, max: max, entries: make(map[string]*trendingEntry)}
+}
+
+var mediaTrending = newTrendingTable(time.Now, defaultTrendingHalfLife, defaultTrendingMaxFiles)
+
+// configure 修改半衰期和上限，已有的得分保留，之后按新的半衰期衰减
+func (t *trendingTable) configure(halfLife time.Duration, max int) {
+	if halfLife <= 0 {
+		halfLife = defaultTrendingHalfLife
+	}
+	if max <= 0 {
+		max = defaultTrendingMaxFiles
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.halfLife, t.max = halfLife, max
+	if len(t.entries) > t.max {
+		t.evictLocked(t.now())
+	}
+}
+
+func (t *trendingTable) decayedLocked(e *trendingEntry, now time.Time) float64 {
+	elapsed := now.Sub(e.at)
+	if elapsed <= 0 {
+		return e.score
+	}
+	return e.score * math.Exp2(-elapsed.Seconds()/t.halfLife.Seconds())
+}
+
+// add 为文件加 1 分
+func (t *trendingTable) add(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	e := t.entries[path]
+	if e == nil {
+		if len(t.entries) >= t.max {
+			t.evictLocked(now)
+		}
+		e = &trendingEntry{}
+		t.entries[path] = e
+	}
+	e.score = t.decayedLocked(e, now) + 1
+	e.at = now
+}
+
+// evictLocked 淘汰当前得分最低的文件，保留 max 的 90%
+func (t *trendingTable) evictLocked(now time.Time) {
+	files := t.sortedLocked(now)
+	keep := int(float64(t.max) * trendingEvictRatio)
+	for _, f := range files[min(keep, len(files)):] {
+		delete(t.entries, f.Path)
+	}
+}
+
+// sortedLocked 返回按当前得分从高到低排列的所有文件
+func (t *trendingTable) sortedLocked(now time.Time) []TrendingFile {
+	files := make([]TrendingFile, 0, len(t.entries))
+	for p, e := range t.entries {
+		files = append(files, TrendingFile{Path: p, Score: t.decayedLocked(e, now), LastAccess: e.at})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Score != files[j].Score {
+			return files[i].Score > files[j].Score
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
+
+// top 返回当前得分最高的 limit 个文件
+func (t *trendingTable) top(limit int) []TrendingFile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	files := t.sortedLocked(t.now())
+	return files[:min(max(limit, 0), len(files))]
+}
+
+// observe 统计一条已经输出的事件，只计入普通访问和跳转下载，扫描、同步、爬虫和内部请求不计入
+func (t *trendingTable) observe(ev *AccessEvent) {
+	if ev.Internal || ev.Traffic != "" || ev.Status >= 400 ||
+		(ev.Event != EventAccess && ev.Event != EventRedirectDownload) {
+		return
+	}
+	t.add(mediaVirtualPath(ev.Path))
+}
+
+// GetMediaTrending 返回按时间衰减的得分最高的 limit 个文件
+func GetMediaTrending(limit int) []TrendingFile {
+	return mediaTrending.top(limit)
+}
+
+// snapshot 返回用于保存到数据库的得分
+func (t *trendingTable) snapshot() []model.MediaTrendingScore {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	scores := make([]model.MediaTrendingScore, 0, len(t.entries))
+	for p, e := range t.entries {
+		scores = append(scores, model.MediaTrendingScore{Path: p, Score: e.score, UpdatedAt: e.at})
+	}
+	return scores
+}
+
+// load 合并数据库中保存的得分，内存中已有的文件以内存为准
+func (t *trendingTable) load(scores []model.MediaTrendingScore) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range scores {
+		if _, ok := t.entries[s.Path]; !ok {
+			t.entries[s.Path] = &trendingEntry{score: s.Score, at: s.UpdatedAt}
+		}
+	}
+	if len(t.entries) > t.max {
+		t.evictLocked(t.now())
+	}
+}
+
+// startTrendingPersistence 从数据库恢复得分，之后每 interval 保存一次，
+// 返回的函数停止定时保存并最后保存一次
+func startTrendingPersistence(t *trendingTable, interval time.Duration) func() {
+	if scores, err := db.GetMediaTrendingScores(); err != nil {
+		log.Errorf("failed to load media trending scores: %+v", err)
+	} else {
+		t.load(scores)
+	}
+	save := func() {
+		if err := db.ReplaceMediaTrendingScores(t.snapshot()); err != nil {
+			log.Errorf("failed to save media trending scores: %+v", err)
+		}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		save()
+	}
+}
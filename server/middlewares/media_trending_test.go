@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/model"
+)
+
+func TestTrendingTableDecay(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)}
+	table := newTrendingTable(clock.Now, 24*time.Hour, 100)
+
+	// 老文件一周前访问了 100 次，新文件今天访问了 10 次
+	for i := 0; i < 100; i++ {
+		table.add("/old.mp4")
+	}
+	clock.Advance(7 * 24 * time.Hour)
+	for i := 0; i < 10; i++ {
+		table.add("/new.mp4")
+	}
+
+	top := table.top(20)
+	if len(top) != 2 || top[0].Path != "/new.mp4" || top[1].Path != "/old.mp4" {
+		t.Fatalf("top = %+v", top)
+	}
+	if math.Abs(top[0].Score-10) > 1e-9 || math.Abs(top[1].Score-100.0/128) > 1e-9 {
+		t.Fatalf("scores = %v, %v", top[0].Score, top[1].Score)
+	}
+	// 读取不会改变保存的得分，只按经过的时间计算
+	clock.Advance(24 * time.Hour)
+	if top = table.top(1); len(top) != 1 || math.Abs(top[0].Score-5) > 1e-9 {
+		t.Fatalf("score after one half-life = %+v", top)
+	}
+}
+
+func TestTrendingTableEvict(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)}
+	table := newTrendingTable(clock.Now, time.Hour, 10)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			table.add(fmt.Sprintf("/%02d.mp4", i))
+		}
+	}
+	table.add("/new.mp4")
+	if n := len(table.entries); n > 10 {
+		t.Fatalf("table grew to %d entries", n)
+	}
+	// 得分最低的文件被淘汰，新文件和得分最高的文件保留
+	for _, p := range []string{"/new.mp4", "/09.mp4", "/08.mp4"} {
+		if table.entries[p] == nil {
+			t.Errorf("%s was evicted", p)
+		}
+	}
+	if table.entries["/00.mp4"] != nil {
+		t.Error("/00.mp4 was kept")
+	}
+}
+
+func TestTrendingTableLoad(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 7, 12, 0, 0, 0, 0, time.UTC)}
+	table := newTrendingTable(clock.Now, time.Hour, 10)
+	table.add("/a.mp4")
+	table.load([]model.MediaTrendingScore{
+		{Path: "/a.mp4", Score: 50, UpdatedAt: clock.Now()},
+		{Path: "/b.mp4", Score: 8, UpdatedAt: clock.Now().Add(-time.Hour)},
+	})
+	top := table.top(10)
+	if len(top) != 2 || top[0].Path != "/b.mp4" || math.Abs(top[0].Score-4) > 1e-9 || top[1].Score != 1 {
+		t.Fatalf("top after load = %+v", top)
+	}
+	if scores := table.snapshot(); len(scores) != 2 {
+		t.Fatalf("snapshot = %+v", scores)
+	}
+}
+
+func TestTrendingObserve(t *testing.T) {
+	table := newTrendingTable(time.Now, time.Hour, 10)
+	for _, ev := range []*AccessEvent{
+		{Event: EventAccess, Path: "/d/a.mp4", Status: 200},
+		{Event: EventRedirectDownload, Path: "/p/a.mp4", Status: 302},
+		{Event: EventAccess, Path: "/d/a.mp4", Status: 200, Traffic: TrafficScan},
+		{Event: EventAccess, Path: "/d/a.mp4", Status: 200, Internal: true},
+		{Event: EventProbe, Path: "/d/a.mp4", Status: 200},
+		{Event: EventAccess, Path: "/d/b.mp4", Status: 404},
+	} {
+		table.observe(ev)
+	}
+	top := table.top(10)
+	if len(top) != 1 || top[0].Path != "/a.mp4" || math.Abs(top[0].Score-2) > 1e-6 {
+		t.Fatalf("top = %+v", top)
+	}
+}
@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 最多记录的 User-Agent 数，写满后不再认为有新的客户端，避免随意构造的 User-Agent 占满内存和磁盘
+	userAgentCacheMax = 100000
+	// 超过这个长度的 User-Agent 只按前缀判断
+	userAgentMaxLen = 512
+)
+
+// UserAgentCache 记录已经出现过的 User-Agent
+type UserAgentCache interface {
+	// Add 记录 ua，返回 ua 是否第一次出现
+	Add(ua string) bool
+}
+
+// MemoryUserAgentCache 只在内存中记录，"新客户端"指启动以来没有出现过的 User-Agent
+type MemoryUserAgentCache struct {
+	seen     sync.Map
+	size     atomic.Int64
+	fullOnce sync.Once
+}
+
+func NewMemoryUserAgentCache() *MemoryUserAgentCache {
+	return &MemoryUserAgentCache{}
+}
+
+func (m *MemoryUserAgentCache) Add(ua string) bool {
+	if len(ua) > userAgentMaxLen {
+		ua = ua[:userAgentMaxLen]
+	}
+	if _, ok := m.seen.Load(ua); ok {
+		return false
+	}
+	if m.size.Load() >= userAgentCacheMax {
+		m.fullOnce.Do(func() {
+			log.Warnf("media user agent: %d user agents recorded, new ones are no longer reported", userAgentCacheMax)
+		})
+		return false
+	}
+	if _, loaded := m.seen.LoadOrStore(ua, struct{}{}); loaded {
+		return false
+	}
+	m.size.Add(1)
+	return true
+}
+
+// FileUserAgentCache 把出现过的 User-Agent 逐行追加到文件中，重启后仍然有效，
+// "新客户端"指从来没有出现过的 User-Agent
+type FileUserAgentCache struct {
+	mem MemoryUserAgentCache
+	mu  sync.Mutex
+	f   *os.File
+}
+
+// OpenFileUserAgentCache 读取 path 中已经记录的 User-Agent，文件不存在时创建
+func OpenFileUserAgentCache(path string) (*FileUserAgentCache, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user agent cache: %w", err)
+	}
+	c := &FileUserAgentCache{f: f}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 4096), userAgentMaxLen+1)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			c.mem.Add(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to read user agent cache: %w", err)
+	}
+	return c, nil
+}
+
+func (c *FileUserAgentCache) Add(ua string) bool {
+	if !c.mem.Add(ua) {
+		return false
+	}
+	if len(ua) > userAgentMaxLen {
+		ua = ua[:userAgentMaxLen]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// HTTP 头中不会出现换行，每行一个
+	if _, err := c.f.WriteString(ua + "\n"); err != nil {
+		log.Errorf("failed to save user agent: %+v", err)
+	}
+	return true
+}
+
+func (c *FileUserAgentCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
+
+// NewUserAgentLogger 在媒体文件请求的 User-Agent 第一次出现时记录一条 new_user_agent 事件，
+// 用于了解新版本的播放器什么时候开始使用；事件由媒体日志中间件输出，需要注册在它之后
+func NewUserAgentLogger(cache UserAgentCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if ua := c.Request.UserAgent(); ua != "" && isMediaFilePath(p) && cache.Add(ua) {
+			RecordMediaAudit(c, EventNewUserAgent, p)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestNewUserAgentLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(d *scanDetector) { mediaScanDetector = d }(mediaScanDetector)
+	mediaScanDetector = newScanDetector()
+
+	logger, hook := logtest.NewNullLogger()
+	sink := &eventSink{}
+	r := gin.New()
+	r.Use(MediaLoggerWithOptions(WithLogger(logger), WithSink(sink)), NewUserAgentLogger(NewMemoryUserAgentCache()))
+	r.GET("/*path", func(c *gin.Context) { c.String(http.StatusOK, "x") })
+	serve := func(path, ua string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", ua)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/d/a.mp4", "mpv 0.38.0")
+	serve("/d/b.mp4", "mpv 0.38.0")
+	serve("/d/a.mp4", "mpv 0.39.0")
+	// 不是媒体文件的请求不记录
+	serve("/api/me", "Firefox/128.0")
+
+	var newAgents []*AccessEvent
+	for _, ev := range sink.events {
+		if ev.Event == EventNewUserAgent {
+			newAgents = append(newAgents, ev)
+		}
+	}
+	if len(newAgents) != 2 || newAgents[0].UserAgent != "mpv 0.38.0" || newAgents[1].UserAgent != "mpv 0.39.0" {
+		t.Fatalf("new user agent events %+v", newAgents)
+	}
+	// 访问本身仍然记录
+	if len(sink.events) != 5 {
+		t.Fatalf("got %d events, want 5", len(sink.events))
+	}
+	found := false
+	for _, entry := range hook.AllEntries() {
+		found = found || strings.Contains(entry.Message, "操作：新客户端 客户端：mpv 0.39.0")
+	}
+	if !found {
+		t.Fatal("new user agent was not in the text log")
+	}
+}
+
+func TestFileUserAgentCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user_agents.txt")
+	c, err := OpenFileUserAgentCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 2*userAgentMaxLen)
+	if !c.Add("VLC/3.0.20") || c.Add("VLC/3.0.20") || !c.Add(long) {
+		t.Fatal("unexpected Add result")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后之前出现过的 User-Agent 不再是新的
+	c, err = OpenFileUserAgentCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Add("VLC/3.0.20") || c.Add(long) || !c.Add("VLC/3.0.21") {
+		t.Fatal("cache was not restored from disk")
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 {
+		t.Fatalf("file lines = %q", lines)
+	}
+}
+
+func TestMemoryUserAgentCacheFull(t *testing.T) {
+	c := NewMemoryUserAgentCache()
+	c.size.Store(userAgentCacheMax)
+	if c.Add("mpv 0.38.0") {
+		t.Fatal("full cache reported a new user agent")
+	}
+}
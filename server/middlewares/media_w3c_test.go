@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func TestFormatW3CLog(t *testing.T) {
+	size := int64(1048576)
+	cst := time.FixedZone("CST", 8*3600)
+	cases := []struct {
+		ev   *AccessEvent
+		want string
+	}{
+		{
+			&AccessEvent{Time: time.Date(2025, 7, 13, 1, 10, 36, 0, cst), ClientIP: "203.0.113.7", Username: "bob smith",
+				Method: "GET", Path: "/电影/my movie.mkv", Status: 206, BytesServed: &size},
+			// 日期和时间转换为 UTC
+			"2025-07-12 17:10:36 203.0.113.7 bob+smith GET /%E7%94%B5%E5%BD%B1/my%20movie.mkv 206 1048576",
+		},
+		{
+			&AccessEvent{Time: time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC), Username: "未知用户", Path: "/a.mp4"},
+			"2025-07-12 15:10:36 - - - /a.mp4 - -",
+		},
+	}
+	for _, tc := range cases {
+		if got := formatW3CLog(tc.ev); got != tc.want {
+			t.Errorf("formatW3CLog = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+// readW3CFiles 返回目录中所有日志文件的内容
+func readW3CFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, string(data))
+	}
+	return files
+}
+
+func checkW3CHeader(t *testing.T, content string) {
+	t.Helper()
+	lines := strings.SplitN(content, "\n", 5)
+	if len(lines) < 5 || !strings.HasPrefix(lines[0], "#Software: OpenList ") || lines[1] != "#Version: 1.0" ||
+		!strings.HasPrefix(lines[2], "#Date: ") || lines[3] != "#Fields: "+w3cFields {
+		t.Fatalf("file does not start with the W3C directives: %q", content[:min(len(content), 200)])
+	}
+	if strings.Count(content, "#Fields:") != 1 {
+		t.Fatalf("directives repeated within a file")
+	}
+}
+
+func TestMediaFileLoggerW3CRotation(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewMediaFileLogger(conf.LogConfig{Name: filepath.Join(dir, "media.log"), MaxSize: 1})
+	defer logger.Close()
+	if err := logger.SetFormat(MediaFileFormatW3C); err != nil {
+		t.Fatal(err)
+	}
+	ev := &AccessEvent{Event: EventAccess, Time: time.Now(), ClientIP: "192.0.2.1", Method: "GET",
+		Path: "/movies/" + strings.Repeat("a", 900) + ".mp4", Status: 200}
+	write := func(ev *AccessEvent) {
+		if err := logger.writeEntry(ev, formatMediaLog(ev)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(ev)
+	// 审计事件不写入
+	write(&AccessEvent{Event: EventDelete, Time: time.Now(), Path: "/movies/a.mp4"})
+	files := readW3CFiles(t, dir)
+	if len(files) != 1 || strings.Count(files[0], "\n") != 5 {
+		t.Fatalf("files %q", files)
+	}
+	checkW3CHeader(t, files[0])
+
+	// 手动切割（例如收到 SIGHUP）后新文件重新写入指令
+	if err := logger.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	write(ev)
+	// 超过 MaxSize 自动切割后同样重新写入指令
+	for i := 0; i < 1500; i++ {
+		write(ev)
+	}
+	files = readW3CFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+	for _, content := range files {
+		checkW3CHeader(t, content)
+		if len(content) > 1<<20 {
+			t.Fatalf("file exceeds MaxSize: %d bytes", len(content))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package middlewares
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// 从数据库读取 limit 的 watchedStoredRowsPerFile 倍条记录用于去重，最多 watchedMaxStoredRows 条，
+// 同一个文件的分段请求会产生很多条记录
+const (
+	watchedStoredRowsPerFile = 50
+	watchedMaxStoredRows     = 5000
+)
+
+// WatchedFile 是用户最近访问的一个媒体文件，Offset 为播放到的最远字节位置，Size 为文件大小，
+// 只有内存中的最近事件带有传输的范围，未知时省略
+type WatchedFile struct {
+	Path       string    `json:"path"`
+	LastAccess time.Time `json:"last_access"`
+	Offset     int64     `json:"offset,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+}
+
+// GetRecentlyWatched 返回 username 最近访问的不同媒体文件，按最后访问时间从新到旧排列，
+// 内存中的最近事件提供播放位置；开启 store 时再从数据库补充更早的文件
+// 扫描、同步客户端、爬虫和内部请求不计入
+func GetRecentlyWatched(username string, limit int) []WatchedFile {
+	if username == "" || limit <= 0 {
+		return []WatchedFile{}
+	}
+	files := make(map[string]*WatchedFile)
+	for _, ev := range recentEvents.snapshot(0) {
+		if ev.Username != username || ev.Internal || ev.Traffic != "" || ev.Status >= 400 ||
+			(ev.Event != EventAccess && ev.Event != EventRedirectDownload) {
+			continue
+		}
+		p := mediaVirtualPath(ev.Path)
+		f := files[p]
+		if f == nil {
+			f = &WatchedFile{Path: p, LastAccess: ev.Time}
+			files[p] = f
+		}
+		offset, size := watchedOffset(ev)
+		f.Offset = max(f.Offset, offset)
+		f.Size = max(f.Size, size)
+	}
+	if mediaLogConf().Store.Enable {
+		logs, err := db.GetRecentMediaAccessLogsByUser(username, min(limit*watchedStoredRowsPerFile, watchedMaxStoredRows))
+		if err != nil {
+			log.Errorf("failed to get recently watched media: %+v", err)
+		}
+		for _, l := range logs {
+			if l.Status >= 400 {
+				continue
+			}
+			p := mediaVirtualPath(l.Path)
+			if f := files[p]; f == nil {
+				files[p] = &WatchedFile{Path: p, LastAccess: l.Time}
+			} else if l.Time.After(f.LastAccess) {
+				f.LastAccess = l.Time
+			}
+		}
+	}
+
+	out := make([]WatchedFile, 0, len(files))
+	for _, f := range files {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].LastAccess.Equal(out[j].LastAccess) {
+			return out[i].LastAccess.After(out[j].LastAccess)
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out[:min(limit, len(out))]
+}
+
+// watchedOffset 返回一次访问传输到的文件位置和文件大小：206 响应取 RangeCaptureMiddleware 记录的 Content-Range，
+// 从头传输的 200 响应取实际传输的字节数
+func watchedOffset(ev *AccessEvent) (offset, size int64) {
+	if r, ok := strings.CutPrefix(ev.RequestedRange, "bytes "); ok {
+		span, total, _ := strings.Cut(r, "/")
+		size, _ = strconv.ParseInt(total, 10, 64)
+		if _, last, ok := strings.Cut(span, "-"); ok {
+			if n, err := strconv.ParseInt(last, 10, 64); err == nil {
+				offset = n + 1
+			}
+		}
+		return offset, size
+	}
+	if ev.Status == http.StatusOK && ev.BytesServed != nil {
+		if ev.Bytes != nil {
+			size = *ev.Bytes
+		}
+		return *ev.BytesServed, size
+	}
+	return 0, 0
+}
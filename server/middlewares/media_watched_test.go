@@ -0,0 +1,82 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	"github.com/OpenListTeam/OpenList/v4/internal/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetRecentlyWatched(t *testing.T) {
+	recentEvents.resize(0)
+	recentEvents.resize(20)
+	defer recentEvents.resize(defaultMediaLogConf.RecentSize)
+
+	start := time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+	served := func(n int64) *int64 { return &n }
+	for i, ev := range []*AccessEvent{
+		{Event: EventAccess, Username: "alice", Path: "/d/movies/a.mkv", Status: 206, RequestedRange: "bytes 0-1048575/10485760"},
+		{Event: EventAccess, Username: "alice", Path: "/d/movies/a.mkv", Status: 206, RequestedRange: "bytes 4194304-5242879/10485760"},
+		{Event: EventAccess, Username: "bob", Path: "/d/movies/secret.mkv", Status: 200},
+		{Event: EventAccess, Username: "alice", Path: "/d/music/b.flac", Status: 200, BytesServed: served(3000), Bytes: served(3000)},
+		{Event: EventAccess, Username: "alice", Path: "/d/movies/scan.mkv", Status: 200, Traffic: TrafficScan},
+		{Event: EventProbe, Username: "alice", Path: "/d/movies/probe.mkv", Status: 200},
+		{Event: EventAccess, Username: "alice", Path: "/d/movies/missing.mkv", Status: 404},
+		// 从开头重新播放不会覆盖已经播放到的位置
+		{Event: EventAccess, Username: "alice", Path: "/p/movies/a.mkv", Status: 206, RequestedRange: "bytes 0-1023/10485760"},
+	} {
+		ev.Time = start.Add(time.Duration(i) * time.Minute)
+		recentEvents.add(ev)
+	}
+
+	got := GetRecentlyWatched("alice", 20)
+	if len(got) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if a := got[0]; a.Path != "/movies/a.mkv" || !a.LastAccess.Equal(start.Add(7*time.Minute)) ||
+		a.Offset != 5242880 || a.Size != 10485760 {
+		t.Fatalf("a.mkv = %+v", a)
+	}
+	if b := got[1]; b.Path != "/music/b.flac" || b.Offset != 3000 || b.Size != 3000 {
+		t.Fatalf("b.flac = %+v", b)
+	}
+	if got := GetRecentlyWatched("alice", 1); len(got) != 1 || got[0].Path != "/movies/a.mkv" {
+		t.Fatalf("limit 1 = %+v", got)
+	}
+	if got := GetRecentlyWatched("", 20); len(got) != 0 {
+		t.Fatalf("empty username = %+v", got)
+	}
+}
+
+func TestGetRecentlyWatchedFromStore(t *testing.T) {
+	dB, err := gorm.Open(sqlite.Open("file:media_watched?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := conf.Conf
+	defer func() { conf.Conf = old }()
+	conf.Conf = conf.DefaultConfig()
+	conf.Conf.MediaLog.Store.Enable = true
+	db.Init(dB)
+	recentEvents.resize(0)
+	defer recentEvents.resize(defaultMediaLogConf.RecentSize)
+
+	start := time.Date(2025, 7, 12, 20, 0, 0, 0, time.UTC)
+	err = mediaStoreSink{}.WriteBatch([]*AccessEvent{
+		{Event: EventAccess, Time: start, Username: "alice", Path: "/d/movies/a.mkv", Status: 200},
+		{Event: EventAccess, Time: start.Add(time.Minute), Username: "alice", Path: "/d/movies/scan.mkv", Status: 200, Traffic: TrafficScan},
+		{Event: EventAccess, Time: start.Add(2 * time.Minute), Username: "alice", Path: "/d/movies/sync.mkv", Status: 200, Traffic: TrafficSync},
+		{Event: EventAccess, Time: start.Add(3 * time.Minute), Username: "alice", Path: "/d/movies/bot.mkv", Status: 200, Traffic: TrafficBot},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := GetRecentlyWatched("alice", 20)
+	if len(got) != 1 || got[0].Path != "/movies/a.mkv" {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,175 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// webhookSink 把事件 POST 到配置的 URL
+// 配置了模板时按模板渲染请求体，否则发送事件本身的 JSON；
+// 配置了 secret 时在 X-OpenList-Signature 头中附带请求体的 HMAC-SHA256 签名
+type webhookSink struct {
+	url          string
+	headers      map[string]string
+	secret       string
+	tmpl         *template.Template
+	client       *http.Client
+	renderErrors atomic.Int64
+}
+
+func newWebhookSink(cfg conf.MediaLogWebhook) (*webhookSink, error) {
+	s := &webhookSink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		secret:  cfg.Secret,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+	if cfg.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(webhookTemplateFuncs).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for webhook %s: %w", urlOrigin(cfg.URL), err)
+		}
+		s.tmpl = tmpl
+	}
+	return s, nil
+}
+
+// payload 渲染请求体，模板渲染失败时计数并退回默认的 JSON，避免丢失数据
+func (s *webhookSink) payload(ev *AccessEvent) ([]byte, error) {
+	if s.tmpl != nil {
+		var buf bytes.Buffer
+		err := s.tmpl.Execute(&buf, ev)
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		s.renderErrors.Add(1)
+		log.Debugf("failed to render webhook template for %s: %+v", urlOrigin(s.url), err)
+	}
+	return json.Marshal(ev)
+}
+
+func (s *webhookSink) Write(ev *AccessEvent) error {
+	body, err := s.payload(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		req.Header.Set("X-OpenList-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// 错误信息中带有完整的 URL，只保留主机名
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = urlOrigin(s.url)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", urlOrigin(s.url), resp.Status)
+	}
+	return nil
+}
+
+// webhookEndpoint 是一个已配置的 webhook，每个 webhook 有独立的过滤条件和异步队列，
+// 某个端点故障时不会影响其他端点的投递
+type webhookEndpoint struct {
+	cfg   conf.MediaLogWebhook
+	sink  *webhookSink
+	async *asyncSink
+}
+
+func newWebhookEndpoint(cfg conf.MediaLogWebhook) (*webhookEndpoint, error) {
+	sink, err := newWebhookSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookEndpoint{
+		cfg:   cfg,
+		sink:  sink,
+		async: newAsyncSink(sink, defaultSinkQueueSize),
+	}, nil
+}
+
+func (e *webhookEndpoint) Write(ev *AccessEvent) error {
+	return e.async.Write(ev)
+}
+
+func (e *webhookEndpoint) acksDeferred() bool { return true }
+
+func (e *webhookEndpoint) Close() error {
+	return e.async.Close()
+}
+
+// MediaWebhookInfo 是 webhook 的配置和投递统计，secret 不会返回
+type MediaWebhookInfo struct {
+	Name         string              `json:"name"`
+	URL          string              `json:"url"`
+	HasSecret    bool                `json:"has_secret"`
+	Filter       conf.MediaLogFilter `json:"filter"`
+	RenderErrors int64               `json:"render_errors"`
+	MediaSinkStats
+}
+
+var (
+	mediaWebhooksMu sync.RWMutex
+	mediaWebhooks   []*webhookEndpoint
+)
+
+func setMediaWebhooks(endpoints []*webhookEndpoint) {
+	mediaWebhooksMu.Lock()
+	defer mediaWebhooksMu.Unlock()
+	mediaWebhooks = endpoints
+}
+
+// ListMediaWebhooks 返回所有已配置的 webhook 及其投递统计
+func ListMediaWebhooks() []MediaWebhookInfo {
+	mediaWebhooksMu.RLock()
+	defer mediaWebhooksMu.RUnlock()
+	infos := make([]MediaWebhookInfo, 0, len(mediaWebhooks))
+	for _, e := range mediaWebhooks {
+		infos = append(infos, MediaWebhookInfo{
+			Name:           e.cfg.Name,
+			URL:            e.cfg.URL,
+			HasSecret:      e.cfg.Secret != "",
+			Filter:         e.cfg.Filter,
+			RenderErrors:   e.sink.renderErrors.Load(),
+			MediaSinkStats: e.async.stats(),
+		})
+	}
+	return infos
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+func newWebhookTestServer(t *testing.T) (*httptest.Server, chan []byte) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+	return srv, bodies
+}
+
+func testAccessEvent() *AccessEvent {
+	return &AccessEvent{
+		Event:    EventAccess,
+		Time:     time.Date(2025, 7, 12, 15, 10, 36, 0, time.UTC),
+		ClientIP: "10.0.0.1",
+		Username: "alice",
+		Method:   http.MethodGet,
+		Path:     "/movies/Interstellar.mkv",
+		Status:   200,
+	}
+}
+
+func TestWebhookDefaultPayload(t *testing.T) {
+	srv, bodies := newWebhookTestServer(t)
+	sink, err := newWebhookSink(conf.MediaLogWebhook{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var got AccessEvent
+	if err = json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != "/movies/Interstellar.mkv" || got.Username != "alice" {
+		t.Fatalf("unexpected default payload: %+v", got)
+	}
+}
+
+func TestWebhookTemplatePayload(t *testing.T) {
+	srv, bodies := newWebhookTestServer(t)
+	sink, err := newWebhookSink(conf.MediaLogWebhook{
+		URL:      srv.URL,
+		Template: `{"text": {{json (printf "%s is playing %s" .Username .Path)}}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if body := string(<-bodies); body != `{"text": "alice is playing /movies/Interstellar.mkv"}` {
+		t.Fatalf("unexpected rendered payload: %s", body)
+	}
+}
+
+func TestWebhookTemplateErrors(t *testing.T) {
+	if _, err := newWebhookSink(conf.MediaLogWebhook{URL: "http://127.0.0.1", Template: "{{.Path"}); err == nil {
+		t.Fatal("expected template parse error")
+	}
+
+	srv, bodies := newWebhookTestServer(t)
+	sink, err := newWebhookSink(conf.MediaLogWebhook{URL: srv.URL, Template: "{{.NoSuchField}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var got AccessEvent
+	if err = json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatalf("render error should fall back to default payload: %v", err)
+	}
+	if n := sink.renderErrors.Load(); n != 1 {
+		t.Fatalf("render errors = %d, want 1", n)
+	}
+}
+
+func TestWebhookHeadersAndSignature(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{header: r.Header, body: body}
+	}))
+	t.Cleanup(srv.Close)
+
+	sink, err := newWebhookSink(conf.MediaLogWebhook{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "s3cret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Write(testAccessEvent()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if got := req.header.Get("Authorization"); got != "Bearer token" {
+		t.Fatalf("Authorization = %q", got)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(req.body)
+	if want, got := "sha256="+hex.EncodeToString(mac.Sum(nil)), req.header.Get("X-OpenList-Signature"); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+}
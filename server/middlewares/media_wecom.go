@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenListTeam/OpenList/v4/internal/conf"
+)
+
+const (
+	weComWebhookURL = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send"
+	// 群机器人每分钟最多发送 20 条消息，markdown 内容最长 4096 字节
+	defaultWeComWindow   = 10 * time.Second
+	weComMinInterval     = 3 * time.Second
+	weComMaxMarkdownSize = 4096
+)
+
+// weComSink 通过企业微信群机器人发送 markdown 格式的事件摘要
+type weComSink struct {
+	url     string
+	client  *http.Client
+	pacer   botPacer
+	retries atomic.Int64
+}
+
+// newWeComSink 创建企业微信机器人 sink，URL 为空时使用官方地址并以 Token 作为机器人 key
+func newWeComSink(cfg conf.MediaLogNotifier) *weComSink {
+	u := cfg.URL
+	if u == "" {
+		u = weComWebhookURL + "?key=" + url.QueryEscape(cfg.Token)
+	}
+	return &weComSink{
+		url:    u,
+		client: &http.Client{Timeout: 10 * time.Second},
+		pacer:  botPacer{interval: weComMinInterval},
+	}
+}
+
+func (s *weComSink) Write(ev *AccessEvent) error {
+	return s.WriteBatch([]*AccessEvent{ev})
+}
+
+func (s *weComSink) WriteBatch(evs []*AccessEvent) error {
+	s.pacer.wait()
+	return postBotMessage(s.client, s.url, map[string]any{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": botMarkdown(coalesceEvents(evs), weComMaxMarkdownSize)},
+	}, &s.retries)
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestWeComMarkdownLimit(t *testing.T) {
+	var evs []*AccessEvent
+	for i := 0; i < 200; i++ {
+		ev := testAccessEvent()
+		ev.Path = "/电影/" + strings.Repeat("星际穿越", 5) + string(rune('a'+i%26)) + strings.Repeat("x", i) + ".mkv"
+		evs = append(evs, ev)
+	}
+	md := botMarkdown(coalesceEvents(evs), weComMaxMarkdownSize)
+	if len(md) > weComMaxMarkdownSize || !utf8.ValidString(md) {
+		t.Fatalf("markdown is %d bytes, valid utf8 = %v", len(md), utf8.ValidString(md))
+	}
+	if !strings.Contains(md, "还有") {
+		t.Fatal("expected a summary of omitted events")
+	}
+
+	long := testAccessEvent()
+	long.Path = "/" + strings.Repeat("长", 3000) + ".mkv"
+	md = botMarkdown(coalesceEvents([]*AccessEvent{long}), weComMaxMarkdownSize)
+	if len(md) > weComMaxMarkdownSize || !utf8.ValidString(md) {
+		t.Fatalf("single long event produced %d bytes", len(md))
+	}
+}
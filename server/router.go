@@ -37,6 +37,8 @@ func Init(e *gin.Engine) {
 	if conf.Conf.MaxConnections > 0 {
 		g.Use(middlewares.MaxAllowed(conf.Conf.MaxConnections))
 	}
+	middlewares.SetMediaMountFilter(handles.MediaLogMountEnabled)
+	middlewares.SetMediaDryRunSource(handles.MediaLogDryRun)
 	WebDav(g.Group("/dav"))
 	S3(g.Group("/s3"))
 
@@ -66,6 +68,8 @@ func Init(e *gin.Engine) {
 	auth.GET("/me/sshkey/list", handles.ListMyPublicKey)
 	auth.POST("/me/sshkey/add", handles.AddMyPublicKey)
 	auth.POST("/me/sshkey/delete", handles.DeleteMyPublicKey)
+	auth.GET("/me/medialog/export", middlewares.AuthNotGuest, handles.ExportMyMediaLog)
+	auth.GET("/me/medialog/recent", handles.GetMyRecentlyWatched)
 	auth.POST("/auth/2fa/generate", handles.Generate2FA)
 	auth.POST("/auth/2fa/verify", handles.Verify2FA)
 	auth.GET("/auth/logout", handles.LogOut)
@@ -163,6 +167,28 @@ func admin(g *gin.RouterGroup) {
 	index.POST("/stop", middlewares.SearchIndex, handles.StopIndex)
 	index.POST("/clear", middlewares.SearchIndex, handles.ClearIndex)
 	index.GET("/progress", middlewares.SearchIndex, handles.GetProgress)
+
+	mediaLog := g.Group("/medialog")
+	mediaLog.GET("/webhooks", handles.ListMediaLogWebhooks)
+	mediaLog.POST("/notifiers/test", handles.TestMediaLogNotifier)
+	mediaLog.POST("/expr/test", handles.TestMediaLogExpr)
+	mediaLog.GET("/stats/internal", handles.GetMediaLogInternalStats)
+	mediaLog.POST("/stats/internal", handles.ResetMediaLogInternalStats)
+	mediaLog.GET("/stats/trending", handles.GetMediaTrending)
+	mediaLog.GET("/mounts", handles.ListMediaLogMounts)
+	mediaLog.POST("/mounts", handles.SetMediaLogMount)
+	mediaLog.GET("/export", handles.ExportMediaLog)
+	mediaLog.GET("/verify", handles.VerifyMediaLog)
+	mediaLog.GET("/recent", handles.GetRecentMediaLog)
+	mediaLog.GET("/trace", handles.GetMediaLogTrace)
+	mediaLog.POST("/trace", handles.StartMediaLogTrace)
+	mediaLog.DELETE("/trace", handles.StopMediaLogTrace)
+	mediaLog.DELETE("/user/:username", handles.PurgeMediaLogUser)
+	mediaLog.GET("/user/:username/export", handles.ExportMediaLogUser)
+	g.GET("/media-log/search", handles.SearchMediaLog)
+	g.GET("/media-log/tail", handles.TailMediaLog)
+	g.GET("/media-stats", handles.GetMediaStats)
+	g.GET("/media-metrics", handles.GetMediaMetrics)
 }
 
 func _fs(g *gin.RouterGroup) {